@@ -0,0 +1,590 @@
+package main
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Exit codes for headless subcommands
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const cliUsage = `Uso: lego-tui [--dry-run] [comando] [opções]
+
+Sem comando, abre a interface interativa. Com --dry-run (em qualquer posição),
+comandos externos (sudo, disko, git, nixos-rebuild) são exibidos em vez de
+executados.
+
+Comandos:
+  build    --preset <nome> [--name <sufixo>] [--modules a,b]  gera uma flake
+           [--dir]                                            ... como diretório (um arquivo por módulo)
+           [--check]                                          ... e avalia a flake gerada
+           --preset a,b,c [--name <dir>]                      flake multi-host em flakes/<dir>/
+  modules  list [--category <cat>]                            lista módulos
+  presets  list | show <nome> | validate <nome>...           lista/mostra/valida presets
+  check    (--preset <nome> | --flake <arquivo>)              avalia uma flake (parse, flake check, drvPath)
+  apply    (--preset <nome> | --flake <arquivo>) [--host <h>] aplica uma flake
+           [--force]                                          ... mesmo que a avaliação tenha falhado
+           [--action <ação>] [--offline] [--impure]           switch, boot, test, build, dry-build,
+           [--option nome=valor]... [--specialisation <s>]    dry-activate ou build-vm (padrão: [rebuild] do preset)
+  diff     <antiga> <nova>                                    compara duas flakes geradas por módulo
+  import   --preset <nome> [--check] <configuration.nix>      converte uma configuração em módulos e preset
+  secrets  list | keygen | new <nome> < valor                 lista, gera a chave age ou cria um segredo (valor lido da entrada)
+`
+
+// usageError marks errors caused by bad arguments (exit code 2)
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+// runCLI dispatches a headless subcommand and returns the process exit code
+func runCLI(root string, runner engine.Runner, args []string, stdout, stderr io.Writer) int {
+	var err error
+	switch args[0] {
+	case "build":
+		err = cmdBuild(root, runner, args[1:], stdout, stderr)
+	case "modules":
+		err = cmdModules(root, args[1:], stdout)
+	case "presets":
+		err = cmdPresets(root, args[1:], stdout)
+	case "check":
+		err = cmdCheck(root, runner, args[1:], stdout)
+	case "apply":
+		err = cmdApply(root, runner, args[1:], stdout, stderr)
+	case "diff":
+		err = cmdDiff(root, args[1:], stdout)
+	case "import":
+		err = cmdImport(root, args[1:], stdout)
+	case "secrets":
+		err = cmdSecrets(root, args[1:], os.Stdin, stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return exitOK
+	default:
+		err = usageError{fmt.Sprintf("comando desconhecido: %s", args[0])}
+	}
+
+	if err == nil {
+		return exitOK
+	}
+	fmt.Fprintln(stderr, "erro:", err)
+
+	var ue usageError
+	if errors.As(err, &ue) {
+		fmt.Fprint(stderr, "\n"+cliUsage)
+		return exitUsage
+	}
+	// Propagate the exit status of nixos-rebuild and friends
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && ee.ExitCode() > 0 {
+		return ee.ExitCode()
+	}
+	return exitError
+}
+
+// globalFlags takes the flags valid before or after any subcommand out of
+// args. Everything after a "--" is left alone.
+func globalFlags(args []string) (rest []string, dryRun bool) {
+	for i, a := range args {
+		switch a {
+		case "--":
+			return append(rest, args[i:]...), dryRun
+		case "--dry-run", "-dry-run":
+			dryRun = true
+		default:
+			rest = append(rest, a)
+		}
+	}
+	return rest, dryRun
+}
+
+// newFlagSet builds a flag set that reports parse errors as usage errors
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return usageError{fmt.Sprintf("%s: %v", fs.Name(), err)}
+	}
+	return nil
+}
+
+func presetPath(root, name string) string {
+	return filepath.Join(root, "presets", name+".toml")
+}
+
+func cmdBuild(root string, runner engine.Runner, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("build")
+	presetName := fs.String("preset", "", "preset em presets/<nome>.toml")
+	name := fs.String("name", "", "sufixo da flake (padrão: timestamp)")
+	modulesFlag := fs.String("modules", "", "módulos separados por vírgula (padrão: active do preset)")
+	dir := fs.Bool("dir", false, "gera flakes/<preset>-<sufixo>/ com um arquivo por módulo")
+	check := fs.Bool("check", false, "avalia a flake gerada")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *presetName == "" {
+		return usageError{"build: --preset é obrigatório"}
+	}
+	if strings.Contains(*presetName, ",") {
+		if *modulesFlag != "" {
+			return usageError{"build: --modules não pode ser usado com vários presets"}
+		}
+		if *dir {
+			return usageError{"build: --dir não pode ser usado com vários presets"}
+		}
+		out, err := buildMultiHost(root, strings.Split(*presetName, ","), *name, stdout, stderr)
+		if err != nil || !*check {
+			return err
+		}
+		return checkFlake(root, runner, flakeFilePath(root, out), stdout)
+	}
+
+	path := presetPath(root, *presetName)
+	preset, err := engine.LoadPreset(path)
+	if err != nil {
+		return err
+	}
+
+	modules := preset.Modules.Active
+	if *modulesFlag != "" {
+		modules = nil
+		for _, mod := range strings.Split(*modulesFlag, ",") {
+			if mod = strings.TrimSpace(mod); mod != "" {
+				modules = append(modules, mod)
+			}
+		}
+	}
+	if len(modules) == 0 {
+		return fmt.Errorf("preset '%s' não tem módulos ativos", *presetName)
+	}
+
+	build := engine.BuildFlake
+	if *dir {
+		build = engine.BuildFlakeDir
+	}
+	out, err := build(root, preset, modules, *name)
+	if err != nil {
+		return err
+	}
+	if err := engine.SavePreset(path, preset); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, out)
+	warnMissingSecrets(root, modules, stderr)
+	if *check {
+		return checkFlake(root, runner, flakeFilePath(root, out), stdout)
+	}
+	return nil
+}
+
+// warnMissingSecrets tells on stderr which secrets a generated flake still
+// needs before it evaluates
+func warnMissingSecrets(root string, modules []string, stderr io.Writer) {
+	for _, w := range engine.MissingSecrets(root, modules) {
+		fmt.Fprintf(stderr, "aviso: %s\n", w)
+	}
+}
+
+// buildMultiHost generates one flake with a nixosConfigurations entry per
+// preset and returns its path
+func buildMultiHost(root string, names []string, flakeName string, stdout, stderr io.Writer) (string, error) {
+	var presets []*engine.Preset
+	var paths []string
+	for _, n := range names {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		p, err := engine.LoadPreset(presetPath(root, n))
+		if err != nil {
+			return "", err
+		}
+		if len(p.Modules.Active) == 0 {
+			return "", fmt.Errorf("preset '%s' não tem módulos ativos", n)
+		}
+		presets = append(presets, p)
+		paths = append(paths, presetPath(root, n))
+	}
+
+	out, err := engine.BuildMultiHostFlake(root, presets, flakeName)
+	if err != nil {
+		return "", err
+	}
+	for i, p := range presets {
+		if err := engine.SavePreset(paths[i], p); err != nil {
+			return "", err
+		}
+	}
+	fmt.Fprintln(stdout, out)
+	for _, p := range presets {
+		warnMissingSecrets(root, p.Modules.Active, stderr)
+	}
+	return out, nil
+}
+
+func cmdModules(root string, args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "list" {
+		return usageError{"modules: use 'modules list'"}
+	}
+	fs := newFlagSet("modules list")
+	category := fs.String("category", "", "filtrar por categoria")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	for _, mod := range engine.ListModules(root) {
+		if *category != "" && mod.Category != *category {
+			continue
+		}
+		fmt.Fprintf(stdout, "%s\t%s\n", mod.RelPath, mod.Purpose)
+	}
+	return nil
+}
+
+func cmdPresets(root string, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usageError{"presets: use 'presets list' ou 'presets show <nome>'"}
+	}
+	switch args[0] {
+	case "list":
+		presets, err := engine.ListPresets(filepath.Join(root, "presets"))
+		if err != nil {
+			return err
+		}
+		for _, p := range presets {
+			fmt.Fprintf(stdout, "%s\t%s\n", p.Name, p.Modified.Format("2006-01-02 15:04"))
+		}
+		return nil
+	case "show":
+		if len(args) != 2 {
+			return usageError{"presets show: informe o nome do preset"}
+		}
+		p, err := engine.LoadPreset(presetPath(root, args[1]))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "preset:        %s\n", p.Host.PresetName)
+		fmt.Fprintf(stdout, "host:          %s\n", p.Host.HostName)
+		fmt.Fprintf(stdout, "state_version: %s\n", p.Host.StateVersion)
+		for _, u := range p.Users {
+			fmt.Fprintf(stdout, "user:          %s [%s]\n", u.Name, strings.Join(u.Groups, ", "))
+			if len(u.Home) > 0 {
+				fmt.Fprintf(stdout, "  home:        %s\n", strings.Join(u.Home, ", "))
+			}
+		}
+		fmt.Fprintf(stdout, "timezone:      %s\n", p.Locale.Timezone)
+		fmt.Fprintf(stdout, "locale:        %s\n", p.Locale.DefaultLocale)
+		fmt.Fprintf(stdout, "keymap:        %s\n", p.Locale.Keymap)
+		fmt.Fprintf(stdout, "last_flake:    %s\n", p.Metadata.LastAppliedFlake)
+		fmt.Fprintf(stdout, "rebuild:       %s\n", p.Rebuild)
+		fmt.Fprintf(stdout, "encryption:    %s\n", p.Encryption)
+		fmt.Fprintf(stdout, "disko:         %s\n", p.Disko)
+		fmt.Fprintf(stdout, "modules (%d):\n", len(p.Modules.Active))
+		for _, mod := range p.Modules.Active {
+			fmt.Fprintf(stdout, "  %s\n", mod)
+		}
+		return nil
+	case "validate":
+		if len(args) < 2 {
+			return usageError{"presets validate: informe o nome do preset"}
+		}
+		invalid := 0
+		for _, name := range args[1:] {
+			p, err := engine.LoadPreset(presetPath(root, name))
+			if err != nil {
+				return err
+			}
+			for _, warning := range p.PasswordWarnings() {
+				fmt.Fprintf(stdout, "%s: aviso: %s\n", name, warning)
+			}
+			for _, warning := range engine.MissingSecrets(root, p.Modules.Active) {
+				fmt.Fprintf(stdout, "%s: aviso: %s\n", name, warning)
+			}
+			issues := engine.ValidatePreset(root, p)
+			if len(issues) == 0 {
+				fmt.Fprintf(stdout, "%s: ok\n", name)
+				continue
+			}
+			invalid++
+			for _, issue := range issues {
+				fmt.Fprintf(stdout, "%s: %s\n", name, issue)
+			}
+		}
+		if invalid > 0 {
+			return fmt.Errorf("%d preset(s) inválido(s)", invalid)
+		}
+		return nil
+	}
+	return usageError{fmt.Sprintf("presets: subcomando desconhecido: %s", args[0])}
+}
+
+func cmdApply(root string, runner engine.Runner, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("apply")
+	presetName := fs.String("preset", "", "aplica a última flake gerada para o preset")
+	flakeFile := fs.String("flake", "", "arquivo (ou <dir>/flake.nix) em flakes/ a aplicar")
+	host := fs.String("host", "", "nixosConfigurations.<host> (padrão: host_name do preset)")
+	force := fs.Bool("force", false, "aplica mesmo que a avaliação da flake tenha falhado")
+	action := fs.String("action", "", "ação do nixos-rebuild ("+strings.Join(engine.RebuildActions, ", ")+")")
+	offline := fs.Bool("offline", false, "passa --offline ao nixos-rebuild")
+	impure := fs.Bool("impure", false, "passa --impure ao nixos-rebuild")
+	var options []string
+	fs.Func("option", "passa --option nome valor ao nixos-rebuild (repetível)", func(v string) error {
+		options = append(options, v)
+		return nil
+	})
+	specialisation := fs.String("specialisation", "", "ativa uma specialisation (switch e test)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *presetName == "" && *flakeFile == "" {
+		return usageError{"apply: informe --preset ou --flake"}
+	}
+	if *action != "" && !slices.Contains(engine.RebuildActions, *action) {
+		return usageError{fmt.Sprintf("apply: ação %q inválida (use %s)", *action, strings.Join(engine.RebuildActions, ", "))}
+	}
+
+	flakePath := *flakeFile
+	hostname := *host
+	var rc engine.RebuildConfig
+	if *presetName != "" {
+		p, err := engine.LoadPreset(presetPath(root, *presetName))
+		if err != nil {
+			return err
+		}
+		rc = p.Rebuild
+		if flakePath == "" {
+			if p.Metadata.LastAppliedFlake == "" {
+				return fmt.Errorf("preset '%s' ainda não tem flake gerada", *presetName)
+			}
+			flakePath = filepath.Join(root, "flakes", p.Metadata.LastAppliedFlake)
+		}
+		if hostname == "" {
+			hostname = p.Host.HostName
+		}
+	}
+	if hostname == "" {
+		return usageError{"apply: informe --host ou --preset"}
+	}
+	flakePath = flakeFilePath(root, flakePath)
+
+	// Flags override the preset's [rebuild] table for this run only
+	if *action != "" {
+		rc.Action = *action
+	}
+	rc.Offline = rc.Offline || *offline
+	rc.Impure = rc.Impure || *impure
+	for _, o := range options {
+		if err := rc.SetOption(o); err != nil {
+			return usageError{"apply: " + err.Error()}
+		}
+	}
+	if *specialisation != "" {
+		rc.Specialisation = *specialisation
+	}
+
+	check, err := engine.LoadFlakeCheck(flakePath)
+	if err != nil {
+		return err
+	}
+	if check != nil && check.Current() && !check.OK() && !*force {
+		return fmt.Errorf("a avaliação de %s encontrou %d problema(s) (veja 'check'); use --force para aplicar mesmo assim",
+			filepath.Base(flakePath), len(check.Problems))
+	}
+
+	rebuild, err := engine.PrepareRebuild(runner, flakePath, hostname, rc)
+	if err != nil {
+		return err
+	}
+	cmd := runner.Interactive(rebuild)
+	cmd.SetStdin(os.Stdin)
+	cmd.SetStdout(stdout)
+	cmd.SetStderr(stderr)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	if err := engine.RecordGeneration(runner, root, engine.SystemProfile(), flakePath, *presetName, hostname, rc); err != nil {
+		fmt.Fprintf(stderr, "aviso: geração não registrada: %v\n", err)
+	}
+	return nil
+}
+
+func cmdCheck(root string, runner engine.Runner, args []string, stdout io.Writer) error {
+	fs := newFlagSet("check")
+	presetName := fs.String("preset", "", "avalia a última flake gerada para o preset")
+	flakeFile := fs.String("flake", "", "arquivo (ou <dir>/flake.nix) em flakes/ a avaliar")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if (*presetName == "") == (*flakeFile == "") {
+		return usageError{"check: informe --preset ou --flake"}
+	}
+
+	flakePath := *flakeFile
+	if *presetName != "" {
+		p, err := engine.LoadPreset(presetPath(root, *presetName))
+		if err != nil {
+			return err
+		}
+		if p.Metadata.LastAppliedFlake == "" {
+			return fmt.Errorf("preset '%s' ainda não tem flake gerada", *presetName)
+		}
+		flakePath = filepath.Join(root, "flakes", p.Metadata.LastAppliedFlake)
+	}
+	return checkFlake(root, runner, flakeFilePath(root, flakePath), stdout)
+}
+
+// checkFlake evaluates a generated flake, saves the result next to it and
+// prints each host's drvPath or the problems found
+func checkFlake(root string, runner engine.Runner, flakePath string, stdout io.Writer) error {
+	check := engine.CheckFlake(runner, root, flakePath)
+	if err := engine.SaveFlakeCheck(check); err != nil {
+		return err
+	}
+	hosts := make([]string, 0, len(check.DrvPaths))
+	for h := range check.DrvPaths {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		fmt.Fprintf(stdout, "ok\t%s\t%s\n", h, check.DrvPaths[h])
+	}
+	for _, p := range check.Problems {
+		fmt.Fprintln(stdout, p.String())
+	}
+	if !check.OK() {
+		return fmt.Errorf("a avaliação encontrou %d problema(s)", len(check.Problems))
+	}
+	return nil
+}
+
+// flakeFilePath accepts names relative to flakes/ as well as real paths.
+// A directory flake may be given as its directory name.
+func flakeFilePath(root, path string) string {
+	if _, err := os.Stat(path); err != nil && !filepath.IsAbs(path) {
+		path = filepath.Join(root, "flakes", path)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, engine.FlakeDirFile)
+	}
+	return path
+}
+
+func cmdDiff(root string, args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return usageError{"diff: informe a flake antiga e a nova"}
+	}
+	diff, err := engine.DiffFlakeFiles(flakeFilePath(root, args[0]), flakeFilePath(root, args[1]))
+	if err != nil {
+		return err
+	}
+	if diff.Empty() {
+		fmt.Fprintln(stdout, "nenhuma diferença")
+		return nil
+	}
+	for _, l := range diff.Lines() {
+		fmt.Fprintln(stdout, l)
+	}
+	return nil
+}
+
+func cmdImport(root string, args []string, stdout io.Writer) error {
+	fs := newFlagSet("import")
+	presetName := fs.String("preset", "", "nome do preset a criar")
+	check := fs.Bool("check", false, "mostra o resultado sem gravar nada")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *presetName == "" || fs.NArg() != 1 {
+		return usageError{"import: use 'import --preset <nome> <configuration.nix>'"}
+	}
+	if _, err := os.Stat(presetPath(root, *presetName)); err == nil && !*check {
+		return fmt.Errorf("preset '%s' já existe", *presetName)
+	}
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("erro ao ler %s: %w", fs.Arg(0), err)
+	}
+	plan, err := engine.PlanImport(root, *presetName, src)
+	if err != nil {
+		return err
+	}
+
+	for _, mod := range plan.Modules {
+		status := "novo"
+		if mod.Reused {
+			status = "existente"
+		}
+		fmt.Fprintf(stdout, "%-9s %s\t%s\n", status, mod.RelPath, mod.Purpose)
+	}
+	for _, w := range plan.Warnings {
+		fmt.Fprintf(stdout, "aviso: %s\n", w)
+	}
+	if *check {
+		return nil
+	}
+	if err := plan.Write(root); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, presetPath(root, *presetName))
+	return nil
+}
+
+func cmdSecrets(root string, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usageError{"secrets: use 'secrets list', 'secrets keygen' ou 'secrets new <nome>'"}
+	}
+	switch args[0] {
+	case "list":
+		names, err := engine.ListSecrets(root)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Fprintln(stdout, name)
+		}
+		return nil
+	case "keygen":
+		pub, err := engine.GenerateAgeKey(root)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s\t%s\n", engine.AgeKeyPath(), pub)
+		return nil
+	case "new":
+		if len(args) != 2 {
+			return usageError{"secrets new: informe o nome do segredo"}
+		}
+		name := args[1]
+		if engine.SecretExists(root, name) {
+			return fmt.Errorf("segredo '%s' já existe (edite na aba Segredos)", name)
+		}
+		value, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("erro ao ler o valor: %w", err)
+		}
+		if len(value) == 0 {
+			return fmt.Errorf("segredo '%s' vazio: passe o valor pela entrada padrão", name)
+		}
+		if err := engine.WriteSecret(root, name, value); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, engine.SecretPath(root, name))
+		return nil
+	}
+	return usageError{fmt.Sprintf("secrets: subcomando desconhecido: %s", args[0])}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGlobalFlagsDryRunAnywhere(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		rest []string
+		dry  bool
+	}{
+		{[]string{"--dry-run", "apply", "--preset", "vm"}, []string{"apply", "--preset", "vm"}, true},
+		{[]string{"apply", "--preset", "vm", "--dry-run"}, []string{"apply", "--preset", "vm"}, true},
+		{[]string{"presets", "-dry-run", "validate", "vm"}, []string{"presets", "validate", "vm"}, true},
+		{[]string{"build", "--preset", "vm"}, []string{"build", "--preset", "vm"}, false},
+		{[]string{"import", "--", "--dry-run"}, []string{"import", "--", "--dry-run"}, false},
+		{nil, nil, false},
+	} {
+		rest, dry := globalFlags(tc.args)
+		if !slices.Equal(rest, tc.rest) || dry != tc.dry {
+			t.Errorf("globalFlags(%q) = %q, %v; want %q, %v", tc.args, rest, dry, tc.rest, tc.dry)
+		}
+	}
+}
+
+func TestBuildMultiHostChecks(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "presets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, active := range map[string][]string{"ry3": {"apps/git-config"}, "vm": nil} {
+		p := engine.NewDefaultPreset(name, "ana")
+		p.Modules.Active = active
+		if err := engine.SavePreset(presetPath(root, name), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		args []string
+		code int
+		err  string
+	}{
+		{[]string{"build", "--preset", "vm"}, exitError, "preset 'vm' não tem módulos ativos"},
+		{[]string{"build", "--preset", "ry3,vm"}, exitError, "preset 'vm' não tem módulos ativos"},
+		{[]string{"build", "--preset", "ry3,vm", "--dir"}, exitUsage, "--dir não pode ser usado com vários presets"},
+		{[]string{"build", "--preset", "ry3,vm", "--modules", "a"}, exitUsage, "--modules não pode ser usado com vários presets"},
+	} {
+		var stdout, stderr bytes.Buffer
+		code := runCLI(root, &engine.RecordingRunner{}, tc.args, &stdout, &stderr)
+		if code != tc.code || !strings.Contains(stderr.String(), tc.err) {
+			t.Errorf("%q: exit %d, stderr %q; want %d and %q", tc.args, code, stderr.String(), tc.code, tc.err)
+		}
+		if stdout.Len() > 0 {
+			t.Errorf("%q: stdout = %q", tc.args, stdout.String())
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "flakes")); len(entries) > 0 {
+		t.Errorf("flakes written: %v", entries)
+	}
+}
+
+func TestBuildWarnsOnInjectedStderr(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "modules", "services", "app.nix")
+	if err := os.MkdirAll(filepath.Dir(app), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(app, []byte("# NIXOS-LEGO-MODULE: app\n# PURPOSE: teste\n# CATEGORY: services\n# SECRETS: app-env\n# ---\nservices.app.enable = true;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"presets", "templates"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tmpl := range []string{"base-flake.nix", "host-config.nix"} {
+		src, err := os.ReadFile(filepath.Join("..", "..", "templates", tmpl))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "templates", tmpl), src, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"ry3", "vm"} {
+		p := engine.NewDefaultPreset(name, "ana")
+		p.Modules.Active = []string{"services/app"}
+		if err := engine.SavePreset(presetPath(root, name), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, preset := range []string{"ry3", "ry3,vm"} {
+		var stdout, stderr bytes.Buffer
+		if code := runCLI(root, &engine.RecordingRunner{}, []string{"build", "--preset", preset}, &stdout, &stderr); code != exitOK {
+			t.Fatalf("%s: exit %d: %s", preset, code, stderr.String())
+		}
+		if !strings.HasPrefix(stderr.String(), "aviso: ") || !strings.Contains(stderr.String(), "'app-env'") {
+			t.Errorf("%s: stderr = %q, want the missing secret warning", preset, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lsblkColumns are the columns ListDisks asks lsblk for
+const lsblkColumns = "NAME,PATH,TYPE,SIZE,MODEL,SERIAL,TRAN,RM,RO,FSTYPE,LABEL,MOUNTPOINTS"
+
+// BlockDevice is one entry of lsblk --json, with its partitions as Children
+type BlockDevice struct {
+	Name        string        `json:"name"`
+	Path        string        `json:"path"`
+	Type        string        `json:"type"` // disk, part, crypt, lvm, rom, loop...
+	Size        lsblkSize     `json:"size"`
+	Model       string        `json:"model"`
+	Serial      string        `json:"serial"`
+	Tran        string        `json:"tran"` // nvme, sata, usb, virtio...
+	Removable   lsblkBool     `json:"rm"`
+	ReadOnly    lsblkBool     `json:"ro"`
+	FSType      string        `json:"fstype"`
+	Label       string        `json:"label"` // the pool name of a zfs_member
+	Mountpoints []string      `json:"mountpoints"`
+	Mountpoint  string        `json:"mountpoint"` // util-linux < 2.37 has a single mountpoint
+	Children    []BlockDevice `json:"children"`
+}
+
+// lsblkSize is a byte count; lsblk -b prints it as a number, older
+// versions as a string
+type lsblkSize int64
+
+func (s *lsblkSize) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "null" || str == "" {
+		*s = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return fmt.Errorf("tamanho %s inválido (use lsblk -b)", data)
+	}
+	*s = lsblkSize(n)
+	return nil
+}
+
+// lsblkBool accepts true/false as well as the "0"/"1" of older versions
+type lsblkBool bool
+
+func (b *lsblkBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// Bytes is the size of the device
+func (d BlockDevice) Bytes() int64 { return int64(d.Size) }
+
+// Mounts returns where the device is mounted, ignoring the null entries
+// lsblk prints for unmounted devices
+func (d BlockDevice) Mounts() []string {
+	var mounts []string
+	for _, m := range append(d.Mountpoints, d.Mountpoint) {
+		if m != "" {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// AllMounts returns the mountpoints of the device and of everything on it
+// (partitions, LUKS mappings, LVM volumes)
+func (d BlockDevice) AllMounts() []string {
+	mounts := d.Mounts()
+	for _, c := range d.Children {
+		mounts = append(mounts, c.AllMounts()...)
+	}
+	return mounts
+}
+
+// DevicePath is /dev/<name> when lsblk did not print PATH
+func (d BlockDevice) DevicePath() string {
+	if d.Path != "" {
+		return d.Path
+	}
+	return "/dev/" + d.Name
+}
+
+// Description is "<size> <model> (<tran>)", for lists
+func (d BlockDevice) Description() string {
+	parts := []string{HumanSize(d.Bytes())}
+	if d.Model != "" {
+		parts = append(parts, strings.TrimSpace(d.Model))
+	}
+	if d.Tran != "" {
+		parts = append(parts, "("+d.Tran+")")
+	}
+	if d.Removable {
+		parts = append(parts, "removível")
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseLsblk decodes lsblk --json output
+func ParseLsblk(data []byte) ([]BlockDevice, error) {
+	var out struct {
+		BlockDevices []BlockDevice `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("erro lendo a saída do lsblk: %w", err)
+	}
+	return out.BlockDevices, nil
+}
+
+// Disks keeps the whole disks that can hold a layout: no partitions,
+// loop devices, CD-ROMs or read-only media, sorted by name
+func Disks(devs []BlockDevice) []BlockDevice {
+	var disks []BlockDevice
+	for _, d := range devs {
+		if d.Type != "disk" || bool(d.ReadOnly) || d.Bytes() == 0 || strings.HasPrefix(d.Name, "zram") {
+			continue
+		}
+		disks = append(disks, d)
+	}
+	sort.Slice(disks, func(i, j int) bool { return disks[i].Name < disks[j].Name })
+	return disks
+}
+
+// ListDisks runs lsblk and returns the disks found
+func ListDisks(r Runner) ([]BlockDevice, error) {
+	devs, err := ListBlockDevices(r)
+	if err != nil {
+		return nil, err
+	}
+	return Disks(devs), nil
+}
+
+// ListBlockDevices runs lsblk and returns every top-level device
+func ListBlockDevices(r Runner) ([]BlockDevice, error) {
+	c := Cmd("lsblk", "--json", "--bytes", "--output", lsblkColumns)
+	c.ReadOnly = true
+	out, err := r.Run(c)
+	if err != nil {
+		return nil, fmt.Errorf("lsblk: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return ParseLsblk(out)
+}
+
+// StableDevicePath returns a /dev/disk/by-id link to dev, which survives
+// renumbering (nvme0n1 ↔ nvme1n1), or dev itself when there is none
+func StableDevicePath(dev string) string {
+	const byID = "/dev/disk/by-id"
+	entries, err := os.ReadDir(byID)
+	if err != nil {
+		return dev
+	}
+	var candidates []string
+	for _, e := range entries {
+		link := filepath.Join(byID, e.Name())
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil || target != dev {
+			continue
+		}
+		candidates = append(candidates, link)
+	}
+	if len(candidates) == 0 {
+		return dev
+	}
+	// Model/serial names read better than wwn-/eui. identifiers
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return idRank(candidates[i]) < idRank(candidates[j])
+	})
+	return candidates[0]
+}
+
+func idRank(link string) int {
+	name := filepath.Base(link)
+	switch {
+	case strings.HasPrefix(name, "wwn-"), strings.HasPrefix(name, "nvme-eui."), strings.HasPrefix(name, "nvme-nvme."):
+		return 1
+	}
+	return 0
+}
+
+// HumanSize formats bytes with binary units, as lsblk does
+func HumanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value := float64(n)
+	suffixes := "KMGTPE"
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", value, suffixes[i])
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func readLsblk(t *testing.T, name string) []BlockDevice {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	devs, err := ParseLsblk(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return devs
+}
+
+func diskNames(devs []BlockDevice) []string {
+	var names []string
+	for _, d := range devs {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func TestParseLsblkNVMe(t *testing.T) {
+	devs := readLsblk(t, "lsblk-nvme.json")
+	disks := Disks(devs)
+	// loop0, sr0, zram0 and the read-only mmcblk0boot0 are not installable
+	if got, want := diskNames(disks), []string{"nvme0n1", "sda"}; !slices.Equal(got, want) {
+		t.Fatalf("Disks = %q, want %q", got, want)
+	}
+
+	nvme := disks[0]
+	if nvme.Bytes() != 1000204886016 || nvme.DevicePath() != "/dev/nvme0n1" {
+		t.Errorf("nvme0n1 = %d bytes at %s", nvme.Bytes(), nvme.DevicePath())
+	}
+	if got, want := nvme.Description(), "931.5G Samsung SSD 980 PRO 1TB (nvme)"; got != want {
+		t.Errorf("Description = %q, want %q", got, want)
+	}
+	if len(nvme.Children) != 2 || nvme.Children[1].Children[0].Type != "crypt" {
+		t.Fatalf("partitions not parsed: %+v", nvme.Children)
+	}
+	// [null] means unmounted, not mounted at ""
+	if mounts := nvme.Mounts(); len(mounts) != 0 {
+		t.Errorf("Mounts = %q, want none", mounts)
+	}
+	if got, want := nvme.AllMounts(), []string{"/boot", "/nix", "/home", "/"}; !slices.Equal(got, want) {
+		t.Errorf("AllMounts = %q, want %q", got, want)
+	}
+
+	if usb := disks[1]; !bool(usb.Removable) || usb.Description() != "28.6G Cruzer Blade (usb) removível" {
+		t.Errorf("sda = %q, removable %v", usb.Description(), usb.Removable)
+	}
+}
+
+func TestParseLsblkOldUtilLinux(t *testing.T) {
+	devs := readLsblk(t, "lsblk-old.json")
+	disks := Disks(devs)
+	if got, want := diskNames(disks), []string{"sda"}; !slices.Equal(got, want) {
+		t.Fatalf("Disks = %q, want %q", got, want)
+	}
+	sda := disks[0]
+	// sizes as strings and "rm":"0" as false
+	if sda.Bytes() != 500107862016 || bool(sda.Removable) || bool(sda.ReadOnly) {
+		t.Errorf("sda = %d bytes, rm %v, ro %v", sda.Bytes(), sda.Removable, sda.ReadOnly)
+	}
+	if got, want := sda.AllMounts(), []string{"/boot/efi", "/"}; !slices.Equal(got, want) {
+		t.Errorf("AllMounts = %q, want %q", got, want)
+	}
+	if !bool(devs[1].Removable) {
+		t.Errorf(`sr0 "rm":"1" parsed as not removable`)
+	}
+}
+
+func TestParseLsblkRejectsHumanSizes(t *testing.T) {
+	if _, err := ParseLsblk([]byte(`{"blockdevices":[{"name":"sda","type":"disk","size":"465.8G"}]}`)); err == nil {
+		t.Error("ParseLsblk accepted a size without --bytes")
+	}
+}
+
+func TestListDisksRunsLsblk(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "lsblk-old.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Cmd("lsblk", "--json", "--bytes", "--output", lsblkColumns)
+	rec := &RecordingRunner{Results: map[string]RecordedResult{c.String(): {Output: string(data)}}}
+	disks, err := ListDisks(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := diskNames(disks); !slices.Equal(got, []string{"sda"}) {
+		t.Errorf("ListDisks = %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"fmt"
+	"strings"
+)
+
+// DefaultPassword is the placeholder password written by NewDefaultPreset
+const DefaultPassword = "123456"
+
+const (
+	cryptAlphabet     = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	sha512CryptRounds = 5000 // glibc default, omitted from the hash string
+	sha512SaltLen     = 16
+)
+
+// HashPassword returns a SHA-512 crypt ($6$) hash with a random salt,
+// suitable for users.users.<name>.hashedPassword
+func HashPassword(password string) (string, error) {
+	buf := make([]byte, sha512SaltLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("erro ao gerar salt: %w", err)
+	}
+	salt := make([]byte, sha512SaltLen)
+	for i, b := range buf {
+		salt[i] = cryptAlphabet[int(b)%len(cryptAlphabet)]
+	}
+	return SHA512Crypt(password, string(salt), sha512CryptRounds), nil
+}
+
+// SHA512Crypt implements glibc's SHA-512 crypt as specified by
+// Ulrich Drepper (https://www.akkadia.org/drepper/SHA-crypt.txt)
+func SHA512Crypt(password, salt string, rounds int) string {
+	if len(salt) > sha512SaltLen {
+		salt = salt[:sha512SaltLen]
+	}
+	rounds = min(max(rounds, 1000), 999999999)
+	p, s := []byte(password), []byte(salt)
+
+	// Digest B: password, salt, password
+	hb := sha512.New()
+	hb.Write(p)
+	hb.Write(s)
+	hb.Write(p)
+	b := hb.Sum(nil)
+
+	// Digest A
+	ha := sha512.New()
+	ha.Write(p)
+	ha.Write(s)
+	ha.Write(repeatBytes(b, len(p)))
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			ha.Write(b)
+		} else {
+			ha.Write(p)
+		}
+	}
+	a := ha.Sum(nil)
+
+	// P sequence: digest of the password repeated len(p) times
+	hp := sha512.New()
+	for range p {
+		hp.Write(p)
+	}
+	pSeq := repeatBytes(hp.Sum(nil), len(p))
+
+	// S sequence: digest of the salt repeated 16+A[0] times
+	hs := sha512.New()
+	for i := 0; i < 16+int(a[0]); i++ {
+		hs.Write(s)
+	}
+	sSeq := repeatBytes(hs.Sum(nil), len(s))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(pSeq)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(sSeq)
+		}
+		if i%7 != 0 {
+			h.Write(pSeq)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(pSeq)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if rounds != sha512CryptRounds {
+		fmt.Fprintf(&out, "rounds=%d$", rounds)
+	}
+	out.WriteString(salt)
+	out.WriteString("$")
+	for i := 0; i < 21; i++ {
+		// Byte order defined by the spec: (i, i+21, i+42) rotated per group
+		x, y, z := i, i+21, i+42
+		switch i % 3 {
+		case 1:
+			x, y, z = i+21, i+42, i
+		case 2:
+			x, y, z = i+42, i, i+21
+		}
+		encode24(&out, c[x], c[y], c[z], 4)
+	}
+	encode24(&out, 0, 0, c[63], 2)
+	return out.String()
+}
+
+func repeatBytes(src []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, src[:min(len(src), n-len(out))]...)
+	}
+	return out
+}
+
+func encode24(out *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+// IsCryptHash reports whether s looks like a crypt(3) hash ($id$...)
+func IsCryptHash(s string) bool {
+	return strings.HasPrefix(s, "$") && strings.Count(s, "$") >= 3
+}
@@ -0,0 +1,24 @@
+package engine
+
+import "testing"
+
+// Known answers from Drepper's specification
+// (https://www.akkadia.org/drepper/SHA-crypt.txt)
+func TestSHA512CryptKnownAnswers(t *testing.T) {
+	for _, tc := range []struct {
+		password, salt string
+		rounds         int
+		want           string
+	}{
+		{"Hello world!", "saltstring", sha512CryptRounds,
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"Hello world!", "saltstringsaltstring", 10000,
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."},
+		{"the minimum number is still observed", "roundstoolow", 10,
+			"$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX."},
+	} {
+		if got := SHA512Crypt(tc.password, tc.salt, tc.rounds); got != tc.want {
+			t.Errorf("SHA512Crypt(%q, %q, %d) =\n%s\nwant\n%s", tc.password, tc.salt, tc.rounds, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Conflict describes two selected modules that cannot coexist
+type Conflict struct {
+	Module string
+	With   string
+	Reason string // capability or module named in # CONFLICTS:
+}
+
+func (c Conflict) String() string {
+	if c.Reason == c.With {
+		return fmt.Sprintf("%s conflita com %s", c.Module, c.With)
+	}
+	return fmt.Sprintf("%s conflita com %s (%s)", c.Module, c.With, c.Reason)
+}
+
+// Resolution is the outcome of resolving a module selection
+type Resolution struct {
+	Modules   []string // final selection, requirements included
+	Added     []string // modules pulled in by # REQUIRES:
+	Missing   []string // requirements that could not be satisfied
+	Conflicts []Conflict
+}
+
+// Err summarizes missing requirements and conflicts, or nil if there are none
+func (r Resolution) Err() error {
+	if len(r.Missing) == 0 && len(r.Conflicts) == 0 {
+		return nil
+	}
+	var problems []string
+	for _, c := range r.Conflicts {
+		problems = append(problems, c.String())
+	}
+	problems = append(problems, r.Missing...)
+	return fmt.Errorf("seleção de módulos inválida:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// ResolveModules expands the selection with required modules and detects
+// conflicts. Requirements may name a module (category/name or name) or a
+// capability declared in another module's # PROVIDES:.
+func ResolveModules(all []ModuleInfo, selected []string) Resolution {
+	var r Resolution
+	included := map[string]bool{}
+	for _, rel := range selected {
+		if !included[rel] {
+			included[rel] = true
+			r.Modules = append(r.Modules, rel)
+		}
+	}
+
+	add := func(rel string) {
+		included[rel] = true
+		r.Modules = append(r.Modules, rel)
+		r.Added = append(r.Added, rel)
+	}
+
+	// Iterate until no new requirement is pulled in
+	for changed := true; changed; {
+		changed = false
+		for _, rel := range r.Modules {
+			mod, ok := findModule(all, rel)
+			if !ok {
+				continue
+			}
+			for _, req := range mod.Requires {
+				if dep, ok := findModule(all, req); ok {
+					if !included[dep.RelPath] {
+						add(dep.RelPath)
+						changed = true
+					}
+					continue
+				}
+				if providedBy(all, included, req) != "" {
+					continue
+				}
+				if providers := providersOf(all, req); len(providers) == 1 {
+					add(providers[0])
+					changed = true
+				}
+			}
+		}
+	}
+
+	// Report requirements that are still unsatisfied
+	for _, rel := range r.Modules {
+		mod, ok := findModule(all, rel)
+		if !ok {
+			continue
+		}
+		for _, req := range mod.Requires {
+			if _, ok := findModule(all, req); ok || providedBy(all, included, req) != "" {
+				continue
+			}
+			providers := providersOf(all, req)
+			if len(providers) > 1 {
+				r.Missing = append(r.Missing, fmt.Sprintf("%s requer %s: escolha um de %s",
+					rel, req, strings.Join(providers, ", ")))
+			} else {
+				r.Missing = append(r.Missing, fmt.Sprintf("%s requer %s: módulo não encontrado", rel, req))
+			}
+		}
+	}
+
+	r.Conflicts = FindConflicts(all, r.Modules)
+	return r
+}
+
+// FindConflicts returns every pair of selected modules that conflict.
+// A module conflicts with another when its # CONFLICTS: names that module
+// or a capability the other one provides.
+func FindConflicts(all []ModuleInfo, selected []string) []Conflict {
+	var mods []ModuleInfo
+	for _, rel := range selected {
+		if mod, ok := findModule(all, rel); ok {
+			mods = append(mods, mod)
+		}
+	}
+
+	var conflicts []Conflict
+	seen := map[string]bool{}
+	for _, a := range mods {
+		for _, b := range mods {
+			if a.RelPath == b.RelPath {
+				continue
+			}
+			for _, c := range a.Conflicts {
+				if !matchesModule(b, c) && !slices.Contains(b.Provides, c) {
+					continue
+				}
+				pair := a.RelPath + "|" + b.RelPath
+				if b.RelPath < a.RelPath {
+					pair = b.RelPath + "|" + a.RelPath
+				}
+				if seen[pair] {
+					break
+				}
+				seen[pair] = true
+				conflicts = append(conflicts, Conflict{Module: a.RelPath, With: b.RelPath, Reason: c})
+				break
+			}
+		}
+	}
+	return conflicts
+}
+
+// findModule looks a reference up by category/name, then by bare name
+func findModule(all []ModuleInfo, ref string) (ModuleInfo, bool) {
+	for _, mod := range all {
+		if mod.RelPath == ref {
+			return mod, true
+		}
+	}
+	for _, mod := range all {
+		if mod.Name == ref {
+			return mod, true
+		}
+	}
+	return ModuleInfo{}, false
+}
+
+func matchesModule(mod ModuleInfo, ref string) bool {
+	return mod.RelPath == ref || mod.Name == ref
+}
+
+// providedBy returns the included module that provides the capability, if any
+func providedBy(all []ModuleInfo, included map[string]bool, capability string) string {
+	for _, mod := range all {
+		if included[mod.RelPath] && slices.Contains(mod.Provides, capability) {
+			return mod.RelPath
+		}
+	}
+	return ""
+}
+
+func providersOf(all []ModuleInfo, capability string) []string {
+	var providers []string
+	for _, mod := range all {
+		if slices.Contains(mod.Provides, capability) {
+			providers = append(providers, mod.RelPath)
+		}
+	}
+	return providers
+}
@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DiskoDir holds the disko layouts listed by the Disko tab
+const DiskoDir = "disko"
+
+// RootFilesystems are the root filesystems the layout wizard offers
+var RootFilesystems = []string{"ext4", "btrfs", "xfs", "zfs"}
+
+// ZFSPool is the pool the wizard creates for a zfs root
+const ZFSPool = "zroot"
+
+var (
+	// diskoSizeRe matches a disko partition size: a number and a unit
+	diskoSizeRe = regexp.MustCompile(`^[0-9]+[KMGT]$`)
+	// layoutNameRe matches a layout file name under disko/
+	layoutNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*\.nix$`)
+)
+
+// DiskLayout is what the Disko wizard asks for: one GPT disk with an ESP,
+// optional swap, the root filesystem and optionally a /home partition. A zfs
+// root is a pool with root, nix and home datasets, optionally mirrored.
+type DiskLayout struct {
+	Device     string           // /dev/disk/by-id/... or /dev/<name>
+	ESPSize    string           // e.g. 1G
+	SwapSize   string           // empty for no swap partition
+	RootFS     string           // one of RootFilesystems
+	RootSize   string           // used when Home is set; / takes the rest otherwise
+	Home       bool             // separate /home partition with the rest of the disk
+	Encryption EncryptionConfig // LUKS2 under / (and /home)
+	Mirror     string           // zfs only: second disk of a mirrored pool
+}
+
+// homeLUKSName is the mapper name of an encrypted /home partition
+const homeLUKSName = "crypthome"
+
+// DefaultDiskLayout is the wizard's starting point for device
+func DefaultDiskLayout(device string) DiskLayout {
+	return DiskLayout{Device: device, ESPSize: "1G", SwapSize: "4G", RootFS: "ext4", RootSize: "64G"}
+}
+
+// Validate returns the first problem with the layout, or nil
+func (l DiskLayout) Validate() error {
+	switch {
+	case l.Device == "":
+		return fmt.Errorf("escolha um disco")
+	case !diskoSizeRe.MatchString(l.ESPSize):
+		return fmt.Errorf("tamanho da ESP %q inválido (ex.: 512M, 1G)", l.ESPSize)
+	case l.SwapSize != "" && !diskoSizeRe.MatchString(l.SwapSize):
+		return fmt.Errorf("tamanho do swap %q inválido (ex.: 8G, vazio para nenhum)", l.SwapSize)
+	case !slices.Contains(RootFilesystems, l.RootFS):
+		return fmt.Errorf("sistema de arquivos %q não suportado (use %s)", l.RootFS, strings.Join(RootFilesystems, ", "))
+	case l.Home && !diskoSizeRe.MatchString(l.RootSize):
+		return fmt.Errorf("tamanho do / %q inválido: com /home separado, / precisa de um tamanho (ex.: 64G)", l.RootSize)
+	case !l.Encryption.LUKS && (l.Encryption.TPM2 || l.Encryption.FIDO2):
+		return fmt.Errorf("TPM2 e FIDO2 desbloqueiam o LUKS: ative a criptografia")
+	case l.Encryption.LUKS && !luksNameRe.MatchString(l.Encryption.DeviceName()):
+		return fmt.Errorf("nome do dispositivo LUKS %q inválido", l.Encryption.DeviceName())
+	case l.RootFS == "zfs" && l.Encryption.LUKS:
+		return fmt.Errorf("com zfs use a criptografia nativa do pool, não LUKS")
+	case l.RootFS == "zfs" && l.Home:
+		return fmt.Errorf("com zfs o /home é um dataset do pool, não uma partição")
+	case l.Mirror != "" && l.RootFS != "zfs":
+		return fmt.Errorf("o espelho só vale para pools zfs")
+	case l.Mirror != "" && l.Mirror == l.Device:
+		return fmt.Errorf("o espelho precisa ser outro disco")
+	}
+	return nil
+}
+
+// Nix renders the layout as a disko file in the style of disko/*.nix
+func (l DiskLayout) Nix() string {
+	var parts []string
+	priority := 1
+	next := func() int { p := priority; priority++; return p }
+
+	parts = append(parts, fmt.Sprintf(`            ESP = {
+              priority = %d;
+              name = "ESP";
+              size = "%s";
+              type = "EF00";
+              content = {
+                type = "filesystem";
+                format = "vfat";
+                mountpoint = "/boot";
+                mountOptions = [ "umask=0077" ];
+              };
+            };
+`, next(), l.ESPSize))
+
+	if l.SwapSize != "" {
+		// Hibernating to a plain swap would leave memory unencrypted, and NixOS
+		// disables hibernation with zfs, so those get a swap with a random key
+		// on every boot instead
+		swapOpt := "resumeDevice = true;"
+		if l.Encryption.LUKS || l.RootFS == "zfs" {
+			swapOpt = "randomEncryption = true;"
+		}
+		parts = append(parts, fmt.Sprintf(`            swap = {
+              priority = %d;
+              size = "%s";
+              content = {
+                type = "swap";
+                %s
+              };
+            };
+`, next(), l.SwapSize, swapOpt))
+	}
+
+	if l.RootFS == "zfs" {
+		parts = append(parts, fmt.Sprintf(`            zfs = {
+              priority = %d;
+              size = "100%%";
+              content = {
+                type = "zfs";
+                pool = "%s";
+              };
+            };
+`, next(), ZFSPool))
+		return l.render(parts)
+	}
+
+	rootSize := "100%"
+	if l.Home {
+		rootSize = l.RootSize
+	}
+	parts = append(parts, fmt.Sprintf(`            root = {
+              priority = %d;
+              size = "%s";
+              content = %s;
+            };
+`, next(), rootSize, l.partContent(l.Encryption.DeviceName(), l.fsContent("root", "/", !l.Home))))
+
+	if l.Home {
+		parts = append(parts, fmt.Sprintf(`            home = {
+              priority = %d;
+              size = "100%%";
+              content = %s;
+            };
+`, next(), l.partContent(homeLUKSName, l.fsContent("home", "/home", false))))
+	}
+	return l.render(parts)
+}
+
+// render wraps the partitions of the main disk into the disko file, adding
+// the mirror disk and the pool of a zfs layout
+func (l DiskLayout) render(parts []string) string {
+	header := "# Gerado pelo assistente de layouts do lego-tui\n"
+	if l.Encryption.LUKS {
+		header += "# LUKS2: a aba Disko pede a senha e passa ao disko uma cópia que a lê de um arquivo privado;\n"
+		header += "# para rodar o disko à mão, grave a senha em " + LUKSPasswordFile + " (0600) e apague depois\n"
+		devices := []string{"/dev/disk/by-partlabel/disk-main-root"}
+		if l.Home {
+			devices = append(devices, "/dev/disk/by-partlabel/disk-main-home")
+		}
+		var cmds []string
+		for _, dev := range devices {
+			cmds = append(cmds, l.Encryption.EnrollCommands(dev)...)
+		}
+		if len(cmds) > 0 {
+			header += "# Depois da instalação, registre o desbloqueio:\n"
+			for _, c := range cmds {
+				header += "#   " + c + "\n"
+			}
+		}
+	}
+
+	disks := diskBlock("main", l.Device, strings.Join(parts, ""))
+	if l.Mirror != "" {
+		disks += diskBlock("mirror", l.Mirror, fmt.Sprintf(`            zfs = {
+              size = "100%%";
+              content = {
+                type = "zfs";
+                pool = "%s";
+              };
+            };
+`, ZFSPool))
+	}
+	var zpool string
+	if l.RootFS == "zfs" {
+		zpool = l.zpoolBlock()
+	}
+
+	return fmt.Sprintf(`%s{
+  disko.devices = {
+    disk = {
+%s    };
+%s  };
+}
+`, header, disks, zpool)
+}
+
+// diskBlock is one GPT disk of disko.devices.disk
+func diskBlock(name, device, partitions string) string {
+	return fmt.Sprintf(`      %s = {
+        type = "disk";
+        device = "%s";
+        content = {
+          type = "gpt";
+          partitions = {
+%s          };
+        };
+      };
+`, name, device, partitions)
+}
+
+// zpoolBlock is the pool of a zfs layout. Datasets use legacy mountpoints
+// so that NixOS mounts them from fileSystems; only /home is snapshotted by
+// services.zfs.autoSnapshot.
+func (l DiskLayout) zpoolBlock() string {
+	mode := ""
+	if l.Mirror != "" {
+		mode = "        mode = \"mirror\";\n"
+	}
+	dataset := func(name, mountpoint string, snapshot bool) string {
+		opts := "options.mountpoint = \"legacy\";"
+		if snapshot {
+			opts = `options = {
+              mountpoint = "legacy";
+              "com.sun:auto-snapshot" = "true";
+            };`
+		}
+		return fmt.Sprintf(`          %s = {
+            type = "zfs_fs";
+            mountpoint = "%s";
+            %s
+          };
+`, name, mountpoint, opts)
+	}
+	return fmt.Sprintf(`    zpool = {
+      %s = {
+        type = "zpool";
+%s        options.ashift = "12";
+        rootFsOptions = {
+          compression = "zstd";
+          acltype = "posixacl";
+          xattr = "sa";
+          atime = "off";
+          mountpoint = "none";
+          "com.sun:auto-snapshot" = "false";
+        };
+        datasets = {
+%s        };
+      };
+    };
+`, ZFSPool, mode, dataset("root", "/", false)+dataset("nix", "/nix", false)+dataset("home", "/home", true))
+}
+
+// partContent wraps the filesystem content of a partition in a LUKS2
+// container named name when the layout is encrypted
+func (l DiskLayout) partContent(name, content string) string {
+	if !l.Encryption.LUKS {
+		return content
+	}
+	settings := "                  allowDiscards = true;\n"
+	if opts := l.Encryption.UnlockOpts(); len(opts) > 0 {
+		settings += "                  crypttabExtraOpts = " + nixStringList(opts) + ";\n"
+	}
+	// The filesystem moves one level deeper, inside the container
+	inner := strings.ReplaceAll(content, "\n", "\n  ")
+	return fmt.Sprintf(`{
+                type = "luks";
+                name = %s;
+                passwordFile = %s;
+                extraFormatArgs = [ "--type" "luks2" ];
+                settings = {
+%s                };
+                content = %s;
+              }`, nixString(name), nixString(LUKSPasswordFile), settings, inner)
+}
+
+// fsContent is the content block of the partition mounted at mountpoint.
+// Btrfs roots get @, @nix and @snapshots subvolumes, plus @home when withHome.
+func (l DiskLayout) fsContent(label, mountpoint string, withHome bool) string {
+	if l.RootFS != "btrfs" {
+		return fmt.Sprintf(`{
+                type = "filesystem";
+                format = "%s";
+                mountpoint = "%s";
+              }`, l.RootFS, mountpoint)
+	}
+
+	subvolumes := [][2]string{{"/@" + label, mountpoint}}
+	if mountpoint == "/" {
+		subvolumes = [][2]string{{"/@", "/"}}
+		if withHome {
+			subvolumes = append(subvolumes, [2]string{"/@home", "/home"})
+		}
+		subvolumes = append(subvolumes, [2]string{"/@nix", "/nix"}, [2]string{"/@snapshots", "/.snapshots"})
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `{
+                type = "btrfs";
+                extraArgs = [ "-f" "-L" "%s" ];
+                subvolumes = {
+`, label)
+	for _, sv := range subvolumes {
+		fmt.Fprintf(&sb, `                  "%s" = {
+                    mountpoint = "%s";
+                    mountOptions = [ "compress=zstd" "noatime" ];
+                  };
+`, sv[0], sv[1])
+	}
+	sb.WriteString(`                };
+              }`)
+	return sb.String()
+}
+
+// WriteDiskoLayout saves the layout as disko/<name>, refusing to replace an
+// existing file, and returns its path
+func WriteDiskoLayout(root, name string, l DiskLayout) (string, error) {
+	if !strings.HasSuffix(name, ".nix") {
+		name += ".nix"
+	}
+	if !layoutNameRe.MatchString(name) {
+		return "", fmt.Errorf("nome de arquivo %q inválido", name)
+	}
+	if err := l.Validate(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, DiskoDir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return "", fmt.Errorf("%s/%s já existe", DiskoDir, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(l.Nix()); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/name, rewriting it under -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs (go test -run %s -update rewrites it):\n%s", path, t.Name(), got)
+	}
+}
+
+const testDevice = "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456A"
+
+func TestDiskLayoutNix(t *testing.T) {
+	luksBtrfs := DefaultDiskLayout(testDevice)
+	luksBtrfs.RootFS = "btrfs"
+	luksBtrfs.Home = true
+	luksBtrfs.Encryption = EncryptionConfig{LUKS: true, TPM2: true}
+
+	zfsMirror := DefaultDiskLayout(testDevice)
+	zfsMirror.RootFS = "zfs"
+	zfsMirror.SwapSize = ""
+	zfsMirror.Mirror = "/dev/sdb"
+
+	for _, tc := range []struct {
+		golden string
+		layout DiskLayout
+	}{
+		{"disko-ext4.nix", DefaultDiskLayout(testDevice)},
+		{"disko-luks-btrfs.nix", luksBtrfs},
+		{"disko-zfs-mirror.nix", zfsMirror},
+	} {
+		if err := tc.layout.Validate(); err != nil {
+			t.Fatalf("%s: %v", tc.golden, err)
+		}
+		golden(t, tc.golden, tc.layout.Nix())
+	}
+}
@@ -0,0 +1,448 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diskoSizeValueRe matches the sizes disko accepts: 512M, 1.5G, 100%...
+var diskoSizeValueRe = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([KMGTP]?)(i?B)?$`)
+
+// PartitionMap is a disko layout reduced to what the Disko tab draws
+type PartitionMap struct {
+	Disks    []DiskMap
+	Pools    []PoolMap
+	Warnings []string
+	Local    bool // read by the local stand-in instead of nix eval
+}
+
+// DiskMap is one disko.devices.disk entry
+type DiskMap struct {
+	Name   string
+	Device string
+	Table  string // gpt, msdos or the content type of an unpartitioned disk
+	Bytes  int64  // size reported by lsblk, 0 when the disk is not here
+	Parts  []PartMap
+}
+
+// PartMap is one partition, in disko's creation order
+type PartMap struct {
+	Name        string
+	Size        string // as written, e.g. 1G or 100%
+	Bytes       int64  // fixed sizes only
+	Percent     int    // percentage sizes only
+	Type        string // GPT type code, e.g. EF00
+	Content     string // e.g. vfat, swap, btrfs, zfs zroot
+	Mountpoints []string
+	Encrypted   bool // inside a LUKS container
+	priority    int
+}
+
+// PoolMap is a zpool or LVM volume group and the mountpoints on it
+type PoolMap struct {
+	Kind        string // zpool or lvm_vg
+	Name        string
+	Mountpoints []string
+}
+
+// Remainder reports whether the partition takes what is left of the disk
+func (p PartMap) Remainder() bool { return p.Size == "100%" || p.Size == "" && p.Bytes == 0 }
+
+// ReadPartitionMap evaluates the disko layout at path with nix eval --json
+// through r and describes its disks, partitions and problems. When r cannot
+// find nix, a local stand-in reads layouts made only of literal values, like
+// the shipped ones and the wizard's.
+func ReadPartitionMap(r Runner, path string) (*PartitionMap, error) {
+	devices, err := evalDiskoDevices(r, path)
+	local := errors.Is(err, exec.ErrNotFound)
+	switch {
+	case local:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if devices, err = localDiskoDevices(string(data)); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	m := buildPartitionMap(devices)
+	m.Local = local
+	if devs, err := ListBlockDevices(r); err == nil {
+		for i := range m.Disks {
+			m.Disks[i].Bytes = diskBytes(devs, m.Disks[i].Device)
+		}
+	}
+	return m, nil
+}
+
+// evalDiskoDevices runs nix eval on the layout's disko.devices
+func evalDiskoDevices(r Runner, path string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	c := Cmd("nix", "eval", "--json", "--file", abs, "disko.devices")
+	c.ReadOnly = true
+	out, err := r.Run(c)
+	if err != nil {
+		return nil, fmt.Errorf("nix eval: %w\n%s", err, strings.TrimSpace(string(out)))
+	}
+	var devices map[string]any
+	if err := json.Unmarshal(out, &devices); err != nil {
+		return nil, fmt.Errorf("saída inesperada do nix eval: %w", err)
+	}
+	return devices, nil
+}
+
+// localDiskoDevices is the stand-in for nix eval: it turns the literal
+// attribute sets, strings, numbers, booleans and string lists of the layout
+// into the same shape as the JSON. Anything computed is left out.
+func localDiskoDevices(src string) (map[string]any, error) {
+	_, top, err := parseNixConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	root := literalAttrs(src, top)
+	disko, _ := root["disko"].(map[string]any)
+	devices, ok := disko["devices"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("disko.devices não encontrado (o layout usa valores calculados? instale o nix)")
+	}
+	return devices, nil
+}
+
+// literalAttrs converts bindings to a map, merging a.b = x paths
+func literalAttrs(src string, bindings []nixBinding) map[string]any {
+	out := map[string]any{}
+	for _, b := range bindings {
+		if b.Inherit || len(b.Path) == 0 {
+			continue
+		}
+		var value any
+		if inner, ok := attrsetBindings(src, b); ok {
+			value = literalAttrs(src, inner)
+		} else if v, ok := literalValue(b.Value); ok {
+			value = v
+		} else {
+			continue
+		}
+		node := out
+		for i, seg := range b.Path {
+			seg = strings.Trim(seg, `"`)
+			if i == len(b.Path)-1 {
+				if sub, ok := value.(map[string]any); ok {
+					if old, ok := node[seg].(map[string]any); ok {
+						for k, v := range sub {
+							old[k] = v
+						}
+						break
+					}
+				}
+				node[seg] = value
+				break
+			}
+			next, ok := node[seg].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				node[seg] = next
+			}
+			node = next
+		}
+	}
+	return out
+}
+
+// literalValue reads a string, number, boolean or string list
+func literalValue(src string) (any, bool) {
+	if s, ok := nixStringLiteral(src); ok {
+		return s, true
+	}
+	if l, ok := nixStringListLiteral(src); ok {
+		return l, true
+	}
+	switch src {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	if n, err := strconv.ParseFloat(src, 64); err == nil {
+		return n, true
+	}
+	return nil, false
+}
+
+// buildPartitionMap walks disko.devices as produced by nix eval --json
+func buildPartitionMap(devices map[string]any) *PartitionMap {
+	m := &PartitionMap{}
+	disks, _ := devices["disk"].(map[string]any)
+	for _, name := range sortedKeys(disks) {
+		d, _ := disks[name].(map[string]any)
+		dm := DiskMap{Name: name, Device: str(d["device"])}
+		content, _ := d["content"].(map[string]any)
+		dm.Table = str(content["type"])
+		switch dm.Table {
+		case "gpt":
+			parts, _ := content["partitions"].(map[string]any)
+			for _, pname := range sortedKeys(parts) {
+				p, _ := parts[pname].(map[string]any)
+				dm.Parts = append(dm.Parts, partMap(pname, p))
+			}
+			sort.SliceStable(dm.Parts, func(i, j int) bool { return dm.Parts[i].priority < dm.Parts[j].priority })
+		case "table":
+			// Legacy msdos/gpt tables list partitions in order
+			dm.Table = str(content["format"])
+			parts, _ := content["partitions"].([]any)
+			for i, raw := range parts {
+				p, _ := raw.(map[string]any)
+				name := str(p["name"])
+				if name == "" {
+					name = strconv.Itoa(i + 1)
+				}
+				pm := partMap(name, p)
+				if pm.Size == "" {
+					pm.Size = legacySize(str(p["start"]), str(p["end"]))
+					pm.Bytes, pm.Percent = parseDiskoSize(pm.Size)
+				}
+				dm.Parts = append(dm.Parts, pm)
+			}
+		default:
+			// The whole disk holds one filesystem, pool or container
+			pm := partMap("disco inteiro", map[string]any{"size": "100%", "content": content})
+			dm.Parts = append(dm.Parts, pm)
+		}
+		m.Disks = append(m.Disks, dm)
+	}
+
+	for _, kind := range []string{"zpool", "lvm_vg"} {
+		pools, _ := devices[kind].(map[string]any)
+		for _, name := range sortedKeys(pools) {
+			pool, _ := pools[name].(map[string]any)
+			pm := PoolMap{Kind: kind, Name: name}
+			if mp := str(pool["mountpoint"]); mp != "" {
+				pm.Mountpoints = append(pm.Mountpoints, mp)
+			}
+			children, _ := pool["datasets"].(map[string]any)
+			if kind == "lvm_vg" {
+				children, _ = pool["lvs"].(map[string]any)
+			}
+			for _, cname := range sortedKeys(children) {
+				child, _ := children[cname].(map[string]any)
+				var info contentInfo
+				info.collect(child)
+				if mp := str(child["mountpoint"]); mp != "" && !slices.Contains(info.mountpoints, mp) {
+					info.mountpoints = append(info.mountpoints, mp)
+				}
+				pm.Mountpoints = append(pm.Mountpoints, info.mountpoints...)
+			}
+			slices.Sort(pm.Mountpoints)
+			m.Pools = append(m.Pools, pm)
+		}
+	}
+
+	m.Warnings = layoutWarnings(m)
+	return m
+}
+
+// partMap describes one partition; the default priority follows disko's
+// (BIOS boot first, the partition filling the disk last)
+func partMap(name string, p map[string]any) PartMap {
+	pm := PartMap{Name: name, Size: str(p["size"]), Type: str(p["type"])}
+	pm.Bytes, pm.Percent = parseDiskoSize(pm.Size)
+	switch prio := p["priority"].(type) {
+	case float64:
+		pm.priority = int(prio)
+	default:
+		switch {
+		case pm.Size == "100%":
+			pm.priority = 9001
+		case pm.Type == "EF02":
+			pm.priority = 100
+		default:
+			pm.priority = 1000
+		}
+	}
+	var info contentInfo
+	content, _ := p["content"].(map[string]any)
+	info.collect(content)
+	pm.Content = strings.Join(info.kinds, " ")
+	pm.Mountpoints = info.mountpoints
+	slices.Sort(pm.Mountpoints)
+	pm.Encrypted = info.encrypted
+	if pm.Type == "EF02" && pm.Content == "" {
+		pm.Content = "BIOS boot"
+	}
+	return pm
+}
+
+// contentInfo accumulates what a (possibly nested) content block holds
+type contentInfo struct {
+	kinds       []string
+	mountpoints []string
+	encrypted   bool
+}
+
+func (c *contentInfo) collect(content map[string]any) {
+	if content == nil {
+		return
+	}
+	mount := func(v any) {
+		if mp := str(v); mp != "" && !slices.Contains(c.mountpoints, mp) {
+			c.mountpoints = append(c.mountpoints, mp)
+		}
+	}
+	switch t := str(content["type"]); t {
+	case "filesystem", "zfs_fs":
+		if f := str(content["format"]); f != "" {
+			c.kinds = append(c.kinds, f)
+		}
+		mount(content["mountpoint"])
+	case "luks":
+		c.encrypted = true
+		c.kinds = append(c.kinds, "luks")
+		inner, _ := content["content"].(map[string]any)
+		c.collect(inner)
+	case "btrfs":
+		c.kinds = append(c.kinds, "btrfs")
+		mount(content["mountpoint"])
+		subvolumes, _ := content["subvolumes"].(map[string]any)
+		for _, name := range sortedKeys(subvolumes) {
+			sv, _ := subvolumes[name].(map[string]any)
+			mount(sv["mountpoint"])
+		}
+	case "zfs":
+		c.kinds = append(c.kinds, "zfs "+str(content["pool"]))
+	case "lvm_pv":
+		c.kinds = append(c.kinds, "lvm "+str(content["vg"]))
+	case "mdraid":
+		c.kinds = append(c.kinds, "mdraid "+str(content["name"]))
+	case "":
+	default:
+		c.kinds = append(c.kinds, t)
+	}
+}
+
+// layoutWarnings flags layouts that disko would build wrong or that would
+// not boot
+func layoutWarnings(m *PartitionMap) []string {
+	var warnings []string
+	esp, biosBoot, root := false, false, false
+	for _, d := range m.Disks {
+		var fill []string
+		for i, p := range d.Parts {
+			if p.Type == "EF00" || slices.Contains(p.Mountpoints, "/boot") && strings.Contains(p.Content, "vfat") {
+				esp = true
+			}
+			if p.Type == "EF02" {
+				biosBoot = true
+			}
+			if slices.Contains(p.Mountpoints, "/") {
+				root = true
+			}
+			if p.Size == "100%" {
+				fill = append(fill, p.Name)
+				if i < len(d.Parts)-1 && d.Parts[i+1].Size != "100%" {
+					warnings = append(warnings, fmt.Sprintf("disco %s: %q usa 100%% mas não é a última partição (%q fica sem espaço)", d.Name, p.Name, d.Parts[i+1].Name))
+				}
+			}
+		}
+		if len(fill) > 1 {
+			warnings = append(warnings, fmt.Sprintf("disco %s: %s usam size = \"100%%\" e se sobrepõem; só a última pode ocupar o resto", d.Name, strings.Join(quoteAll(fill), " e ")))
+		}
+		var fixed int64
+		for _, p := range d.Parts {
+			fixed += p.Bytes
+		}
+		if d.Bytes > 0 && fixed > d.Bytes {
+			warnings = append(warnings, fmt.Sprintf("disco %s: as partições somam %s, mais que os %s do disco", d.Name, HumanSize(fixed), HumanSize(d.Bytes)))
+		}
+	}
+	for _, pool := range m.Pools {
+		if slices.Contains(pool.Mountpoints, "/") {
+			root = true
+		}
+	}
+	if !esp && !biosBoot && len(m.Disks) > 0 {
+		warnings = append(warnings, "nenhuma ESP (type = \"EF00\", vfat em /boot): o boot UEFI não vai encontrar o sistema")
+	}
+	if !root && len(m.Disks) > 0 {
+		warnings = append(warnings, "nada é montado em /")
+	}
+	return warnings
+}
+
+// parseDiskoSize returns the bytes of a fixed size or the percentage
+func parseDiskoSize(size string) (bytes int64, percent int) {
+	if strings.HasSuffix(size, "%") {
+		n, _ := strconv.Atoi(strings.TrimSuffix(size, "%"))
+		return 0, n
+	}
+	m := diskoSizeValueRe.FindStringSubmatch(size)
+	if m == nil {
+		return 0, 0
+	}
+	n, _ := strconv.ParseFloat(m[1], 64)
+	shift := strings.Index("KMGTP", m[2]) + 1
+	if m[2] == "" {
+		shift = 0
+	}
+	return int64(n * float64(int64(1)<<(10*shift))), 0
+}
+
+// legacySize turns the start/end of a legacy table entry into a size
+func legacySize(start, end string) string {
+	if end == "100%" || end == "-0" {
+		return "100%"
+	}
+	s, _ := parseDiskoSize(start)
+	e, _ := parseDiskoSize(end)
+	if e > s {
+		return HumanSize(e - s)
+	}
+	return end
+}
+
+// diskBytes is the lsblk size of the disk at device, following by-id links
+func diskBytes(devs []BlockDevice, device string) int64 {
+	resolved := resolveNode(device)
+	for _, d := range devs {
+		if d.DevicePath() == resolved {
+			return d.Bytes()
+		}
+	}
+	return 0
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quoteAll(items []string) []string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = strconv.Quote(s)
+	}
+	return quoted
+}
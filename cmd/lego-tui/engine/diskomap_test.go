@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// localMap reads a layout with the stand-in for nix eval
+func localMap(t *testing.T, src string) *PartitionMap {
+	t.Helper()
+	devices, err := localDiskoDevices(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buildPartitionMap(devices)
+}
+
+func partNames(parts []PartMap) []string {
+	var names []string
+	for _, p := range parts {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestPartitionMapShippedNVMe(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "..", "disko", "nvme.nix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := localMap(t, string(data))
+	if len(m.Disks) != 1 || m.Disks[0].Device != "/dev/nvme0n1" || m.Disks[0].Table != "gpt" {
+		t.Fatalf("disks = %+v", m.Disks)
+	}
+	parts := m.Disks[0].Parts
+	if got, want := partNames(parts), []string{"ESP", "swap", "root"}; !slices.Equal(got, want) {
+		t.Fatalf("partitions = %q, want %q", got, want)
+	}
+	if parts[0].Bytes != 1<<30 || parts[0].Content != "vfat" || parts[1].Content != "swap" {
+		t.Errorf("ESP/swap = %+v %+v", parts[0], parts[1])
+	}
+	if want := []string{"/", "/.snapshots", "/home", "/nix", "/var/log"}; !slices.Equal(parts[2].Mountpoints, want) || !parts[2].Remainder() {
+		t.Errorf("root = %+v, want btrfs subvolumes %q filling the disk", parts[2], want)
+	}
+	if len(m.Warnings) != 0 {
+		t.Errorf("warnings = %q", m.Warnings)
+	}
+}
+
+func TestPartitionMapWizardLayouts(t *testing.T) {
+	luks := DefaultDiskLayout(testDevice)
+	luks.RootFS = "btrfs"
+	luks.Home = true
+	luks.Encryption.LUKS = true
+	m := localMap(t, luks.Nix())
+	parts := m.Disks[0].Parts
+	if got, want := partNames(parts), []string{"ESP", "swap", "root", "home"}; !slices.Equal(got, want) {
+		t.Fatalf("partitions = %q, want %q", got, want)
+	}
+	if root := parts[2]; !root.Encrypted || root.Content != "luks btrfs" || !slices.Contains(root.Mountpoints, "/") {
+		t.Errorf("root = %+v", root)
+	}
+	if home := parts[3]; !home.Encrypted || !slices.Equal(home.Mountpoints, []string{"/home"}) || !home.Remainder() {
+		t.Errorf("home = %+v", home)
+	}
+	if len(m.Warnings) != 0 {
+		t.Errorf("warnings = %q", m.Warnings)
+	}
+
+	zfs := DefaultDiskLayout(testDevice)
+	zfs.RootFS = "zfs"
+	zfs.Mirror = "/dev/sdb"
+	m = localMap(t, zfs.Nix())
+	if len(m.Disks) != 2 || len(m.Pools) != 1 {
+		t.Fatalf("disks %+v, pools %+v", m.Disks, m.Pools)
+	}
+	if pool := m.Pools[0]; pool.Kind != "zpool" || pool.Name != "zroot" || !slices.Equal(pool.Mountpoints, []string{"/", "/home", "/nix"}) {
+		t.Errorf("pool = %+v", pool)
+	}
+	// Only the main disk carries the ESP; the pool provides /
+	if len(m.Warnings) != 0 {
+		t.Errorf("warnings = %q", m.Warnings)
+	}
+}
+
+func TestPartitionMapWarnings(t *testing.T) {
+	m := localMap(t, `{
+  disko.devices.disk.main = {
+    device = "/dev/vda";
+    content = {
+      type = "gpt";
+      partitions = {
+        data = { priority = 1; size = "100%"; content = { type = "filesystem"; format = "ext4"; mountpoint = "/srv"; }; };
+        root = { priority = 2; size = "100%"; content = { type = "filesystem"; format = "ext4"; mountpoint = "/"; }; };
+      };
+    };
+  };
+}`)
+	want := []string{
+		`disco main: "data" e "root" usam size = "100%" e se sobrepõem; só a última pode ocupar o resto`,
+		`nenhuma ESP (type = "EF00", vfat em /boot): o boot UEFI não vai encontrar o sistema`,
+	}
+	if !slices.Equal(m.Warnings, want) {
+		t.Errorf("warnings:\n%q\nwant:\n%q", m.Warnings, want)
+	}
+}
+
+func TestReadPartitionMapFallsBackWithoutNix(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "disko"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path, err := WriteDiskoLayout(root, "vm", DefaultDiskLayout("/dev/vda"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval := Cmd("nix", "eval", "--json", "--file", path, "disko.devices")
+	lsblk := Cmd("lsblk", "--json", "--bytes", "--output", lsblkColumns)
+	rec := &RecordingRunner{Results: map[string]RecordedResult{
+		eval.String():  {Err: &exec.Error{Name: "nix", Err: exec.ErrNotFound}},
+		lsblk.String(): {Output: `{"blockdevices":[{"name":"vda","path":"/dev/vda","type":"disk","size":68719476736}]}`},
+	}}
+	m, err := ReadPartitionMap(rec, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.Local || len(m.Disks) != 1 || m.Disks[0].Bytes != 64<<30 {
+		t.Errorf("map = %+v", m)
+	}
+	if got := commandLines(rec.Commands()); !slices.Equal(got, []string{eval.String(), lsblk.String()}) {
+		t.Errorf("commands = %q", got)
+	}
+
+	// Any other failure of nix eval is reported, not papered over
+	rec.Results[eval.String()] = RecordedResult{Output: "error: syntax error", Err: errors.New("exit status 1")}
+	if _, err := ReadPartitionMap(rec, path); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("err = %v, want the nix eval error", err)
+	}
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// procMounts lists the mounted filesystems of the running system; it is
+// read through the runner like lsblk, so dry runs and tests see the same
+const procMounts = "/proc/mounts"
+
+// layoutDeviceRe finds the disks a disko layout formats
+var layoutDeviceRe = regexp.MustCompile(`device\s*=\s*"(/dev/[^"]+)"`)
+
+// DiskoTarget is a disk a layout would wipe, as found on this machine
+type DiskoTarget struct {
+	Device   string       // as written in the layout
+	Resolved string       // the /dev node it points to
+	Disk     *BlockDevice // nil when lsblk does not know it
+	Problems []string     // reasons to refuse formatting it
+}
+
+// Name is the kernel name the user types to confirm, e.g. nvme0n1
+func (t DiskoTarget) Name() string {
+	if t.Disk != nil {
+		return t.Disk.Name
+	}
+	return filepath.Base(t.Resolved)
+}
+
+// LayoutDevices returns the devices declared in the disko layout at path,
+// in order and without repeats
+func LayoutDevices(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	for _, m := range layoutDeviceRe.FindAllStringSubmatch(string(data), -1) {
+		if !slices.Contains(devices, m[1]) {
+			devices = append(devices, m[1])
+		}
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("nenhum device = \"/dev/...\" encontrado no layout")
+	}
+	return devices, nil
+}
+
+// CheckDiskoTargets lists the disks the layout at path would wipe and what
+// makes each unsafe: missing, not a whole disk, read-only, mounted (per
+// lsblk or /proc/mounts) or holding the running root filesystem. Datasets
+// of a mounted ZFS pool count as mounted from each of the pool's disks.
+func CheckDiskoTargets(r Runner, path string) ([]DiskoTarget, error) {
+	devices, err := LayoutDevices(path)
+	if err != nil {
+		return nil, err
+	}
+	devs, err := ListBlockDevices(r)
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := readMounts(r, devs)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []DiskoTarget
+	for _, dev := range devices {
+		t := DiskoTarget{Device: dev, Resolved: dev}
+		if resolved, err := filepath.EvalSymlinks(dev); err == nil {
+			t.Resolved = resolved
+		}
+		t.Disk = findDevice(devs, t.Resolved)
+		if t.Disk == nil {
+			t.Problems = append(t.Problems, "não encontrado pelo lsblk (o disco existe nesta máquina?)")
+			targets = append(targets, t)
+			continue
+		}
+		d := t.Disk
+		if d.Type != "disk" {
+			t.Problems = append(t.Problems, fmt.Sprintf("é do tipo %s, não um disco inteiro", d.Type))
+		}
+		if d.ReadOnly {
+			t.Problems = append(t.Problems, "somente leitura")
+		}
+		if m := d.AllMounts(); len(m) > 0 {
+			t.Problems = append(t.Problems, "montado em "+strings.Join(m, ", "))
+		}
+		nodes := d.nodes()
+		for _, mnt := range mounts {
+			if !nodes[resolveNode(mnt.source)] {
+				continue
+			}
+			if mnt.target == "/" {
+				t.Problems = append(t.Problems, "contém o / do sistema em execução")
+			} else if !slices.Contains(d.AllMounts(), mnt.target) {
+				t.Problems = append(t.Problems, "montado em "+mnt.target+" (/proc/mounts)")
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// findDevice looks for path among devs and their partitions
+func findDevice(devs []BlockDevice, path string) *BlockDevice {
+	for i := range devs {
+		if devs[i].DevicePath() == path {
+			return &devs[i]
+		}
+		if d := findDevice(devs[i].Children, path); d != nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// nodes are the resolved /dev nodes of the device and everything on it
+func (d BlockDevice) nodes() map[string]bool {
+	nodes := map[string]bool{resolveNode(d.DevicePath()): true}
+	for _, c := range d.Children {
+		for n := range c.nodes() {
+			nodes[n] = true
+		}
+	}
+	return nodes
+}
+
+// resolveNode follows /dev/mapper and /dev/disk links to the /dev node
+func resolveNode(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+type mountEntry struct{ source, target string }
+
+// readMounts returns the /dev-backed entries of procMounts, with every ZFS
+// dataset replaced by the devices of its pool
+func readMounts(r Runner, devs []BlockDevice) ([]mountEntry, error) {
+	c := Cmd("cat", procMounts)
+	c.ReadOnly = true
+	out, err := r.Run(c)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", procMounts, err)
+	}
+	var mounts []mountEntry
+	pools := map[string][]string{}
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		// Spaces in mountpoints are escaped as \040
+		target := strings.ReplaceAll(fields[1], `\040`, " ")
+		switch {
+		case strings.HasPrefix(fields[0], "/dev/"):
+			mounts = append(mounts, mountEntry{fields[0], target})
+		case fields[2] == "zfs":
+			pool, _, _ := strings.Cut(fields[0], "/")
+			if _, ok := pools[pool]; !ok {
+				pools[pool] = poolDevices(r, pool, devs)
+			}
+			for _, dev := range pools[pool] {
+				mounts = append(mounts, mountEntry{dev, target})
+			}
+		}
+	}
+	return mounts, sc.Err()
+}
+
+// poolDevices returns the member devices of an imported zpool, from
+// zpool status -P, or else the zfs_member partitions lsblk labels with
+// the pool name
+func poolDevices(r Runner, pool string, devs []BlockDevice) []string {
+	c := Cmd("zpool", "status", "-P", pool)
+	c.ReadOnly = true
+	var members []string
+	if out, err := r.Run(c); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[0], "/dev/") {
+				members = append(members, fields[0])
+			}
+		}
+	}
+	if len(members) > 0 {
+		return members
+	}
+	var walk func([]BlockDevice)
+	walk = func(ds []BlockDevice) {
+		for _, d := range ds {
+			if d.FSType == "zfs_member" && d.Label == pool {
+				members = append(members, d.DevicePath())
+			}
+			walk(d.Children)
+		}
+	}
+	walk(devs)
+	return members
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// safetyRunner answers lsblk, /proc/mounts and zpool status from testdata
+func safetyRunner(t *testing.T, lsblk, mounts, zpool string) *RecordingRunner {
+	t.Helper()
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	results := map[string]RecordedResult{
+		Cmd("lsblk", "--json", "--bytes", "--output", lsblkColumns).String(): {Output: read(lsblk)},
+		Cmd("cat", procMounts).String():                                      {Output: read(mounts)},
+		Cmd("zpool", "status", "-P", "rpool").String():                       {Output: "zpool: command not found", Err: errors.New("exit status 127")},
+	}
+	if zpool != "" {
+		results[Cmd("zpool", "status", "-P", "rpool").String()] = RecordedResult{Output: read(zpool)}
+	}
+	return &RecordingRunner{Results: results}
+}
+
+// layoutFor writes a layout formatting devices and returns its path
+func layoutFor(t *testing.T, devices ...string) string {
+	t.Helper()
+	src := "{\n  disko.devices.disk = {\n"
+	for i, d := range devices {
+		src += "    d" + string(rune('0'+i)) + ".device = \"" + d + "\";\n"
+	}
+	src += "  };\n}\n"
+	path := filepath.Join(t.TempDir(), "layout.nix")
+	writeFile(t, path, src)
+	return path
+}
+
+func targetProblems(targets []DiskoTarget) map[string][]string {
+	problems := map[string][]string{}
+	for _, t := range targets {
+		problems[t.Device] = t.Problems
+	}
+	return problems
+}
+
+func TestCheckDiskoTargetsZFSRoot(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		zpool string
+	}{
+		{"zpool status", "zpool-status-rpool"},
+		{"lsblk zfs_member", ""}, // zpool missing: the pool label decides
+	} {
+		r := safetyRunner(t, "lsblk-zfs.json", "mounts-zfs", tc.zpool)
+		targets, err := CheckDiskoTargets(r, layoutFor(t, "/dev/nvme0n1", "/dev/sdb"))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got := targetProblems(targets)
+		want := []string{
+			"contém o / do sistema em execução",
+			"montado em /nix (/proc/mounts)",
+			"montado em /home (/proc/mounts)",
+		}
+		if !slices.Equal(got["/dev/nvme0n1"], want) {
+			t.Errorf("%s: nvme0n1 problems = %q, want %q", tc.name, got["/dev/nvme0n1"], want)
+		}
+		if len(got["/dev/sdb"]) != 0 {
+			t.Errorf("%s: sdb problems = %q, want none", tc.name, got["/dev/sdb"])
+		}
+	}
+}
+
+func TestCheckDiskoTargetsProblems(t *testing.T) {
+	r := safetyRunner(t, "lsblk-nvme.json", "mounts-zfs", "")
+	targets, err := CheckDiskoTargets(r, layoutFor(t, "/dev/nvme0n1", "/dev/sda1", "/dev/mmcblk0boot0", "/dev/sdz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := targetProblems(targets)
+	for dev, want := range map[string][]string{
+		"/dev/nvme0n1":      {"montado em /boot, /nix, /home, /"},
+		"/dev/sda1":         {"é do tipo part, não um disco inteiro", "montado em /boot (/proc/mounts)"},
+		"/dev/mmcblk0boot0": {"somente leitura"},
+		"/dev/sdz":          {"não encontrado pelo lsblk (o disco existe nesta máquina?)"},
+	} {
+		if !slices.Equal(got[dev], want) {
+			t.Errorf("%s problems = %q, want %q", dev, got[dev], want)
+		}
+	}
+	if name := targets[0].Name(); name != "nvme0n1" {
+		t.Errorf("Name = %q, want nvme0n1", name)
+	}
+}
+
+func TestCheckDiskoTargetsReportsUnreadableMounts(t *testing.T) {
+	r := safetyRunner(t, "lsblk-zfs.json", "mounts-zfs", "")
+	r.Results[Cmd("cat", procMounts).String()] = RecordedResult{Err: errors.New("permissão negada")}
+	if _, err := CheckDiskoTargets(r, layoutFor(t, "/dev/sdb")); err == nil {
+		t.Error("CheckDiskoTargets ignored an unreadable /proc/mounts")
+	}
+}
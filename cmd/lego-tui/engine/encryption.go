@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultLUKSName is the /dev/mapper name of an encrypted root
+const DefaultLUKSName = "cryptroot"
+
+// LUKSPasswordFile is the luks.passwordFile of layouts from the wizard. The
+// Disko tab never writes it: each run gets a private copy of the layout
+// pointing at a fresh key file instead (see PrepareLUKSRun).
+const LUKSPasswordFile = "/tmp/lego-luks.key"
+
+// luksNameRe matches a device-mapper name usable as a Nix attribute
+var luksNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// EncryptionConfig is the [encryption] table of a preset: a LUKS2 root
+// opened in the systemd initrd, optionally by a TPM2 chip or FIDO2 key
+type EncryptionConfig struct {
+	LUKS  bool   `toml:"luks,omitempty"`
+	Name  string `toml:"name,omitempty"` // mapper name in the disko layout; empty means cryptroot
+	TPM2  bool   `toml:"tpm2,omitempty"`
+	FIDO2 bool   `toml:"fido2,omitempty"`
+}
+
+// DeviceName is the configured mapper name, defaulting to cryptroot
+func (e EncryptionConfig) DeviceName() string {
+	if e.Name == "" {
+		return DefaultLUKSName
+	}
+	return e.Name
+}
+
+// UnlockOpts are the crypttab options that let systemd-cryptsetup try the
+// enrolled TPM2 chip or FIDO2 key before asking for the passphrase
+func (e EncryptionConfig) UnlockOpts() []string {
+	var opts []string
+	if e.TPM2 {
+		opts = append(opts, "tpm2-device=auto")
+	}
+	if e.FIDO2 {
+		opts = append(opts, "fido2-device=auto")
+	}
+	return opts
+}
+
+// EnrollCommands are the systemd-cryptenroll calls that register the TPM2
+// chip or FIDO2 key on device once the system is installed
+func (e EncryptionConfig) EnrollCommands(device string) []string {
+	var cmds []string
+	if e.TPM2 {
+		cmds = append(cmds, "sudo systemd-cryptenroll --tpm2-device=auto --tpm2-pcrs=7 "+device)
+	}
+	if e.FIDO2 {
+		cmds = append(cmds, "sudo systemd-cryptenroll --fido2-device=auto "+device)
+	}
+	return cmds
+}
+
+// String summarizes the table for presets show
+func (e EncryptionConfig) String() string {
+	if !e.LUKS {
+		return "nenhuma"
+	}
+	parts := []string{"luks2 " + e.DeviceName()}
+	if e.TPM2 {
+		parts = append(parts, "tpm2")
+	}
+	if e.FIDO2 {
+		parts = append(parts, "fido2")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e EncryptionConfig) validate() []PresetIssue {
+	var issues []PresetIssue
+	if e.Name != "" && !luksNameRe.MatchString(e.Name) {
+		issues = append(issues, PresetIssue{"encryption.name", fmt.Sprintf("%q inválido: use letras, números, '_' e '-'", e.Name)})
+	}
+	if !e.LUKS && (e.Name != "" || e.TPM2 || e.FIDO2) {
+		issues = append(issues, PresetIssue{"encryption.luks", "tpm2, fido2 e name só valem com luks = true"})
+	}
+	return issues
+}
+
+// encryptionEntries renders the initrd side of an encrypted root as a module
+// list entry at indent. The disko layout declares the LUKS device itself, so
+// the unlock settings are defaults that a layout's own settings override.
+func encryptionEntries(e EncryptionConfig, indent string) string {
+	if !e.LUKS {
+		return ""
+	}
+	name := nixString(e.DeviceName())
+	var sb strings.Builder
+	sb.WriteString("\n")
+	sb.WriteString(indent + "# ── encryption ── Raiz LUKS2 aberta no initrd (systemd-cryptsetup)\n")
+	sb.WriteString(indent + "({ lib, ... }: {\n")
+	sb.WriteString(indent + "  boot.initrd.systemd.enable = true;\n")
+	sb.WriteString(indent + "  boot.initrd.luks.devices." + name + ".allowDiscards = lib.mkDefault true;\n")
+	if opts := e.UnlockOpts(); len(opts) > 0 {
+		sb.WriteString(indent + "  boot.initrd.luks.devices." + name + ".crypttabExtraOpts = lib.mkDefault " + nixStringList(opts) + ";\n")
+	}
+	if e.TPM2 {
+		sb.WriteString(indent + "  security.tpm2.enable = true;\n")
+	}
+	if cmds := e.EnrollCommands("<partição LUKS>"); len(cmds) > 0 {
+		sb.WriteString(indent + "  # Depois da instalação, registre o desbloqueio (a senha continua valendo):\n")
+		for _, c := range cmds {
+			sb.WriteString(indent + "  #   " + c + "\n")
+		}
+	}
+	sb.WriteString(indent + "})\n")
+	return sb.String()
+}
+
+// NeedsLUKSPassphrase reports whether the disko layout at path reads its
+// passphrase from LUKSPasswordFile
+func NeedsLUKSPassphrase(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && strings.Contains(string(data), `"`+LUKSPasswordFile+`"`)
+}
+
+// LUKSRun holds the passphrase of one disko run and a copy of the layout
+// that reads it, in a private temporary directory
+type LUKSRun struct {
+	Layout string // layout to pass to disko
+	Key    string // passphrase file, 0600
+	dir    string
+}
+
+// PrepareLUKSRun writes pass, without a trailing newline so that it matches
+// what is typed at boot, to a new key file in a 0700 directory, and copies
+// the layout at path with every LUKSPasswordFile pointing at that key.
+// The copy lives outside the repo, so the layout must not import files
+// relative to itself.
+func PrepareLUKSRun(path, pass string) (*LUKSRun, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler %s: %w", filepath.Base(path), err)
+	}
+	dir, err := os.MkdirTemp("", "lego-luks-")
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório para a senha: %w", err)
+	}
+	run := &LUKSRun{
+		Layout: filepath.Join(dir, filepath.Base(path)),
+		Key:    filepath.Join(dir, "luks.key"),
+		dir:    dir,
+	}
+	if err := writeNew(run.Key, []byte(pass)); err != nil {
+		run.Remove()
+		return nil, fmt.Errorf("erro ao gravar a senha: %w", err)
+	}
+	layout := strings.ReplaceAll(string(data), nixString(LUKSPasswordFile), nixString(run.Key))
+	if err := writeNew(run.Layout, []byte(layout)); err != nil {
+		run.Remove()
+		return nil, fmt.Errorf("erro ao copiar o layout: %w", err)
+	}
+	return run, nil
+}
+
+// writeNew creates path with mode 0600, failing if anything is already there
+func writeNew(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Remove deletes the key and the layout copy once disko is done
+func (r *LUKSRun) Remove() {
+	os.RemoveAll(r.dir)
+}
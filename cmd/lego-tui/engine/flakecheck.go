@@ -0,0 +1,490 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckProblem is an error found while evaluating a generated flake
+type CheckProblem struct {
+	Step    string `json:"step"`             // parse, flake check or eval <host>
+	Module  string `json:"module,omitempty"` // category/name, or the generated block (secrets, home-manager)
+	Line    int    `json:"line,omitempty"`   // line in modules/<Module>.nix, 0 when unknown
+	Message string `json:"message"`
+}
+
+func (p CheckProblem) String() string {
+	where := ""
+	if p.Module != "" {
+		where = p.Module
+		if p.Line > 0 {
+			where += fmt.Sprintf(" (linha %d)", p.Line)
+		}
+		where += ": "
+	}
+	return fmt.Sprintf("[%s] %s%s", p.Step, where, p.Message)
+}
+
+// FlakeCheck is the outcome of CheckFlake. It is saved next to the flake
+// (<flake>.check.json) so that Aplicar can refuse flakes that failed.
+type FlakeCheck struct {
+	Hash      string            `json:"hash"` // flakeHash when checked
+	CheckedAt string            `json:"checked_at"`
+	DrvPaths  map[string]string `json:"drv_paths,omitempty"` // host → toplevel drvPath
+	Problems  []CheckProblem    `json:"problems,omitempty"`
+
+	Flake string `json:"-"` // generated flake file
+}
+
+// OK reports whether every step passed
+func (c *FlakeCheck) OK() bool { return len(c.Problems) == 0 }
+
+// Current reports whether the flake is unchanged since it was checked
+func (c *FlakeCheck) Current() bool {
+	hash, err := flakeHash(c.Flake)
+	return err == nil && hash == c.Hash
+}
+
+func flakeCheckPath(flakePath string) string {
+	return strings.TrimSuffix(flakePath, ".nix") + ".check.json"
+}
+
+// LoadFlakeCheck reads the saved check of a flake; nil when it was never checked
+func LoadFlakeCheck(flakePath string) (*FlakeCheck, error) {
+	data, err := os.ReadFile(flakeCheckPath(flakePath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c FlakeCheck
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("erro ao ler avaliação da flake: %w", err)
+	}
+	c.Flake = flakePath
+	return &c, nil
+}
+
+// SaveFlakeCheck writes the check next to its flake
+func SaveFlakeCheck(c *FlakeCheck) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(flakeCheckPath(c.Flake), append(data, '\n'), 0644)
+}
+
+// flakeHash fingerprints a generated flake: the file itself and, for
+// directory flakes, every file under lego/
+func flakeHash(flakePath string) (string, error) {
+	h := sha256.New()
+	data, err := os.ReadFile(flakePath)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	if filepath.Base(flakePath) == FlakeDirFile {
+		lego := filepath.Join(filepath.Dir(flakePath), "lego")
+		err := filepath.WalkDir(lego, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(lego, path)
+			fmt.Fprintf(h, "\x00%s\x00", filepath.ToSlash(rel))
+			h.Write(data)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CheckFlake validates a flake produced by BuildFlake, BuildFlakeDir or
+// BuildMultiHostFlake: nix-instantiate --parse on every module, then
+// nix flake check and the toplevel drvPath of each host. Errors are traced
+// back to the module they come from. Every command is read-only; the
+// evaluation runs on a copy of the flake in a temporary directory.
+func CheckFlake(r Runner, root, flakePath string) *FlakeCheck {
+	check := &FlakeCheck{
+		Flake:     flakePath,
+		CheckedAt: time.Now().UTC().Format(time.RFC3339),
+		DrvPaths:  map[string]string{},
+	}
+	check.Hash, _ = flakeHash(flakePath)
+
+	src, err := loadFlakeSource(root, flakePath)
+	if err != nil {
+		check.Problems = []CheckProblem{{Step: "parse", Message: err.Error()}}
+		return check
+	}
+	// Nothing is evaluated while a module does not even parse
+	if check.Problems = src.parse(r); len(check.Problems) > 0 {
+		return check
+	}
+	check.Problems = src.evaluate(r, check.DrvPaths)
+	return check
+}
+
+// ── Flake source map ─────────────────────────────────────────
+
+var (
+	originRe      = regexp.MustCompile(`^# origem: modules/(\S+)\.nix \(corpo a partir da linha (\d+)\)`)
+	nixPositionRe = regexp.MustCompile(`(?:«string»|\(string\)|\S+\.nix):(\d+):\d+`)
+	storePathRe   = regexp.MustCompile("(/nix/store/[^/\\s]+)/([^\\s:'\"`]+\\.nix)(?::(\\d+))?")
+)
+
+// flakeSegment is a wrapped module (or generated block) of a flake file
+type flakeSegment struct {
+	file       string // flake.nix or lego/<...>.nix
+	start, end int    // 0-based inclusive line range
+	header     int    // line of "({ ... }: {"
+	module     string // category/name, or the block name when it is not a module
+	bodyLine   int    // line of the first body line in modules/<module>.nix, 0 for blocks
+	nested     bool   // inside another segment (home modules in home-manager)
+}
+
+// flakeSource maps the lines of a generated flake back to modules
+type flakeSource struct {
+	root     string
+	path     string
+	dir      bool
+	files    map[string][]string // lines per file, relative to the flake root
+	segments []flakeSegment
+	hosts    []string // nixosConfigurations attribute names, as written
+}
+
+func loadFlakeSource(root, flakePath string) (*flakeSource, error) {
+	data, err := os.ReadFile(flakePath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler flake: %w", err)
+	}
+	src := &flakeSource{
+		root:  root,
+		path:  flakePath,
+		dir:   filepath.Base(flakePath) == FlakeDirFile,
+		files: map[string][]string{FlakeDirFile: strings.Split(string(data), "\n")},
+	}
+
+	// Wrappers are marked with the header name; find the file and body line
+	type origin struct {
+		rel      string
+		bodyLine int
+	}
+	index := map[string]origin{}
+	for _, info := range ListModules(root) {
+		if mod, err := LoadModule(info.FullPath); err == nil {
+			index[mod.Name] = origin{info.RelPath, mod.BodyLine}
+		}
+	}
+
+	lines := src.files[FlakeDirFile]
+	for i, line := range lines {
+		if m := hostStartRe.FindStringSubmatch(line); m != nil {
+			src.hosts = append(src.hosts, m[1])
+		}
+		if m := moduleImportRe.FindStringSubmatch(line); m != nil && src.dir {
+			if err := src.addImported(strings.TrimPrefix(m[1], "./")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m := moduleCommentRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		end := i + 1
+		for end < len(lines) && lines[end] != indent+"})" {
+			end++
+		}
+		seg := flakeSegment{file: FlakeDirFile, start: i, end: min(end, len(lines)-1), header: i + 1, module: m[1]}
+		if o, ok := index[m[1]]; ok {
+			seg.module, seg.bodyLine = o.rel, o.bodyLine
+		}
+		for _, outer := range src.segments {
+			if outer.file == seg.file && outer.start < i && i <= outer.end {
+				seg.nested = true
+			}
+		}
+		src.segments = append(src.segments, seg)
+	}
+	return src, nil
+}
+
+// addImported maps a lego/ file of a directory flake through its origin comment
+func (s *flakeSource) addImported(file string) error {
+	if _, seen := s.files[file]; seen {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(s.path), filepath.FromSlash(file)))
+	if err != nil {
+		return fmt.Errorf("erro ao ler módulo importado: %w", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	s.files[file] = lines
+	seg := flakeSegment{file: file, end: len(lines) - 1, module: file}
+	if m := originRe.FindStringSubmatch(lines[0]); m != nil {
+		seg.module = m[1]
+		seg.bodyLine, _ = strconv.Atoi(m[2])
+	}
+	for i, line := range lines {
+		if moduleCommentRe.MatchString(line) {
+			seg.header = i + 1
+			break
+		}
+	}
+	s.segments = append(s.segments, seg)
+	return nil
+}
+
+// locate maps a 0-based line of a flake file to the innermost module
+// containing it and the matching line of the module file (0 if unknown)
+func (s *flakeSource) locate(file string, line int) (string, int) {
+	var best *flakeSegment
+	for i := range s.segments {
+		seg := &s.segments[i]
+		if seg.file != file || line < seg.start || line > seg.end {
+			continue
+		}
+		if best == nil || seg.end-seg.start < best.end-best.start {
+			best = seg
+		}
+	}
+	if best == nil {
+		return "", 0
+	}
+	if best.bodyLine == 0 || line <= best.header {
+		return best.module, 0
+	}
+	return best.module, best.bodyLine + line - best.header - 1
+}
+
+// ── Steps ────────────────────────────────────────────────────
+
+// parse runs nix-instantiate --parse on each module, then on the whole flake
+func (s *flakeSource) parse(r Runner) []CheckProblem {
+	var problems []CheckProblem
+	for _, seg := range s.segments {
+		if seg.nested {
+			continue
+		}
+		text := strings.Join(s.files[seg.file][seg.start:seg.end+1], "\n")
+		c := Cmd("nix-instantiate", "--parse", "-E", text)
+		c.ReadOnly = true
+		out, err := r.Run(c)
+		if err == nil {
+			continue
+		}
+		if missing := missingTool(err, "nix-instantiate"); missing != nil {
+			return []CheckProblem{*missing}
+		}
+		p := CheckProblem{Step: "parse", Module: seg.module, Message: nixErrorMessage(string(out), "")}
+		if line := nixErrorLine(string(out)); line > 0 {
+			if mod, modLine := s.locate(seg.file, seg.start+line-1); mod != "" {
+				p.Module, p.Line = mod, modLine
+			}
+		}
+		problems = append(problems, p)
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	c := Cmd("nix-instantiate", "--parse", s.path)
+	c.ReadOnly = true
+	if out, err := r.Run(c); err != nil {
+		if missing := missingTool(err, "nix-instantiate"); missing != nil {
+			return []CheckProblem{*missing}
+		}
+		p := CheckProblem{Step: "parse", Message: nixErrorMessage(string(out), "")}
+		if line := nixErrorLine(string(out)); line > 0 {
+			p.Module, p.Line = s.locate(FlakeDirFile, line-1)
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// evaluate copies the flake with the files it references to a temporary
+// directory and runs nix flake check and the drvPath of every host there
+func (s *flakeSource) evaluate(r Runner, drvPaths map[string]string) []CheckProblem {
+	tmp, err := os.MkdirTemp("", "lego-check-")
+	if err != nil {
+		return []CheckProblem{{Step: "flake check", Message: err.Error()}}
+	}
+	defer os.RemoveAll(tmp)
+	if err := s.stage(tmp); err != nil {
+		return []CheckProblem{{Step: "flake check", Message: fmt.Sprintf("erro ao copiar a flake: %v", err)}}
+	}
+	ref := "path:" + tmp
+
+	// The store path of the copy tells our files apart from nixpkgs' in traces
+	meta := Cmd("nix", "flake", "metadata", "--json", ref)
+	meta.ReadOnly = true
+	out, err := r.Run(meta)
+	if err != nil {
+		if missing := missingTool(err, "nix"); missing != nil {
+			return []CheckProblem{*missing}
+		}
+		return []CheckProblem{s.evalProblem("flake check", string(out), "")}
+	}
+	var info struct {
+		Path string `json:"path"`
+	}
+	json.Unmarshal(out, &info)
+
+	check := Cmd("nix", "flake", "check", "--no-build", ref)
+	check.ReadOnly = true
+	if out, err := r.Run(check); err != nil {
+		return []CheckProblem{s.evalProblem("flake check", string(out), info.Path)}
+	}
+
+	var problems []CheckProblem
+	for _, host := range s.hosts {
+		name := strings.Trim(host, `"`)
+		eval := Cmd("nix", "eval", "--raw", ref+"#nixosConfigurations."+host+".config.system.build.toplevel.drvPath")
+		eval.ReadOnly = true
+		out, err := r.Run(eval)
+		if err != nil {
+			problems = append(problems, s.evalProblem("eval "+name, string(out), info.Path))
+			continue
+		}
+		drvPaths[name] = strings.TrimSpace(string(out))
+	}
+	return problems
+}
+
+// stage writes the flake as <dir>/flake.nix next to what it references:
+// hardware-configuration.nix, disko.nix, flake.lock, secrets/, the per-host
+// files under hosts/ and lego/
+func (s *flakeSource) stage(dir string) error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, FlakeDirFile), data, 0644); err != nil {
+		return err
+	}
+	for _, name := range []string{"hardware-configuration.nix", "disko.nix", "flake.lock"} {
+		data, err := os.ReadFile(filepath.Join(s.root, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	for _, sub := range []string{SecretsDir, HostsDir} {
+		if err := copyModuleTree(filepath.Join(s.root, sub), filepath.Join(dir, sub)); err != nil {
+			return err
+		}
+	}
+	if s.dir {
+		return copyModuleTree(filepath.Join(filepath.Dir(s.path), "lego"), filepath.Join(dir, "lego"))
+	}
+	return nil
+}
+
+// evalProblem builds a problem from nix output, attributing it to the first
+// position inside the flake copy (storePath) that maps to a module
+func (s *flakeSource) evalProblem(step, out, storePath string) CheckProblem {
+	p := CheckProblem{Step: step, Message: nixErrorMessage(out, storePath)}
+	if storePath == "" {
+		return p
+	}
+	for _, m := range storePathRe.FindAllStringSubmatch(out, -1) {
+		if m[1] != storePath {
+			continue
+		}
+		line, _ := strconv.Atoi(m[3])
+		if line == 0 {
+			if _, ok := s.files[m[2]]; ok && m[2] != FlakeDirFile {
+				p.Module, _ = s.locate(m[2], 0)
+				return p
+			}
+			continue
+		}
+		if mod, modLine := s.locate(m[2], line-1); mod != "" {
+			p.Module, p.Line = mod, modLine
+			return p
+		}
+	}
+	return p
+}
+
+// missingTool turns "executable not found" into a problem, nil for other errors
+func missingTool(err error, name string) *CheckProblem {
+	if !errors.Is(err, exec.ErrNotFound) {
+		return nil
+	}
+	return &CheckProblem{Step: "parse", Message: fmt.Sprintf("%s não encontrado: a avaliação precisa do Nix instalado", name)}
+}
+
+// nixErrorLine returns the line of the first position in a nix error, 0 if none
+func nixErrorLine(out string) int {
+	m := nixPositionRe.FindStringSubmatch(out)
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// nixErrorMessage keeps the innermost "error:" of nix output and the lines
+// right after it, with the flake's store path stripped
+func nixErrorMessage(out, storePath string) string {
+	if storePath != "" {
+		out = strings.ReplaceAll(out, storePath+"/", "")
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	start := -1
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "error:") {
+			start = i
+		}
+	}
+	if start < 0 {
+		if len(lines) == 0 || lines[0] == "" {
+			return "falhou sem mensagem"
+		}
+		return strings.TrimSpace(lines[len(lines)-1])
+	}
+	var msg []string
+	if first := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[start]), "error:")); first != "" {
+		msg = append(msg, first)
+	}
+	for _, l := range lines[start+1:] {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			if len(msg) > 0 {
+				break
+			}
+			continue
+		}
+		if len(msg) == 4 {
+			break
+		}
+		msg = append(msg, l)
+	}
+	return strings.Join(msg, "\n")
+}
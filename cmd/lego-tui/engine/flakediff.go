@@ -0,0 +1,436 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FlakeSnapshot is the module-level view of a generated flake
+type FlakeSnapshot struct {
+	Inputs map[string]string // input attribute (e.g. zen-browser.url) → value
+	Hosts  map[string]*HostSnapshot
+}
+
+// HostSnapshot is one nixosConfigurations entry of a generated flake
+type HostSnapshot struct {
+	Settings map[string]string // identity/preset assignments, keyed by attribute path
+	Modules  map[string]string // module name → body
+	Order    []string          // module names in flake order
+}
+
+var (
+	hostStartRe     = regexp.MustCompile(`^\s*nixosConfigurations\.("?[^"\s]+"?) = `)
+	moduleCommentRe = regexp.MustCompile(`^\s*# ── (.+?) ── `)
+	moduleImportRe  = regexp.MustCompile(`^\s*(\./lego/\S+\.nix)\s*$`)
+	assignmentRe    = regexp.MustCompile(`^([^=#]+?)\s*=\s*(.*?);?$`)
+)
+
+// ParseGeneratedFlake reads a flake produced by BuildFlake, BuildFlakeDir or
+// BuildMultiHostFlake. Directory flakes have their lego/ imports resolved.
+func ParseGeneratedFlake(path string) (*FlakeSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler flake: %w", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	snap := &FlakeSnapshot{Inputs: map[string]string{}, Hosts: map[string]*HostSnapshot{}}
+
+	// inputs = { ... };
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "inputs = {" {
+			continue
+		}
+		for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "};"; i++ {
+			if m := assignmentRe.FindStringSubmatch(strings.TrimSpace(lines[i])); m != nil {
+				snap.Inputs[m[1]] = m[2]
+			}
+		}
+		break
+	}
+
+	// Split the outputs into one section per host
+	var starts []int
+	var names []string
+	for i, line := range lines {
+		if m := hostStartRe.FindStringSubmatch(line); m != nil {
+			starts = append(starts, i)
+			names = append(names, strings.Trim(m[1], `"`))
+		}
+	}
+	for n, start := range starts {
+		end := len(lines)
+		if n+1 < len(starts) {
+			end = starts[n+1]
+		}
+		host, err := parseHostSection(filepath.Dir(path), lines[start+1:end])
+		if err != nil {
+			return nil, err
+		}
+		snap.Hosts[names[n]] = host
+	}
+	return snap, nil
+}
+
+func parseHostSection(flakeDir string, lines []string) (*HostSnapshot, error) {
+	host := &HostSnapshot{Settings: map[string]string{}, Modules: map[string]string{}}
+
+	// Identity block: everything before the LEGO MODULES marker
+	var stack []string
+	i := 0
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "# LEGO MODULES" {
+			break
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "}") {
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		m := assignmentRe.FindStringSubmatch(trimmed)
+		if m == nil {
+			continue
+		}
+		if m[2] == "{" {
+			stack = append(stack, m[1])
+			continue
+		}
+		if m[2] == "[" {
+			continue // modules = [ ... ] opens the module list
+		}
+		host.Settings[strings.Join(append(append([]string{}, stack...), m[1]), ".")] = m[2]
+	}
+
+	// Module section: inline wrappers or ./lego/ imports
+	for ; i < len(lines); i++ {
+		if m := moduleImportRe.FindStringSubmatch(lines[i]); m != nil {
+			data, err := os.ReadFile(filepath.Join(flakeDir, filepath.FromSlash(m[1])))
+			if err != nil {
+				return nil, fmt.Errorf("erro ao ler módulo importado: %w", err)
+			}
+			name, body, _ := parseWrappedModule(strings.Split(string(data), "\n"), 0)
+			host.add(name, body)
+			continue
+		}
+		if moduleCommentRe.MatchString(lines[i]) {
+			name, body, next := parseWrappedModule(lines, i)
+			host.add(name, body)
+			i = next
+		}
+	}
+	return host, nil
+}
+
+func (h *HostSnapshot) add(name, body string) {
+	if name == "" {
+		return
+	}
+	if _, dup := h.Modules[name]; !dup {
+		h.Order = append(h.Order, name)
+	}
+	h.Modules[name] = body
+}
+
+// parseWrappedModule reads "# ── name ── purpose" + "({ ... }: {" + body + "})"
+// starting at or after line start and returns the dedented body and the
+// index of the closing line.
+func parseWrappedModule(lines []string, start int) (string, string, int) {
+	i := start
+	for ; i < len(lines); i++ {
+		if moduleCommentRe.MatchString(lines[i]) {
+			break
+		}
+	}
+	if i >= len(lines) {
+		return "", "", len(lines)
+	}
+	name := moduleCommentRe.FindStringSubmatch(lines[i])[1]
+	indent := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " "))]
+	closing := indent + "})"
+	bodyIndent := indent + "  "
+
+	var body []string
+	j := i + 2 // skip the function header line
+	for ; j < len(lines) && lines[j] != closing; j++ {
+		body = append(body, strings.TrimPrefix(lines[j], bodyIndent))
+	}
+	return name, strings.Join(body, "\n"), j
+}
+
+// FieldChange is an added, removed or modified key/value pair
+type FieldChange struct {
+	Key string
+	Old string // empty when added
+	New string // empty when removed
+}
+
+// ModuleChange is a module whose body differs between two flakes
+type ModuleChange struct {
+	Name string
+	Diff []DiffLine
+}
+
+// HostDiff groups the changes of one nixosConfigurations entry
+type HostDiff struct {
+	Host     string
+	Status   string // "", "adicionado" or "removido"
+	Added    []string
+	Removed  []string
+	Settings []FieldChange
+	Changed  []ModuleChange
+}
+
+// FlakeDiff is the module-granular difference between two generated flakes
+type FlakeDiff struct {
+	Inputs []FieldChange
+	Hosts  []HostDiff
+}
+
+// Empty reports whether both flakes are equivalent
+func (d FlakeDiff) Empty() bool {
+	if len(d.Inputs) > 0 {
+		return false
+	}
+	for _, h := range d.Hosts {
+		if h.Status != "" || len(h.Added)+len(h.Removed)+len(h.Settings)+len(h.Changed) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// DiffFlakes compares two snapshots at module granularity
+func DiffFlakes(a, b *FlakeSnapshot) FlakeDiff {
+	var d FlakeDiff
+	d.Inputs = diffFields(a.Inputs, b.Inputs)
+
+	for _, name := range unionKeys(a.Hosts, b.Hosts) {
+		ha, hb := a.Hosts[name], b.Hosts[name]
+		hd := HostDiff{Host: name}
+		switch {
+		case ha == nil:
+			hd.Status = "adicionado"
+			hd.Added = hb.Order
+		case hb == nil:
+			hd.Status = "removido"
+			hd.Removed = ha.Order
+		default:
+			hd.Settings = diffFields(ha.Settings, hb.Settings)
+			for _, mod := range hb.Order {
+				if _, ok := ha.Modules[mod]; !ok {
+					hd.Added = append(hd.Added, mod)
+				}
+			}
+			for _, mod := range ha.Order {
+				bodyB, ok := hb.Modules[mod]
+				if !ok {
+					hd.Removed = append(hd.Removed, mod)
+					continue
+				}
+				if bodyA := ha.Modules[mod]; bodyA != bodyB {
+					hd.Changed = append(hd.Changed, ModuleChange{Name: mod, Diff: UnifiedDiff(bodyA, bodyB, 3)})
+				}
+			}
+		}
+		d.Hosts = append(d.Hosts, hd)
+	}
+	return d
+}
+
+func diffFields(a, b map[string]string) []FieldChange {
+	var changes []FieldChange
+	for _, k := range unionKeys(a, b) {
+		va, okA := a[k]
+		vb, okB := b[k]
+		if okA && okB && va == vb {
+			continue
+		}
+		changes = append(changes, FieldChange{Key: k, Old: va, New: vb})
+	}
+	return changes
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]V{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DiffLine is one rendered line of a diff. Kind is ' ' (context), '+', '-',
+// '@' (hunk header) or '#' (section header).
+type DiffLine struct {
+	Kind byte
+	Text string
+}
+
+// UnifiedDiff returns a line diff of a and b with the given context size
+func UnifiedDiff(a, b string, context int) []DiffLine {
+	la, lb := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(la)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(lb)+1)
+	}
+	for i := len(la) - 1; i >= 0; i-- {
+		for j := len(lb) - 1; j >= 0; j-- {
+			if la[i] == lb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Full edit script with line numbers in a (1-based) and b
+	type edit struct {
+		kind   byte
+		text   string
+		ai, bi int
+	}
+	var script []edit
+	i, j := 0, 0
+	for i < len(la) || j < len(lb) {
+		switch {
+		case i < len(la) && j < len(lb) && la[i] == lb[j]:
+			script = append(script, edit{' ', la[i], i, j})
+			i++
+			j++
+		case j < len(lb) && (i >= len(la) || lcs[i][j+1] >= lcs[i+1][j]):
+			script = append(script, edit{'+', lb[j], i, j})
+			j++
+		default:
+			script = append(script, edit{'-', la[i], i, j})
+			i++
+		}
+	}
+
+	// Group changes into hunks with surrounding context
+	var out []DiffLine
+	for k := 0; k < len(script); {
+		if script[k].kind == ' ' {
+			k++
+			continue
+		}
+		start := max(k-context, 0)
+		end := k
+		for end < len(script) {
+			if script[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].kind == ' ' {
+				run++
+			}
+			if run-end > 2*context || run == len(script) {
+				end = min(end+context, len(script))
+				break
+			}
+			end = run
+		}
+
+		var countA, countB int
+		for _, e := range script[start:end] {
+			if e.kind != '+' {
+				countA++
+			}
+			if e.kind != '-' {
+				countB++
+			}
+		}
+		out = append(out, DiffLine{'@', fmt.Sprintf("@@ -%d,%d +%d,%d @@",
+			script[start].ai+1, countA, script[start].bi+1, countB)})
+		for _, e := range script[start:end] {
+			out = append(out, DiffLine{e.kind, e.text})
+		}
+		k = end
+	}
+	return out
+}
+
+// Lines renders the whole diff for display, one DiffLine per output line
+func (d FlakeDiff) Lines() []DiffLine {
+	var out []DiffLine
+	if len(d.Inputs) > 0 {
+		out = append(out, DiffLine{'#', "inputs"})
+		out = append(out, fieldLines(d.Inputs)...)
+	}
+	for _, h := range d.Hosts {
+		header := "host " + h.Host
+		if h.Status != "" {
+			header += " (" + h.Status + ")"
+		}
+		if h.Status == "" && len(h.Added)+len(h.Removed)+len(h.Settings)+len(h.Changed) == 0 {
+			continue
+		}
+		out = append(out, DiffLine{'#', header})
+		if len(h.Settings) > 0 {
+			out = append(out, DiffLine{'#', "  preset"})
+			out = append(out, fieldLines(h.Settings)...)
+		}
+		for _, mod := range h.Added {
+			out = append(out, DiffLine{'+', "módulo adicionado: " + mod})
+		}
+		for _, mod := range h.Removed {
+			out = append(out, DiffLine{'-', "módulo removido: " + mod})
+		}
+		for _, c := range h.Changed {
+			out = append(out, DiffLine{'#', "  módulo alterado: " + c.Name})
+			out = append(out, c.Diff...)
+		}
+	}
+	return out
+}
+
+func fieldLines(changes []FieldChange) []DiffLine {
+	var out []DiffLine
+	for _, c := range changes {
+		if c.Old != "" {
+			out = append(out, DiffLine{'-', c.Key + " = " + c.Old})
+		}
+		if c.New != "" {
+			out = append(out, DiffLine{'+', c.Key + " = " + c.New})
+		}
+	}
+	return out
+}
+
+// String renders a DiffLine in plain unified-diff form
+func (l DiffLine) String() string {
+	switch l.Kind {
+	case '@', '#':
+		return l.Text
+	}
+	return string(l.Kind) + l.Text
+}
+
+// DiffFlakeFiles parses and compares two generated flakes, old first
+func DiffFlakeFiles(oldPath, newPath string) (FlakeDiff, error) {
+	a, err := ParseGeneratedFlake(oldPath)
+	if err != nil {
+		return FlakeDiff{}, err
+	}
+	b, err := ParseGeneratedFlake(newPath)
+	if err != nil {
+		return FlakeDiff{}, err
+	}
+	return DiffFlakes(a, b), nil
+}
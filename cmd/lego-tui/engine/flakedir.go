@@ -0,0 +1,226 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FlakeDirFile is the entry point of a flake generated as a directory
+const FlakeDirFile = "flake.nix"
+
+// HostsDir holds the machine-specific files of each host of a multi-host
+// flake: hosts/<host_name>/hardware-configuration.nix and disko.nix
+const HostsDir = "hosts"
+
+// moduleVariant is one distinct rendering of a module across hosts.
+// Modules using host placeholders (e.g. {{USER_NAME}}) may differ per host.
+type moduleVariant struct {
+	content string
+	hosts   []string
+	file    string // path relative to the flake directory
+}
+
+// hostSelection pairs a preset with the modules its host imports
+type hostSelection struct {
+	preset  *Preset
+	modules []string
+}
+
+// BuildFlakeDir generates flakes/<preset>-<suffix>/ with flake.nix importing
+// one wrapped file per module under lego/<category>/<name>.nix, so Nix
+// traces and diffs point at the originating module.
+func BuildFlakeDir(root string, preset *Preset, modules []string, customName string) (string, error) {
+	suffix := customName
+	if suffix == "" {
+		suffix = time.Now().Format("20060102-150405")
+	}
+	name := fmt.Sprintf("%s-%s", preset.Host.PresetName, suffix)
+	return buildFlakeDir(root, []hostSelection{{preset, modules}}, preset.Host.PresetName, name, false)
+}
+
+// BuildMultiHostFlake generates flakes/<name>/ with one nixosConfigurations
+// entry per preset. Inputs and devShells are shared, and module bodies that
+// render identically for several hosts are written once under lego/. Each
+// host imports its own hardware and disk layout from HostFilesDir.
+// Each preset's active modules are updated; the caller saves the presets.
+func BuildMultiHostFlake(root string, presets []*Preset, customName string) (string, error) {
+	if len(presets) == 0 {
+		return "", fmt.Errorf("nenhum preset selecionado")
+	}
+	var hosts []hostSelection
+	var names []string
+	for _, p := range presets {
+		hosts = append(hosts, hostSelection{p, p.Modules.Active})
+		names = append(names, p.Host.PresetName)
+	}
+	name := customName
+	if name == "" {
+		name = "hosts-" + time.Now().Format("20060102-150405")
+	}
+	return buildFlakeDir(root, hosts, strings.Join(names, " + "), name, true)
+}
+
+// HostFilesDir is where a host of a multi-host flake finds its
+// hardware-configuration.nix and disko.nix, relative to the project root
+func HostFilesDir(hostName string) string {
+	return HostsDir + "/" + hostName
+}
+
+// buildFlakeDir writes flakes/<name>/flake.nix and the lego/ module tree.
+// With perHost, each host imports its machine files from HostFilesDir
+// instead of the project root.
+func buildFlakeDir(root string, hosts []hostSelection, title, name string, perHost bool) (string, error) {
+	seenHosts := map[string]bool{}
+	for _, h := range hosts {
+		if seenHosts[h.preset.Host.HostName] {
+			return "", fmt.Errorf("host_name duplicado entre presets: %s", h.preset.Host.HostName)
+		}
+		seenHosts[h.preset.Host.HostName] = true
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("nome de flake inválido: %s", name)
+	}
+	outDir := filepath.Join(root, "flakes", name)
+	if _, err := os.Stat(outDir); err == nil {
+		return "", fmt.Errorf("flakes/%s já existe: escolha outro nome ou apague a flake antiga", name)
+	}
+
+	ctx, err := loadFlakeContext(root)
+	if err != nil {
+		return "", err
+	}
+
+	// Render every module per host and group identical renderings
+	variants := map[string][]*moduleVariant{}
+	hostModules := make([][]*moduleVariant, len(hosts))
+	resolved := make([][]string, len(hosts))
+	hostSecrets := make([]string, len(hosts))
+	hostStorage := make([]string, len(hosts))
+	hostHome := make([][]homeUser, len(hosts))
+	homeModules := make([][][]*moduleVariant, len(hosts)) // host, user, module
+	var order []string
+	addVariant := func(key, content, host string) *moduleVariant {
+		for _, v := range variants[key] {
+			if v.content == content {
+				v.hosts = append(v.hosts, host)
+				return v
+			}
+		}
+		if len(variants[key]) == 0 {
+			order = append(order, key)
+		}
+		v := &moduleVariant{content: content, hosts: []string{host}}
+		variants[key] = append(variants[key], v)
+		return v
+	}
+	for i, h := range hosts {
+		p := h.preset
+		rels, loaded, err := ctx.loadHostModules(p, h.modules)
+		if err != nil {
+			return "", fmt.Errorf("preset '%s': %w", p.Host.PresetName, err)
+		}
+		resolved[i] = rels
+		for j, mod := range loaded {
+			rel := rels[j]
+			origin := fmt.Sprintf("# origem: modules/%s.nix (corpo a partir da linha %d)\n", rel, mod.BodyLine)
+			content := origin + applyPreset(ctx.wrapModule(mod, ""), p)
+			hostModules[i] = append(hostModules[i], addVariant(rel, content, p.Host.HostName))
+		}
+		hostSecrets[i] = ctx.secretsEntries(loaded)
+		if hostStorage[i], err = ctx.storageEntries(p); err != nil {
+			return "", fmt.Errorf("preset '%s': %w", p.Host.PresetName, err)
+		}
+
+		// Home modules go to lego/home/<user>/<name>.nix
+		users, err := ctx.loadHomeModules(p)
+		if err != nil {
+			return "", fmt.Errorf("preset '%s': %w", p.Host.PresetName, err)
+		}
+		hostHome[i] = users
+		for _, u := range users {
+			var userModules []*moduleVariant
+			for j, mod := range u.modules {
+				rel := u.rels[j]
+				origin := fmt.Sprintf("# origem: modules/%s.nix (corpo a partir da linha %d)\n", rel, mod.BodyLine)
+				content := origin + applyPreset(ctx.wrapModule(mod, ""), p)
+				key := HomeCategory + "/" + u.name + "/" + strings.TrimPrefix(rel, HomeCategory+"/")
+				userModules = append(userModules, addVariant(key, content, p.Host.HostName))
+			}
+			homeModules[i] = append(homeModules[i], userModules)
+		}
+	}
+
+	// Shared modules keep their plain name; per-host variants get a suffix
+	for _, rel := range order {
+		for _, v := range variants[rel] {
+			v.file = "lego/" + rel + ".nix"
+			if len(variants[rel]) > 1 {
+				v.file = "lego/" + rel + "." + v.hosts[0] + ".nix"
+			}
+		}
+	}
+
+	// Render one host block per preset, importing the module files
+	var blocks []string
+	for i, h := range hosts {
+		var entries strings.Builder
+		entries.WriteString("\n")
+		for _, v := range hostModules[i] {
+			entries.WriteString(ctx.moduleIndent + "./" + v.file + "\n")
+		}
+		entries.WriteString(hostSecrets[i])
+		entries.WriteString(encryptionEntries(h.preset.Encryption, ctx.moduleIndent))
+		entries.WriteString(hostStorage[i])
+		var homeImports []string
+		for _, userModules := range homeModules[i] {
+			var imports strings.Builder
+			for _, v := range userModules {
+				imports.WriteString(ctx.homeIndent() + "./" + v.file + "\n")
+			}
+			homeImports = append(homeImports, imports.String())
+		}
+		entries.WriteString(ctx.homeManagerEntries(h.preset, hostHome[i], homeImports))
+		filesDir := "."
+		if perHost {
+			filesDir = "./" + HostFilesDir(h.preset.Host.HostName)
+		}
+		blocks = append(blocks, ctx.hostBlock(h.preset, filesDir, entries.String()))
+	}
+	flake := ctx.render(title, blocks)
+
+	// Save into a fresh directory; never write over an existing flake
+	if err := os.MkdirAll(filepath.Dir(outDir), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		if os.IsExist(err) {
+			return "", fmt.Errorf("flakes/%s já existe: escolha outro nome ou apague a flake antiga", name)
+		}
+		return "", err
+	}
+	for _, rel := range order {
+		for _, v := range variants[rel] {
+			path := filepath.Join(outDir, filepath.FromSlash(v.file))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return "", err
+			}
+			if err := os.WriteFile(path, []byte(v.content), 0644); err != nil {
+				return "", err
+			}
+		}
+	}
+	outPath := filepath.Join(outDir, FlakeDirFile)
+	if err := os.WriteFile(outPath, []byte(flake), 0644); err != nil {
+		return "", err
+	}
+
+	// Update presets
+	for i, h := range hosts {
+		h.preset.Modules.Active = resolved[i]
+		h.preset.Metadata.LastAppliedFlake = name + "/" + FlakeDirFile
+	}
+	return outPath, nil
+}
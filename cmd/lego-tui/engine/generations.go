@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSystemProfile is the NixOS system profile; its generations are the
+// system-<N>-link symlinks next to it
+const DefaultSystemProfile = "/nix/var/nix/profiles/system"
+
+// generationsFile records which flake and preset produced each generation
+const generationsFile = "generations.json"
+
+// SystemProfile returns the system profile: $LEGO_SYSTEM_PROFILE, or
+// DefaultSystemProfile
+func SystemProfile() string {
+	if p := os.Getenv("LEGO_SYSTEM_PROFILE"); p != "" {
+		return p
+	}
+	return DefaultSystemProfile
+}
+
+// GenerationRecord is written when Aplicar creates a generation
+type GenerationRecord struct {
+	Generation int    `json:"generation"`
+	StorePath  string `json:"store_path"`
+	Flake      string `json:"flake"` // relative to flakes/
+	Preset     string `json:"preset,omitempty"`
+	Host       string `json:"host"`
+	Action     string `json:"action"`
+	AppliedAt  string `json:"applied_at"`
+}
+
+// Generation is one system-<N>-link of the system profile
+type Generation struct {
+	Number    int
+	Link      string // .../system-<N>-link
+	StorePath string // resolved toplevel
+	Created   time.Time
+	Current   bool // the profile points at it
+	Booted    bool // /run/booted-system points at it
+	Version   string
+	Kernel    string
+	Record    *GenerationRecord // nil when it was not applied by lego-tui
+}
+
+// Label is the host and version part of the toplevel name
+// (nixos-system-<host>-<version>)
+func (g Generation) Label() string {
+	name := filepath.Base(g.StorePath)
+	if i := strings.Index(name, "-nixos-system-"); i >= 0 {
+		return name[i+len("-nixos-system-"):]
+	}
+	return name
+}
+
+// ListGenerations returns the generations of profile, newest first, with
+// the records of the project at root attached
+func ListGenerations(root, profile string) ([]Generation, error) {
+	entries, err := os.ReadDir(filepath.Dir(profile))
+	if err != nil {
+		return nil, fmt.Errorf("erro lendo perfis do sistema: %w", err)
+	}
+	current, _ := os.Readlink(profile)
+	booted, _ := filepath.EvalSymlinks("/run/booted-system")
+	records, err := loadGenerationRecords(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var gens []Generation
+	for _, e := range entries {
+		name := e.Name()
+		n := generationNumber(profile, name)
+		if n == 0 {
+			continue
+		}
+		link := filepath.Join(filepath.Dir(profile), name)
+		g := Generation{Number: n, Link: link, Current: filepath.Base(current) == name}
+		if target, err := os.Readlink(link); err == nil {
+			g.StorePath = target
+		}
+		if info, err := os.Lstat(link); err == nil {
+			g.Created = info.ModTime()
+		}
+		if resolved, err := filepath.EvalSymlinks(link); err == nil {
+			g.Booted = resolved == booted
+			g.Version = readTrimmed(filepath.Join(resolved, "nixos-version"))
+			g.Kernel = kernelVersion(resolved)
+		}
+		g.Record = matchRecord(records, g)
+		gens = append(gens, g)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].Number > gens[j].Number })
+	return gens, nil
+}
+
+// generationNumber parses <profile>-<N>-link, returning 0 for other names
+func generationNumber(profile, name string) int {
+	rest, ok := strings.CutPrefix(name, filepath.Base(profile)+"-")
+	if !ok {
+		return 0
+	}
+	rest, ok = strings.CutSuffix(rest, "-link")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(rest)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// matchRecord finds the record of g by store path, falling back to the
+// generation number when the toplevel is unknown
+func matchRecord(records []GenerationRecord, g Generation) *GenerationRecord {
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if r.StorePath != "" && r.StorePath == g.StorePath || r.StorePath == "" && r.Generation == g.Number {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// kernelVersion reads the module directory name of the generation's kernel
+func kernelVersion(toplevel string) string {
+	dirs, err := os.ReadDir(filepath.Join(toplevel, "kernel-modules", "lib", "modules"))
+	if err != nil || len(dirs) == 0 {
+		return ""
+	}
+	return dirs[0].Name()
+}
+
+func generationsPath(root string) string {
+	return filepath.Join(root, "flakes", generationsFile)
+}
+
+func loadGenerationRecords(root string) ([]GenerationRecord, error) {
+	data, err := os.ReadFile(generationsPath(root))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []GenerationRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("erro lendo %s: %w", generationsFile, err)
+	}
+	return records, nil
+}
+
+// RecordGeneration notes that the current generation of profile was
+// produced by flakePath. Only switch and boot create generations, and a
+// dry run changes nothing, so both are skipped.
+func RecordGeneration(r Runner, root, profile, flakePath, preset, host string, rc RebuildConfig) error {
+	if r.DryRun() {
+		return nil
+	}
+	if a := rc.ActionName(); a != "switch" && a != "boot" {
+		return nil
+	}
+	link, err := os.Readlink(profile)
+	if err != nil {
+		return fmt.Errorf("erro lendo o perfil do sistema: %w", err)
+	}
+	n := generationNumber(profile, filepath.Base(link))
+	if n == 0 {
+		return fmt.Errorf("perfil do sistema aponta para %s, não para uma geração", link)
+	}
+	target, _ := os.Readlink(filepath.Join(filepath.Dir(profile), filepath.Base(link)))
+
+	rel, err := filepath.Rel(filepath.Join(root, "flakes"), flakePath)
+	if err != nil {
+		rel = flakePath
+	}
+	records, err := loadGenerationRecords(root)
+	if err != nil {
+		return err
+	}
+	records = append(records, GenerationRecord{
+		Generation: n,
+		StorePath:  target,
+		Flake:      rel,
+		Preset:     preset,
+		Host:       host,
+		Action:     rc.ActionName(),
+		AppliedAt:  time.Now().UTC().Format(time.RFC3339),
+	})
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(generationsPath(root), append(data, '\n'), 0644)
+}
+
+// DiffClosures compares the closures of two generations
+func DiffClosures(r Runner, older, newer Generation) (string, error) {
+	c := Cmd("nix", "store", "diff-closures", older.Link, newer.Link)
+	c.ReadOnly = true
+	out, err := r.Run(c)
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("nix não encontrado: o diff de closures precisa do Nix instalado")
+	}
+	if err != nil {
+		return "", fmt.Errorf("nix store diff-closures: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// RollbackCommand makes g the default generation of profile and activates it
+func RollbackCommand(profile string, g Generation) Command {
+	script := fmt.Sprintf("nix-env -p %s --switch-generation %d && %s/bin/switch-to-configuration switch",
+		shellQuote(profile), g.Number, shellQuote(profile))
+	return Cmd("sudo", "sh", "-c", script)
+}
+
+// ActivateCommand activates g without changing the default boot entry
+func ActivateCommand(g Generation) Command {
+	return Cmd("sudo", filepath.Join(g.Link, "bin", "switch-to-configuration"), "test")
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordGenerationSkipsDryRun(t *testing.T) {
+	root := t.TempDir()
+	profiles := t.TempDir()
+	profile := filepath.Join(profiles, "system")
+	if err := os.Symlink("/nix/store/abc-nixos-system", filepath.Join(profiles, "system-7-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("system-7-link", profile); err != nil {
+		t.Fatal(err)
+	}
+	flake := filepath.Join(root, "flakes", "vm-1.nix")
+	writeFile(t, flake, "{ }\n")
+
+	if err := RecordGeneration(NewDryRunner(nil), root, profile, flake, "vm", "vm", RebuildConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(generationsPath(root)); !os.IsNotExist(err) {
+		t.Fatalf("dry run wrote %s (err %v)", generationsFile, err)
+	}
+
+	if err := RecordGeneration(ExecRunner{}, root, profile, flake, "vm", "vm", RebuildConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := loadGenerationRecords(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Generation != 7 || records[0].Flake != "vm-1.nix" {
+		t.Errorf("records = %+v", records)
+	}
+}
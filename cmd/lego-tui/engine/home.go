@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HomeCategory holds Home Manager modules. They are chosen per user
+// ([[users]] home = [...]) instead of in the host's module selection.
+const HomeCategory = "home"
+
+// homeManagerURL is the flake input added when a user has home modules
+const homeManagerURL = "github:nix-community/home-manager"
+
+// IsHomeModule reports whether rel (category/name) is a Home Manager module
+func IsHomeModule(rel string) bool {
+	return strings.HasPrefix(rel, HomeCategory+"/")
+}
+
+// SystemModules lists the modules a host can select (all but home)
+func SystemModules(root string) []ModuleInfo {
+	var mods []ModuleInfo
+	for _, m := range ListModules(root) {
+		if m.Category != HomeCategory {
+			mods = append(mods, m)
+		}
+	}
+	return mods
+}
+
+// HomeModules lists modules/home
+func HomeModules(root string) []ModuleInfo {
+	var mods []ModuleInfo
+	for _, m := range ListModules(root) {
+		if m.Category == HomeCategory {
+			mods = append(mods, m)
+		}
+	}
+	return mods
+}
+
+// homeUser is a user's Home Manager modules, loaded with that user's values
+type homeUser struct {
+	name    string
+	rels    []string
+	modules []*Module
+}
+
+// loadHomeModules parses the home modules of every user of the preset.
+// User params override the preset's, and {{USER_NAME}} and
+// {{USER_DESCRIPTION}} refer to the user the module is installed for.
+func (c *flakeContext) loadHomeModules(preset *Preset) ([]homeUser, error) {
+	var users []homeUser
+	for _, u := range preset.Users {
+		if len(u.Home) == 0 {
+			continue
+		}
+		hu := homeUser{name: u.Name}
+		for _, rel := range u.Home {
+			if !IsHomeModule(rel) {
+				return nil, fmt.Errorf("usuário '%s': '%s' não é um módulo %s/", u.Name, rel, HomeCategory)
+			}
+			mod, err := LoadModule(filepath.Join(c.root, "modules", rel+".nix"))
+			if err != nil {
+				return nil, fmt.Errorf("usuário '%s': módulo '%s' inválido: %w", u.Name, rel, err)
+			}
+			values := map[string]any{}
+			for k, v := range preset.Params[rel] {
+				values[k] = v
+			}
+			for k, v := range u.Params[rel] {
+				values[k] = v
+			}
+			if len(values) == 0 {
+				values = nil
+			}
+			if err := substituteParams(rel, mod, values); err != nil {
+				return nil, fmt.Errorf("usuário '%s': %w", u.Name, err)
+			}
+			mod.Body = strings.ReplaceAll(mod.Body, "{{USER_NAME}}", u.Name)
+			mod.Body = strings.ReplaceAll(mod.Body, "{{USER_DESCRIPTION}}", u.Description)
+			hu.rels = append(hu.rels, rel)
+			hu.modules = append(hu.modules, mod)
+		}
+		users = append(users, hu)
+	}
+	if len(users) > 0 {
+		c.requireInput("home-manager", homeManagerURL)
+	}
+	return users, nil
+}
+
+// homeManagerEntries renders the Home Manager NixOS module and one
+// home-manager.users block per user. imports[i] holds the already indented
+// entries of users[i]'s imports list (wrapped modules or ./lego paths).
+func (c *flakeContext) homeManagerEntries(preset *Preset, users []homeUser, imports []string) string {
+	if len(users) == 0 {
+		return ""
+	}
+	in := c.moduleIndent
+	var sb strings.Builder
+	sb.WriteString("\n")
+	sb.WriteString(in + "home-manager.nixosModules.home-manager\n")
+	sb.WriteString(in + "# ── home-manager ── Módulos Home Manager por usuário (modules/home)\n")
+	sb.WriteString(in + "({ ... }: {\n")
+	sb.WriteString(in + "  home-manager.useGlobalPkgs = true;\n")
+	sb.WriteString(in + "  home-manager.useUserPackages = true;\n")
+	sb.WriteString(in + "  home-manager.extraSpecialArgs = {\n")
+	sb.WriteString(in + "    inherit pkgs-master;\n")
+	for _, l := range strings.Split(c.specialArgs, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			sb.WriteString(in + "    " + l + "\n")
+		}
+	}
+	sb.WriteString(in + "  };\n")
+	for i, u := range users {
+		sb.WriteString(in + "  home-manager.users." + nixString(u.name) + " = {\n")
+		sb.WriteString(in + "    home.stateVersion = " + nixString(preset.Host.StateVersion) + ";\n")
+		sb.WriteString(in + "    imports = [\n")
+		sb.WriteString(imports[i])
+		sb.WriteString(in + "    ];\n")
+		sb.WriteString(in + "  };\n")
+	}
+	sb.WriteString(in + "})\n")
+	return sb.String()
+}
+
+// homeIndent is where home modules sit inside home-manager.users.<name>.imports
+func (c *flakeContext) homeIndent() string {
+	return c.moduleIndent + "      "
+}
+
+// checkHomeModule is used by the validation to check one home entry
+func checkHomeModule(root, rel string) string {
+	if !IsHomeModule(rel) {
+		return fmt.Sprintf("'%s' não é um módulo %s/ (módulos de sistema vão em modules.active)", rel, HomeCategory)
+	}
+	path := filepath.Join(root, "modules", rel+".nix")
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Sprintf("módulo '%s' não encontrado em modules/", rel)
+	}
+	if _, err := LoadModule(path); err != nil {
+		return fmt.Sprintf("módulo '%s' inválido: %v", rel, err)
+	}
+	return ""
+}
@@ -0,0 +1,574 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ImportedModule is one module of an import: an existing module whose
+// content was found in the configuration, or a new file to write
+type ImportedModule struct {
+	RelPath string
+	Purpose string
+	Content string // whole module file; empty when Reused
+	Reused  bool
+}
+
+// ImportPlan is what PlanImport made of a configuration.nix: the modules,
+// in the order their options appeared, and a preset that selects them
+type ImportPlan struct {
+	Preset   *Preset
+	Modules  []ImportedModule
+	Warnings []string
+}
+
+// importGroups maps attribute paths to the module they are imported into.
+// The longest matching prefix wins; an empty name is taken from the path
+// segment after the prefix (services.openssh -> openssh).
+var importGroups = []struct{ prefix, name, category string }{
+	{"boot.loader", "bootloader", "system"},
+	{"boot.kernelPackages", "kernel", "system"},
+	{"boot.kernelParams", "kernel", "system"},
+	{"boot.kernelModules", "kernel", "system"},
+	{"boot.kernel", "kernel", "system"},
+	{"boot.extraModulePackages", "kernel", "system"},
+	{"boot.blacklistedKernelModules", "kernel", "system"},
+	{"boot.initrd", "initrd", "system"},
+	{"boot", "boot", "system"},
+	{"nix", "nix-settings", "system"},
+	{"nixpkgs", "nixpkgs-config", "overlays"},
+	{"fonts", "fonts", "system"},
+	{"zramSwap", "swap", "system"},
+	{"swapDevices", "swap", "system"},
+	{"systemd", "systemd", "system"},
+	{"security", "security", "system"},
+	{"documentation", "documentation", "system"},
+	{"environment.systemPackages", "system-packages", "apps"},
+	{"environment", "environment", "system"},
+	{"sound", "audio", "hardware"},
+	{"services.pipewire", "audio", "hardware"},
+	{"services.pulseaudio", "audio", "hardware"},
+	{"hardware.pulseaudio", "audio", "hardware"},
+	{"hardware", "", "hardware"},
+	{"powerManagement", "power-management", "hardware"},
+	{"services.xserver.xkb", "keyboard-layout", "hardware"},
+	{"services.xserver", "desktop", "apps"},
+	{"services.desktopManager", "desktop", "apps"},
+	{"services.displayManager", "desktop", "apps"},
+	{"services", "", "services"},
+	{"programs.steam", "steam", "services"},
+	{"programs", "", "apps"},
+	{"virtualisation", "", "services"},
+	{"networking.firewall", "firewall", "services"},
+	{"networking", "networking", "system"},
+	{"users", "users", "system"},
+	{"i18n.inputMethod", "input-method", "apps"},
+	{"i18n", "locale", "system"},
+	{"time", "locale", "system"},
+	{"console", "locale", "system"},
+	{"xdg", "xdg", "apps"},
+}
+
+// importArgs are the module arguments LEGO wrappers always provide
+var importArgs = []string{"config", "pkgs", "lib", "pkgs-master"}
+
+var camelBoundaryRe = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// importGroup returns the module name, category and grouping prefix for an
+// attribute path
+func importGroup(path []string) (name, category, prefix string) {
+	key := strings.Join(path, ".")
+	for _, g := range importGroups {
+		if key != g.prefix && !strings.HasPrefix(key, g.prefix+".") {
+			continue
+		}
+		if g.name != "" {
+			return g.name, g.category, g.prefix
+		}
+		depth := strings.Count(g.prefix, ".") + 1
+		if depth < len(path) {
+			return moduleNameFrom(path[depth]), g.category, g.prefix + "." + path[depth]
+		}
+		return moduleNameFrom(path[0]), g.category, g.prefix
+	}
+	return moduleNameFrom(path[0]), "system", path[0]
+}
+
+// moduleNameFrom turns an attribute name into a module file name
+func moduleNameFrom(attr string) string {
+	attr = strings.Trim(attr, `"`)
+	attr = camelBoundaryRe.ReplaceAllString(attr, "$1-$2")
+	var sb strings.Builder
+	for _, r := range strings.ToLower(attr) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('-')
+		}
+	}
+	return strings.Trim(sb.String(), "-")
+}
+
+// importStmt is one fully flattened option of the configuration
+type importStmt struct {
+	path     []string
+	raw      string // value source
+	col      int    // indentation of the value source
+	origin   int    // index of the top-level binding it came from
+	consumed bool
+}
+
+func (s importStmt) key() string { return strings.Join(s.path, ".") }
+
+func (s importStmt) norm() string {
+	return s.key() + " = " + normalizeNix(s.raw)
+}
+
+// flattenBinding expands nested attribute set literals into one statement
+// per leaf option
+func flattenBinding(src string, b nixBinding, prefix []string, origin int) []importStmt {
+	path := append(append([]string{}, prefix...), b.Path...)
+	if b.Inherit {
+		return []importStmt{{path: append(path, b.Value), raw: "", col: b.Col, origin: origin}}
+	}
+	if inner, ok := attrsetBindings(src, b); ok && len(inner) > 0 {
+		var out []importStmt
+		for _, ib := range inner {
+			out = append(out, flattenBinding(src, ib, path, origin)...)
+		}
+		return out
+	}
+	return []importStmt{{path: path, raw: b.Value, col: b.Col, origin: origin}}
+}
+
+// expandTopLevel splits "services = { ... };" style bindings one level, so
+// every binding names at least two path segments when possible
+func expandTopLevel(src string, binds []nixBinding) []nixBinding {
+	var out []nixBinding
+	for _, b := range binds {
+		if inner, ok := attrsetBindings(src, b); ok && len(b.Path) == 1 && len(inner) > 0 {
+			for i, ib := range inner {
+				ib.Path = append(append([]string{}, b.Path...), ib.Path...)
+				if i == 0 {
+					ib.Comment = append(append([]string{}, b.Comment...), ib.Comment...)
+				}
+				out = append(out, ib)
+			}
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// PlanImport reads a NixOS configuration and works out the modules and the
+// preset that reproduce it. Options the preset covers (host name, locale,
+// users...) go to the preset; options matching an existing module select
+// it; everything else is grouped into new modules by attribute path.
+func PlanImport(root, presetName string, src []byte) (*ImportPlan, error) {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	args, top, err := parseNixConfig(text)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler a configuração: %w", err)
+	}
+
+	plan := &ImportPlan{}
+	warn := func(format string, a ...any) {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf(format, a...))
+	}
+	for _, a := range args {
+		if !slices.Contains(importArgs, a) {
+			warn("argumento '%s' não existe nos módulos LEGO: revise onde ele é usado", a)
+		}
+	}
+
+	binds := expandTopLevel(text, top)
+	var stmts []importStmt
+	for i, b := range binds {
+		stmts = append(stmts, flattenBinding(text, b, nil, i)...)
+	}
+
+	plan.Preset = importPreset(presetName, stmts, warn)
+	matched := matchExistingModules(root, plan.Preset, stmts)
+	newMods := groupRemaining(text, binds, stmts)
+
+	// Name new modules, avoiding every existing module name
+	taken := map[string]bool{}
+	for _, m := range ListModules(root) {
+		taken[m.Name] = true
+	}
+	type placed struct {
+		pos int
+		mod ImportedModule
+	}
+	var all []placed
+	for _, m := range matched {
+		all = append(all, placed{m.pos, ImportedModule{RelPath: m.rel, Purpose: m.purpose, Reused: true}})
+	}
+	for _, g := range newMods {
+		name := g.name
+		if taken[name] {
+			name = g.name + "-" + moduleNameFrom(presetName)
+			for n := 2; taken[name]; n++ {
+				name = fmt.Sprintf("%s-%s-%d", g.name, moduleNameFrom(presetName), n)
+			}
+		}
+		taken[name] = true
+		purpose := "Imported from configuration.nix (" + strings.Join(g.keys, ", ") + ")"
+		content := fmt.Sprintf("# NIXOS-LEGO-MODULE: %s\n# PURPOSE: %s\n# CATEGORY: %s\n# AUTHOR: import\n%s\n%s\n",
+			name, purpose, g.category, HeaderSeparator, strings.TrimRight(g.body.String(), "\n"))
+		rel := g.category + "/" + name
+		if _, err := ParseModule(rel+".nix", content); err != nil {
+			return nil, fmt.Errorf("módulo gerado inválido: %w", err)
+		}
+		all = append(all, placed{g.pos, ImportedModule{RelPath: rel, Purpose: purpose, Content: content}})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].pos < all[j].pos })
+	for _, p := range all {
+		plan.Modules = append(plan.Modules, p.mod)
+		plan.Preset.Modules.Active = append(plan.Preset.Modules.Active, p.mod.RelPath)
+	}
+
+	// Reused modules may pull in others through # REQUIRES: or conflict
+	res := ResolveModules(ListModules(root), plan.Preset.Modules.Active)
+	for _, rel := range res.Added {
+		warn("'%s' será adicionado no build por # REQUIRES: de um módulo reaproveitado", rel)
+	}
+	for _, c := range res.Conflicts {
+		warn("%s", c)
+	}
+	return plan, nil
+}
+
+// importPreset builds the preset from the options the host template sets,
+// consuming them. Anything it cannot read as a literal stays for a module.
+func importPreset(name string, stmts []importStmt, warn func(string, ...any)) *Preset {
+	p := NewDefaultPreset(name, "user")
+	p.Users = nil
+	lcFields := map[string]*string{
+		"LC_ADDRESS": &p.Locale.LcAddress, "LC_IDENTIFICATION": &p.Locale.LcIdentification,
+		"LC_MEASUREMENT": &p.Locale.LcMeasurement, "LC_MONETARY": &p.Locale.LcMonetary,
+		"LC_NAME": &p.Locale.LcName, "LC_NUMERIC": &p.Locale.LcNumeric,
+		"LC_PAPER": &p.Locale.LcPaper, "LC_TELEPHONE": &p.Locale.LcTelephone,
+		"LC_TIME": &p.Locale.LcTime,
+	}
+	found := map[string]bool{}
+	lcSet := map[string]bool{}
+
+	str := func(st *importStmt, dst *string) {
+		if v, ok := nixStringLiteral(st.raw); ok {
+			*dst = v
+			st.consumed = true
+			found[st.key()] = true
+			return
+		}
+		warn("%s não é um texto simples: mantido em módulo, revise o valor do preset", st.key())
+	}
+
+	users := map[string][]*importStmt{}
+	var userOrder []string
+	for i := range stmts {
+		st := &stmts[i]
+		switch key := st.key(); {
+		case key == "networking.hostName":
+			str(st, &p.Host.HostName)
+		case key == "networking.networkmanager.enable" && normalizeNix(st.raw) == "true":
+			st.consumed = true // the host template enables it
+		case key == "time.timeZone":
+			str(st, &p.Locale.Timezone)
+		case key == "i18n.defaultLocale":
+			str(st, &p.Locale.DefaultLocale)
+		case key == "console.keyMap":
+			str(st, &p.Locale.Keymap)
+		case key == "system.stateVersion":
+			str(st, &p.Host.StateVersion)
+		case len(st.path) == 3 && key == "i18n.extraLocaleSettings."+st.path[2] && lcFields[st.path[2]] != nil:
+			if str(st, lcFields[st.path[2]]); st.consumed {
+				lcSet[st.path[2]] = true
+			}
+		case key == "imports":
+			paths := strings.Fields(strings.Trim(normalizeNix(st.raw), "[]"))
+			for _, imp := range paths {
+				if filepath.Base(imp) != "hardware-configuration.nix" {
+					warn("import %s ignorado: copie o conteúdo para um módulo", imp)
+				}
+			}
+			st.consumed = true
+		case len(st.path) >= 4 && st.path[0] == "users" && st.path[1] == "users":
+			u := strings.Trim(st.path[2], `"`)
+			if _, ok := users[u]; !ok {
+				userOrder = append(userOrder, u)
+			}
+			users[u] = append(users[u], st)
+		}
+	}
+
+	for _, name := range userOrder {
+		if u, ok := importUser(name, users[name], warn); ok {
+			p.Users = append(p.Users, u)
+			if w := u.PasswordWarning(); w != "" {
+				warn("users.users.%s: %s", name, w)
+			}
+		}
+	}
+	// usersBlock enables the programs the users' shells need
+	for i := range stmts {
+		st := &stmts[i]
+		if len(st.path) == 3 && st.path[0] == "programs" && st.path[2] == "enable" && normalizeNix(st.raw) == "true" &&
+			slices.ContainsFunc(p.Users, func(u UserConfig) bool { return u.Shell != "" && UserShells[u.Shell] == st.path[1] }) {
+			st.consumed = true
+		}
+	}
+
+	if !found["networking.hostName"] {
+		p.Host.HostName = name
+		warn("networking.hostName ausente: usando '%s'", name)
+	}
+	if !found["system.stateVersion"] {
+		warn("system.stateVersion ausente: usando %s", p.Host.StateVersion)
+	}
+	if !found["time.timeZone"] {
+		warn("time.timeZone ausente: usando %s", p.Locale.Timezone)
+	}
+	if !found["console.keyMap"] {
+		p.Locale.Keymap = "us" // NixOS default
+	}
+	if found["i18n.defaultLocale"] {
+		for lc, dst := range lcFields {
+			if !lcSet[lc] {
+				*dst = p.Locale.DefaultLocale // NixOS default for unset LC_*
+			}
+		}
+	}
+	if len(p.Users) == 0 {
+		p.Users = NewDefaultPreset(name, "user").Users
+		warn("nenhum usuário normal (isNormalUser = true) encontrado: preset criado com o usuário padrão 'user'")
+	}
+	return p
+}
+
+// importUser turns the users.users.<name> options of a normal user into a
+// UserConfig, consuming the options it understands
+func importUser(name string, stmts []*importStmt, warn func(string, ...any)) (UserConfig, bool) {
+	normal := false
+	for _, st := range stmts {
+		if len(st.path) == 4 && st.path[3] == "isNormalUser" && normalizeNix(st.raw) == "true" {
+			normal = true
+		}
+	}
+	if !normal {
+		return UserConfig{}, false
+	}
+
+	u := UserConfig{Name: name, Groups: []string{}}
+	for _, st := range stmts {
+		attr := strings.Join(st.path[3:], ".")
+		ok := true
+		switch attr {
+		case "isNormalUser":
+		case "description":
+			u.Description, ok = nixStringLiteral(st.raw)
+		case "initialPassword":
+			u.Initialpassword, ok = nixStringLiteral(st.raw)
+		case "hashedPassword":
+			u.HashedPassword, ok = nixStringLiteral(st.raw)
+		case "extraGroups":
+			u.Groups, ok = nixStringListLiteral(st.raw)
+		case "openssh.authorizedKeys.keys":
+			u.SSHKeys, ok = nixStringListLiteral(st.raw)
+		case "shell":
+			shell := strings.TrimPrefix(normalizeNix(st.raw), "pkgs.")
+			_, ok = UserShells[shell]
+			if ok {
+				u.Shell = shell
+			}
+		default:
+			continue // packages, uid...: kept in a module
+		}
+		if !ok {
+			warn("users.users.%s.%s não é um valor literal: mantido em módulo, revise o usuário no preset", name, attr)
+		}
+		st.consumed = ok
+	}
+	return u, true
+}
+
+type importMatch struct {
+	rel, purpose string
+	pos          int
+}
+
+// matchExistingModules selects every existing module whose options all
+// appear, with the same values, among the statements not yet consumed.
+// Bigger modules are tried first.
+func matchExistingModules(root string, preset *Preset, stmts []importStmt) []importMatch {
+	type candidate struct {
+		info  ModuleInfo
+		norms []string
+	}
+	user := preset.PrimaryUser()
+	var cands []candidate
+	for _, info := range SystemModules(root) {
+		mod, err := LoadModule(info.FullPath)
+		if err != nil || len(mod.List("SECRETS")) > 0 {
+			continue
+		}
+		if substituteParams(info.RelPath, mod, nil) != nil {
+			continue
+		}
+		body := strings.ReplaceAll(mod.Body, "{{USER_NAME}}", user.Name)
+		body = strings.ReplaceAll(body, "{{USER_DESCRIPTION}}", user.Description)
+		if strings.Contains(body, "{{") {
+			continue
+		}
+		s := &nixScanner{src: body}
+		binds, err := s.bindings()
+		if err != nil || s.pos != len(body) {
+			continue
+		}
+		var norms []string
+		for _, b := range binds {
+			for _, st := range flattenBinding(body, b, nil, 0) {
+				norms = append(norms, st.norm())
+			}
+		}
+		if len(norms) > 0 {
+			cands = append(cands, candidate{info, norms})
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool { return len(cands[i].norms) > len(cands[j].norms) })
+
+	index := map[string][]int{}
+	for i, st := range stmts {
+		index[st.norm()] = append(index[st.norm()], i)
+	}
+
+	var matches []importMatch
+	for _, c := range cands {
+		var picked []int
+		for _, n := range c.norms {
+			j := slices.IndexFunc(index[n], func(i int) bool {
+				return !stmts[i].consumed && !slices.Contains(picked, i)
+			})
+			if j < 0 {
+				picked = nil
+				break
+			}
+			picked = append(picked, index[n][j])
+		}
+		if picked == nil {
+			continue
+		}
+		pos := len(stmts)
+		for _, i := range picked {
+			stmts[i].consumed = true
+			pos = min(pos, stmts[i].origin)
+		}
+		matches = append(matches, importMatch{c.info.RelPath, c.info.Purpose, pos})
+	}
+	return matches
+}
+
+type importNewModule struct {
+	name, category string
+	keys           []string // attribute prefixes, for the purpose line
+	body           strings.Builder
+	pos            int
+}
+
+// groupRemaining writes the statements left over into new module bodies.
+// Untouched bindings keep their original text and comments; partially
+// consumed ones are written one flattened option per line.
+func groupRemaining(src string, binds []nixBinding, stmts []importStmt) []*importNewModule {
+	var groups []*importNewModule
+	byName := map[string]*importNewModule{}
+
+	for i, b := range binds {
+		var left []importStmt
+		total := 0
+		for _, st := range stmts {
+			if st.origin != i {
+				continue
+			}
+			total++
+			if !st.consumed {
+				left = append(left, st)
+			}
+		}
+		if len(left) == 0 {
+			continue
+		}
+		path := b.Path
+		if b.Inherit {
+			path = []string{"inherit"}
+		}
+		name, category, prefix := importGroup(path)
+		g := byName[name]
+		if g == nil {
+			g = &importNewModule{name: name, category: category, pos: i}
+			byName[name] = g
+			groups = append(groups, g)
+		}
+		if !slices.Contains(g.keys, prefix) && len(g.keys) < 3 {
+			g.keys = append(g.keys, prefix)
+		}
+
+		if len(left) == total {
+			for _, c := range b.Comment {
+				g.body.WriteString(c + "\n")
+			}
+			if b.Inherit {
+				g.body.WriteString(b.Value + ";")
+			} else {
+				g.body.WriteString(b.key() + " = " + dedentNix(b.Value, b.Col) + ";")
+			}
+			if b.Trailing != "" {
+				g.body.WriteString(" " + b.Trailing)
+			}
+			g.body.WriteString("\n")
+			continue
+		}
+		for _, st := range left {
+			g.body.WriteString(st.key() + " = " + dedentNix(st.raw, st.col) + ";\n")
+		}
+	}
+	return groups
+}
+
+// Write creates the new module files and the preset. It refuses to
+// overwrite an existing preset or module.
+func (p *ImportPlan) Write(root string) error {
+	presetFile := filepath.Join(root, "presets", p.Preset.Host.PresetName+".toml")
+	if _, err := os.Stat(presetFile); err == nil {
+		return fmt.Errorf("preset '%s' já existe", p.Preset.Host.PresetName)
+	}
+	for _, m := range p.Modules {
+		if m.Reused {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, "modules", m.RelPath+".nix")); err == nil {
+			return fmt.Errorf("módulo '%s' já existe", m.RelPath)
+		}
+	}
+	for _, m := range p.Modules {
+		if m.Reused {
+			continue
+		}
+		path := filepath.Join(root, "modules", m.RelPath+".nix")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("erro ao criar diretório: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(m.Content), 0644); err != nil {
+			return fmt.Errorf("erro ao salvar módulo '%s': %w", m.RelPath, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(presetFile), 0755); err != nil {
+		return fmt.Errorf("erro ao criar diretório: %w", err)
+	}
+	return SavePreset(presetFile, p.Preset)
+}
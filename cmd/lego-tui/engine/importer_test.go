@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// importRoot is a project holding copies of a few of the repository's own
+// modules, so matching runs against their real content
+func importRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, rel := range []string{"system/systemd-boot", "apps/firefox-browser", "overlays/allow-unfree"} {
+		src, err := os.ReadFile(filepath.Join("..", "..", "..", "modules", rel+".nix"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(root, "modules", rel+".nix"), string(src))
+	}
+	return root
+}
+
+const importConfig = `{ config, pkgs, ... }:
+
+{
+  imports = [ ./hardware-configuration.nix ];
+
+  boot.loader.systemd-boot.enable = true;
+  boot.loader.efi.canTouchEfiVariables = true;
+
+  networking.hostName = "desktop";
+  networking.networkmanager.enable = true;
+
+  time.timeZone = "America/Sao_Paulo";
+  i18n.defaultLocale = "pt_BR.UTF-8";
+  i18n.extraLocaleSettings.LC_TIME = "en_GB.UTF-8";
+  console.keyMap = "br-abnt2";
+
+  users.users.ana = {
+    isNormalUser = true;
+    description = "Ana";
+    extraGroups = [ "networkmanager" "wheel" ];
+    uid = 1001;
+  };
+
+  programs.firefox.enable = true;
+  nixpkgs.config.allowUnfree = true;
+
+  # Ferramentas
+  environment.systemPackages = with pkgs; [ vim git ];
+
+  services.openssh = {
+    enable = true;
+    settings.PermitRootLogin = "no";
+  };
+
+  system.stateVersion = "24.05";
+}
+`
+
+// importModules renders the plan's modules as "existente rel" / "novo rel"
+func importModules(plan *ImportPlan) []string {
+	var out []string
+	for _, m := range plan.Modules {
+		status := "novo"
+		if m.Reused {
+			status = "existente"
+		}
+		out = append(out, status+" "+m.RelPath)
+	}
+	return out
+}
+
+func TestPlanImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		modules  []string          // nil skips the check
+		contents map[string]string // module -> text its file must contain
+		warnings []string          // substrings some warning must contain
+		clean    []string          // substrings no warning may contain
+		check    func(t *testing.T, p *Preset)
+		err      string
+	}{
+		{
+			name: "preset",
+			src:  importConfig,
+			check: func(t *testing.T, p *Preset) {
+				if p.Host.HostName != "desktop" || p.Host.StateVersion != "24.05" {
+					t.Errorf("host = %+v", p.Host)
+				}
+				l := p.Locale
+				if l.Timezone != "America/Sao_Paulo" || l.DefaultLocale != "pt_BR.UTF-8" || l.Keymap != "br-abnt2" {
+					t.Errorf("locale = %+v", l)
+				}
+				if l.LcTime != "en_GB.UTF-8" || l.LcMonetary != "pt_BR.UTF-8" {
+					t.Errorf("LC_TIME = %q, LC_MONETARY = %q", l.LcTime, l.LcMonetary)
+				}
+				if len(p.Users) != 1 {
+					t.Fatalf("users = %+v", p.Users)
+				}
+				u := p.Users[0]
+				if u.Name != "ana" || u.Description != "Ana" || !slices.Equal(u.Groups, []string{"networkmanager", "wheel"}) {
+					t.Errorf("user = %+v", u)
+				}
+			},
+		},
+		{
+			name: "existing and new modules",
+			src:  importConfig,
+			modules: []string{
+				"existente system/systemd-boot",
+				"novo system/users",
+				"existente apps/firefox-browser",
+				"existente overlays/allow-unfree",
+				"novo apps/system-packages",
+				"novo services/openssh",
+			},
+			contents: map[string]string{
+				"system/users":         "users.users.ana.uid = 1001;\n",
+				"apps/system-packages": "# Ferramentas\nenvironment.systemPackages = with pkgs; [ vim git ];\n",
+				"services/openssh":     "services.openssh = {\n  enable = true;\n  settings.PermitRootLogin = \"no\";\n};\n",
+			},
+			clean: []string{"argumento", "import", "ausente"},
+		},
+		{
+			name:     "user without password",
+			src:      importConfig,
+			warnings: []string{"users.users.ana: usuário sem senha definida (conta bloqueada"},
+			check: func(t *testing.T, p *Preset) {
+				if u := p.Users[0]; u.Initialpassword != "" || u.HashedPassword != "" {
+					t.Errorf("password = %q / %q, want none", u.Initialpassword, u.HashedPassword)
+				}
+			},
+		},
+		{
+			name: "user with hashed password",
+			src: `{ ... }: {
+  users.users.ana.isNormalUser = true;
+  users.users.ana.hashedPassword = "$6$sal$hash";
+}`,
+			modules:  []string{},
+			warnings: []string{"networking.hostName ausente: usando 'importado'"},
+			clean:    []string{"conta bloqueada", "texto puro"},
+			check: func(t *testing.T, p *Preset) {
+				if u := p.Users[0]; u.HashedPassword != "$6$sal$hash" {
+					t.Errorf("hashedPassword = %q", u.HashedPassword)
+				}
+			},
+		},
+		{
+			name: "no normal user",
+			src: `{ pkgs, inputs, ... }: {
+  users.users.root.shell = pkgs.zsh;
+}`,
+			modules:  []string{"novo system/users"},
+			warnings: []string{"argumento 'inputs'", "nenhum usuário normal"},
+		},
+		{
+			name: "top-level let",
+			src: `{ pkgs, ... }:
+let
+  user = "ana";
+in {
+  users.users.${user}.isNormalUser = true;
+}`,
+			err: "linha 2: 'let'/'with' no nível superior não é suportado",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := PlanImport(importRoot(t), "importado", []byte(tt.src))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modules != nil && !slices.Equal(importModules(plan), tt.modules) {
+				t.Errorf("modules = %q, want %q", importModules(plan), tt.modules)
+			}
+			var rels []string
+			for _, m := range plan.Modules {
+				rels = append(rels, m.RelPath)
+			}
+			if !slices.Equal(plan.Preset.Modules.Active, rels) {
+				t.Errorf("active = %q, want the modules %q", plan.Preset.Modules.Active, rels)
+			}
+			for rel, want := range tt.contents {
+				i := slices.IndexFunc(plan.Modules, func(m ImportedModule) bool { return m.RelPath == rel })
+				if i < 0 || !strings.HasSuffix(plan.Modules[i].Content, HeaderSeparator+"\n"+want) {
+					t.Errorf("%s content does not end with %q", rel, want)
+				}
+			}
+			joined := strings.Join(plan.Warnings, "\n")
+			for _, w := range tt.warnings {
+				if !strings.Contains(joined, w) {
+					t.Errorf("warnings = %q, want one containing %q", plan.Warnings, w)
+				}
+			}
+			for _, w := range tt.clean {
+				if strings.Contains(joined, w) {
+					t.Errorf("warnings = %q, want none containing %q", plan.Warnings, w)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, plan.Preset)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// HeaderSeparator ends the module header; everything after it is Nix code
+const HeaderSeparator = "# ---"
+
+// Required header keys, in the order they are written
+var requiredHeaderKeys = []string{"NIXOS-LEGO-MODULE", "PURPOSE", "CATEGORY"}
+
+var headerLineRe = regexp.MustCompile(`^#\s+([A-Z][A-Z0-9_-]*):\s*(.*)$`)
+
+// Module is a parsed LEGO module file
+type Module struct {
+	Name     string
+	Purpose  string
+	Category string
+	Header   map[string]string // every "# KEY: value" line, required keys included
+	Params   []ModuleParam     // "# PARAM:" lines, the only repeatable key
+	Body     string            // Nix code after the separator
+	BodyLine int               // 1-based line number where Body starts
+}
+
+// ModuleError reports a malformed module file
+type ModuleError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *ModuleError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+}
+
+// LoadModule reads and parses a module file
+func LoadModule(path string) (*Module, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao ler módulo: %w", err)
+	}
+	return ParseModule(path, string(data))
+}
+
+// ParseModule reads all "# KEY: value" header lines up to the "# ---"
+// separator and validates the required keys. On error the returned module
+// still carries whatever header fields could be read.
+func ParseModule(path, data string) (*Module, error) {
+	mod := &Module{Header: map[string]string{}}
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+
+	sep := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == HeaderSeparator {
+			sep = i
+			break
+		}
+		match := headerLineRe.FindStringSubmatch(trimmed)
+		if match == nil {
+			return mod, &ModuleError{path, i + 1, fmt.Sprintf("linha de cabeçalho inválida antes de '%s': %q", HeaderSeparator, trimmed)}
+		}
+		key, value := match[1], strings.TrimSpace(match[2])
+		if key == "PARAM" {
+			param, err := parseParamLine(value)
+			if err != nil {
+				return mod, &ModuleError{path, i + 1, err.Error()}
+			}
+			for _, existing := range mod.Params {
+				if existing.Name == param.Name {
+					return mod, &ModuleError{path, i + 1, fmt.Sprintf("parâmetro duplicado: %s", param.Name)}
+				}
+			}
+			mod.Params = append(mod.Params, param)
+			continue
+		}
+		if _, dup := mod.Header[key]; dup {
+			return mod, &ModuleError{path, i + 1, fmt.Sprintf("chave de cabeçalho duplicada: %s", key)}
+		}
+		mod.Header[key] = value
+	}
+
+	mod.Name = mod.Header["NIXOS-LEGO-MODULE"]
+	mod.Purpose = mod.Header["PURPOSE"]
+	mod.Category = mod.Header["CATEGORY"]
+
+	if sep < 0 {
+		return mod, &ModuleError{path, 0, fmt.Sprintf("separador '%s' não encontrado", HeaderSeparator)}
+	}
+	for _, key := range requiredHeaderKeys {
+		if mod.Header[key] == "" {
+			return mod, &ModuleError{path, 0, fmt.Sprintf("chave obrigatória ausente: # %s:", key)}
+		}
+	}
+	if !slices.Contains(Categories, mod.Category) {
+		return mod, &ModuleError{path, 0, fmt.Sprintf("categoria desconhecida: %s", mod.Category)}
+	}
+	for _, name := range mod.List("SECRETS") {
+		if !ValidSecretName(name) {
+			return mod, &ModuleError{path, 0, fmt.Sprintf("nome de segredo inválido: %s", name)}
+		}
+	}
+
+	mod.Body = strings.Join(lines[sep+1:], "\n")
+	mod.BodyLine = sep + 2
+	return mod, nil
+}
+
+// List returns a comma-separated header value as a slice
+func (m *Module) List(key string) []string {
+	var items []string
+	for _, item := range strings.Split(m.Header[key], ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
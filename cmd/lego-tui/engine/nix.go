@@ -4,13 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
-var Categories = []string{"system", "hardware", "apps", "services", "overlays"}
+var Categories = []string{"system", "hardware", "apps", "services", "overlays", HomeCategory}
 
 var CategoryDescriptions = map[string]string{
 	"system":   "Configs base do NixOS e bootloader",
@@ -18,15 +17,22 @@ var CategoryDescriptions = map[string]string{
 	"apps":     "Programas de usuário e terminais",
 	"services": "Docker, DBs, servidores e daemons",
 	"overlays": "Modificações e patches no nixpkgs",
+	"home":     "Módulos Home Manager, escolhidos por usuário",
 }
 
 // ModuleInfo represents a discovered module
 type ModuleInfo struct {
-	Category string
-	Name     string
-	Purpose  string
-	RelPath  string // category/name
-	FullPath string
+	Category  string
+	Name      string
+	Purpose   string
+	RelPath   string // category/name
+	FullPath  string
+	Requires  []string // modules or capabilities pulled in automatically
+	Conflicts []string // modules or capabilities that cannot coexist
+	Provides  []string // capabilities offered (e.g. kernel, bootloader)
+	Secrets   []string // secrets/<name>.age files the module reads
+	Params    []ModuleParam
+	Err       error // header parse error, nil for well-formed modules
 }
 
 // FlakeInput represents an external flake input from flake-inputs.json
@@ -97,123 +103,232 @@ func ListModules(root string) []ModuleInfo {
 			}
 			name := strings.TrimSuffix(e.Name(), ".nix")
 			fullPath := filepath.Join(catDir, e.Name())
-			purpose := readPurpose(fullPath)
+			mod, err := LoadModule(fullPath)
+			if mod == nil {
+				mod = &Module{Header: map[string]string{}}
+			}
 			modules = append(modules, ModuleInfo{
-				Category: cat,
-				Name:     name,
-				Purpose:  purpose,
-				RelPath:  cat + "/" + name,
-				FullPath: fullPath,
+				Category:  cat,
+				Name:      name,
+				Purpose:   mod.Purpose,
+				RelPath:   cat + "/" + name,
+				FullPath:  fullPath,
+				Requires:  mod.List("REQUIRES"),
+				Conflicts: mod.List("CONFLICTS"),
+				Provides:  mod.List("PROVIDES"),
+				Secrets:   mod.List("SECRETS"),
+				Params:    mod.Params,
+				Err:       err,
 			})
 		}
 	}
 	return modules
 }
 
-func readPurpose(path string) string {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return ""
-	}
-	for _, line := range strings.Split(string(data), "\n") {
-		trimmed := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmed, "# PURPOSE: ") {
-			return strings.TrimSpace(strings.TrimPrefix(trimmed, "# PURPOSE: "))
-		}
-	}
-	return ""
-}
-
 // ValidateNixSyntax runs nix-instantiate --parse on a file
-func ValidateNixSyntax(path string) (bool, string) {
-	cmd := exec.Command("nix-instantiate", "--parse", path)
-	out, err := cmd.CombinedOutput()
+func ValidateNixSyntax(r Runner, path string) (bool, string) {
+	cmd := Cmd("nix-instantiate", "--parse", path)
+	cmd.ReadOnly = true
+	out, err := r.Run(cmd)
 	if err != nil {
 		return false, string(out)
 	}
 	return true, ""
 }
 
-// BuildFlake concatenates modules into a flake from template
-func BuildFlake(root string, preset *Preset, modules []string, customName string) (string, error) {
-	// Read template
-	tmplPath := filepath.Join(root, "templates", "base-flake.nix")
-	tmpl, err := os.ReadFile(tmplPath)
+// flakeContext holds everything shared by the hosts of a generated flake
+type flakeContext struct {
+	root         string
+	baseTmpl     string
+	hostTmpl     string
+	inputs       string
+	outputArgs   string
+	specialArgs  string
+	devShells    string
+	wrapperArgs  string
+	moduleIndent string
+	declared     map[string]bool // inputs from flake-inputs.json
+	extraInputs  []FlakeInput    // inputs required by the selection (agenix, home-manager)
+}
+
+func loadFlakeContext(root string) (*flakeContext, error) {
+	// Read templates
+	baseTmpl, err := os.ReadFile(filepath.Join(root, "templates", "base-flake.nix"))
+	if err != nil {
+		return nil, fmt.Errorf("template não encontrado: %w", err)
+	}
+	hostTmpl, err := os.ReadFile(filepath.Join(root, "templates", "host-config.nix"))
 	if err != nil {
-		return "", fmt.Errorf("template não encontrado: %w", err)
+		return nil, fmt.Errorf("template não encontrado: %w", err)
 	}
 
 	// Load flake inputs
 	flakeInputs, err := LoadFlakeInputs(root)
 	if err != nil {
-		return "", fmt.Errorf("erro ao carregar flake inputs: %w", err)
+		return nil, fmt.Errorf("erro ao carregar flake inputs: %w", err)
 	}
 
 	// Load devshells
 	devShells, err := LoadDevShells(root)
 	if err != nil {
-		return "", fmt.Errorf("erro ao carregar devshells: %w", err)
+		return nil, fmt.Errorf("erro ao carregar devshells: %w", err)
 	}
 
-	// Generate flake input snippets
-	flakeInputsSnippet, flakeOutputArgs, flakeSpecialArgs, moduleArgs := generateFlakeSnippets(flakeInputs)
+	ctx := &flakeContext{
+		root:         root,
+		baseTmpl:     string(baseTmpl),
+		hostTmpl:     strings.TrimRight(string(hostTmpl), "\n"),
+		devShells:    generateDevShellsSnippet(devShells),
+		moduleIndent: "        ", // 8 spaces — aligns with modules list level
+	}
 
-	// Generate devshells snippet
-	devShellsSnippet := generateDevShellsSnippet(devShells)
+	// Generate flake input snippets
+	var moduleArgs []string
+	ctx.inputs, ctx.outputArgs, ctx.specialArgs, moduleArgs = generateFlakeSnippets(flakeInputs)
+	ctx.declared = map[string]bool{}
+	for _, fi := range flakeInputs {
+		ctx.declared[fi.Name] = true
+	}
 
 	// Build module wrapper args
-	wrapperArgs := "pkgs, lib, config, pkgs-master"
+	ctx.wrapperArgs = "pkgs, lib, config, pkgs-master"
 	for _, a := range moduleArgs {
-		wrapperArgs += ", " + a
+		ctx.wrapperArgs += ", " + a
 	}
+	return ctx, nil
+}
 
-	// Build module content — each module becomes a separate entry in modules list
-	var moduleContent strings.Builder
-	indent := "        " // 8 spaces — aligns with modules list level
-	bodyIndent := indent + "  "
-	for _, mod := range modules {
-		modPath := filepath.Join(root, "modules", mod+".nix")
-		data, err := os.ReadFile(modPath)
+// loadHostModules resolves requirements and conflicts for one host and
+// parses every module it uses, in order, with the preset's parameters
+// substituted into the bodies.
+func (c *flakeContext) loadHostModules(preset *Preset, modules []string) ([]string, []*Module, error) {
+	if err := validatePreset(c.root, preset, modules).Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Pull in requirements and refuse conflicting selections
+	res := ResolveModules(ListModules(c.root), modules)
+	if err := res.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var loaded []*Module
+	for _, rel := range res.Modules {
+		if IsHomeModule(rel) {
+			return nil, nil, fmt.Errorf("módulo '%s' é Home Manager e não pode ser exigido por um módulo de sistema", rel)
+		}
+		modPath := filepath.Join(c.root, "modules", rel+".nix")
+		if _, err := os.Stat(modPath); err != nil {
+			return nil, nil, fmt.Errorf("módulo '%s' não encontrado: %w", rel, err)
+		}
+		mod, err := LoadModule(modPath)
 		if err != nil {
-			continue
+			return nil, nil, fmt.Errorf("módulo '%s' inválido: %w", rel, err)
 		}
-		lines := strings.Split(string(data), "\n")
-		if len(lines) < 4 {
-			continue
+		if err := substituteParams(rel, mod, preset.Params[rel]); err != nil {
+			return nil, nil, err
 		}
-		modName := strings.TrimPrefix(lines[0], "# NIXOS-LEGO-MODULE: ")
-		modPurpose := strings.TrimPrefix(lines[1], "# PURPOSE: ")
-		body := strings.TrimRight(strings.Join(lines[4:], "\n"), "\n ")
+		loaded = append(loaded, mod)
+	}
+	return res.Modules, loaded, nil
+}
 
-		moduleContent.WriteString("\n")
-		moduleContent.WriteString(indent + "# ── " + modName + " ── " + modPurpose + "\n")
-		moduleContent.WriteString(indent + "({ " + wrapperArgs + ", ... }: {\n")
-		for _, l := range strings.Split(body, "\n") {
-			if strings.TrimSpace(l) == "" {
-				moduleContent.WriteString("\n")
-			} else {
-				moduleContent.WriteString(bodyIndent + l + "\n")
-			}
+// wrapModule turns a module body into a NixOS module function.
+// The function header is written at indent, the body one level deeper.
+func (c *flakeContext) wrapModule(mod *Module, indent string) string {
+	var sb strings.Builder
+	bodyIndent := indent + "  "
+	body := strings.TrimRight(mod.Body, "\n ")
+
+	sb.WriteString(indent + "# ── " + mod.Name + " ── " + mod.Purpose + "\n")
+	sb.WriteString(indent + "({ " + c.wrapperArgs + ", ... }: {\n")
+	for _, l := range strings.Split(body, "\n") {
+		if strings.TrimSpace(l) == "" {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString(bodyIndent + l + "\n")
+		}
+	}
+	sb.WriteString(indent + "})\n")
+	return sb.String()
+}
+
+// secretsEntries wires the secrets used by a host's modules and marks the
+// flake as needing the agenix input
+func (c *flakeContext) secretsEntries(loaded []*Module) string {
+	names := moduleSecrets(loaded)
+	if len(names) == 0 {
+		return ""
+	}
+	c.requireInput("agenix", agenixURL)
+	return secretsEntries(names, c.moduleIndent)
+}
+
+// requireInput adds a flake input following nixpkgs, unless
+// flake-inputs.json already declares it
+func (c *flakeContext) requireInput(name, url string) {
+	if c.declared[name] {
+		return
+	}
+	for _, fi := range c.extraInputs {
+		if fi.Name == name {
+			return
+		}
+	}
+	c.extraInputs = append(c.extraInputs, FlakeInput{Name: name, URL: url, FollowsNixpkgs: true})
+}
+
+// hostBlock renders one nixosConfigurations entry with the given module
+// list, importing hardware-configuration.nix and disko.nix from filesDir
+// (relative to the flake root, e.g. "." or "./hosts/<host>")
+func (c *flakeContext) hostBlock(preset *Preset, filesDir, moduleEntries string) string {
+	block := strings.ReplaceAll(c.hostTmpl, "{{MODULE_INJECTION_POINT}}", moduleEntries)
+	block = strings.ReplaceAll(block, "{{HOST_FILES_DIR}}", filesDir)
+	block = strings.ReplaceAll(block, "{{FLAKE_SPECIAL_ARGS}}", c.specialArgs)
+	return applyPreset(block, preset)
+}
+
+// render injects the host blocks and shared snippets into the base template
+func (c *flakeContext) render(title string, hostBlocks []string) string {
+	inputs, outputArgs := c.inputs, c.outputArgs
+	if len(c.extraInputs) > 0 {
+		extra, extraArgs, _, _ := generateFlakeSnippets(c.extraInputs)
+		if inputs == "" {
+			inputs = strings.TrimLeft(extra, " ")
+		} else {
+			inputs += "\n" + extra
 		}
-		moduleContent.WriteString(indent + "})\n")
+		outputArgs += extraArgs
 	}
 
-	// Inject snippets and module content first
-	flake := string(tmpl)
-	flake = strings.ReplaceAll(flake, "{{MODULE_INJECTION_POINT}}", moduleContent.String())
-	flake = strings.ReplaceAll(flake, "{{DEVSHELLS_INJECTION}}", devShellsSnippet)
-	flake = strings.ReplaceAll(flake, "{{FLAKE_INPUTS}}", flakeInputsSnippet)
-	flake = strings.ReplaceAll(flake, "{{FLAKE_OUTPUT_ARGS}}", flakeOutputArgs)
-	flake = strings.ReplaceAll(flake, "{{FLAKE_SPECIAL_ARGS}}", flakeSpecialArgs)
+	flake := c.baseTmpl
+	flake = strings.ReplaceAll(flake, "{{NIXOS_CONFIGURATIONS}}", strings.Join(hostBlocks, "\n\n"))
+	flake = strings.ReplaceAll(flake, "{{DEVSHELLS_INJECTION}}", c.devShells)
+	flake = strings.ReplaceAll(flake, "{{FLAKE_INPUTS}}", inputs)
+	flake = strings.ReplaceAll(flake, "{{FLAKE_OUTPUT_ARGS}}", outputArgs)
+	flake = strings.ReplaceAll(flake, "{{PRESET_NAME}}", title)
+	return flake
+}
 
-	// Replace preset configuration placeholders everywhere
-	replacements := map[string]string{
+// applyPreset replaces preset configuration placeholders everywhere
+func applyPreset(s string, preset *Preset) string {
+	for k, v := range presetValues(preset) {
+		s = strings.ReplaceAll(s, k, v)
+	}
+	return s
+}
+
+// presetValues maps each preset placeholder to its value
+func presetValues(preset *Preset) map[string]string {
+	return map[string]string{
 		"{{PRESET_NAME}}":          preset.Host.PresetName,
 		"{{HOST_NAME}}":            preset.Host.HostName,
 		"{{STATE_VERSION}}":        preset.Host.StateVersion,
-		"{{USER_NAME}}":            preset.User.Name,
-		"{{USER_INITIALPASSWORD}}": preset.User.Initialpassword,
-		"{{USER_DESCRIPTION}}":     preset.User.Description,
+		"{{USER_NAME}}":            preset.PrimaryUser().Name,
+		"{{USER_INITIALPASSWORD}}": preset.PrimaryUser().Initialpassword,
+		"{{USER_PASSWORD}}":        passwordAttr(preset.PrimaryUser()),
+		"{{USER_DESCRIPTION}}":     preset.PrimaryUser().Description,
+		"{{USERS}}":                usersBlock(preset.Users, "          "),
 		"{{TIMEZONE}}":             preset.Locale.Timezone,
 		"{{DEFAULT_LOCALE}}":       preset.Locale.DefaultLocale,
 		"{{LC_ADDRESS}}":           preset.Locale.LcAddress,
@@ -227,9 +342,57 @@ func BuildFlake(root string, preset *Preset, modules []string, customName string
 		"{{LC_TIME}}":              preset.Locale.LcTime,
 		"{{KEYMAP}}":               preset.Locale.Keymap,
 	}
-	for k, v := range replacements {
-		flake = strings.ReplaceAll(flake, k, v)
+}
+
+// passwordAttr renders the users.users password attribute, preferring the hash
+func passwordAttr(u UserConfig) string {
+	if u.HashedPassword != "" {
+		return "hashedPassword = " + nixString(u.HashedPassword)
+	}
+	return "initialPassword = " + nixString(u.Initialpassword)
+}
+
+// BuildFlake concatenates modules into a flake from template
+func BuildFlake(root string, preset *Preset, modules []string, customName string) (string, error) {
+	ctx, err := loadFlakeContext(root)
+	if err != nil {
+		return "", err
+	}
+
+	modules, loaded, err := ctx.loadHostModules(preset, modules)
+	if err != nil {
+		return "", err
+	}
+
+	// Build module content — each module becomes a separate entry in modules list
+	var moduleContent strings.Builder
+	for _, mod := range loaded {
+		moduleContent.WriteString("\n")
+		moduleContent.WriteString(ctx.wrapModule(mod, ctx.moduleIndent))
+	}
+	moduleContent.WriteString(ctx.secretsEntries(loaded))
+	moduleContent.WriteString(encryptionEntries(preset.Encryption, ctx.moduleIndent))
+	storage, err := ctx.storageEntries(preset)
+	if err != nil {
+		return "", err
+	}
+	moduleContent.WriteString(storage)
+
+	homeUsers, err := ctx.loadHomeModules(preset)
+	if err != nil {
+		return "", err
+	}
+	var homeImports []string
+	for _, u := range homeUsers {
+		var imports strings.Builder
+		for _, mod := range u.modules {
+			imports.WriteString(ctx.wrapModule(mod, ctx.homeIndent()))
+		}
+		homeImports = append(homeImports, imports.String())
 	}
+	moduleContent.WriteString(ctx.homeManagerEntries(preset, homeUsers, homeImports))
+
+	flake := ctx.render(preset.Host.PresetName, []string{ctx.hostBlock(preset, ".", moduleContent.String())})
 
 	// Save
 	suffix := customName
@@ -238,6 +401,9 @@ func BuildFlake(root string, preset *Preset, modules []string, customName string
 	}
 	outName := fmt.Sprintf("%s-%s.nix", preset.Host.PresetName, suffix)
 	outPath := filepath.Join(root, "flakes", outName)
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return "", err
+	}
 	if err := os.WriteFile(outPath, []byte(flake), 0644); err != nil {
 		return "", err
 	}
@@ -304,30 +470,99 @@ func generateDevShellsSnippet(shells []DevShell) string {
 }
 
 // PrepareRebuild copies the selected flake to flake.nix, runs git add,
-// and returns the *exec.Cmd ready to be executed interactively.
-func PrepareRebuild(flakePath, hostname string) (*exec.Cmd, error) {
+// and returns the nixos-rebuild command to run through r, using sudo only
+// for the actions that activate or install the configuration.
+// Directory flakes (flakes/<name>/flake.nix) also have their lego/ module
+// tree copied to the project root. The copies go through r as well, so a
+// dry run leaves the project untouched.
+func PrepareRebuild(r Runner, flakePath, hostname string, rc RebuildConfig) (Command, error) {
 	// Root dir is project root
 	flakeDir := filepath.Dir(flakePath)
 	gitRoot := filepath.Dir(flakeDir)
+	isDir := filepath.Base(flakePath) == FlakeDirFile
+	if isDir {
+		gitRoot = filepath.Dir(gitRoot)
+	}
 
 	targetFlakeNix := filepath.Join(gitRoot, "flake.nix")
 
-	data, err := os.ReadFile(flakePath)
-	if err != nil {
-		return nil, fmt.Errorf("erro lendo flake gerado: %w", err)
+	if _, err := os.Stat(flakePath); err != nil {
+		return Command{}, fmt.Errorf("erro lendo flake gerado: %w", err)
+	}
+	if out, err := r.Run(Cmd("cp", flakePath, targetFlakeNix)); err != nil {
+		return Command{}, fmt.Errorf("erro criando flake.nix na raiz: %v\n%s", err, strings.TrimSpace(string(out)))
+	}
+
+	tracked := []string{"flakes", "flake.nix"}
+	// Flakes only see tracked files; secrets/ holds ciphertext only and
+	// hosts/ the machine files of multi-host flakes
+	for _, dir := range []string{SecretsDir, HostsDir} {
+		if _, err := os.Stat(filepath.Join(gitRoot, dir)); err == nil {
+			tracked = append(tracked, dir)
+		}
 	}
-	if err := os.WriteFile(targetFlakeNix, data, 0644); err != nil {
-		return nil, fmt.Errorf("erro criando flake.nix na raiz: %w", err)
+	if isDir {
+		if err := replaceModuleTree(r, filepath.Join(flakeDir, "lego"), filepath.Join(gitRoot, "lego")); err != nil {
+			return Command{}, fmt.Errorf("erro copiando módulos para a raiz: %w", err)
+		}
+		tracked = append(tracked, "lego")
 	}
 
-	addCmd := exec.Command("git", "add", "flakes", "flake.nix")
+	addCmd := Cmd("git", append([]string{"add"}, tracked...)...)
 	addCmd.Dir = gitRoot
-	if err := addCmd.Run(); err != nil {
+	if _, err := r.Run(addCmd); err != nil {
 		fmt.Printf("Aviso: Falha ao rastrear arquivos no git: %v\n", err)
 	}
 
-	cmd := exec.Command("sudo", "nixos-rebuild", "switch",
-		"--flake", gitRoot+"#"+hostname, "--show-trace")
+	args := append([]string{"nixos-rebuild", rc.ActionName(), "--flake", gitRoot + "#" + hostname}, rc.Args()...)
+	cmd := Cmd(args[0], args[1:]...)
+	if rc.NeedsRoot() {
+		cmd = Cmd("sudo", args...)
+	}
 	cmd.Dir = gitRoot
 	return cmd, nil
 }
+
+// replaceModuleTree replaces dst with a copy of the generated module tree
+// src, running rm and cp through r
+func replaceModuleTree(r Runner, src, dst string) error {
+	if out, err := r.Run(Cmd("rm", "-rf", dst)); err != nil {
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	if out, err := r.Run(Cmd("cp", "-r", src, dst)); err != nil {
+		return fmt.Errorf("%v\n%s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// copyModuleTree replaces dst with a copy of the tree src; CheckFlake uses
+// it to stage flakes in a temporary directory
+func copyModuleTree(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeFile creates path (and its directories) with content
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commandLines renders recorded commands as shell lines
+func commandLines(cmds []Command) []string {
+	lines := make([]string, len(cmds))
+	for i, c := range cmds {
+		lines[i] = c.String()
+	}
+	return lines
+}
+
+// dirFlake creates flakes/<name>/flake.nix with one module under lego/
+func dirFlake(t *testing.T, root, name string) string {
+	t.Helper()
+	flake := filepath.Join(root, "flakes", name, FlakeDirFile)
+	writeFile(t, flake, "{ }\n")
+	writeFile(t, filepath.Join(root, "flakes", name, "lego", "apps", "git.nix"), "({ ... }: { })\n")
+	return flake
+}
+
+func TestPrepareRebuildDryRunLeavesProjectUntouched(t *testing.T) {
+	root := t.TempDir()
+	flake := dirFlake(t, root, "vm-teste")
+	writeFile(t, filepath.Join(root, "lego", "apps", "old.nix"), "old\n")
+
+	rec := &RecordingRunner{}
+	cmd, err := PrepareRebuild(rec, flake, "vm", RebuildConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"cp " + flake + " " + filepath.Join(root, "flake.nix"),
+		"rm -rf " + filepath.Join(root, "lego"),
+		"cp -r " + filepath.Join(root, "flakes", "vm-teste", "lego") + " " + filepath.Join(root, "lego"),
+		"(cd " + root + " && git add flakes flake.nix lego)",
+	}
+	if got := commandLines(rec.Commands()); !slices.Equal(got, want) {
+		t.Errorf("commands:\n%q\nwant:\n%q", got, want)
+	}
+	if want := "(cd " + root + " && sudo nixos-rebuild switch --flake '" + root + "#vm' --show-trace)"; cmd.String() != want {
+		t.Errorf("rebuild = %s, want %s", cmd, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "flake.nix")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote flake.nix (err %v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "lego", "apps", "old.nix")); err != nil {
+		t.Errorf("dry run touched lego/: %v", err)
+	}
+}
+
+func TestPrepareRebuildTracksSecretsAndHosts(t *testing.T) {
+	root := t.TempDir()
+	flake := filepath.Join(root, "flakes", "vm-1.nix")
+	writeFile(t, flake, "{ }\n")
+	writeFile(t, filepath.Join(root, SecretsDir, "wifi.age"), "x")
+	writeFile(t, filepath.Join(root, HostsDir, "vm", "disko.nix"), "{ }\n")
+
+	rec := &RecordingRunner{}
+	cmd, err := PrepareRebuild(rec, flake, "vm", RebuildConfig{Action: "build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := commandLines(rec.Commands())
+	if want := "(cd " + root + " && git add flakes flake.nix secrets hosts)"; !slices.Contains(got, want) {
+		t.Errorf("commands %q do not contain %q", got, want)
+	}
+	// build does not activate anything, so it runs without sudo
+	if cmd.Name != "nixos-rebuild" || cmd.Args[0] != "build" {
+		t.Errorf("rebuild = %s, want nixos-rebuild build", cmd)
+	}
+}
+
+// copyingRunner really runs cp and rm and records everything else
+type copyingRunner struct{ *RecordingRunner }
+
+func (r copyingRunner) Run(c Command) ([]byte, error) {
+	if c.Name == "cp" || c.Name == "rm" {
+		return ExecRunner{}.Run(c)
+	}
+	return r.RecordingRunner.Run(c)
+}
+
+func TestPrepareRebuildCopiesFlakeAndModules(t *testing.T) {
+	root := t.TempDir()
+	flake := dirFlake(t, root, "vm-teste")
+	writeFile(t, filepath.Join(root, "lego", "apps", "old.nix"), "old\n")
+
+	if _, err := PrepareRebuild(copyingRunner{&RecordingRunner{}}, flake, "vm", RebuildConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "flake.nix")); err != nil || string(data) != "{ }\n" {
+		t.Errorf("flake.nix = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "lego", "apps", "git.nix")); err != nil {
+		t.Errorf("lego/apps/git.nix not copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "lego", "apps", "old.nix")); !os.IsNotExist(err) {
+		t.Errorf("stale lego/apps/old.nix kept (err %v)", err)
+	}
+}
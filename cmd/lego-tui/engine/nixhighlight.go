@@ -0,0 +1,277 @@
+package engine
+
+import "strings"
+
+// NixTokenKind classifies a piece of Nix source for syntax highlighting
+type NixTokenKind int
+
+const (
+	NixPlain NixTokenKind = iota
+	NixComment
+	NixString
+	NixInterpolation // ${ ... } inside a string
+	NixKeyword
+	NixLiteral // numbers, true, false, null
+	NixPath
+	NixAttr        // attribute path on the left of "="
+	NixPlaceholder // {{NAME}}, filled in by the preset or a module param
+)
+
+// NixToken is a run of source text of one kind. Concatenating the Text of
+// every token gives back the original source.
+type NixToken struct {
+	Kind NixTokenKind
+	Text string
+}
+
+var nixKeywords = map[string]bool{
+	"let": true, "in": true, "with": true, "rec": true, "inherit": true,
+	"if": true, "then": true, "else": true, "assert": true, "or": true,
+}
+
+var nixLiterals = map[string]bool{"true": true, "false": true, "null": true}
+
+// nixTokenizer splits source into highlight tokens. It never fails: text
+// it does not recognise is kept as NixPlain.
+type nixTokenizer struct {
+	src    string
+	pos    int
+	tokens []NixToken
+}
+
+// TokenizeNix splits Nix source (module bodies, wrapped modules) into
+// tokens for highlighting
+func TokenizeNix(src string) []NixToken {
+	t := &nixTokenizer{src: src}
+	for t.pos < len(src) {
+		t.next()
+	}
+	return t.tokens
+}
+
+// emit appends src[start:end], merging it into the previous token when
+// both have the same kind
+func (t *nixTokenizer) emit(kind NixTokenKind, start, end int) {
+	if start >= end {
+		return
+	}
+	text := t.src[start:end]
+	if n := len(t.tokens); n > 0 && t.tokens[n-1].Kind == kind {
+		t.tokens[n-1].Text += text
+		return
+	}
+	t.tokens = append(t.tokens, NixToken{Kind: kind, Text: text})
+}
+
+func (t *nixTokenizer) peek(prefix string) bool {
+	return strings.HasPrefix(t.src[t.pos:], prefix)
+}
+
+func (t *nixTokenizer) wordStart() bool {
+	return t.pos == 0 || !(isNixIdentChar(t.src[t.pos-1]) || t.src[t.pos-1] == '.')
+}
+
+func (t *nixTokenizer) next() {
+	start := t.pos
+	c := t.src[t.pos]
+	switch {
+	case c == '#':
+		end := strings.IndexByte(t.src[t.pos:], '\n')
+		if end < 0 {
+			t.pos = len(t.src)
+		} else {
+			t.pos += end
+		}
+		t.emit(NixComment, start, t.pos)
+	case t.peek("/*"):
+		end := strings.Index(t.src[t.pos+2:], "*/")
+		if end < 0 {
+			t.pos = len(t.src)
+		} else {
+			t.pos += end + 4
+		}
+		t.emit(NixComment, start, t.pos)
+	case t.placeholder():
+	case c == '"':
+		t.pos++
+		t.stringBody(false)
+	case t.peek("''"):
+		t.pos += 2
+		t.stringBody(true)
+	case t.path():
+	case c >= '0' && c <= '9' && t.wordStart():
+		for t.pos < len(t.src) && (isNixIdentChar(t.src[t.pos]) || t.src[t.pos] == '.') {
+			t.pos++
+		}
+		t.emit(NixLiteral, start, t.pos)
+	case (c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) && t.wordStart():
+		t.word()
+	default:
+		t.pos++
+		t.emit(NixPlain, start, t.pos)
+	}
+}
+
+// placeholder consumes a {{NAME}} placeholder
+func (t *nixTokenizer) placeholder() bool {
+	if !t.peek("{{") {
+		return false
+	}
+	end := strings.Index(t.src[t.pos+2:], "}}")
+	if end <= 0 {
+		return false
+	}
+	for _, c := range t.src[t.pos+2 : t.pos+2+end] {
+		if !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	start := t.pos
+	t.pos += end + 4
+	t.emit(NixPlaceholder, start, t.pos)
+	return true
+}
+
+// stringBody consumes a string after its opening quote, splitting out
+// interpolations and placeholders
+func (t *nixTokenizer) stringBody(indented bool) {
+	start := t.pos - 1
+	if indented {
+		start--
+	}
+	for t.pos < len(t.src) {
+		switch {
+		case !indented && t.src[t.pos] == '\\':
+			t.pos += 2
+		case !indented && t.src[t.pos] == '"':
+			t.pos++
+			t.emit(NixString, start, t.pos)
+			return
+		case indented && (t.peek("'''") || t.peek("''$") || t.peek("''\\")):
+			t.pos += 3
+		case indented && t.peek("''"):
+			t.pos += 2
+			t.emit(NixString, start, t.pos)
+			return
+		case t.peek("${"):
+			t.emit(NixString, start, t.pos)
+			t.interpolation()
+			start = t.pos
+		case t.peek("{{"):
+			t.emit(NixString, start, t.pos)
+			if !t.placeholder() {
+				t.pos++
+				t.emit(NixString, t.pos-1, t.pos)
+			}
+			start = t.pos
+		default:
+			t.pos++
+		}
+	}
+	t.pos = min(t.pos, len(t.src))
+	t.emit(NixString, start, t.pos)
+}
+
+// interpolation consumes ${ ... } up to its matching brace
+func (t *nixTokenizer) interpolation() {
+	start := t.pos
+	depth := 0
+	for t.pos < len(t.src) {
+		switch t.src[t.pos] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				t.pos++
+				t.emit(NixInterpolation, start, t.pos)
+				return
+			}
+		case '\n':
+			// An unterminated interpolation ends with the line
+			t.emit(NixInterpolation, start, t.pos)
+			return
+		}
+		t.pos++
+	}
+	t.emit(NixInterpolation, start, t.pos)
+}
+
+// path consumes ./relative, ../relative, ~/home and <lookup> paths
+func (t *nixTokenizer) path() bool {
+	if !t.wordStart() {
+		return false
+	}
+	start := t.pos
+	if t.src[t.pos] == '<' {
+		end := strings.IndexByte(t.src[t.pos:], '>')
+		if end < 2 {
+			return false
+		}
+		for _, c := range t.src[t.pos+1 : t.pos+end] {
+			if !(isNixIdentChar(byte(c)) || c == '/' || c == '.') {
+				return false
+			}
+		}
+		t.pos += end + 1
+		t.emit(NixPath, start, t.pos)
+		return true
+	}
+	if !(t.peek("./") || t.peek("../") || t.peek("~/")) {
+		return false
+	}
+	for t.pos < len(t.src) && (isNixIdentChar(t.src[t.pos]) || strings.IndexByte("./~+", t.src[t.pos]) >= 0) {
+		t.pos++
+	}
+	t.emit(NixPath, start, t.pos)
+	return true
+}
+
+// word consumes an identifier or attribute path, classifying it as a
+// keyword, a literal or the left side of a binding
+func (t *nixTokenizer) word() {
+	start := t.pos
+	for t.pos < len(t.src) && isNixIdentChar(t.src[t.pos]) {
+		t.pos++
+	}
+	word := t.src[start:t.pos]
+	switch {
+	case nixKeywords[word]:
+		t.emit(NixKeyword, start, t.pos)
+		return
+	case nixLiterals[word]:
+		t.emit(NixLiteral, start, t.pos)
+		return
+	}
+
+	// Follow a dotted path (quoted segments included) and look for "="
+	end := t.pos
+	for end < len(t.src) && t.src[end] == '.' {
+		seg := end + 1
+		if seg < len(t.src) && t.src[seg] == '"' {
+			q := strings.IndexByte(t.src[seg+1:], '"')
+			if q < 0 {
+				break
+			}
+			end = seg + q + 2
+			continue
+		}
+		for seg < len(t.src) && isNixIdentChar(t.src[seg]) {
+			seg++
+		}
+		if seg == end+1 {
+			break
+		}
+		end = seg
+	}
+	after := end
+	for after < len(t.src) && (t.src[after] == ' ' || t.src[after] == '\t') {
+		after++
+	}
+	if after < len(t.src) && t.src[after] == '=' && (after+1 == len(t.src) || t.src[after+1] != '=') {
+		t.pos = end
+		t.emit(NixAttr, start, t.pos)
+		return
+	}
+	t.emit(NixPlain, start, t.pos)
+}
@@ -0,0 +1,476 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A minimal Nix scanner for the configuration.nix importer. It evaluates
+// nothing: it only splits attribute sets into bindings, skipping strings,
+// comments and nested brackets.
+
+// nixBinding is one "path = value;" or "inherit ...;" of an attribute set
+type nixBinding struct {
+	Path     []string // attribute path; quoted segments keep their quotes
+	Value    string   // value source without the ';' ("inherit ..." for Inherit)
+	Comment  []string // comment lines right above the binding
+	Trailing string   // comment after the ';' on the same line
+	Col      int      // column where the binding starts
+	Inherit  bool
+
+	vStart, vEnd int // value offsets in the scanned source
+}
+
+func (b nixBinding) key() string { return strings.Join(b.Path, ".") }
+
+type nixScanner struct {
+	src string
+	pos int
+}
+
+func (s *nixScanner) errorf(format string, args ...any) error {
+	line := strings.Count(s.src[:min(s.pos, len(s.src))], "\n") + 1
+	return fmt.Errorf("linha %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (s *nixScanner) peek(prefix string) bool {
+	return strings.HasPrefix(s.src[s.pos:], prefix)
+}
+
+// keyword reports whether the source continues with the keyword kw
+func (s *nixScanner) keyword(kw string) bool {
+	if !s.peek(kw) {
+		return false
+	}
+	next := s.pos + len(kw)
+	return next == len(s.src) || !isNixIdentChar(s.src[next])
+}
+
+// wordStart reports whether pos starts a word (not inside an identifier
+// or an attribute path)
+func (s *nixScanner) wordStart() bool {
+	return s.pos == 0 || !(isNixIdentChar(s.src[s.pos-1]) || s.src[s.pos-1] == '.')
+}
+
+func isNixIdentChar(c byte) bool {
+	return c == '_' || c == '-' || c == '\'' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipSpace skips whitespace and comments and returns the "#" comment lines
+// found, dropping those separated from the next token by a blank line
+func (s *nixScanner) skipSpace() []string {
+	var comments []string
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case c == '\n':
+			if s.blankLineAhead() {
+				comments = nil
+			}
+			s.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			s.pos++
+		case c == '#':
+			end := strings.IndexByte(s.src[s.pos:], '\n')
+			if end < 0 {
+				end = len(s.src) - s.pos
+			}
+			comments = append(comments, strings.TrimSpace(s.src[s.pos:s.pos+end]))
+			s.pos += end
+		case s.peek("/*"):
+			end := strings.Index(s.src[s.pos+2:], "*/")
+			if end < 0 {
+				s.pos = len(s.src)
+				return comments
+			}
+			s.pos += end + 4
+		default:
+			return comments
+		}
+	}
+	return comments
+}
+
+// blankLineAhead reports whether the line after the newline at pos is empty
+func (s *nixScanner) blankLineAhead() bool {
+	rest := s.src[s.pos+1:]
+	end := strings.IndexByte(rest, '\n')
+	return end >= 0 && strings.TrimSpace(rest[:end]) == ""
+}
+
+// skipString skips a "..." string starting at pos
+func (s *nixScanner) skipString() error {
+	start := s.pos
+	s.pos++
+	for s.pos < len(s.src) {
+		switch {
+		case s.src[s.pos] == '\\':
+			s.pos += 2
+		case s.src[s.pos] == '"':
+			s.pos++
+			return nil
+		case s.peek("${"):
+			if err := s.skipInterpolation(); err != nil {
+				return err
+			}
+		default:
+			s.pos++
+		}
+	}
+	s.pos = start
+	return s.errorf("string sem fim")
+}
+
+// skipIndented skips a ”...” string starting at pos
+func (s *nixScanner) skipIndented() error {
+	start := s.pos
+	s.pos += 2
+	for s.pos < len(s.src) {
+		switch {
+		case s.peek("'''"), s.peek("''$"):
+			s.pos += 3
+		case s.peek("''\\"):
+			s.pos += 4
+		case s.peek("''"):
+			s.pos += 2
+			return nil
+		case s.peek("${"):
+			if err := s.skipInterpolation(); err != nil {
+				return err
+			}
+		default:
+			s.pos++
+		}
+	}
+	s.pos = start
+	return s.errorf("string '' sem fim")
+}
+
+func (s *nixScanner) skipInterpolation() error {
+	s.pos += 2
+	if err := s.scanUntil("}"); err != nil {
+		return err
+	}
+	s.pos++
+	return nil
+}
+
+// scanUntil advances to the first byte of stops found outside strings,
+// comments and brackets. A closing bracket that is not in stops and has no
+// opening one is an error.
+func (s *nixScanner) scanUntil(stops string) error {
+	var closers []byte
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		if len(closers) == 0 && strings.IndexByte(stops, c) >= 0 {
+			return nil
+		}
+		switch {
+		case c == '#' || s.peek("/*"):
+			s.skipSpace()
+		case c == '"':
+			if err := s.skipString(); err != nil {
+				return err
+			}
+		case s.peek("''") && (s.pos == 0 || !isNixIdentChar(s.src[s.pos-1])):
+			if err := s.skipIndented(); err != nil {
+				return err
+			}
+		case s.peek("${"):
+			closers = append(closers, '}')
+			s.pos += 2
+		case s.wordStart() && (s.keyword("with") || s.keyword("assert")):
+			// "with x;" and "assert x;" carry their own ';'
+			for s.pos < len(s.src) && isNixIdentChar(s.src[s.pos]) {
+				s.pos++
+			}
+			if err := s.scanUntil(";"); err != nil {
+				return err
+			}
+			s.pos++
+		case s.wordStart() && s.keyword("let"):
+			s.pos += 3
+			for {
+				s.skipSpace()
+				if s.keyword("in") {
+					s.pos += 2
+					break
+				}
+				if err := s.scanUntil(";"); err != nil {
+					return err
+				}
+				s.pos++
+			}
+		case c == '{':
+			closers = append(closers, '}')
+			s.pos++
+		case c == '[':
+			closers = append(closers, ']')
+			s.pos++
+		case c == '(':
+			closers = append(closers, ')')
+			s.pos++
+		case c == '}' || c == ']' || c == ')':
+			if len(closers) == 0 || closers[len(closers)-1] != c {
+				return s.errorf("'%c' inesperado", c)
+			}
+			closers = closers[:len(closers)-1]
+			s.pos++
+		default:
+			s.pos++
+		}
+	}
+	return s.errorf("fim de arquivo inesperado (faltou '%s')", stops)
+}
+
+func (s *nixScanner) column(pos int) int {
+	return pos - (strings.LastIndexByte(s.src[:pos], '\n') + 1)
+}
+
+// bindings reads bindings up to a '}' at pos or the end of the source
+func (s *nixScanner) bindings() ([]nixBinding, error) {
+	var out []nixBinding
+	for {
+		comments := s.skipSpace()
+		if s.pos >= len(s.src) || s.src[s.pos] == '}' {
+			return out, nil
+		}
+		start := s.pos
+		b := nixBinding{Comment: comments, Col: s.column(start)}
+		if s.keyword("inherit") {
+			if err := s.scanUntil(";"); err != nil {
+				return nil, err
+			}
+			b.Inherit = true
+			b.Value = strings.TrimSpace(s.src[start:s.pos])
+			b.vStart, b.vEnd = start, s.pos
+		} else {
+			if err := s.scanUntil("=;"); err != nil {
+				return nil, err
+			}
+			if s.src[s.pos] != '=' {
+				return nil, s.errorf("esperado '=' depois de %q", strings.TrimSpace(s.src[start:s.pos]))
+			}
+			b.Path = splitNixPath(s.src[start:s.pos])
+			s.pos++
+			s.skipSpace()
+			b.vStart = s.pos
+			if err := s.scanUntil(";"); err != nil {
+				return nil, err
+			}
+			b.vEnd = s.pos
+			for b.vEnd > b.vStart && strings.ContainsRune(" \t\r\n", rune(s.src[b.vEnd-1])) {
+				b.vEnd--
+			}
+			b.Value = s.src[b.vStart:b.vEnd]
+		}
+		s.pos++ // ';'
+		for s.pos < len(s.src) && (s.src[s.pos] == ' ' || s.src[s.pos] == '\t') {
+			s.pos++
+		}
+		if s.pos < len(s.src) && s.src[s.pos] == '#' {
+			end := strings.IndexByte(s.src[s.pos:], '\n')
+			if end < 0 {
+				end = len(s.src) - s.pos
+			}
+			b.Trailing = strings.TrimSpace(s.src[s.pos : s.pos+end])
+			s.pos += end
+		}
+		out = append(out, b)
+	}
+}
+
+// splitNixPath splits "a.b.\"c.d\"" into its segments
+func splitNixPath(src string) []string {
+	var parts []string
+	var cur strings.Builder
+	quoted := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(src):
+			cur.WriteByte(c)
+			cur.WriteByte(src[i+1])
+			i++
+		case c == '"':
+			quoted = !quoted
+			cur.WriteByte(c)
+		case c == '.' && !quoted:
+			parts = append(parts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		case (c == ' ' || c == '\t' || c == '\n' || c == '\r') && !quoted:
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	return append(parts, strings.TrimSpace(cur.String()))
+}
+
+// attrsetBindings returns the bindings of b's value when it is a plain
+// attribute set literal ("{ ... }", not rec and not merged with //)
+func attrsetBindings(src string, b nixBinding) ([]nixBinding, bool) {
+	if b.Inherit || b.vEnd-b.vStart < 2 || src[b.vStart] != '{' || src[b.vEnd-1] != '}' {
+		return nil, false
+	}
+	sub := &nixScanner{src: src[:b.vEnd-1], pos: b.vStart + 1}
+	inner, err := sub.bindings()
+	if err != nil || sub.pos != b.vEnd-1 {
+		return nil, false
+	}
+	return inner, true
+}
+
+// parseNixConfig splits a NixOS configuration ("{ config, pkgs, ... }: { ... }"
+// or a bare attribute set) into its argument names and top-level bindings
+func parseNixConfig(src string) ([]string, []nixBinding, error) {
+	s := &nixScanner{src: src}
+	s.skipSpace()
+
+	var args []string
+	if s.pos < len(src) && (src[s.pos] == '{' || isNixIdentChar(src[s.pos])) {
+		start := s.pos
+		// "args@{ ... }:" or "{ ... }@args:" or "{ ... }:"
+		for s.pos < len(src) && isNixIdentChar(src[s.pos]) {
+			s.pos++
+		}
+		s.skipSpace()
+		if s.pos < len(src) && src[s.pos] == '@' {
+			s.pos++
+			s.skipSpace()
+		} else if s.pos != start {
+			s.pos = start
+		}
+		if s.pos < len(src) && src[s.pos] == '{' {
+			open := s.pos
+			s.pos++
+			if err := s.scanUntil("}"); err != nil {
+				return nil, nil, err
+			}
+			inner := src[open+1 : s.pos]
+			s.pos++
+			s.skipSpace()
+			if s.pos < len(src) && src[s.pos] == '@' {
+				s.pos++
+				for s.pos < len(src) && isNixIdentChar(src[s.pos]) {
+					s.pos++
+				}
+				s.skipSpace()
+			}
+			if s.pos < len(src) && src[s.pos] == ':' {
+				s.pos++
+				for _, a := range strings.Split(inner, ",") {
+					a, _, _ = strings.Cut(a, "?")
+					if a = strings.TrimSpace(a); a != "" && a != "..." {
+						args = append(args, a)
+					}
+				}
+			} else {
+				s.pos = open // not a function: the file is the attribute set
+			}
+		} else {
+			s.pos = start
+		}
+	}
+
+	s.skipSpace()
+	if s.keyword("let") || s.keyword("with") {
+		return nil, nil, s.errorf("'let'/'with' no nível superior não é suportado: mova as definições para dentro dos atributos")
+	}
+	if s.pos >= len(src) || src[s.pos] != '{' {
+		return nil, nil, s.errorf("esperado um conjunto de atributos '{ ... }'")
+	}
+	s.pos++
+	binds, err := s.bindings()
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.pos >= len(src) {
+		return nil, nil, s.errorf("'}' final não encontrado")
+	}
+	s.pos++
+	s.skipSpace()
+	if s.pos < len(src) {
+		return nil, nil, s.errorf("conteúdo inesperado depois do '}' final")
+	}
+	return args, binds, nil
+}
+
+// normalizeNix drops comments and collapses whitespace so that equivalent
+// values compare equal regardless of layout
+func normalizeNix(src string) string {
+	s := &nixScanner{src: src}
+	var sb strings.Builder
+	for s.pos < len(src) {
+		start := s.pos
+		switch c := src[s.pos]; {
+		case c == '#' || s.peek("/*"):
+			s.skipSpace()
+			sb.WriteByte(' ')
+			continue
+		case c == '"':
+			if s.skipString() != nil {
+				s.pos = len(src)
+			}
+		case s.peek("''") && (s.pos == 0 || !isNixIdentChar(src[s.pos-1])):
+			if s.skipIndented() != nil {
+				s.pos = len(src)
+			}
+		default:
+			s.pos++
+		}
+		sb.WriteString(src[start:s.pos])
+	}
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// nixStringLiteral returns the value of a plain "..." string
+func nixStringLiteral(src string) (string, bool) {
+	src = strings.TrimSpace(src)
+	if len(src) < 2 || src[0] != '"' {
+		return "", false
+	}
+	s := &nixScanner{src: src}
+	if s.skipString() != nil || s.pos != len(src) || strings.Contains(src, "${") {
+		return "", false
+	}
+	r := strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\t`, "\t", `\$`, "$")
+	return r.Replace(src[1 : len(src)-1]), true
+}
+
+// nixStringListLiteral returns the values of a [ "a" "b" ] list
+func nixStringListLiteral(src string) ([]string, bool) {
+	src = strings.TrimSpace(src)
+	if len(src) < 2 || src[0] != '[' || src[len(src)-1] != ']' {
+		return nil, false
+	}
+	s := &nixScanner{src: src[:len(src)-1], pos: 1}
+	items := []string{}
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.src) {
+			return items, true
+		}
+		start := s.pos
+		if s.src[s.pos] != '"' || s.skipString() != nil {
+			return nil, false
+		}
+		v, ok := nixStringLiteral(s.src[start:s.pos])
+		if !ok {
+			return nil, false
+		}
+		items = append(items, v)
+	}
+}
+
+// dedentNix removes col columns of indentation from every line but the first
+func dedentNix(src string, col int) string {
+	lines := strings.Split(src, "\n")
+	for i := 1; i < len(lines); i++ {
+		n := 0
+		for n < col && n < len(lines[i]) && (lines[i][n] == ' ' || lines[i][n] == '\t') {
+			n++
+		}
+		lines[i] = lines[i][n:]
+	}
+	return strings.Join(lines, "\n")
+}
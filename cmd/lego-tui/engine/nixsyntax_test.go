@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// bindingLines renders bindings as "path = value", "inherit ..." lines
+func bindingLines(binds []nixBinding) []string {
+	var out []string
+	for _, b := range binds {
+		if b.Inherit {
+			out = append(out, b.Value)
+		} else {
+			out = append(out, b.key()+" = "+b.Value)
+		}
+	}
+	return out
+}
+
+func TestParseNixConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		args  []string
+		binds []string
+		err   string
+	}{
+		{
+			name:  "bare attribute set",
+			src:   "{ a = 1; }\n",
+			binds: []string{"a = 1"},
+		},
+		{
+			name:  "function arguments",
+			src:   "args@{ config, lib ? null, ... }: { a = 1; }",
+			args:  []string{"config", "lib"},
+			binds: []string{"a = 1"},
+		},
+		{
+			name: "strings",
+			src: `{ a = "x; }"; b = "aspas \" e ; "; c = ''
+    linha; com } e ''${escapado}
+  ''; "d.e" = 1; }`,
+			binds: []string{
+				`a = "x; }"`,
+				`b = "aspas \" e ; "`,
+				"c = ''\n    linha; com } e ''${escapado}\n  ''",
+				`"d.e" = 1`,
+			},
+		},
+		{
+			name: "antiquotation",
+			src:  `{ a = "${pkgs.hello}/bin/${if x then "a;b" else "}"}"; b = ''${lib.concatStringsSep ";" [ "x" ]}''; ${name} = 1; }`,
+			binds: []string{
+				`a = "${pkgs.hello}/bin/${if x then "a;b" else "}"}"`,
+				`b = ''${lib.concatStringsSep ";" [ "x" ]}''`,
+				"${name} = 1",
+			},
+		},
+		{
+			name: "comments",
+			src: `{
+  # solto; }
+
+  # do a
+  a = 1; # depois; }
+  /* bloco; } */ b = /* dentro */ 2;
+}`,
+			binds: []string{"a = 1", "b = 2"},
+		},
+		{
+			name: "nested attribute sets and let",
+			src: `{
+  services.x = { enable = true; settings = { y = [ 1 2 ]; }; };
+  inherit (pkgs) lib;
+  z = let v = { }; in v;
+  w = with pkgs; [ a ];
+}`,
+			binds: []string{
+				"services.x = { enable = true; settings = { y = [ 1 2 ]; }; }",
+				"inherit (pkgs) lib",
+				"z = let v = { }; in v",
+				"w = with pkgs; [ a ]",
+			},
+		},
+		{name: "top-level with", src: "{ pkgs, ... }: with pkgs; { }", err: "linha 1: 'let'/'with' no nível superior"},
+		{name: "unterminated string", src: "{\n  a = \"x;\n}", err: "linha 2"},
+		{name: "missing closing brace", src: "{ a = { b = 1; };", err: "fim de arquivo inesperado (faltou '}')"},
+		{name: "stray bracket", src: "{ a = 1 ]; }", err: "']' inesperado"},
+		{name: "trailing content", src: "{ } { }", err: "conteúdo inesperado"},
+		{name: "missing equals", src: "{ a; }", err: `esperado '=' depois de "a"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, binds, err := parseNixConfig(tt.src)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(args, tt.args) {
+				t.Errorf("args = %q, want %q", args, tt.args)
+			}
+			if got := bindingLines(binds); !slices.Equal(got, tt.binds) {
+				t.Errorf("bindings = %q, want %q", got, tt.binds)
+			}
+		})
+	}
+}
+
+func TestParseNixConfigComments(t *testing.T) {
+	_, binds, err := parseNixConfig(`{
+  # solto
+
+  # do a
+  # segunda linha
+  a = 1; # depois
+  b = 2;
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := binds[0].Comment; !slices.Equal(got, []string{"# do a", "# segunda linha"}) {
+		t.Errorf("a comments = %q", got)
+	}
+	if binds[0].Trailing != "# depois" {
+		t.Errorf("a trailing = %q", binds[0].Trailing)
+	}
+	if len(binds[1].Comment) != 0 || binds[1].Trailing != "" {
+		t.Errorf("b comments = %q, trailing %q", binds[1].Comment, binds[1].Trailing)
+	}
+}
+
+func TestAttrsetBindingsNested(t *testing.T) {
+	src := `{
+  services.x = {
+    enable = true;
+    settings = { y = "a;b"; z.w = 1; };
+  };
+  merged = { a = 1; } // { b = 2; };
+  recursive = rec { a = 1; b = a; };
+}`
+	_, binds, err := parseNixConfig(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flat []string
+	for _, st := range flattenBinding(src, binds[0], nil, 0) {
+		flat = append(flat, st.key()+" = "+st.raw)
+	}
+	want := []string{"services.x.enable = true", `services.x.settings.y = "a;b"`, "services.x.settings.z.w = 1"}
+	if !slices.Equal(flat, want) {
+		t.Errorf("flattened = %q, want %q", flat, want)
+	}
+	for _, b := range binds[1:] {
+		if _, ok := attrsetBindings(src, b); ok {
+			t.Errorf("%s read as a plain attribute set", b.key())
+		}
+	}
+}
+
+func TestNixStringLiterals(t *testing.T) {
+	strs := []struct {
+		src, want string
+		ok        bool
+	}{
+		{`"simples"`, "simples", true},
+		{` "com \"aspas\" e \$HOME\n" `, "com \"aspas\" e $HOME\n", true},
+		{`"${pkgs.hello}"`, "", false},
+		{`''indentado''`, "", false},
+		{`"aberto`, "", false},
+		{`pkgs.hello`, "", false},
+	}
+	for _, tt := range strs {
+		got, ok := nixStringLiteral(tt.src)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("nixStringLiteral(%s) = %q, %v; want %q, %v", tt.src, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	lists := []struct {
+		src  string
+		want []string
+		ok   bool
+	}{
+		{`[ "wheel" "networkmanager" ]`, []string{"wheel", "networkmanager"}, true},
+		{"[\n  # grupos\n  \"wheel\"\n]", []string{"wheel"}, true},
+		{`[ ]`, []string{}, true},
+		{`[ "wheel" config.x ]`, nil, false},
+		{`[ "${x}" ]`, nil, false},
+	}
+	for _, tt := range lists {
+		got, ok := nixStringListLiteral(tt.src)
+		if !slices.Equal(got, tt.want) || ok != tt.ok {
+			t.Errorf("nixStringListLiteral(%s) = %q, %v; want %q, %v", tt.src, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParamTypes lists the supported module parameter types. A "[]" suffix
+// (e.g. "port[]") declares a list of that type.
+var ParamTypes = []string{"string", "int", "bool", "port"}
+
+var paramNameRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// ModuleParam is a typed parameter declared in a module header as
+//
+//	# PARAM: NAME | type | default | description
+//
+// and referenced in the body as {{NAME}}.
+type ModuleParam struct {
+	Name        string
+	Type        string
+	Default     string // raw header text; empty means the preset must set it
+	Description string
+}
+
+// IsList reports whether the parameter holds a list
+func (p ModuleParam) IsList() bool {
+	return strings.HasSuffix(p.Type, "[]")
+}
+
+func (p ModuleParam) elemType() string {
+	return strings.TrimSuffix(p.Type, "[]")
+}
+
+// parseParamLine parses the value of a "# PARAM:" header line
+func parseParamLine(value string) (ModuleParam, error) {
+	fields := strings.Split(value, "|")
+	if len(fields) < 3 || len(fields) > 4 {
+		return ModuleParam{}, fmt.Errorf("PARAM deve ser 'NOME | tipo | padrão | descrição': %q", value)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	p := ModuleParam{Name: fields[0], Type: fields[1], Default: fields[2]}
+	if len(fields) == 4 {
+		p.Description = fields[3]
+	}
+	if !paramNameRe.MatchString(p.Name) {
+		return p, fmt.Errorf("nome de parâmetro inválido: %q (use MAIÚSCULAS_COM_UNDERSCORE)", p.Name)
+	}
+	if _, reserved := presetValues(&Preset{})["{{"+p.Name+"}}"]; reserved {
+		return p, fmt.Errorf("parâmetro %s conflita com um placeholder do preset", p.Name)
+	}
+	known := false
+	for _, t := range ParamTypes {
+		if p.elemType() == t {
+			known = true
+		}
+	}
+	if !known {
+		return p, fmt.Errorf("tipo de parâmetro desconhecido: %s (use %s, com [] para listas)",
+			p.Type, strings.Join(ParamTypes, ", "))
+	}
+	if p.Default != "" {
+		if _, err := ParseParamInput(p, p.Default); err != nil {
+			return p, fmt.Errorf("padrão inválido para %s: %w", p.Name, err)
+		}
+	}
+	return p, nil
+}
+
+// ParseParamInput converts text typed by the user (or a header default)
+// into a typed value. Lists are comma-separated.
+func ParseParamInput(p ModuleParam, text string) (any, error) {
+	text = strings.TrimSpace(text)
+	if !p.IsList() {
+		return parseScalar(p.elemType(), text)
+	}
+	var items []any
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		v, err := parseScalar(p.elemType(), item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func parseScalar(typ, text string) (any, error) {
+	switch typ {
+	case "string":
+		return text, nil
+	case "bool":
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%q não é bool (true/false)", text)
+		}
+		return b, nil
+	case "int", "port":
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q não é um inteiro", text)
+		}
+		return checkScalar(typ, n)
+	}
+	return nil, fmt.Errorf("tipo desconhecido: %s", typ)
+}
+
+// normalizeParam validates a value decoded from the preset TOML
+func normalizeParam(p ModuleParam, value any) (any, error) {
+	if !p.IsList() {
+		return normalizeScalar(p.elemType(), value)
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("esperava lista de %s, recebeu %T", p.elemType(), value)
+	}
+	var items []any
+	for _, item := range list {
+		v, err := normalizeScalar(p.elemType(), item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+	return items, nil
+}
+
+func normalizeScalar(typ string, value any) (any, error) {
+	switch typ {
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case "int", "port":
+		switch n := value.(type) {
+		case int64:
+			return checkScalar(typ, n)
+		case int:
+			return checkScalar(typ, int64(n))
+		}
+	}
+	return nil, fmt.Errorf("esperava %s, recebeu %v (%T)", typ, value, value)
+}
+
+func checkScalar(typ string, n int64) (any, error) {
+	if typ == "port" && (n < 1 || n > 65535) {
+		return nil, fmt.Errorf("porta fora do intervalo 1-65535: %d", n)
+	}
+	return n, nil
+}
+
+// FormatParamInput renders a typed value back to the text form used by ParseParamInput
+func FormatParamInput(value any) string {
+	if list, ok := value.([]any); ok {
+		var parts []string
+		for _, item := range list {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// nixLiteral renders a validated value as a Nix expression
+func nixLiteral(value any) string {
+	switch v := value.(type) {
+	case string:
+		return nixString(v)
+	case []any:
+		var parts []string
+		for _, item := range v {
+			parts = append(parts, nixLiteral(item))
+		}
+		if len(parts) == 0 {
+			return "[ ]"
+		}
+		return "[ " + strings.Join(parts, " ") + " ]"
+	}
+	return fmt.Sprint(value)
+}
+
+func nixString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "${", `\${`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// ResolveParams merges preset values over header defaults and validates them
+func ResolveParams(rel string, mod *Module, values map[string]any) (map[string]any, error) {
+	resolved := map[string]any{}
+	declared := map[string]ModuleParam{}
+	for _, p := range mod.Params {
+		declared[p.Name] = p
+		if p.Default != "" {
+			v, _ := ParseParamInput(p, p.Default)
+			resolved[p.Name] = v
+		}
+	}
+	for name, raw := range values {
+		p, ok := declared[name]
+		if !ok {
+			return nil, fmt.Errorf("módulo '%s': parâmetro desconhecido no preset: %s", rel, name)
+		}
+		v, err := normalizeParam(p, raw)
+		if err != nil {
+			return nil, fmt.Errorf("módulo '%s': parâmetro %s: %w", rel, name, err)
+		}
+		resolved[name] = v
+	}
+	for _, p := range mod.Params {
+		if _, ok := resolved[p.Name]; !ok {
+			return nil, fmt.Errorf("módulo '%s': parâmetro obrigatório sem valor: %s", rel, p.Name)
+		}
+	}
+	return resolved, nil
+}
+
+// substituteParams replaces {{NAME}} placeholders in the module body
+func substituteParams(rel string, mod *Module, values map[string]any) error {
+	if len(mod.Params) == 0 {
+		if len(values) > 0 {
+			return fmt.Errorf("módulo '%s' não declara parâmetros, mas o preset define [params]", rel)
+		}
+		return nil
+	}
+	resolved, err := ResolveParams(rel, mod, values)
+	if err != nil {
+		return err
+	}
+	for _, p := range mod.Params {
+		mod.Body = strings.ReplaceAll(mod.Body, "{{"+p.Name+"}}", nixLiteral(resolved[p.Name]))
+	}
+	return nil
+}
@@ -11,13 +11,25 @@ import (
 )
 
 type Preset struct {
-	Host     HostConfig     `toml:"host"`
-	User     UserConfig     `toml:"user"`
-	Locale   LocaleConfig   `toml:"locale"`
-	Modules  ModulesConfig  `toml:"modules"`
-	Metadata MetadataConfig `toml:"metadata"`
+	Host       HostConfig       `toml:"host"`
+	User       *UserConfig      `toml:"user,omitempty"` // legacy single-user table, moved into Users on load
+	Users      []UserConfig     `toml:"users"`
+	Locale     LocaleConfig     `toml:"locale"`
+	Modules    ModulesConfig    `toml:"modules"`
+	Params     ParamsConfig     `toml:"params,omitempty"`
+	Rebuild    RebuildConfig    `toml:"rebuild,omitempty"`
+	Encryption EncryptionConfig `toml:"encryption,omitempty"`
+	Disko      DiskoConfig      `toml:"disko,omitempty"`
+	Metadata   MetadataConfig   `toml:"metadata"`
+
+	unknownKeys []string // keys in the file that match no field
+	ignoredUser bool     // both [user] and [[users]] were present
 }
 
+// ParamsConfig maps a module (category/name) to its parameter values,
+// written as [params."category/name"] tables in the preset TOML
+type ParamsConfig map[string]map[string]any
+
 type HostConfig struct {
 	PresetName   string `toml:"preset_name"`
 	HostName     string `toml:"host_name"`
@@ -25,9 +37,70 @@ type HostConfig struct {
 }
 
 type UserConfig struct {
-	Name            string `toml:"name"`
-	Initialpassword string `toml:"initialPassword"`
-	Description     string `toml:"description"`
+	Name            string       `toml:"name"`
+	Initialpassword string       `toml:"initialPassword,omitempty"`
+	HashedPassword  string       `toml:"hashedPassword,omitempty"` // crypt(3) hash, used instead of initialPassword
+	Description     string       `toml:"description"`
+	Groups          []string     `toml:"groups"`
+	Shell           string       `toml:"shell,omitempty"`    // package name, e.g. fish; empty keeps the NixOS default
+	SSHKeys         []string     `toml:"ssh_keys,omitempty"` // openssh.authorizedKeys.keys
+	Home            []string     `toml:"home,omitempty"`     // Home Manager modules (home/<name>)
+	Params          ParamsConfig `toml:"params,omitempty"`   // per-user values for home modules, over [params]
+}
+
+// legacyUserGroups were hardcoded in the template before [[users]] existed
+var legacyUserGroups = []string{"wheel", "networkmanager"}
+
+// PrimaryUser is the first user, the one {{USER_NAME}} refers to in modules
+func (p *Preset) PrimaryUser() UserConfig {
+	if len(p.Users) == 0 {
+		return UserConfig{}
+	}
+	return p.Users[0]
+}
+
+// PasswordWarnings returns each user's PasswordWarning, prefixed with the
+// user name when the preset has several users
+func (p *Preset) PasswordWarnings() []string {
+	var warnings []string
+	for _, u := range p.Users {
+		w := u.PasswordWarning()
+		if w == "" {
+			continue
+		}
+		if len(p.Users) > 1 {
+			w = u.Name + ": " + w
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings
+}
+
+// PasswordWarning describes why a user's password is unsafe to commit,
+// or returns "" when only a hash is stored
+func (u UserConfig) PasswordWarning() string {
+	switch {
+	case u.HashedPassword != "" && u.Initialpassword != "":
+		return "initialPassword em texto puro ainda presente (ignorado: hashedPassword tem prioridade)"
+	case u.HashedPassword != "":
+		return ""
+	case u.Initialpassword == DefaultPassword:
+		return "senha padrão '" + DefaultPassword + "' em texto puro — gere um hashedPassword"
+	case u.Initialpassword != "":
+		return "senha em texto puro no preset — gere um hashedPassword"
+	}
+	return "usuário sem senha definida (conta bloqueada, só acesso por chave SSH)"
+}
+
+// SetPassword stores the SHA-512 crypt hash of password and drops any plaintext
+func (u *UserConfig) SetPassword(password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	u.HashedPassword = hash
+	u.Initialpassword = ""
+	return nil
 }
 
 type LocaleConfig struct {
@@ -58,9 +131,31 @@ type MetadataConfig struct {
 // LoadPreset reads a .toml preset file
 func LoadPreset(path string) (*Preset, error) {
 	var p Preset
-	if _, err := toml.DecodeFile(path, &p); err != nil {
+	meta, err := toml.DecodeFile(path, &p)
+	if err != nil {
 		return nil, fmt.Errorf("erro ao carregar preset: %w", err)
 	}
+	for _, key := range meta.Undecoded() {
+		// [params] values are free-form and checked against the modules
+		if len(key) > 0 && key[0] == "params" || len(key) > 1 && key[0] == "users" && key[1] == "params" {
+			continue
+		}
+		p.unknownKeys = append(p.unknownKeys, key.String())
+	}
+
+	// The old [user] table becomes the only [[users]] entry
+	if p.User != nil {
+		if len(p.Users) == 0 {
+			u := *p.User
+			if u.Groups == nil {
+				u.Groups = append([]string{}, legacyUserGroups...)
+			}
+			p.Users = []UserConfig{u}
+		} else {
+			p.ignoredUser = true
+		}
+		p.User = nil
+	}
 	return &p, nil
 }
 
@@ -112,11 +207,12 @@ func NewDefaultPreset(name, userName string) *Preset {
 			HostName:     name,
 			StateVersion: "26.05",
 		},
-		User: UserConfig{
+		Users: []UserConfig{{
 			Name:            userName,
-			Initialpassword: "123456",
+			Initialpassword: DefaultPassword,
 			Description:     "user <email@provider>",
-		},
+			Groups:          append([]string{}, legacyUserGroups...),
+		}},
 		Locale: LocaleConfig{
 			Timezone:         "America/Sao_Paulo",
 			DefaultLocale:    "en_US.UTF-8",
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PresetUse is a preset that includes a module
+type PresetUse struct {
+	Preset string
+	Via    string // "" when selected directly, "requires" when pulled in, or the users of a home module
+}
+
+// PresetsUsingModule lists the presets whose selection includes rel
+// (category/name): directly, through # REQUIRES: or, for home modules,
+// in some user's home list
+func PresetsUsingModule(root, rel string) []PresetUse {
+	presets, err := ListPresets(filepath.Join(root, "presets"))
+	if err != nil {
+		return nil
+	}
+	var all []ModuleInfo
+	var uses []PresetUse
+	for _, info := range presets {
+		p, err := LoadPreset(info.Path)
+		if err != nil {
+			continue
+		}
+		if IsHomeModule(rel) {
+			var users []string
+			for _, u := range p.Users {
+				if slices.Contains(u.Home, rel) {
+					users = append(users, u.Name)
+				}
+			}
+			if len(users) > 0 {
+				uses = append(uses, PresetUse{Preset: info.Name, Via: strings.Join(users, ", ")})
+			}
+			continue
+		}
+		if slices.Contains(p.Modules.Active, rel) {
+			uses = append(uses, PresetUse{Preset: info.Name})
+			continue
+		}
+		if all == nil {
+			all = ListModules(root)
+		}
+		if slices.Contains(ResolveModules(all, p.Modules.Active).Added, rel) {
+			uses = append(uses, PresetUse{Preset: info.Name, Via: "requires"})
+		}
+	}
+	return uses
+}
+
+// WrapModulePreview shows how BuildFlake wraps the module rel, inside the
+// list it is injected into. Params with a default are filled in; other
+// placeholders are left for the preset.
+func WrapModulePreview(root, rel string) (string, error) {
+	ctx, err := loadFlakeContext(root)
+	if err != nil {
+		return "", err
+	}
+	mod, err := LoadModule(filepath.Join(root, "modules", rel+".nix"))
+	if err != nil {
+		return "", fmt.Errorf("módulo '%s' inválido: %w", rel, err)
+	}
+	for _, p := range mod.Params {
+		if p.Default == "" {
+			continue
+		}
+		if v, err := ParseParamInput(p, p.Default); err == nil {
+			mod.Body = strings.ReplaceAll(mod.Body, "{{"+p.Name+"}}", nixLiteral(v))
+		}
+	}
+
+	if IsHomeModule(rel) {
+		return "home-manager.users.{{USER_NAME}} = {\n" +
+			"  imports = [\n" +
+			ctx.wrapModule(mod, "    ") +
+			"  ];\n" +
+			"};\n", nil
+	}
+	return "modules = [\n" +
+		"  # ...\n" +
+		ctx.wrapModule(mod, "  ") +
+		"];\n", nil
+}
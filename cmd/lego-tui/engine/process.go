@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// LogsDir holds the full output of every streamed process, relative to the root
+const LogsDir = "logs"
+
+// cancelGrace is how long a canceled process group gets before SIGKILL
+const cancelGrace = 5 * time.Second
+
+// maxBatch caps how many lines NextLines returns at once
+const maxBatch = 500
+
+// ErrCanceled is returned by Process.Err when Cancel stopped the process
+var ErrCanceled = errors.New("cancelado pelo usuário")
+
+var processSeq atomic.Int64
+
+// Process is a running command whose merged stdout/stderr is streamed
+// line by line and written in full to a log file.
+type Process struct {
+	ID      int64
+	LogPath string
+
+	cmd      *exec.Cmd
+	lines    chan string
+	done     chan struct{}
+	err      error
+	canceled atomic.Bool
+}
+
+// startProcess starts cmd in its own process group and streams its output.
+// The log is written to logs/<name>-<timestamp>.log under root.
+func startProcess(root, name string, cmd *exec.Cmd) (*Process, error) {
+	logDir := filepath.Join(root, LogsDir)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, fmt.Errorf("erro ao criar diretório de logs: %w", err)
+	}
+	logPath := filepath.Join(logDir, fmt.Sprintf("%s-%s.log", name, time.Now().Format("20060102-150405")))
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao criar log: %w", err)
+	}
+	fmt.Fprintf(logFile, "$ %s\n", strings.Join(cmd.Args, " "))
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		pr.Close()
+		pw.Close()
+		fmt.Fprintf(logFile, "erro ao iniciar: %v\n", err)
+		logFile.Close()
+		return nil, fmt.Errorf("erro ao iniciar %s: %w", cmd.Args[0], err)
+	}
+	// Only the child keeps the write end, so EOF means it has exited
+	pw.Close()
+
+	p := &Process{
+		ID:      processSeq.Add(1),
+		LogPath: logPath,
+		cmd:     cmd,
+		lines:   make(chan string, maxBatch+1), // +1 for the last droppedNote
+		done:    make(chan struct{}),
+	}
+	go p.stream(pr, logFile)
+	return p, nil
+}
+
+// finishedProcess wraps output that needs no real process (dry-run)
+func finishedProcess(lines []string, err error) *Process {
+	p := &Process{
+		ID:    processSeq.Add(1),
+		lines: make(chan string, len(lines)),
+		done:  make(chan struct{}),
+		err:   err,
+	}
+	for _, l := range lines {
+		p.lines <- l
+	}
+	close(p.lines)
+	close(p.done)
+	return p
+}
+
+func (p *Process) stream(pr *os.File, logFile *os.File) {
+	defer close(p.lines)
+	defer close(p.done)
+	defer logFile.Close()
+
+	reader := bufio.NewReader(pr)
+	dropped := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			logFile.WriteString(line)
+			line = strings.TrimRight(line, "\r\n")
+			// Progress bars redraw with \r; keep only the last state
+			if i := strings.LastIndex(line, "\r"); i >= 0 {
+				line = line[i+1:]
+			}
+			dropped = p.send(line, dropped)
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(logFile, "erro ao ler saída: %v\n", err)
+			}
+			break
+		}
+	}
+	pr.Close()
+	if dropped > 0 {
+		p.lines <- droppedNote(dropped) // the spare slot
+	}
+
+	p.err = p.cmd.Wait()
+	if p.canceled.Load() {
+		p.err = ErrCanceled
+	}
+	if p.err != nil {
+		fmt.Fprintf(logFile, "\n[%v]\n", p.err)
+	} else {
+		fmt.Fprintln(logFile, "\n[ok]")
+	}
+}
+
+// send queues line for NextLines without ever blocking: nothing may be
+// reading (the view was left). The stream is the only sender, so checking
+// the length is enough. Lines that do not fit are dropped (they are in the
+// log) and counted; a note with the count is queued once there is room.
+func (p *Process) send(line string, dropped int) int {
+	if dropped > 0 {
+		if len(p.lines) >= maxBatch {
+			return dropped + 1
+		}
+		p.lines <- droppedNote(dropped)
+	}
+	if len(p.lines) >= maxBatch {
+		return 1
+	}
+	p.lines <- line
+	return 0
+}
+
+func droppedNote(n int) string {
+	return fmt.Sprintf("… %d linhas omitidas (veja o log)", n)
+}
+
+// NextLines blocks for the next output line and returns it together with
+// any lines already buffered. ok is false once the process has finished
+// and all output has been read.
+func (p *Process) NextLines() (lines []string, ok bool) {
+	line, ok := <-p.lines
+	if !ok {
+		return nil, false
+	}
+	lines = append(lines, line)
+	for len(lines) < maxBatch {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return lines, true
+			}
+			lines = append(lines, line)
+		default:
+			return lines, true
+		}
+	}
+	return lines, true
+}
+
+// Err waits for the process to exit and returns its result
+func (p *Process) Err() error {
+	<-p.done
+	return p.err
+}
+
+// Cancel terminates the whole process group, escalating to SIGKILL if it
+// is still alive after a grace period.
+func (p *Process) Cancel() {
+	if p.cmd == nil || p.canceled.Swap(true) {
+		return
+	}
+	pgid := p.cmd.Process.Pid
+	syscall.Kill(-pgid, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-p.done:
+		case <-time.After(cancelGrace):
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+	}()
+}
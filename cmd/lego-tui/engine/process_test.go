@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessDropsLinesNobodyReads(t *testing.T) {
+	total := maxBatch * 3
+	p, err := ExecRunner{}.Start(t.TempDir(), "seq", Cmd("seq", "1", fmt.Sprint(total)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Err() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the process blocked on output nobody reads")
+	}
+
+	var got []string
+	for {
+		lines, ok := p.NextLines()
+		if !ok {
+			break
+		}
+		got = append(got, lines...)
+	}
+	if len(got) != maxBatch+1 || got[0] != "1" || got[maxBatch-1] != fmt.Sprint(maxBatch) {
+		t.Fatalf("read %d lines (%q...), want 1..%d and a note", len(got), got[:min(3, len(got))], maxBatch)
+	}
+	if want := droppedNote(total - maxBatch); got[maxBatch] != want {
+		t.Errorf("last line = %q, want %q", got[maxBatch], want)
+	}
+
+	log, err := os.ReadFile(p.LogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), fmt.Sprintf("\n%d\n", total)) {
+		t.Errorf("log misses the dropped lines:\n%s", log[len(log)-100:])
+	}
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// RebuildActions are the nixos-rebuild subcommands offered by Aplicar, in
+// the order they are cycled through
+var RebuildActions = []string{"switch", "boot", "test", "build", "dry-build", "dry-activate", "build-vm"}
+
+// rebuildActionInfo describes each action for the confirmation screen
+var rebuildActionInfo = map[string]string{
+	"switch":       "constrói, ativa agora e vira o padrão do boot",
+	"boot":         "constrói e vira o padrão do próximo boot, sem ativar agora",
+	"test":         "constrói e ativa agora, sem mudar o padrão do boot",
+	"build":        "só constrói (link ./result), sem ativar",
+	"dry-build":    "mostra o que seria construído ou baixado",
+	"dry-activate": "constrói e mostra o que a ativação mudaria",
+	"build-vm":     "constrói uma VM QEMU da configuração (./result/bin/run-*-vm)",
+}
+
+// rootActions change the running system or the bootloader and need sudo
+var rootActions = []string{"switch", "boot", "test", "dry-activate"}
+
+// nixOptionRe matches a nix.conf setting name, as passed to --option
+var nixOptionRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// specialisationRe matches a specialisation.<name> attribute
+var specialisationRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
+
+// RebuildConfig is how Aplicar runs nixos-rebuild for a preset, remembered
+// in its [rebuild] table
+type RebuildConfig struct {
+	Action         string            `toml:"action,omitempty"` // one of RebuildActions; empty means switch
+	Offline        bool              `toml:"offline,omitempty"`
+	Impure         bool              `toml:"impure,omitempty"`
+	Options        map[string]string `toml:"options,omitempty"`        // --option name value
+	Specialisation string            `toml:"specialisation,omitempty"` // switch and test only
+}
+
+// ActionName is the configured action, defaulting to switch
+func (c RebuildConfig) ActionName() string {
+	if c.Action == "" {
+		return "switch"
+	}
+	return c.Action
+}
+
+// ActionInfo explains what the configured action does
+func (c RebuildConfig) ActionInfo() string {
+	return rebuildActionInfo[c.ActionName()]
+}
+
+// NextAction moves to the following action in RebuildActions
+func (c *RebuildConfig) NextAction() {
+	i := slices.Index(RebuildActions, c.ActionName())
+	c.Action = RebuildActions[(i+1)%len(RebuildActions)]
+}
+
+// NeedsRoot reports whether the action runs through sudo
+func (c RebuildConfig) NeedsRoot() bool {
+	return slices.Contains(rootActions, c.ActionName())
+}
+
+// SpecialisationApplies reports whether --specialisation is passed for the
+// configured action
+func (c RebuildConfig) SpecialisationApplies() bool {
+	a := c.ActionName()
+	return c.Specialisation != "" && (a == "switch" || a == "test")
+}
+
+// SetOption parses "name=value" into Options; an empty value removes name
+func (c *RebuildConfig) SetOption(pair string) error {
+	name, value, _ := strings.Cut(pair, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !nixOptionRe.MatchString(name) {
+		return fmt.Errorf("opção %q inválida: use nome=valor (ex.: max-jobs=4)", pair)
+	}
+	if value == "" {
+		delete(c.Options, name)
+		return nil
+	}
+	if c.Options == nil {
+		c.Options = map[string]string{}
+	}
+	c.Options[name] = value
+	return nil
+}
+
+// Args are the nixos-rebuild arguments after the action and --flake
+func (c RebuildConfig) Args() []string {
+	var args []string
+	if c.Offline {
+		args = append(args, "--offline")
+	}
+	if c.Impure {
+		args = append(args, "--impure")
+	}
+	names := make([]string, 0, len(c.Options))
+	for name := range c.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--option", name, c.Options[name])
+	}
+	if c.SpecialisationApplies() {
+		args = append(args, "--specialisation", c.Specialisation)
+	}
+	return append(args, "--show-trace")
+}
+
+// String is the command line shown before applying
+func (c RebuildConfig) String() string {
+	return strings.Join(append([]string{"nixos-rebuild", c.ActionName()}, c.Args()...), " ")
+}
+
+// validate returns the problems in a [rebuild] table
+func (c RebuildConfig) validate() []PresetIssue {
+	var issues []PresetIssue
+	if c.Action != "" && !slices.Contains(RebuildActions, c.Action) {
+		issues = append(issues, PresetIssue{"rebuild.action",
+			fmt.Sprintf("%q inválida (use %s)", c.Action, strings.Join(RebuildActions, ", "))})
+	}
+	for name := range c.Options {
+		if !nixOptionRe.MatchString(name) {
+			issues = append(issues, PresetIssue{"rebuild.options", fmt.Sprintf("nome de opção %q inválido", name)})
+		}
+	}
+	if c.Specialisation != "" && !specialisationRe.MatchString(c.Specialisation) {
+		issues = append(issues, PresetIssue{"rebuild.specialisation", fmt.Sprintf("%q inválida", c.Specialisation)})
+	}
+	return issues
+}
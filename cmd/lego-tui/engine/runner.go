@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Command is an external command, described before it is run
+type Command struct {
+	Name     string
+	Args     []string
+	Dir      string
+	ReadOnly bool // only inspects the system (lsblk, nix eval); runs even in dry-run
+}
+
+// Cmd builds a Command
+func Cmd(name string, args ...string) Command {
+	return Command{Name: name, Args: args}
+}
+
+// String renders the command as a shell line
+func (c Command) String() string {
+	parts := []string{shellQuote(c.Name)}
+	for _, a := range c.Args {
+		parts = append(parts, shellQuote(a))
+	}
+	line := strings.Join(parts, " ")
+	if c.Dir != "" {
+		line = "(cd " + shellQuote(c.Dir) + " && " + line + ")"
+	}
+	return line
+}
+
+func shellQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (c Command) exec() *exec.Cmd {
+	cmd := exec.Command(c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	return cmd
+}
+
+// InteractiveCommand runs with the terminal attached (sudo prompts).
+// It satisfies bubbletea's ExecCommand.
+type InteractiveCommand interface {
+	Run() error
+	SetStdin(io.Reader)
+	SetStdout(io.Writer)
+	SetStderr(io.Writer)
+}
+
+// Runner executes external commands. Every side effect of the TUI and the
+// CLI goes through one, so a dry run only has to swap the runner.
+type Runner interface {
+	// Run executes c to completion and returns its combined output
+	Run(c Command) ([]byte, error)
+	// Start launches c and streams its output, logging to logs/<logName>-*.log
+	Start(root, logName string, c Command) (*Process, error)
+	// Interactive prepares c to run in the foreground terminal
+	Interactive(c Command) InteractiveCommand
+	// DryRun reports whether commands are only recorded, so that callers
+	// also skip the local writes that would describe them as done
+	DryRun() bool
+	// Drain returns the commands recorded instead of run since the last
+	// Drain, for showing what a dry run would have done
+	Drain() []Command
+}
+
+// ── Exec runner ──────────────────────────────────────────────
+
+// ExecRunner runs commands for real
+type ExecRunner struct{}
+
+func (ExecRunner) Run(c Command) ([]byte, error) {
+	return c.exec().CombinedOutput()
+}
+
+func (ExecRunner) Start(root, logName string, c Command) (*Process, error) {
+	return startProcess(root, logName, c.exec())
+}
+
+func (ExecRunner) Interactive(c Command) InteractiveCommand {
+	return &execInteractive{c.exec()}
+}
+
+func (ExecRunner) DryRun() bool { return false }
+
+func (ExecRunner) Drain() []Command { return nil }
+
+type execInteractive struct{ *exec.Cmd }
+
+func (e *execInteractive) SetStdin(r io.Reader)  { e.Stdin = r }
+func (e *execInteractive) SetStdout(w io.Writer) { e.Stdout = w }
+func (e *execInteractive) SetStderr(w io.Writer) { e.Stderr = w }
+
+// ── Recording runner ─────────────────────────────────────────
+
+// RecordedResult is the scripted outcome of a recorded command
+type RecordedResult struct {
+	Output string
+	Err    error
+}
+
+// RecordingRunner records commands instead of executing them. It backs the
+// --dry-run mode and doubles as a fake for exercising destructive paths.
+type RecordingRunner struct {
+	// Echo, when set, receives every command as it is recorded
+	Echo io.Writer
+	// Results scripts the outcome per Command.String(); unlisted commands
+	// succeed with no output
+	Results map[string]RecordedResult
+	// Passthrough, when set, really runs ReadOnly commands
+	Passthrough Runner
+
+	mu       sync.Mutex
+	commands []Command
+	shown    int
+}
+
+// NewDryRunner records side effects and prints them to echo (may be nil)
+func NewDryRunner(echo io.Writer) *RecordingRunner {
+	return &RecordingRunner{Echo: echo, Passthrough: ExecRunner{}}
+}
+
+func (r *RecordingRunner) record(c Command) RecordedResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, c)
+	if r.Echo != nil {
+		fmt.Fprintln(r.Echo, DryRunLine(c))
+	}
+	return r.Results[c.String()]
+}
+
+// Commands returns everything recorded so far
+func (r *RecordingRunner) Commands() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Command(nil), r.commands...)
+}
+
+// Drain returns the commands recorded since the last Drain (or Start)
+func (r *RecordingRunner) Drain() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := append([]Command(nil), r.commands[r.shown:]...)
+	r.shown = len(r.commands)
+	return pending
+}
+
+func (r *RecordingRunner) Run(c Command) ([]byte, error) {
+	if c.ReadOnly && r.Passthrough != nil {
+		return r.Passthrough.Run(c)
+	}
+	res := r.record(c)
+	return []byte(res.Output), res.Err
+}
+
+// Start returns an already finished process whose output lists the
+// commands recorded since the previous Start, this one included.
+func (r *RecordingRunner) Start(root, logName string, c Command) (*Process, error) {
+	if c.ReadOnly && r.Passthrough != nil {
+		return r.Passthrough.Start(root, logName, c)
+	}
+	res := r.record(c)
+	var lines []string
+	for _, pending := range r.Drain() {
+		lines = append(lines, DryRunLine(pending))
+	}
+	if res.Output != "" {
+		lines = append(lines, strings.Split(strings.TrimRight(res.Output, "\n"), "\n")...)
+	}
+	return finishedProcess(lines, res.Err), nil
+}
+
+func (r *RecordingRunner) Interactive(c Command) InteractiveCommand {
+	if c.ReadOnly && r.Passthrough != nil {
+		return r.Passthrough.Interactive(c)
+	}
+	return &recordedInteractive{runner: r, cmd: c}
+}
+
+func (r *RecordingRunner) DryRun() bool { return true }
+
+type recordedInteractive struct {
+	runner *RecordingRunner
+	cmd    Command
+}
+
+func (i *recordedInteractive) Run() error          { return i.runner.record(i.cmd).Err }
+func (i *recordedInteractive) SetStdin(io.Reader)  {}
+func (i *recordedInteractive) SetStdout(io.Writer) {}
+func (i *recordedInteractive) SetStderr(io.Writer) {}
+
+// DryRunLine formats a command that was recorded instead of executed
+func DryRunLine(c Command) string {
+	return "[dry-run] $ " + c.String()
+}
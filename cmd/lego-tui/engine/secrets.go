@@ -0,0 +1,316 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+)
+
+// SecretsDir holds the age-encrypted secrets, relative to the root.
+// Only ciphertext lives there, so it is safe to commit.
+const SecretsDir = "secrets"
+
+// RecipientsFile lists the public keys every secret is encrypted to
+const RecipientsFile = "recipients.txt"
+
+// HostAgeKeyPath is where a host looks for the LEGO age key at activation
+const HostAgeKeyPath = "/var/lib/lego/age.key"
+
+// agenixURL is the flake input added when a host uses secrets
+const agenixURL = "github:ryantm/agenix"
+
+var secretNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// ValidSecretName reports whether name can be used as secrets/<name>.age
+// and as an unquoted age.secrets attribute, so it starts with a letter
+func ValidSecretName(name string) bool {
+	return secretNameRe.MatchString(name)
+}
+
+// AgeKeyPath returns the local age identity file: $LEGO_AGE_KEY, or
+// lego/age.key under the user config dir. It never lives in the repo.
+func AgeKeyPath() string {
+	if p := os.Getenv("LEGO_AGE_KEY"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "lego", "age.key")
+}
+
+// GenerateAgeKey creates the local age identity and adds its public key to
+// the recipients. It refuses to overwrite an existing key.
+func GenerateAgeKey(root string) (string, error) {
+	path := AgeKeyPath()
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("chave age já existe em %s", path)
+	}
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", fmt.Errorf("erro ao gerar chave age: %w", err)
+	}
+	pub := id.Recipient().String()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("erro ao criar diretório da chave: %w", err)
+	}
+	content := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339), pub, id.String())
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("erro ao salvar chave age: %w", err)
+	}
+	if err := AddSecretRecipient(root, pub); err != nil {
+		return "", err
+	}
+	return pub, nil
+}
+
+// LocalAgePublicKey returns the public key of the local identity, or "" if
+// none has been generated yet
+func LocalAgePublicKey() string {
+	ids, err := loadAgeIdentities()
+	if err != nil {
+		return ""
+	}
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			return x.Recipient().String()
+		}
+	}
+	return ""
+}
+
+func loadAgeIdentities() ([]age.Identity, error) {
+	f, err := os.Open(AgeKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("chave age não encontrada (gere uma na aba Segredos): %w", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("chave age inválida em %s: %w", AgeKeyPath(), err)
+	}
+	return ids, nil
+}
+
+// SecretRecipients reads secrets/recipients.txt, skipping comments
+func SecretRecipients(root string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(root, SecretsDir, RecipientsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("erro ao ler %s: %w", RecipientsFile, err)
+	}
+	var keys []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, nil
+}
+
+// parseRecipient accepts age X25519 keys and SSH public keys, so hosts can
+// decrypt with their /etc/ssh host key
+func parseRecipient(s string) (age.Recipient, error) {
+	if strings.HasPrefix(s, "ssh-") {
+		return agessh.ParseRecipient(s)
+	}
+	return age.ParseX25519Recipient(s)
+}
+
+// AddSecretRecipient validates key and appends it to the recipients.
+// Existing secrets must be re-encrypted (RekeySecrets) to include it.
+func AddSecretRecipient(root, key string) error {
+	key = strings.TrimSpace(key)
+	if _, err := parseRecipient(key); err != nil {
+		return fmt.Errorf("chave pública inválida: %w", err)
+	}
+	existing, err := SecretRecipients(root)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(existing, key) {
+		return nil
+	}
+
+	dir := filepath.Join(root, SecretsDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("erro ao criar %s/: %w", SecretsDir, err)
+	}
+	path := filepath.Join(dir, RecipientsFile)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("erro ao abrir %s: %w", RecipientsFile, err)
+	}
+	defer f.Close()
+	if len(existing) == 0 {
+		fmt.Fprintln(f, "# Chaves públicas (age1... ou ssh-ed25519 ...) que podem ler os segredos")
+	}
+	_, err = fmt.Fprintln(f, key)
+	return err
+}
+
+// ListSecrets returns the names of secrets/<name>.age, sorted
+func ListSecrets(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, SecretsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("erro ao listar %s/: %w", SecretsDir, err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".age") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(e.Name(), ".age"))
+	}
+	return names, nil
+}
+
+// SecretPath returns the file of a secret
+func SecretPath(root, name string) string {
+	return filepath.Join(root, SecretsDir, name+".age")
+}
+
+// SecretExists reports whether secrets/<name>.age exists
+func SecretExists(root, name string) bool {
+	_, err := os.Stat(SecretPath(root, name))
+	return err == nil
+}
+
+// WriteSecret encrypts value to every recipient and saves it as
+// secrets/<name>.age, replacing any previous value
+func WriteSecret(root, name string, value []byte) error {
+	if !ValidSecretName(name) {
+		return fmt.Errorf("nome de segredo inválido: %q (use letras, números, '_' e '-', começando por letra)", name)
+	}
+	keys, err := SecretRecipients(root)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("nenhum destinatário em %s/%s: gere a chave age primeiro", SecretsDir, RecipientsFile)
+	}
+	var recipients []age.Recipient
+	for _, k := range keys {
+		r, err := parseRecipient(k)
+		if err != nil {
+			return fmt.Errorf("destinatário inválido %q: %w", k, err)
+		}
+		recipients = append(recipients, r)
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return fmt.Errorf("erro ao criptografar '%s': %w", name, err)
+	}
+	if _, err := w.Write(value); err != nil {
+		return fmt.Errorf("erro ao criptografar '%s': %w", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("erro ao criptografar '%s': %w", name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, SecretsDir), 0755); err != nil {
+		return fmt.Errorf("erro ao criar %s/: %w", SecretsDir, err)
+	}
+	return os.WriteFile(SecretPath(root, name), buf.Bytes(), 0644)
+}
+
+// ReadSecret decrypts secrets/<name>.age with the local identity
+func ReadSecret(root, name string) ([]byte, error) {
+	ids, err := loadAgeIdentities()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(SecretPath(root, name))
+	if err != nil {
+		return nil, fmt.Errorf("segredo '%s' não encontrado: %w", name, err)
+	}
+	defer f.Close()
+	r, err := age.Decrypt(f, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao descriptografar '%s': %w", name, err)
+	}
+	return io.ReadAll(r)
+}
+
+// RekeySecrets re-encrypts every secret to the current recipients and
+// returns how many were rewritten
+func RekeySecrets(root string) (int, error) {
+	names, err := ListSecrets(root)
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		value, err := ReadSecret(root, name)
+		if err != nil {
+			return i, err
+		}
+		if err := WriteSecret(root, name, value); err != nil {
+			return i, err
+		}
+	}
+	return len(names), nil
+}
+
+// DeleteSecret removes secrets/<name>.age
+func DeleteSecret(root, name string) error {
+	if err := os.Remove(SecretPath(root, name)); err != nil {
+		return fmt.Errorf("erro ao remover segredo '%s': %w", name, err)
+	}
+	return nil
+}
+
+// ── Flake wiring ────────────────────────────────────────────
+
+// moduleSecrets collects the secrets referenced by the modules, in order
+func moduleSecrets(mods []*Module) []string {
+	var names []string
+	for _, mod := range mods {
+		for _, s := range mod.List("SECRETS") {
+			if !slices.Contains(names, s) {
+				names = append(names, s)
+			}
+		}
+	}
+	return names
+}
+
+// secretsEntries renders the agenix module and one age.secrets declaration
+// per secret, as module list entries at indent
+func secretsEntries(names []string, indent string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n")
+	sb.WriteString(indent + "agenix.nixosModules.default\n")
+	sb.WriteString(indent + "# ── secrets ── Segredos age (secrets/*.age), descriptografados na ativação\n")
+	sb.WriteString(indent + "({ config, lib, ... }: {\n")
+	sb.WriteString(indent + "  age.identityPaths = [ \"" + HostAgeKeyPath + "\" ]\n")
+	sb.WriteString(indent + "    ++ map (k: k.path) (lib.filter (k: k.type == \"ed25519\") config.services.openssh.hostKeys);\n")
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("%s  age.secrets.%s.file = ./%s/%s.age;\n", indent, name, SecretsDir, name))
+	}
+	sb.WriteString(indent + "})\n")
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidSecretName(t *testing.T) {
+	for _, name := range []string{"khoj-env", "a", "Api_Key2"} {
+		if !ValidSecretName(name) {
+			t.Errorf("%q rejected", name)
+		}
+	}
+	// Names become unquoted age.secrets.<name> attributes: age.secrets.1pass
+	// is not valid Nix
+	for _, name := range []string{"1pass", "-env", "_env", "a.b", "a b", ""} {
+		if ValidSecretName(name) {
+			t.Errorf("%q accepted", name)
+		}
+	}
+}
+
+func TestSecretNameChecks(t *testing.T) {
+	_, err := ParseModule("services/app.nix",
+		"# NIXOS-LEGO-MODULE: app\n# PURPOSE: teste\n# CATEGORY: services\n# SECRETS: 1pass\n# ---\n")
+	if err == nil || !strings.Contains(err.Error(), "nome de segredo inválido: 1pass") {
+		t.Errorf("ParseModule err = %v", err)
+	}
+	if err := WriteSecret(t.TempDir(), "1pass", []byte("x")); err == nil || !strings.Contains(err.Error(), "começando por letra") {
+		t.Errorf("WriteSecret err = %v", err)
+	}
+	entries := secretsEntries([]string{"khoj-env"}, "")
+	if !strings.Contains(entries, "  age.secrets.khoj-env.file = ./secrets/khoj-env.age;\n") {
+		t.Errorf("entries:\n%s", entries)
+	}
+}
@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// hostIDRe matches networking.hostId: 8 hex digits
+	hostIDRe = regexp.MustCompile(`^[0-9a-f]{8}$`)
+	// layoutTypeRe finds the content types declared by a disko layout
+	layoutTypeRe = regexp.MustCompile(`type\s*=\s*"(btrfs|zfs|zpool|zfs_fs|zfs_volume)"`)
+	// snapshotsMountRe finds a btrfs subvolume mounted at /.snapshots
+	snapshotsMountRe = regexp.MustCompile(`mountpoint\s*=\s*"/\.snapshots"`)
+)
+
+// DiskoConfig is the [disko] table of a preset: the layout under disko/ the
+// host is installed with, which decides the filesystem support of the flake
+type DiskoConfig struct {
+	Layout string `toml:"layout,omitempty"`  // file name under disko/
+	HostID string `toml:"host_id,omitempty"` // networking.hostId for zfs; derived from the host name when empty
+}
+
+// HostIDFor is the configured host id, or one derived from hostName so that
+// it stays the same across builds
+func (c DiskoConfig) HostIDFor(hostName string) string {
+	if c.HostID != "" {
+		return c.HostID
+	}
+	sum := sha256.Sum256([]byte(hostName))
+	return hex.EncodeToString(sum[:4])
+}
+
+// String summarizes the table for presets show
+func (c DiskoConfig) String() string {
+	if c.Layout == "" {
+		return "nenhum layout"
+	}
+	s := DiskoDir + "/" + c.Layout
+	if c.HostID != "" {
+		s += " (host_id " + c.HostID + ")"
+	}
+	return s
+}
+
+func (c DiskoConfig) validate(root string) []PresetIssue {
+	var issues []PresetIssue
+	if c.Layout != "" {
+		if !layoutNameRe.MatchString(c.Layout) {
+			issues = append(issues, PresetIssue{"disko.layout", fmt.Sprintf("%q inválido: use o nome de um arquivo de %s/", c.Layout, DiskoDir)})
+		} else if _, err := os.Stat(filepath.Join(root, DiskoDir, c.Layout)); err != nil {
+			issues = append(issues, PresetIssue{"disko.layout", fmt.Sprintf("%s/%s não encontrado", DiskoDir, c.Layout)})
+		}
+	}
+	if c.HostID != "" && !hostIDRe.MatchString(c.HostID) {
+		issues = append(issues, PresetIssue{"disko.host_id", fmt.Sprintf("%q inválido: use 8 dígitos hexadecimais minúsculos (ex.: 8425e349)", c.HostID)})
+	}
+	return issues
+}
+
+// LayoutFeatures is what a disko layout needs from the system configuration
+type LayoutFeatures struct {
+	Btrfs     bool
+	ZFS       bool
+	Snapshots bool // a btrfs subvolume is mounted at /.snapshots
+}
+
+// ScanDiskoLayout reads the filesystems declared by the layout at path
+func ScanDiskoLayout(path string) (LayoutFeatures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LayoutFeatures{}, err
+	}
+	var f LayoutFeatures
+	for _, m := range layoutTypeRe.FindAllStringSubmatch(string(data), -1) {
+		if m[1] == "btrfs" {
+			f.Btrfs = true
+		} else {
+			f.ZFS = true
+		}
+	}
+	f.Snapshots = f.Btrfs && snapshotsMountRe.Match(data)
+	return f, nil
+}
+
+// Filesystems lists the boot.supportedFilesystems entries of the layout
+func (f LayoutFeatures) Filesystems() []string {
+	var fs []string
+	if f.Btrfs {
+		fs = append(fs, "btrfs")
+	}
+	if f.ZFS {
+		fs = append(fs, "zfs")
+	}
+	return fs
+}
+
+// storageEntries renders the filesystem support of the preset's disko
+// layout as a module list entry: supported filesystems, the zfs host id,
+// scrubbing and snapshots. Layouts with plain filesystems need nothing.
+func (c *flakeContext) storageEntries(preset *Preset) (string, error) {
+	layout := preset.Disko.Layout
+	if layout == "" {
+		return "", nil
+	}
+	f, err := ScanDiskoLayout(filepath.Join(c.root, DiskoDir, layout))
+	if err != nil {
+		return "", fmt.Errorf("layout disko do preset: %w", err)
+	}
+	if !f.Btrfs && !f.ZFS {
+		return "", nil
+	}
+
+	in := c.moduleIndent
+	var sb strings.Builder
+	sb.WriteString("\n")
+	sb.WriteString(in + "# ── storage ── Sistemas de arquivos do layout " + DiskoDir + "/" + layout + "\n")
+	sb.WriteString(in + "({ lib, ... }: {\n")
+	sb.WriteString(in + "  boot.supportedFilesystems = " + nixStringList(f.Filesystems()) + ";\n")
+	if f.Btrfs {
+		sb.WriteString(in + "  services.btrfs.autoScrub.enable = true;\n")
+	}
+	if f.Snapshots {
+		sb.WriteString(in + "  services.snapper.configs.root = {\n")
+		sb.WriteString(in + "    SUBVOLUME = \"/\";\n")
+		sb.WriteString(in + "    TIMELINE_CREATE = true;\n")
+		sb.WriteString(in + "    TIMELINE_CLEANUP = true;\n")
+		sb.WriteString(in + "  };\n")
+	}
+	if f.ZFS {
+		sb.WriteString(in + "  networking.hostId = lib.mkDefault " + nixString(preset.Disko.HostIDFor(preset.Host.HostName)) + ";\n")
+		sb.WriteString(in + "  services.zfs.autoScrub.enable = true;\n")
+		sb.WriteString(in + "  services.zfs.trim.enable = true;\n")
+		sb.WriteString(in + "  # Só datasets com com.sun:auto-snapshot=true (no assistente, o home)\n")
+		sb.WriteString(in + "  services.zfs.autoSnapshot.enable = true;\n")
+	}
+	sb.WriteString(in + "})\n")
+	return sb.String(), nil
+}
+
+// BindDiskoLayout records layout (a file under disko/) as the preset's
+// disk layout
+func BindDiskoLayout(root, presetName, layout string) error {
+	path := filepath.Join(root, "presets", presetName+".toml")
+	p, err := LoadPreset(path)
+	if err != nil {
+		return err
+	}
+	p.Disko.Layout = layout
+	return SavePreset(path, p)
+}
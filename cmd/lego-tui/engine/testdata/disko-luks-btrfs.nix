@@ -0,0 +1,97 @@
+# Gerado pelo assistente de layouts do lego-tui
+# LUKS2: a aba Disko pede a senha e passa ao disko uma cópia que a lê de um arquivo privado;
+# para rodar o disko à mão, grave a senha em /tmp/lego-luks.key (0600) e apague depois
+# Depois da instalação, registre o desbloqueio:
+#   sudo systemd-cryptenroll --tpm2-device=auto --tpm2-pcrs=7 /dev/disk/by-partlabel/disk-main-root
+#   sudo systemd-cryptenroll --tpm2-device=auto --tpm2-pcrs=7 /dev/disk/by-partlabel/disk-main-home
+{
+  disko.devices = {
+    disk = {
+      main = {
+        type = "disk";
+        device = "/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNF0R123456A";
+        content = {
+          type = "gpt";
+          partitions = {
+            ESP = {
+              priority = 1;
+              name = "ESP";
+              size = "1G";
+              type = "EF00";
+              content = {
+                type = "filesystem";
+                format = "vfat";
+                mountpoint = "/boot";
+                mountOptions = [ "umask=0077" ];
+              };
+            };
+            swap = {
+              priority = 2;
+              size = "4G";
+              content = {
+                type = "swap";
+                randomEncryption = true;
+              };
+            };
+            root = {
+              priority = 3;
+              size = "64G";
+              content = {
+                type = "luks";
+                name = "cryptroot";
+                passwordFile = "/tmp/lego-luks.key";
+                extraFormatArgs = [ "--type" "luks2" ];
+                settings = {
+                  allowDiscards = true;
+                  crypttabExtraOpts = [ "tpm2-device=auto" ];
+                };
+                content = {
+                  type = "btrfs";
+                  extraArgs = [ "-f" "-L" "root" ];
+                  subvolumes = {
+                    "/@" = {
+                      mountpoint = "/";
+                      mountOptions = [ "compress=zstd" "noatime" ];
+                    };
+                    "/@nix" = {
+                      mountpoint = "/nix";
+                      mountOptions = [ "compress=zstd" "noatime" ];
+                    };
+                    "/@snapshots" = {
+                      mountpoint = "/.snapshots";
+                      mountOptions = [ "compress=zstd" "noatime" ];
+                    };
+                  };
+                };
+              };
+            };
+            home = {
+              priority = 4;
+              size = "100%";
+              content = {
+                type = "luks";
+                name = "crypthome";
+                passwordFile = "/tmp/lego-luks.key";
+                extraFormatArgs = [ "--type" "luks2" ];
+                settings = {
+                  allowDiscards = true;
+                  crypttabExtraOpts = [ "tpm2-device=auto" ];
+                };
+                content = {
+                  type = "btrfs";
+                  extraArgs = [ "-f" "-L" "home" ];
+                  subvolumes = {
+                    "/@home" = {
+                      mountpoint = "/home";
+                      mountOptions = [ "compress=zstd" "noatime" ];
+                    };
+                  };
+                };
+              };
+            };
+          };
+        };
+      };
+    };
+  };
+}
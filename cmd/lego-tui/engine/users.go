@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+)
+
+// UserShells maps the shells a user may pick to the programs.<name>.enable
+// option NixOS requires for them ("" when none is needed)
+var UserShells = map[string]string{
+	"bash":    "",
+	"zsh":     "zsh",
+	"fish":    "fish",
+	"xonsh":   "xonsh",
+	"nushell": "",
+}
+
+// NewUser returns an extra account with no password and no admin rights
+func NewUser(name string) UserConfig {
+	return UserConfig{
+		Name:        name,
+		Description: name,
+		Groups:      []string{"networkmanager"},
+	}
+}
+
+// usersBlock renders one users.users entry per user, plus the
+// programs.<shell>.enable lines their shells need, at indent.
+// Users without any password are left locked (SSH keys only).
+func usersBlock(users []UserConfig, indent string) string {
+	var sb strings.Builder
+	var shells []string
+	for i, u := range users {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		in := indent + "  "
+		sb.WriteString(indent + "users.users." + nixString(u.Name) + " = {\n")
+		sb.WriteString(in + "isNormalUser = true;\n")
+		if u.HashedPassword != "" || u.Initialpassword != "" {
+			sb.WriteString(in + passwordAttr(u) + ";\n")
+		}
+		sb.WriteString(in + "description = " + nixString(u.Description) + ";\n")
+		if len(u.Groups) > 0 {
+			sb.WriteString(in + "extraGroups = " + nixStringList(u.Groups) + ";\n")
+		}
+		if u.Shell != "" {
+			sb.WriteString(in + "shell = pkgs." + u.Shell + ";\n")
+			if prog := UserShells[u.Shell]; prog != "" && !slices.Contains(shells, prog) {
+				shells = append(shells, prog)
+			}
+		}
+		if len(u.SSHKeys) > 0 {
+			sb.WriteString(in + "openssh.authorizedKeys.keys = [\n")
+			for _, k := range u.SSHKeys {
+				sb.WriteString(in + "  " + nixString(k) + "\n")
+			}
+			sb.WriteString(in + "];\n")
+		}
+		sb.WriteString(indent + "};\n")
+	}
+	if len(shells) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, prog := range shells {
+		sb.WriteString(indent + "programs." + prog + ".enable = true;\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func nixStringList(items []string) string {
+	var quoted []string
+	for _, it := range items {
+		quoted = append(quoted, nixString(it))
+	}
+	return "[ " + strings.Join(quoted, " ") + " ]"
+}
@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezone check works without a system zoneinfo
+)
+
+// PresetIssue is one problem found by ValidatePreset
+type PresetIssue struct {
+	Field string // TOML key, e.g. host.host_name
+	Msg   string
+}
+
+func (i PresetIssue) String() string {
+	return i.Field + ": " + i.Msg
+}
+
+// PresetIssues is the result of ValidatePreset
+type PresetIssues []PresetIssue
+
+// Err summarizes the issues, or nil if there are none
+func (issues PresetIssues) Err() error {
+	if len(issues) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, i := range issues {
+		lines = append(lines, i.String())
+	}
+	return fmt.Errorf("preset inválido:\n  %s", strings.Join(lines, "\n  "))
+}
+
+var (
+	// networking.hostName must be a single DNS label
+	hostNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+	// releases were YY.03/YY.09 until 20.09 and YY.05/YY.11 since; any YY.MM
+	// is accepted since a stateVersion must stay what the system installed
+	stateVersionRe = regexp.MustCompile(`^[0-9]{2}\.[0-9]{2}$`)
+	userNameRe     = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	localeRe       = regexp.MustCompile(`^([a-z]{2,3}_[A-Z]{2}|C)(\.[A-Za-z0-9-]+)?(@[a-z]+)?$`)
+	keymapRe       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	sshKeyRe       = regexp.MustCompile(`^(ssh-(ed25519|rsa|dss)|ecdsa-sha2-nistp(256|384|521)|sk-(ssh-ed25519|ecdsa-sha2-nistp256)@openssh\.com) [A-Za-z0-9+/]+=*( .*)?$`)
+)
+
+// keymapDirs are searched for console keymaps (kbd) when present
+var keymapDirs = []string{
+	"/run/current-system/sw/share/keymaps",
+	"/usr/share/keymaps",
+	"/usr/share/kbd/keymaps",
+}
+
+// ValidatePreset checks the preset fields and that every active module
+// resolves to a valid file under modules/
+func ValidatePreset(root string, p *Preset) PresetIssues {
+	return validatePreset(root, p, p.Modules.Active)
+}
+
+// validatePreset is ValidatePreset with an explicit module selection, as
+// used by the builds
+func validatePreset(root string, p *Preset, modules []string) PresetIssues {
+	var issues PresetIssues
+	add := func(field, format string, args ...any) {
+		issues = append(issues, PresetIssue{field, fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range p.unknownKeys {
+		add(key, "chave desconhecida (erro de digitação?)")
+	}
+
+	if !hostNameRe.MatchString(p.Host.HostName) {
+		add("host.host_name", "%q inválido: use letras, números e '-' (até 63, sem '.' e sem '-' nas pontas)", p.Host.HostName)
+	}
+	if !stateVersionRe.MatchString(p.Host.StateVersion) {
+		add("host.state_version", "%q inválido: use o formato AA.MM da versão instalada (ex.: 25.11)", p.Host.StateVersion)
+	}
+	if p.ignoredUser {
+		add("user", "tabela [user] ignorada: o preset já define [[users]]")
+	}
+	if len(p.Users) == 0 {
+		add("users", "nenhum usuário definido")
+	}
+	seenUsers := map[string]bool{}
+	for i, u := range p.Users {
+		field := fmt.Sprintf("users[%d]", i)
+		if !userNameRe.MatchString(u.Name) {
+			add(field+".name", "%q inválido: use minúsculas, números, '_' e '-' (até 32, começando por letra)", u.Name)
+		} else if seenUsers[u.Name] {
+			add(field+".name", "usuário %q duplicado", u.Name)
+		}
+		seenUsers[u.Name] = true
+		if u.HashedPassword != "" && !IsCryptHash(u.HashedPassword) {
+			add(field+".hashedPassword", "não é um hash crypt(3) (gere em 👥 Usuários → p na aba Hosts ou mkpasswd -m sha-512)")
+		}
+		for _, g := range u.Groups {
+			if !userNameRe.MatchString(g) {
+				add(field+".groups", "grupo %q inválido", g)
+			}
+		}
+		if _, ok := UserShells[u.Shell]; u.Shell != "" && !ok {
+			add(field+".shell", "%q não suportado (use %s)", u.Shell, strings.Join(shellNames(), ", "))
+		}
+		for _, k := range u.SSHKeys {
+			if !sshKeyRe.MatchString(k) {
+				add(field+".ssh_keys", "chave SSH pública inválida: %q", truncate(k, 40))
+			}
+		}
+		for _, rel := range u.Home {
+			if msg := checkHomeModule(root, rel); msg != "" {
+				add(field+".home", "%s", msg)
+			}
+		}
+	}
+
+	if p.Locale.Timezone == "" || p.Locale.Timezone == "Local" {
+		add("locale.timezone", "fuso horário vazio (ex.: America/Sao_Paulo)")
+	} else if _, err := time.LoadLocation(p.Locale.Timezone); err != nil {
+		add("locale.timezone", "%q não existe na base tzdata (ex.: America/Sao_Paulo)", p.Locale.Timezone)
+	}
+
+	locales := []struct{ field, value string }{
+		{"locale.default_locale", p.Locale.DefaultLocale},
+		{"locale.lc_address", p.Locale.LcAddress},
+		{"locale.lc_identification", p.Locale.LcIdentification},
+		{"locale.lc_measurement", p.Locale.LcMeasurement},
+		{"locale.lc_monetary", p.Locale.LcMonetary},
+		{"locale.lc_name", p.Locale.LcName},
+		{"locale.lc_numeric", p.Locale.LcNumeric},
+		{"locale.lc_paper", p.Locale.LcPaper},
+		{"locale.lc_telephone", p.Locale.LcTelephone},
+		{"locale.lc_time", p.Locale.LcTime},
+	}
+	for _, l := range locales {
+		if !localeRe.MatchString(l.value) {
+			add(l.field, "%q inválido: use idioma_PAÍS.CODIFICAÇÃO (ex.: pt_BR.UTF-8)", l.value)
+		}
+	}
+
+	if msg := checkKeymap(p.Locale.Keymap); msg != "" {
+		add("locale.keymap", "%s", msg)
+	}
+	issues = append(issues, p.Rebuild.validate()...)
+	issues = append(issues, p.Encryption.validate()...)
+	issues = append(issues, p.Disko.validate(root)...)
+
+	for _, rel := range modules {
+		if IsHomeModule(rel) {
+			add("modules.active", "'%s' é um módulo Home Manager: escolha-o por usuário (users[].home)", rel)
+			continue
+		}
+		path := filepath.Join(root, "modules", rel+".nix")
+		if _, err := os.Stat(path); err != nil {
+			add("modules.active", "módulo '%s' não encontrado em modules/", rel)
+			continue
+		}
+		if _, err := LoadModule(path); err != nil {
+			add("modules.active", "módulo '%s' inválido: %v", rel, err)
+		}
+	}
+	return issues
+}
+
+// MissingSecrets describes each secret read by the modules (or the modules
+// they require) that does not exist yet. It does not block a build, but the
+// flake only evaluates once the secret is created.
+func MissingSecrets(root string, modules []string) []string {
+	if res := ResolveModules(ListModules(root), modules); res.Err() == nil {
+		modules = res.Modules
+	}
+	var warnings []string
+	for _, rel := range modules {
+		mod, err := LoadModule(filepath.Join(root, "modules", rel+".nix"))
+		if err != nil {
+			continue
+		}
+		for _, name := range mod.List("SECRETS") {
+			if !SecretExists(root, name) {
+				warnings = append(warnings, fmt.Sprintf("módulo '%s' usa o segredo '%s', que ainda não existe em %s/: crie com 'lego-tui secrets new %s' (ou na aba Segredos) antes de aplicar", rel, name, SecretsDir, name))
+			}
+		}
+	}
+	return warnings
+}
+
+// shellNames lists UserShells sorted, for messages
+func shellNames() []string {
+	names := make([]string, 0, len(UserShells))
+	for name := range UserShells {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func truncate(s string, n int) string {
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// checkKeymap validates the console keymap name, and its existence when a
+// kbd keymaps directory is available on this machine
+func checkKeymap(name string) string {
+	if !keymapRe.MatchString(name) {
+		return fmt.Sprintf("%q inválido (ex.: br-abnt2, us)", name)
+	}
+	for _, dir := range keymapDirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		found := false
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			base := strings.TrimSuffix(strings.TrimSuffix(d.Name(), ".gz"), ".map")
+			if base == name {
+				found = true
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if !found {
+			return fmt.Sprintf("%q não encontrado em %s", name, dir)
+		}
+		return ""
+	}
+	return ""
+}
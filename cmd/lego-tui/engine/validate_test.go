@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateVersionAcceptsOldReleases(t *testing.T) {
+	for _, v := range []string{"18.03", "18.09", "19.09", "20.03", "21.05", "25.11"} {
+		if !stateVersionRe.MatchString(v) {
+			t.Errorf("%s rejected", v)
+		}
+	}
+	for _, v := range []string{"25", "25.5", "unstable", "2025.11", ""} {
+		if stateVersionRe.MatchString(v) {
+			t.Errorf("%q accepted", v)
+		}
+	}
+}
+
+func TestMissingSecretIsOnlyAWarning(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "modules", "services", "app.nix"),
+		"# NIXOS-LEGO-MODULE: app\n# PURPOSE: teste\n# CATEGORY: services\n# SECRETS: app-env\n# ---\nservices.app.enable = true;\n")
+	writeFile(t, filepath.Join(root, "modules", "apps", "cli.nix"),
+		"# NIXOS-LEGO-MODULE: cli\n# PURPOSE: teste\n# CATEGORY: apps\n# REQUIRES: services/app\n# ---\n")
+
+	p := NewDefaultPreset("teste", "ana")
+	for _, issue := range validatePreset(root, p, []string{"apps/cli"}) {
+		if issue.Field == "modules.active" {
+			t.Errorf("unexpected issue: %s", issue)
+		}
+	}
+	warnings := MissingSecrets(root, []string{"apps/cli"})
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "'app-env'") || !strings.Contains(warnings[0], "secrets new app-env") {
+		t.Errorf("warnings = %q, want one for app-env required through services/app", warnings)
+	}
+
+	writeFile(t, SecretPath(root, "app-env"), "cifrado")
+	if warnings := MissingSecrets(root, []string{"apps/cli"}); len(warnings) != 0 {
+		t.Errorf("warnings = %q once the secret exists", warnings)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"LEGOFlakes/cmd/lego-tui/engine"
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"LEGOFlakes/cmd/lego-tui/views"
 	"os"
@@ -13,14 +14,16 @@ import (
 
 // Tab indices
 const (
-	tabIntro     = 0
-	tabDisko     = 1
-	tabHosts     = 2
-	tabModules   = 3
-	tabSelection = 4
-	tabBuilder   = 5
-	tabInstaller = 6
-	tabScripts   = 7
+	tabIntro       = 0
+	tabDisko       = 1
+	tabHosts       = 2
+	tabModules     = 3
+	tabSelection   = 4
+	tabBuilder     = 5
+	tabInstaller   = 6
+	tabScripts     = 7
+	tabSecrets     = 8
+	tabGenerations = 9
 )
 
 var tabNames = []string{
@@ -32,27 +35,32 @@ var tabNames = []string{
 	"Gerar",
 	"Aplicar",
 	"Scripts",
+	"Segredos",
+	"Gerações",
 }
 
 type model struct {
 	activeTab  int
 	rootDir    string
 	presetsDir string
+	dryRun     bool
 
 	// Sub-models
-	hosts     views.HostsModel
-	modules   views.ModulesModel
-	selection views.SelectionModel
-	builder   views.BuilderModel
-	installer views.InstallerModel
-	scripts   views.ScriptsModel
-	disko     views.DiskoModel
+	hosts       views.HostsModel
+	modules     views.ModulesModel
+	selection   views.SelectionModel
+	builder     views.BuilderModel
+	installer   views.InstallerModel
+	scripts     views.ScriptsModel
+	disko       views.DiskoModel
+	secrets     views.SecretsModel
+	generations views.GenerationsModel
 
 	width  int
 	height int
 }
 
-func initialModel() model {
+func initialModel(runner engine.Runner) model {
 	// Resolve project root: binary location or cwd-based
 	root := findRoot()
 	presetsDir := filepath.Join(root, "presets")
@@ -63,18 +71,21 @@ func initialModel() model {
 	os.MkdirAll(filepath.Join(root, "scripts"), 0755)
 
 	return model{
-		activeTab:  tabIntro,
-		rootDir:    root,
-		presetsDir: presetsDir,
-		hosts:      views.NewHostsModel(presetsDir, root),
-		modules:    views.NewModulesModel(root),
-		selection:  views.NewSelectionModel(root),
-		builder:    views.NewBuilderModel(root),
-		installer:  views.NewInstallerModel(root),
-		scripts:    views.NewScriptsModel(root),
-		disko:      views.NewDiskoModel(root),
-		width:      120,
-		height:     30,
+		activeTab:   tabIntro,
+		rootDir:     root,
+		presetsDir:  presetsDir,
+		dryRun:      runner.DryRun(),
+		hosts:       views.NewHostsModel(presetsDir, root, runner),
+		modules:     views.NewModulesModel(root, runner),
+		selection:   views.NewSelectionModel(root),
+		builder:     views.NewBuilderModel(root, runner),
+		installer:   views.NewInstallerModel(root, runner),
+		scripts:     views.NewScriptsModel(root, runner),
+		disko:       views.NewDiskoModel(root, runner),
+		secrets:     views.NewSecretsModel(root, runner),
+		generations: views.NewGenerationsModel(root, runner),
+		width:       120,
+		height:      30,
 	}
 }
 
@@ -123,10 +134,42 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.selection.SetSize(msg.Width, contentH)
 		m.builder.SetSize(msg.Width, contentH)
 		m.installer.SetSize(msg.Width, contentH)
+		m.scripts.SetSize(msg.Width, contentH)
 		m.disko.SetSize(msg.Width, contentH)
+		m.secrets.SetSize(msg.Width, contentH)
+		m.generations.SetSize(msg.Width, contentH)
 		return m, nil
 
+	case views.ProcessMsg:
+		// Streamed output keeps flowing to its tab even when another tab is active
+		var c1, c2, c3, c4 tea.Cmd
+		m.installer, c1 = m.installer.Update(msg)
+		m.scripts, c2 = m.scripts.Update(msg)
+		m.disko, c3 = m.disko.Update(msg)
+		m.generations, c4 = m.generations.Update(msg)
+		return m, tea.Batch(c1, c2, c3, c4)
+
+	case views.FlakeCheckMsg:
+		// Evaluations may outlast a tab switch, like streamed processes
+		var c1, c2 tea.Cmd
+		m.builder, c1 = m.builder.Update(msg)
+		m.installer, c2 = m.installer.Update(msg)
+		return m, tea.Batch(c1, c2)
+
 	case tea.KeyMsg:
+		// Text forms receive every key except ctrl+c
+		if m.activeTab == tabSelection && m.selection.InputActive() && msg.String() != "ctrl+c" {
+			break
+		}
+		if m.activeTab == tabHosts && m.hosts.InputActive() && msg.String() != "ctrl+c" {
+			break
+		}
+		if m.activeTab == tabSecrets && m.secrets.InputActive() && msg.String() != "ctrl+c" {
+			break
+		}
+		if m.activeTab == tabDisko && m.disko.InputActive() && msg.String() != "ctrl+c" {
+			break
+		}
 		// Global keys: tab switch with Ctrl+← / Ctrl+→ or number keys
 		switch msg.String() {
 		case "ctrl+c":
@@ -181,6 +224,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.activeTab = tabDisko
 			m, cmd := m.onTabSwitch(prev)
 			return m, cmd
+		case "(":
+			prev := m.activeTab
+			m.activeTab = tabSecrets
+			m, cmd := m.onTabSwitch(prev)
+			return m, cmd
+		case ")":
+			prev := m.activeTab
+			m.activeTab = tabGenerations
+			m, cmd := m.onTabSwitch(prev)
+			return m, cmd
 		case "q":
 			// Only quit from Intro tab
 			if m.activeTab == tabIntro {
@@ -192,6 +245,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Handle ManageModulesMsg globally — switch to Selection tab with preset modules loaded
 	if mmMsg, ok := msg.(views.ManageModulesMsg); ok {
 		m.selection.Refresh()
+		m.selection.SetPreset(mmMsg.PresetName)
 		m.selection.LoadFromPreset(mmMsg.Modules)
 		m.activeTab = tabSelection
 		return m, nil
@@ -209,7 +263,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tabBuilder:
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
-			if msg.String() == "enter" {
+			if msg.String() == "enter" && !m.builder.IsMultiHost() {
 				presetName := m.hosts.SelectedPreset()
 				modules := m.selection.GetSelected()
 				if presetName == "" || len(modules) == 0 {
@@ -219,7 +273,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.builder.IsMenu() {
 					// Menu confirmed
 					switch m.builder.MenuCursor() {
-					case 0: // Gerar Flake → go to name input
+					case 0, 3: // Gerar Flake (arquivo único ou diretório) → go to name input
 						cmd = m.builder.GoToNameInput()
 						return m, cmd
 					case 1: // Salvar Preset → save directly
@@ -240,6 +294,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.scripts, cmd = m.scripts.Update(msg)
 	case tabDisko:
 		m.disko, cmd = m.disko.Update(msg)
+	case tabSecrets:
+		m.secrets, cmd = m.secrets.Update(msg)
+	case tabGenerations:
+		m.generations, cmd = m.generations.Update(msg)
 	}
 
 	return m, cmd
@@ -249,6 +307,7 @@ func (m model) onTabSwitch(prevTab int) (model, tea.Cmd) {
 	switch m.activeTab {
 	case tabSelection:
 		m.selection.Refresh()
+		m.selection.SetPreset(m.hosts.SelectedPreset())
 	case tabBuilder:
 		return m, m.builder.FocusInput()
 	case tabInstaller:
@@ -257,6 +316,10 @@ func (m model) onTabSwitch(prevTab int) (model, tea.Cmd) {
 		m.scripts.Refresh()
 	case tabDisko:
 		m.disko.Refresh()
+	case tabSecrets:
+		m.secrets.Refresh()
+	case tabGenerations:
+		m.generations.Refresh()
 	}
 	return m, nil
 }
@@ -272,6 +335,9 @@ func (m model) View() string {
 			tabs = append(tabs, styles.InactiveTab.Render("  "+label))
 		}
 	}
+	if m.dryRun {
+		tabs = append(tabs, styles.WarningStyle.Bold(true).Render("  [DRY-RUN]"))
+	}
 	tabBar := styles.TabBar.Width(m.width).Render(lipgloss.JoinHorizontal(lipgloss.Top, tabs...))
 
 	// ── Help bar (bottom) ───────────────────────────────────────
@@ -293,6 +359,10 @@ func (m model) View() string {
 		helpText = m.scripts.HelpKeys()
 	case tabDisko:
 		helpText = m.disko.HelpKeys()
+	case tabSecrets:
+		helpText = m.secrets.HelpKeys()
+	case tabGenerations:
+		helpText = m.generations.HelpKeys()
 	}
 	helpBar := styles.HelpBar.Width(m.width).Render(helpText)
 
@@ -322,6 +392,10 @@ func (m model) View() string {
 		content = m.scripts.View()
 	case tabDisko:
 		content = m.disko.View()
+	case tabSecrets:
+		content = m.secrets.View()
+	case tabGenerations:
+		content = m.generations.View()
 	}
 
 	contentStyle := lipgloss.NewStyle().Width(m.width).Height(contentH)
@@ -329,8 +403,23 @@ func (m model) View() string {
 }
 
 func main() {
+	// --dry-run records external commands instead of running them
+	args, dryRun := globalFlags(os.Args[1:])
+	var runner engine.Runner = engine.ExecRunner{}
+	if dryRun {
+		runner = engine.NewDryRunner(nil)
+	}
+
+	// Headless subcommands (build, modules, presets, apply, diff) skip the TUI
+	if len(args) > 0 {
+		if dryRun {
+			runner = engine.NewDryRunner(os.Stdout)
+		}
+		os.Exit(runCLI(findRoot(), runner, args, os.Stdout, os.Stderr))
+	}
+
 	p := tea.NewProgram(
-		initialModel(),
+		initialModel(runner),
 		tea.WithAltScreen(),
 		tea.WithMouseAllMotion(),
 	)
@@ -81,3 +81,15 @@ var (
 	NormalItem = lipgloss.NewStyle().
 			Foreground(ColorText)
 )
+
+// Nix syntax highlighting
+var (
+	NixComment       = lipgloss.NewStyle().Foreground(ColorMuted).Italic(true)
+	NixString        = lipgloss.NewStyle().Foreground(ColorSecondary)
+	NixInterpolation = lipgloss.NewStyle().Foreground(ColorWarning)
+	NixKeyword       = lipgloss.NewStyle().Foreground(ColorDanger)
+	NixLiteral       = lipgloss.NewStyle().Foreground(ColorPurple)
+	NixPath          = lipgloss.NewStyle().Foreground(ColorPrimary).Underline(true)
+	NixAttr          = lipgloss.NewStyle().Foreground(ColorPrimary)
+	NixPlaceholder   = lipgloss.NewStyle().Foreground(ColorAccent).Bold(true)
+)
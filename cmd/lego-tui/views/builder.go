@@ -4,6 +4,8 @@ import (
 	"LEGOFlakes/cmd/lego-tui/engine"
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -14,9 +16,11 @@ import (
 type buildState int
 
 const (
-	buildMenu buildState = iota // starts here: pick action
-	buildName                   // typing flake name
+	buildMenu  buildState = iota // starts here: pick action
+	buildHosts                   // picking presets for a multi-host flake
+	buildName                    // typing flake name
 	buildRunning
+	buildChecking // evaluating the generated flake
 	buildDone
 	buildError
 	buildSaved
@@ -24,8 +28,9 @@ const (
 
 // ── Messages ─────────────────────────────────────────────────
 type buildResult struct {
-	path string
-	err  error
+	path     string
+	warnings []string // secrets the flake still needs
+	err      error
 }
 
 type saveResult struct {
@@ -39,14 +44,24 @@ type BuilderModel struct {
 	spinner    spinner.Model
 	nameInput  textinput.Model
 	rootDir    string
+	runner     engine.Runner
 	result     string
+	warnings   []string // shown with the generated flake
 	errMsg     string
+	check      *engine.FlakeCheck // evaluation of the generated flake, nil if skipped
 	menuCursor int
+	dirMode    bool // emit flakes/<name>/ with one file per module
 	width      int
 	height     int
+
+	// Multi-host flow
+	multiHost   bool
+	hostPresets []engine.PresetInfo
+	hostChecked map[string]bool
+	hostCursor  int
 }
 
-func NewBuilderModel(rootDir string) BuilderModel {
+func NewBuilderModel(rootDir string, runner engine.Runner) BuilderModel {
 	sp := spinner.New()
 	sp.Spinner = spinner.Dot
 	sp.Style = lipgloss.NewStyle().Foreground(styles.ColorAccent)
@@ -61,6 +76,7 @@ func NewBuilderModel(rootDir string) BuilderModel {
 		spinner:   sp,
 		nameInput: ti,
 		rootDir:   rootDir,
+		runner:    runner,
 		width:     80,
 		height:    24,
 	}
@@ -69,6 +85,17 @@ func NewBuilderModel(rootDir string) BuilderModel {
 func (m BuilderModel) Init() tea.Cmd { return nil }
 
 func (m BuilderModel) Update(msg tea.Msg) (BuilderModel, tea.Cmd) {
+	if msg, ok := msg.(FlakeCheckMsg); ok {
+		if m.state == buildChecking && msg.check.Flake == m.result {
+			m.check = msg.check
+			m.state = buildDone
+			if msg.err != nil {
+				m.errMsg = "Erro ao salvar a avaliação: " + msg.err.Error()
+			}
+		}
+		return m, nil
+	}
+
 	switch m.state {
 	case buildMenu:
 		switch msg := msg.(type) {
@@ -79,23 +106,61 @@ func (m BuilderModel) Update(msg tea.Msg) (BuilderModel, tea.Cmd) {
 					m.menuCursor--
 				}
 			case "down", "j":
-				if m.menuCursor < 1 {
+				if m.menuCursor < 3 {
 					m.menuCursor++
 				}
+			case "enter":
+				if m.menuCursor == 2 {
+					m.startHostPicker()
+				}
 			case "esc":
 				return m, nil
 			}
 		}
 		return m, nil
 
+	case buildHosts:
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			switch msg.String() {
+			case "up", "k":
+				if m.hostCursor > 0 {
+					m.hostCursor--
+				}
+			case "down", "j":
+				if m.hostCursor < len(m.hostPresets)-1 {
+					m.hostCursor++
+				}
+			case " ":
+				if len(m.hostPresets) > 0 {
+					name := m.hostPresets[m.hostCursor].Name
+					m.hostChecked[name] = !m.hostChecked[name]
+				}
+			case "enter":
+				if len(m.checkedHosts()) > 0 {
+					return m, m.GoToNameInput()
+				}
+			case "esc":
+				m.state = buildMenu
+				m.multiHost = false
+			}
+		}
+		return m, nil
+
 	case buildName:
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "esc":
 				m.state = buildMenu
+				m.multiHost = false
+				m.dirMode = false
 				m.nameInput.SetValue("")
 				return m, nil
+			case "enter":
+				if m.multiHost {
+					return m, m.StartMultiBuild()
+				}
 			}
 		}
 		var cmd tea.Cmd
@@ -109,8 +174,9 @@ func (m BuilderModel) Update(msg tea.Msg) (BuilderModel, tea.Cmd) {
 				m.state = buildError
 				m.errMsg = msg.err.Error()
 			} else {
-				m.state = buildDone
 				m.result = msg.path
+				m.warnings = msg.warnings
+				return m, m.startCheck()
 			}
 			return m, nil
 		case saveResult:
@@ -128,6 +194,21 @@ func (m BuilderModel) Update(msg tea.Msg) (BuilderModel, tea.Cmd) {
 			return m, cmd
 		}
 
+	case buildChecking:
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			if msg.String() == "esc" {
+				// The evaluation keeps running and still saves its result
+				m.check = nil
+				m.state = buildDone
+			}
+			return m, nil
+		case spinner.TickMsg:
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
 	case buildDone, buildError, buildSaved:
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
@@ -135,13 +216,21 @@ func (m BuilderModel) Update(msg tea.Msg) (BuilderModel, tea.Cmd) {
 			case "enter", "esc":
 				m.state = buildMenu
 				m.result = ""
+				m.warnings = nil
 				m.errMsg = ""
+				m.check = nil
 				m.menuCursor = 0
+				m.multiHost = false
+				m.dirMode = false
 				m.nameInput.SetValue("")
 				return m, nil
 			case "e":
 				if m.state == buildDone && m.result != "" {
-					return m, openEditor(m.result)
+					return m, openEditor(m.runner, m.result)
+				}
+			case "v":
+				if m.state == buildDone && m.result != "" {
+					return m, m.startCheck()
 				}
 			}
 		case editorFinishedMsg:
@@ -156,6 +245,10 @@ func (m BuilderModel) Update(msg tea.Msg) (BuilderModel, tea.Cmd) {
 func (m *BuilderModel) StartBuild(presetName, presetsDir string, modules []string) tea.Cmd {
 	m.state = buildRunning
 	name := m.nameInput.Value()
+	build := engine.BuildFlake
+	if m.dirMode {
+		build = engine.BuildFlakeDir
+	}
 
 	return tea.Batch(m.spinner.Tick, func() tea.Msg {
 		presetPath := fmt.Sprintf("%s/%s.toml", presetsDir, presetName)
@@ -163,16 +256,24 @@ func (m *BuilderModel) StartBuild(presetName, presetsDir string, modules []strin
 		if err != nil {
 			return buildResult{err: err}
 		}
-		path, err := engine.BuildFlake(m.rootDir, preset, modules, name)
+		path, err := build(m.rootDir, preset, modules, name)
 		if err != nil {
 			return buildResult{err: err}
 		}
 		// Update preset file
 		engine.SavePreset(presetPath, preset)
-		return buildResult{path: path}
+		return buildResult{path: path, warnings: engine.MissingSecrets(m.rootDir, modules)}
 	})
 }
 
+// startCheck evaluates the flake just generated
+func (m *BuilderModel) startCheck() tea.Cmd {
+	m.state = buildChecking
+	m.check = nil
+	m.errMsg = ""
+	return tea.Batch(m.spinner.Tick, checkFlake(m.runner, m.rootDir, m.result))
+}
+
 // SavePresetOnly saves the selected modules to the preset without generating a flake
 func (m *BuilderModel) SavePresetOnly(presetName, presetsDir string, modules []string) tea.Cmd {
 	m.state = buildRunning
@@ -191,14 +292,65 @@ func (m *BuilderModel) SavePresetOnly(presetName, presetsDir string, modules []s
 	})
 }
 
+// startHostPicker lists presets for the multi-host flow
+func (m *BuilderModel) startHostPicker() {
+	m.hostPresets, _ = engine.ListPresets(filepath.Join(m.rootDir, "presets"))
+	m.hostChecked = make(map[string]bool)
+	m.hostCursor = 0
+	m.multiHost = true
+	m.state = buildHosts
+}
+
+// checkedHosts returns the preset names picked for the multi-host flake
+func (m BuilderModel) checkedHosts() []string {
+	var names []string
+	for _, p := range m.hostPresets {
+		if m.hostChecked[p.Name] {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// StartMultiBuild generates one flake with every picked preset as a host
+func (m *BuilderModel) StartMultiBuild() tea.Cmd {
+	m.state = buildRunning
+	name := m.nameInput.Value()
+	hosts := m.checkedHosts()
+	presetsDir := filepath.Join(m.rootDir, "presets")
+
+	return tea.Batch(m.spinner.Tick, func() tea.Msg {
+		var presets []*engine.Preset
+		for _, h := range hosts {
+			preset, err := engine.LoadPreset(fmt.Sprintf("%s/%s.toml", presetsDir, h))
+			if err != nil {
+				return buildResult{err: err}
+			}
+			presets = append(presets, preset)
+		}
+		path, err := engine.BuildMultiHostFlake(m.rootDir, presets, name)
+		if err != nil {
+			return buildResult{err: err}
+		}
+		// Update preset files
+		var warnings []string
+		for i, h := range hosts {
+			engine.SavePreset(fmt.Sprintf("%s/%s.toml", presetsDir, h), presets[i])
+			warnings = append(warnings, engine.MissingSecrets(m.rootDir, presets[i].Modules.Active)...)
+		}
+		return buildResult{path: path, warnings: warnings}
+	})
+}
+
 // GoToNameInput transitions from menu to name input state
 func (m *BuilderModel) GoToNameInput() tea.Cmd {
+	m.dirMode = m.menuCursor == 3
 	m.state = buildName
 	m.nameInput.Focus()
 	return m.nameInput.Cursor.BlinkCmd()
 }
 
-// MenuCursor returns the current menu selection (0=build, 1=save)
+// MenuCursor returns the current menu selection (0=build, 1=save, 2=multi-host, 3=build as directory)
 func (m BuilderModel) MenuCursor() int {
 	return m.menuCursor
 }
@@ -208,6 +360,11 @@ func (m BuilderModel) IsMenu() bool {
 	return m.state == buildMenu
 }
 
+// IsMultiHost returns whether the multi-host flow owns the key handling
+func (m BuilderModel) IsMultiHost() bool {
+	return m.multiHost || (m.state == buildMenu && m.menuCursor == 2)
+}
+
 // IsNameInput returns whether the builder is in name input state
 func (m BuilderModel) IsNameInput() bool {
 	return m.state == buildName
@@ -217,10 +374,14 @@ func (m BuilderModel) HelpKeys() string {
 	switch m.state {
 	case buildMenu:
 		return "enter: confirmar • j/k: navegar"
+	case buildHosts:
+		return "space: marcar host • enter: confirmar • esc: voltar"
 	case buildName:
 		return "enter: gerar flake • esc: voltar"
+	case buildChecking:
+		return "esc: não esperar a avaliação"
 	case buildDone:
-		return "e: abrir no editor • esc: voltar"
+		return "e: abrir no editor • v: avaliar de novo • esc: voltar"
 	case buildSaved:
 		return "enter/esc: voltar"
 	case buildError:
@@ -231,6 +392,18 @@ func (m BuilderModel) HelpKeys() string {
 	return ""
 }
 
+// renderWarnings lists the secrets the generated flake still needs
+func (m BuilderModel) renderWarnings() string {
+	var s string
+	for _, w := range m.warnings {
+		s += styles.WarningStyle.Render("  ⚠️  "+w) + "\n"
+	}
+	if s != "" {
+		s += "\n"
+	}
+	return s
+}
+
 func (m BuilderModel) View() string {
 	var s string
 	title := styles.Subtitle.Render("GERAR FLAKE")
@@ -243,6 +416,8 @@ func (m BuilderModel) View() string {
 		}{
 			{"🔨 Gerar Flake", "Gera o flake.nix e salva os módulos no preset"},
 			{"💾 Salvar Preset", "Salva os módulos selecionados no preset (sem gerar flake)"},
+			{"🏘️ Gerar Flake Multi-host", "Uma flake com um nixosConfigurations por preset escolhido"},
+			{"📁 Gerar Flake em Diretório", "flake.nix + lego/<categoria>/<módulo>.nix (traces e diffs por módulo)"},
 		}
 		lines := "\n"
 		for i, opt := range options {
@@ -256,16 +431,58 @@ func (m BuilderModel) View() string {
 			lines += "    " + styles.MutedStyle.Render(opt.desc) + "\n\n"
 		}
 		s = title + lines
+	case buildHosts:
+		lines := "\n"
+		for i, p := range m.hostPresets {
+			cursor := "  "
+			style := styles.NormalItem
+			if i == m.hostCursor {
+				cursor = "▸ "
+				style = styles.SelectedItem
+			}
+			check := styles.MutedStyle.Render("[ ]")
+			if m.hostChecked[p.Name] {
+				check = lipgloss.NewStyle().Foreground(styles.ColorSecondary).Render("[✓]")
+			}
+			lines += cursor + check + " " + style.Render(p.Name) + "\n"
+		}
+		if len(m.hostPresets) == 0 {
+			lines += styles.MutedStyle.Render("  Nenhum preset encontrado.") + "\n"
+		}
+		s = title + "\n" + styles.MutedStyle.Render(fmt.Sprintf("  %d host(s) marcado(s)", len(m.checkedHosts()))) + "\n" + lines
 	case buildName:
 		label := styles.NormalItem.Render("\n  Nome personalizado para a flake:")
 		hint := styles.MutedStyle.Render("\n  (deixe vazio e pressione enter para usar host+timestamp)")
+		if m.multiHost {
+			label = styles.NormalItem.Render("\n  Nome do diretório da flake multi-host (" + strings.Join(m.checkedHosts(), ", ") + "):")
+			hint = styles.MutedStyle.Render("\n  (deixe vazio e pressione enter para usar hosts+timestamp)")
+		}
 		s = title + label + "\n\n  " + m.nameInput.View() + hint
 	case buildRunning:
 		s = title + "\n\n  " + m.spinner.View() + " Processando..."
+	case buildChecking:
+		s = title + "\n\n" +
+			styles.SuccessStyle.Render("  ✅ Flake gerada com sucesso!") + "\n\n" +
+			styles.NormalItem.Render("  Arquivo: "+m.result) + "\n\n" +
+			m.renderWarnings() + "  " +
+			m.spinner.View() + " Avaliando a flake (nix-instantiate --parse, nix flake check, drvPath)..."
 	case buildDone:
 		s = title + "\n\n" +
 			styles.SuccessStyle.Render("  ✅ Flake gerada com sucesso!") + "\n\n" +
-			styles.NormalItem.Render("  Arquivo: "+m.result)
+			styles.NormalItem.Render("  Arquivo: "+m.result) + "\n\n" +
+			m.renderWarnings()
+		switch {
+		case m.check != nil:
+			s += renderCheck(m.check)
+			if !m.check.OK() {
+				s += "\n" + styles.WarningStyle.Render("  Aplicar fica bloqueado para esta flake (F na confirmação força).")
+			}
+		default:
+			s += styles.WarningStyle.Render("  ⚠️  Flake não avaliada — v avalia agora.")
+		}
+		if m.errMsg != "" {
+			s += "\n" + styles.ErrorStyle.Render("  "+m.errMsg)
+		}
 	case buildSaved:
 		s = title + "\n\n" +
 			styles.SuccessStyle.Render("  💾 Preset atualizado com sucesso!") + "\n\n" +
@@ -1,16 +1,17 @@
 package views
 
 import (
+	"LEGOFlakes/cmd/lego-tui/engine"
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -20,14 +21,22 @@ type diskoSubState int
 const (
 	diskoSubList diskoSubState = iota
 	diskoSubAction
-	diskoSubCreate
+	diskoSubWizardLoading // waiting for lsblk
+	diskoSubWizardDisk    // choosing the target disk
+	diskoSubWizardForm    // partition scheme
+	diskoSubBind          // choosing the preset that uses the layout
+	diskoSubMapLoading    // evaluating the layout, see diskomap.go
+	diskoSubMap           // partition map of the layout
 	diskoSubConfirmDelete
-	diskoSubConfirmRun
+	diskoSubPreflight  // checking the disks a destructive run would wipe
+	diskoSubConfirmRun // mount-only: y/n; destructive: typing the disk names
+	diskoSubPassphrase // LUKS passphrase for the layout, see engine.LUKSPasswordFile
 	diskoSubRun
 	diskoSubResult
 )
 
-type diskoResult struct {
+// diskoCopyFinished reports copying the layout to /mnt after disko succeeded
+type diskoCopyFinished struct {
 	output string
 	err    error
 }
@@ -62,19 +71,39 @@ type DiskoModel struct {
 	subState    diskoSubState
 	list        list.Model
 	actionList  list.Model
-	input       textinput.Model
+	presetList  list.Model // presets for diskoSubBind
+	mapView     viewport.Model
 	spinner     spinner.Model
 	rootDir     string
+	runner      engine.Runner
 	selected    string // Path of selected file
-	output      string
+	proc        processView
 	errMsg      string
 	width       int
 	height      int
 	message     string
 	isMountOnly bool
+	passInputs  []textinput.Model // LUKS passphrase, confirmation
+	passFocus   int
+	luks        *engine.LUKSRun // key and layout copy of the current run
+
+	// Pre-flight of destructive runs (see diskosafety.go)
+	targets      []engine.DiskoTarget
+	confirmInput textinput.Model
+
+	// Layout wizard (see diskowizard.go)
+	diskList     list.Model
+	disk         engine.BlockDevice
+	device       string            // stable path of disk, see engine.StableDevicePath
+	wizardInputs []textinput.Model // file name, ESP, swap, root size
+	wizardFocus  int               // see wizardField
+	wizardFS     int               // index into engine.RootFilesystems
+	wizardHome   bool
+	wizardCrypt  engine.EncryptionConfig
+	wizardMirror int // 0 for none, else 1 + index into mirrorCandidates
 }
 
-func NewDiskoModel(rootDir string) DiskoModel {
+func NewDiskoModel(rootDir string, runner engine.Runner) DiskoModel {
 	sp := spinner.New()
 	sp.Spinner = spinner.Line
 	sp.Style = lipgloss.NewStyle().Foreground(styles.ColorWarning)
@@ -89,22 +118,25 @@ func NewDiskoModel(rootDir string) DiskoModel {
 	actionList.Title = "Ações Disko"
 	actionList.Styles.Title = styles.Subtitle
 
-	ti := textinput.New()
-	ti.Placeholder = "disk-layout.nix"
-	ti.Focus()
-
 	// Ensure dir exists
 	os.MkdirAll(filepath.Join(rootDir, "disko"), 0755)
 
 	return DiskoModel{
-		subState:   diskoSubList,
-		spinner:    sp,
-		rootDir:    rootDir,
-		list:       emptyList,
-		actionList: actionList,
-		input:      ti,
-		width:      80,
-		height:     24,
+		subState:     diskoSubList,
+		spinner:      sp,
+		rootDir:      rootDir,
+		runner:       runner,
+		list:         emptyList,
+		actionList:   actionList,
+		presetList:   emptyList,
+		diskList:     emptyList,
+		wizardInputs: newWizardInputs(),
+		passInputs:   newPassphraseInputs(),
+		confirmInput: newConfirmInput(),
+		mapView:      viewport.New(76, 16),
+		proc:         newProcessView(),
+		width:        80,
+		height:       24,
 	}
 }
 
@@ -139,6 +171,8 @@ func (m *DiskoModel) refreshActionList() {
 	actions := []list.Item{
 		diskoActionItem{title: "🚀 Executar Disko", desc: "Formatar e montar discos (PERIGOSO)"},
 		diskoActionItem{title: "💽 Montar Apenas", desc: "Apenas montar as unidades configuradas"},
+		diskoActionItem{title: "🗺️  Mapa de Partições", desc: "Ver discos, tamanhos e montagens do layout"},
+		diskoActionItem{title: "🔗 Vincular a Preset", desc: "Usar este layout no preset (btrfs/zfs na flake)"},
 		diskoActionItem{title: "📝 Editar", desc: "Abrir no editor"},
 		diskoActionItem{title: "🗑️  Deletar", desc: "Remover arquivo permanentemente"},
 		diskoActionItem{title: "↩️  Voltar", desc: "Retornar à lista"},
@@ -159,15 +193,7 @@ func (m *DiskoModel) refreshActionList() {
 }
 
 func (m *DiskoModel) openEditor(path string) tea.Cmd {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "micro"
-	}
-	c := exec.Command(editor, path)
-	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	return tea.ExecProcess(c, func(err error) tea.Msg {
+	return editorCommand(m.runner, path, func(err error) tea.Msg {
 		return diskoEditorFinished{err}
 	})
 }
@@ -184,6 +210,41 @@ func (m DiskoModel) Update(msg tea.Msg) (DiskoModel, tea.Cmd) {
 		return m, nil
 	case tea.WindowSizeMsg:
 		m.SetSize(msg.Width, msg.Height)
+	case sudoValidated:
+		if m.subState != diskoSubRun {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.removeLUKSKey()
+			m.errMsg = "sudo: " + msg.err.Error()
+			m.subState = diskoSubResult
+			return m, nil
+		}
+		return m.runDisko()
+	case ProcessMsg:
+		if !m.proc.owns(msg) {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.handle(msg)
+		if msg.done {
+			m.removeLUKSKey()
+			if msg.err != nil {
+				m.errMsg = msg.err.Error()
+				m.subState = diskoSubResult
+				return m, nil
+			}
+			return m, m.copyLayout()
+		}
+		return m, cmd
+	case diskoCopyFinished:
+		showDryRun(&m.proc, m.runner)
+		m.proc.append(msg.output)
+		if msg.err != nil {
+			m.errMsg = msg.err.Error()
+		}
+		m.subState = diskoSubResult
+		return m, nil
 	}
 
 	switch m.subState {
@@ -191,12 +252,25 @@ func (m DiskoModel) Update(msg tea.Msg) (DiskoModel, tea.Cmd) {
 		return m.updateList(msg)
 	case diskoSubAction:
 		return m.updateAction(msg)
-	case diskoSubCreate:
-		return m.updateCreate(msg)
+	case diskoSubWizardLoading, diskoSubWizardDisk:
+		return m.updateWizardDisk(msg)
+	case diskoSubWizardForm:
+		return m.updateWizardForm(msg)
+	case diskoSubBind:
+		return m.updateBind(msg)
+	case diskoSubMapLoading, diskoSubMap:
+		return m.updateMap(msg)
 	case diskoSubConfirmDelete:
 		return m.updateConfirmDelete(msg)
+	case diskoSubPreflight:
+		return m.updatePreflight(msg)
 	case diskoSubConfirmRun:
+		if !m.isMountOnly {
+			return m.updateConfirmWipe(msg)
+		}
 		return m.updateConfirmRun(msg)
+	case diskoSubPassphrase:
+		return m.updatePassphrase(msg)
 	case diskoSubRun:
 		return m.updateRun(msg)
 	case diskoSubResult:
@@ -217,10 +291,7 @@ func (m DiskoModel) updateList(msg tea.Msg) (DiskoModel, tea.Cmd) {
 			}
 			return m, nil
 		case "n":
-			m.subState = diskoSubCreate
-			m.input.SetValue("")
-			m.input.Focus()
-			return m, textinput.Blink
+			return m.startWizard()
 		case "d":
 			if item, ok := m.list.SelectedItem().(diskoItem); ok {
 				m.selected = item.path
@@ -250,12 +321,15 @@ func (m DiskoModel) updateAction(msg tea.Msg) (DiskoModel, tea.Cmd) {
 				switch item.title {
 				case "🚀 Executar Disko":
 					m.isMountOnly = false
-					m.subState = diskoSubConfirmRun
-					return m, nil
+					return m.startPreflight()
 				case "💽 Montar Apenas":
 					m.isMountOnly = true
 					m.subState = diskoSubConfirmRun
 					return m, nil
+				case "🗺️  Mapa de Partições":
+					return m.openMap()
+				case "🔗 Vincular a Preset":
+					return m.openBind()
 				case "📝 Editar":
 					return m, m.openEditor(m.selected)
 				case "🗑️  Deletar":
@@ -276,74 +350,70 @@ func (m DiskoModel) updateAction(msg tea.Msg) (DiskoModel, tea.Cmd) {
 	return m, cmd
 }
 
-func (m DiskoModel) updateCreate(msg tea.Msg) (DiskoModel, tea.Cmd) {
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
+// openBind lists the presets the selected layout can be bound to
+func (m DiskoModel) openBind() (DiskoModel, tea.Cmd) {
+	presets, err := engine.ListPresets(filepath.Join(m.rootDir, "presets"))
+	if err != nil || len(presets) == 0 {
+		m.message = "Nenhum preset encontrado (crie um na aba Hosts)"
+		m.subState = diskoSubList
+		return m, nil
+	}
+	layout := filepath.Base(m.selected)
+	var items []list.Item
+	for _, info := range presets {
+		desc := "sem layout"
+		if p, err := engine.LoadPreset(info.Path); err == nil && p.Disko.Layout != "" {
+			desc = "layout atual: " + p.Disko.Layout
+			if p.Disko.Layout == layout {
+				desc += " (este)"
+			}
+		}
+		items = append(items, diskoActionItem{title: info.Name, desc: desc})
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(styles.ColorText)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(styles.ColorMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(styles.ColorSecondary).
+		BorderLeftForeground(styles.ColorSecondary)
+
+	m.presetList = list.New(items, delegate, m.width-4, m.height-6)
+	m.presetList.Title = "Vincular " + layout + " ao preset"
+	m.presetList.Styles.Title = styles.Subtitle
+	m.presetList.SetShowHelp(false)
+	m.presetList.SetFilteringEnabled(false)
+	m.message = ""
+	m.subState = diskoSubBind
+	return m, nil
+}
+
+func (m DiskoModel) updateBind(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
 		switch msg.String() {
+		case "esc":
+			m.subState = diskoSubAction
+			return m, nil
 		case "enter":
-			name := m.input.Value()
-			if name == "" {
+			item, ok := m.presetList.SelectedItem().(diskoActionItem)
+			if !ok {
 				return m, nil
 			}
-			if !strings.HasSuffix(name, ".nix") {
-				name += ".nix"
-			}
-			path := filepath.Join(m.rootDir, "disko", name)
-
-			f, err := os.Create(path)
-			if err != nil {
-				m.message = "Erro ao criar: " + err.Error()
-				m.subState = diskoSubList
+			layout := filepath.Base(m.selected)
+			if err := engine.BindDiskoLayout(m.rootDir, item.title, layout); err != nil {
+				m.message = "Erro ao salvar o preset: " + err.Error()
 				return m, nil
 			}
-			// Default disko template
-			f.WriteString(`{
-  disko.devices = {
-    disk = {
-      main = {
-        type = "disk";
-        device = "/dev/vda";
-        content = {
-          type = "gpt";
-          partitions = {
-            ESP = {
-              type = "EF00";
-              size = "512M";
-              content = {
-                type = "filesystem";
-                format = "vfat";
-                mountpoint = "/boot";
-              };
-            };
-            root = {
-              size = "100%";
-              content = {
-                type = "filesystem";
-                format = "ext4";
-                mountpoint = "/";
-              };
-            };
-          };
-        };
-      };
-    };
-  };
-}
-`)
-			f.Close()
-
-			m.selected = path
-			m.Refresh()
-			m.subState = diskoSubList
-			return m, m.openEditor(path)
-
-		case "esc":
+			m.message = fmt.Sprintf("🔗 %s/%s vinculado ao preset '%s'", engine.DiskoDir, layout, item.title)
+			if f, err := engine.ScanDiskoLayout(m.selected); err == nil && len(f.Filesystems()) > 0 {
+				m.message += " — a flake terá suporte a " + strings.Join(f.Filesystems(), " e ")
+			}
 			m.subState = diskoSubList
 			return m, nil
 		}
 	}
 	var cmd tea.Cmd
-	m.input, cmd = m.input.Update(msg)
+	m.presetList, cmd = m.presetList.Update(msg)
 	return m, cmd
 }
 
@@ -353,10 +423,12 @@ func (m DiskoModel) updateResult(msg tea.Msg) (DiskoModel, tea.Cmd) {
 		switch msg.String() {
 		case "enter", "esc":
 			m.subState = diskoSubList
-			m.output = ""
 			m.errMsg = ""
 			return m, nil
 		}
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.updateKeys(msg)
+		return m, cmd
 	}
 	return m, nil
 }
@@ -388,8 +460,7 @@ func (m DiskoModel) updateConfirmRun(msg tea.Msg) (DiskoModel, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "y", "Y":
-			m.subState = diskoSubRun
-			return m, tea.Batch(m.spinner.Tick, m.runDisko())
+			return m.proceedRun()
 		case "n", "N", "esc":
 			m.subState = diskoSubList
 			return m, nil
@@ -398,17 +469,115 @@ func (m DiskoModel) updateConfirmRun(msg tea.Msg) (DiskoModel, tea.Cmd) {
 	return m, nil
 }
 
-func (m DiskoModel) updateRun(msg tea.Msg) (DiskoModel, tea.Cmd) {
-	switch msg := msg.(type) {
-	case diskoResult:
-		if msg.err != nil {
-			m.errMsg = msg.err.Error()
-			m.output = msg.output
-		} else {
-			m.output = msg.output
+// proceedRun goes on from a confirmed run: the LUKS passphrase when the
+// layout needs one, then sudo and disko
+func (m DiskoModel) proceedRun() (DiskoModel, tea.Cmd) {
+	m.errMsg = ""
+	if engine.NeedsLUKSPassphrase(m.selected) {
+		return m, m.openPassphrase()
+	}
+	// Ask for the sudo password before the output is captured
+	m.subState = diskoSubRun
+	return m, validateSudo(m.runner)
+}
+
+func newPassphraseInputs() []textinput.Model {
+	inputs := make([]textinput.Model, 2)
+	for i, placeholder := range []string{"senha LUKS", "confirmar senha"} {
+		inputs[i] = textinput.New()
+		inputs[i].Placeholder = placeholder
+		inputs[i].EchoMode = textinput.EchoPassword
+		inputs[i].EchoCharacter = '•'
+		inputs[i].Width = 40
+	}
+	return inputs
+}
+
+func (m *DiskoModel) openPassphrase() tea.Cmd {
+	m.subState = diskoSubPassphrase
+	m.message = ""
+	m.passFocus = 0
+	for i := range m.passInputs {
+		m.passInputs[i].SetValue("")
+		m.passInputs[i].Blur()
+	}
+	return m.passInputs[0].Focus()
+}
+
+func (m DiskoModel) updatePassphrase(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.subState = diskoSubList
+			return m, nil
+		case "tab", "shift+tab", "up", "down":
+			m.passInputs[m.passFocus].Blur()
+			m.passFocus = 1 - m.passFocus
+			return m, m.passInputs[m.passFocus].Focus()
+		case "enter":
+			if m.passFocus == 0 {
+				m.passInputs[0].Blur()
+				m.passFocus = 1
+				return m, m.passInputs[1].Focus()
+			}
+			return m.savePassphrase()
 		}
-		m.subState = diskoSubResult
+	}
+	var cmd tea.Cmd
+	m.passInputs[m.passFocus], cmd = m.passInputs[m.passFocus].Update(msg)
+	return m, cmd
+}
+
+// savePassphrase writes the typed passphrase to a private key file and
+// goes on to run disko; the file is removed as soon as disko ends. A dry
+// run writes nothing.
+func (m DiskoModel) savePassphrase() (DiskoModel, tea.Cmd) {
+	pass := m.passInputs[0].Value()
+	switch {
+	case pass == "":
+		m.message = "A senha não pode ser vazia"
+		return m, nil
+	case pass != m.passInputs[1].Value():
+		m.message = "As senhas não conferem"
 		return m, nil
+	}
+	if !m.runner.DryRun() {
+		run, err := engine.PrepareLUKSRun(m.selected, pass)
+		if err != nil {
+			m.message = err.Error()
+			return m, nil
+		}
+		m.luks = run
+	}
+	for i := range m.passInputs {
+		m.passInputs[i].SetValue("")
+	}
+	m.message = ""
+	m.subState = diskoSubRun
+	return m, validateSudo(m.runner)
+}
+
+func (m DiskoModel) passphraseView() string {
+	s := styles.Subtitle.Render("SENHA LUKS: "+filepath.Base(m.selected)) + "\n\n"
+	if m.isMountOnly {
+		s += styles.MutedStyle.Render("  A senha abre os volumes criptografados antes de montar.") + "\n"
+	} else {
+		s += styles.MutedStyle.Render("  A senha criptografa os volumes e será pedida a cada boot (até registrar TPM2/FIDO2).") + "\n"
+	}
+	s += styles.MutedStyle.Render("  Ela fica num arquivo temporário privado (0600) só enquanto o disko roda.") + "\n\n" +
+		"  " + m.passInputs[0].View() + "\n  " + m.passInputs[1].View()
+	if m.message != "" {
+		s += "\n\n" + styles.ErrorStyle.Render("  "+m.message)
+	}
+	return s
+}
+
+func (m DiskoModel) updateRun(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.updateKeys(msg)
+		return m, cmd
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -417,51 +586,87 @@ func (m DiskoModel) updateRun(msg tea.Msg) (DiskoModel, tea.Cmd) {
 	return m, nil
 }
 
-func (m DiskoModel) runDisko() tea.Cmd {
-	return func() tea.Msg {
-		mode := "disko"
-		if m.isMountOnly {
-			mode = "mount"
-		}
-		// sudo nix run github:nix-community/disko -- --mode <mode> <file>
-		cmd := exec.Command("sudo", "nix", "run", "github:nix-community/disko", "--", "--mode", mode, m.selected)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return diskoResult{output: string(out), err: err}
-		}
+// runDisko streams disko into the output viewport
+func (m DiskoModel) runDisko() (DiskoModel, tea.Cmd) {
+	mode := "disko"
+	if m.isMountOnly {
+		mode = "mount"
+	}
+	// sudo nix run github:nix-community/disko -- --mode <mode> <file>
+	file := m.selected
+	if m.luks != nil {
+		file = m.luks.Layout
+	}
+	cmd := engine.Cmd("sudo", "nix", "run", "github:nix-community/disko", "--", "--mode", mode, file)
+	name := "disko-" + mode + "-" + strings.TrimSuffix(filepath.Base(m.selected), ".nix")
+	readCmd := m.proc.start(m.runner, m.rootDir, name, cmd)
+	if m.proc.err != nil {
+		m.removeLUKSKey()
+		m.errMsg = m.proc.err.Error()
+		m.subState = diskoSubResult
+		return m, nil
+	}
+	return m, tea.Batch(m.spinner.Tick, readCmd)
+}
 
+// removeLUKSKey deletes the passphrase of the current run, if any
+func (m *DiskoModel) removeLUKSKey() {
+	if m.luks != nil {
+		m.luks.Remove()
+		m.luks = nil
+	}
+}
+
+// copyLayout copies the layout to /mnt/etc/nixos once disko has finished
+func (m DiskoModel) copyLayout() tea.Cmd {
+	return func() tea.Msg {
 		destDir := "/mnt/etc/nixos"
-		exec.Command("sudo", "mkdir", "-p", destDir).Run()
+		m.runner.Run(engine.Cmd("sudo", "mkdir", "-p", destDir))
 
 		destFile := filepath.Join(destDir, "disko.nix")
-		cpCmd := exec.Command("sudo", "cp", m.selected, destFile)
-		if cpOut, cpErr := cpCmd.CombinedOutput(); cpErr != nil {
-			return diskoResult{output: string(out) + "\nErro ao copiar para /mnt: " + string(cpOut), err: cpErr}
+		if cpOut, cpErr := m.runner.Run(engine.Cmd("sudo", "cp", m.selected, destFile)); cpErr != nil {
+			return diskoCopyFinished{output: "Erro ao copiar para /mnt: " + string(cpOut), err: cpErr}
 		}
-
-		return diskoResult{output: string(out) + fmt.Sprintf("\nLayout copiado para %s com sucesso.", destFile), err: nil}
+		return diskoCopyFinished{output: fmt.Sprintf("Layout copiado para %s com sucesso.", destFile)}
 	}
 }
 
 func (m DiskoModel) HelpKeys() string {
 	switch m.subState {
 	case diskoSubList:
-		return "enter: confirmar/ações • n: novo • d: deletar • e: editar"
+		return "enter: confirmar/ações • n: novo (assistente) • d: deletar • e: editar"
 	case diskoSubAction:
 		return "enter: selecionar • esc: voltar"
-	case diskoSubCreate:
-		return "enter: criar (abre editor) • esc: cancelar"
+	case diskoSubWizardLoading:
+		return "aguarde o lsblk..."
+	case diskoSubWizardDisk:
+		return "enter: escolher disco • esc: cancelar"
+	case diskoSubWizardForm:
+		return "tab/↑/↓: campo • espaço/←/→: alternar • ctrl+s: salvar layout • esc: voltar aos discos"
+	case diskoSubBind:
+		return "enter: vincular ao preset • esc: voltar"
+	case diskoSubMapLoading:
+		return "avaliando o layout... • esc: voltar"
+	case diskoSubMap:
+		return "↑/↓/pgup/pgdn: rolar • esc: voltar"
 	case diskoSubConfirmDelete:
 		return "y: confirmar • n/esc: cancelar"
+	case diskoSubPreflight:
+		return "verificando discos... • esc: cancelar"
 	case diskoSubConfirmRun:
 		if m.isMountOnly {
 			return "y: MONTAR UNIDADES • n: cancelar"
 		}
-		return "y: DESTRUIR DADOS E FORMATAR • n: cancelar"
+		if !m.targetsSafe() {
+			return "esc: voltar"
+		}
+		return "digite o(s) disco(s) • enter: DESTRUIR DADOS E FORMATAR • esc: cancelar"
+	case diskoSubPassphrase:
+		return "tab: próximo campo • enter: continuar • esc: cancelar"
 	case diskoSubRun:
-		return "aguarde..."
+		return "↑/↓/pgup/pgdn: rolar • x: cancelar"
 	case diskoSubResult:
-		return "enter/esc: voltar"
+		return "↑/↓/pgup/pgdn: rolar • enter/esc: voltar"
 	}
 	return ""
 }
@@ -481,9 +686,20 @@ func (m DiskoModel) View() string {
 	case diskoSubAction:
 		s = m.actionList.View()
 
-	case diskoSubCreate:
-		title := styles.Subtitle.Render("NOVO LAYOUT DE DISCO")
-		s = title + "\n\n  Nome do arquivo (.nix):\n  " + m.input.View()
+	case diskoSubWizardLoading, diskoSubWizardDisk, diskoSubWizardForm:
+		s = m.wizardView()
+
+	case diskoSubBind:
+		s = m.presetList.View()
+		if m.message != "" {
+			s += "\n" + styles.ErrorStyle.Render(m.message)
+		}
+
+	case diskoSubMapLoading:
+		s = m.mapTitle() + "\n\n  " + m.spinner.View() + " Avaliando o layout..."
+
+	case diskoSubMap:
+		s = m.mapTitle() + "\n\n" + m.mapView.View()
 
 	case diskoSubConfirmDelete:
 		title := styles.Subtitle.Render("CONFIRMAR DELEÇÃO")
@@ -500,12 +716,16 @@ func (m DiskoModel) View() string {
 				"\n  ⚠️  Apenas montar as unidades configuradas em '%s'?\n  (Nenhum dado será deletado)\n", fname))
 			s = title + warn
 		} else {
-			title := styles.Subtitle.Render("PERIGO: formatar disco?")
-			warn := styles.ErrorStyle.Render(fmt.Sprintf(
-				"\n  ⚠️  ATENÇÃO: Isso irá DESTRUIR DADOS no disco configurado em '%s'.\n  Tem certeza absoluta?\n", fname))
-			s = title + warn
+			s = m.confirmWipeView()
 		}
 
+	case diskoSubPreflight:
+		s = styles.Subtitle.Render("VERIFICANDO DISCOS") + "\n\n  " + m.spinner.View() +
+			" Conferindo os discos de '" + filepath.Base(m.selected) + "' (lsblk, /proc/mounts)..."
+
+	case diskoSubPassphrase:
+		s = m.passphraseView()
+
 	case diskoSubRun:
 		if m.isMountOnly {
 			title := styles.Subtitle.Render("MONTANDO DISCO")
@@ -514,13 +734,10 @@ func (m DiskoModel) View() string {
 			title := styles.Subtitle.Render("EXECUTANDO DISKO")
 			s = title + "\n\n  " + m.spinner.View() + " Formatando e montando..."
 		}
+		s += "\n\n" + m.proc.View()
 
 	case diskoSubResult:
 		title := styles.Subtitle.Render("RESULTADO")
-		out := m.output
-		if len(out) > 800 {
-			out = out[len(out)-800:]
-		}
 		resStyle := styles.SuccessStyle
 		icon := "✅"
 		if m.errMsg != "" {
@@ -535,7 +752,7 @@ func (m DiskoModel) View() string {
 			s += styles.MutedStyle.Render("  Erro: "+m.errMsg) + "\n"
 		}
 
-		s += "\n" + styles.MutedStyle.Render(strings.TrimSpace(out))
+		s += "\n" + m.proc.View()
 	}
 
 	return lipgloss.NewStyle().Padding(1, 2).Render(s)
@@ -546,4 +763,9 @@ func (m *DiskoModel) SetSize(w, h int) {
 	m.height = h
 	m.list.SetSize(w-4, h-8)
 	m.actionList.SetSize(w-4, h-6)
+	m.presetList.SetSize(w-4, h-6)
+	m.diskList.SetSize(w-4, h-8)
+	m.proc.SetSize(w-4, h-10)
+	m.mapView.Width = w - 4
+	m.mapView.Height = h - 8
 }
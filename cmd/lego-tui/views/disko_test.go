@@ -0,0 +1,81 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// liveRunner records commands but reports a real run, so that the
+// passphrase is written as it would be outside --dry-run
+type liveRunner struct{ *engine.RecordingRunner }
+
+func (liveRunner) DryRun() bool { return false }
+
+// luksLayout writes a wizard layout with LUKS and returns its path
+func luksLayout(t *testing.T, root string) string {
+	t.Helper()
+	l := engine.DefaultDiskLayout("/dev/vda")
+	l.Encryption.LUKS = true
+	path, err := engine.WriteDiskoLayout(root, "luks", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func typePassphrase(m DiskoModel, pass string) DiskoModel {
+	for i := range m.passInputs {
+		m.passInputs[i].SetValue(pass)
+	}
+	return m
+}
+
+func TestDiskoLUKSKeyIsPrivateAndRemoved(t *testing.T) {
+	root := t.TempDir()
+	rec := &engine.RecordingRunner{}
+	m := NewDiskoModel(root, liveRunner{rec})
+	m.selected = luksLayout(t, root)
+
+	m, _ = typePassphrase(m, "s3nha").savePassphrase()
+	if m.luks == nil {
+		t.Fatalf("no key written: %s", m.message)
+	}
+	key, layout := m.luks.Key, m.luks.Layout
+	if data, err := os.ReadFile(key); err != nil || string(data) != "s3nha" {
+		t.Fatalf("key = %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Dir(key)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("key directory mode = %v, %v", info.Mode().Perm(), err)
+	}
+	if data, _ := os.ReadFile(layout); !strings.Contains(string(data), `"`+key+`"`) || strings.Contains(string(data), engine.LUKSPasswordFile+`"`) {
+		t.Errorf("layout copy does not read %s:\n%s", key, data)
+	}
+
+	m, _ = m.runDisko()
+	if got := recorded(rec); len(got) != 1 || !strings.HasSuffix(got[0], " "+layout) {
+		t.Errorf("disko = %q, want the layout copy", got)
+	}
+	m, _ = m.Update(ProcessMsg{id: m.proc.proc.ID, done: true})
+	if _, err := os.Stat(filepath.Dir(key)); !os.IsNotExist(err) {
+		t.Errorf("key kept after disko (err %v)", err)
+	}
+}
+
+func TestDiskoLUKSDryRunWritesNoKey(t *testing.T) {
+	root := t.TempDir()
+	rec := &engine.RecordingRunner{}
+	m := NewDiskoModel(root, rec)
+	m.selected = luksLayout(t, root)
+
+	m, _ = typePassphrase(m, "s3nha").savePassphrase()
+	if m.luks != nil {
+		t.Fatalf("dry run wrote %s", m.luks.Key)
+	}
+	m, _ = m.runDisko()
+	if got := recorded(rec); len(got) != 1 || !strings.HasSuffix(got[0], " "+m.selected) {
+		t.Errorf("disko = %q, want the layout itself", got)
+	}
+}
@@ -0,0 +1,251 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// partColors are cycled through the segments of a disk's bar
+var partColors = []lipgloss.Color{
+	styles.ColorPrimary, styles.ColorSecondary, styles.ColorAccent,
+	styles.ColorPurple, styles.ColorWarning,
+}
+
+// diskoMapMsg carries the evaluated layout of the selected file
+type diskoMapMsg struct {
+	pm  *engine.PartitionMap
+	err error
+}
+
+// openMap evaluates the selected layout for the partition map
+func (m DiskoModel) openMap() (DiskoModel, tea.Cmd) {
+	m.message = ""
+	m.subState = diskoSubMapLoading
+	r, path := m.runner, m.selected
+	return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+		pm, err := engine.ReadPartitionMap(r, path)
+		return diskoMapMsg{pm, err}
+	})
+}
+
+func (m DiskoModel) updateMap(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case diskoMapMsg:
+		if m.subState != diskoSubMapLoading {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.message = "Mapa de partições falhou: " + msg.err.Error()
+			m.subState = diskoSubList
+			return m, nil
+		}
+		m.mapView.SetContent(renderPartitionMap(msg.pm, m.mapView.Width))
+		m.mapView.GotoTop()
+		m.subState = diskoSubMap
+		return m, nil
+	case spinner.TickMsg:
+		if m.subState != diskoSubMapLoading {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	case tea.KeyMsg:
+		if msg.String() == "esc" || msg.String() == "q" {
+			m.subState = diskoSubAction
+			return m, nil
+		}
+	}
+	if m.subState != diskoSubMap {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.mapView, cmd = m.mapView.Update(msg)
+	return m, cmd
+}
+
+func (m DiskoModel) mapTitle() string {
+	return styles.Subtitle.Render("MAPA DE PARTIÇÕES  " + filepath.Base(m.selected))
+}
+
+// renderPartitionMap draws one proportional bar per disk, a legend of its
+// partitions, the pools built on them and the layout's problems
+func renderPartitionMap(pm *engine.PartitionMap, width int) string {
+	barWidth := min(max(width-4, 20), 72)
+	var sb strings.Builder
+
+	if len(pm.Disks) == 0 {
+		sb.WriteString(styles.WarningStyle.Render("Nenhum disco em disko.devices.disk.") + "\n")
+	}
+	for _, d := range pm.Disks {
+		size := "tamanho desconhecido"
+		if d.Bytes > 0 {
+			size = engine.HumanSize(d.Bytes)
+		}
+		sb.WriteString(styles.SuccessStyle.Render("💽 "+d.Name) + "  " + d.Device +
+			styles.MutedStyle.Render(fmt.Sprintf("  (%s, %s)", d.Table, size)) + "\n\n")
+
+		sb.WriteString(" " + partitionBar(d, barWidth) + "\n\n")
+		for i, p := range d.Parts {
+			sb.WriteString(partitionLegend(i, p, d) + "\n")
+		}
+		if d.Bytes == 0 && hasRemainder(d) {
+			sb.WriteString(styles.MutedStyle.Render("   Disco fora desta máquina: a parte que ocupa o resto está fora de escala.") + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	for _, pool := range pm.Pools {
+		mounts := "sem pontos de montagem"
+		if len(pool.Mountpoints) > 0 {
+			mounts = strings.Join(pool.Mountpoints, ", ")
+		}
+		sb.WriteString(styles.SuccessStyle.Render(fmt.Sprintf("🗄️  %s %s", pool.Kind, pool.Name)) + "  " + mounts + "\n")
+	}
+	if len(pm.Pools) > 0 {
+		sb.WriteString("\n")
+	}
+
+	if len(pm.Warnings) == 0 {
+		sb.WriteString(styles.SuccessStyle.Render("✅ Nenhum problema encontrado no layout.") + "\n")
+	}
+	for _, w := range pm.Warnings {
+		sb.WriteString(styles.WarningStyle.Render("⚠️  "+w) + "\n")
+	}
+
+	source := "Lido com nix eval --json."
+	if pm.Local {
+		source = "Lido localmente (nix não instalado): só valores literais do layout são considerados."
+	}
+	sb.WriteString("\n" + styles.MutedStyle.Render(source))
+	return sb.String()
+}
+
+// partitionBar splits width cells among the disk's partitions, each
+// numbered as in the legend and at least one cell wide
+func partitionBar(d engine.DiskMap, width int) string {
+	if len(d.Parts) == 0 {
+		return styles.MutedStyle.Render(strings.Repeat("░", width))
+	}
+	weights := partWeights(d)
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	cells := make([]int, len(weights))
+	used := 0
+	for i, w := range weights {
+		cells[i] = max(1, int(w/total*float64(width)))
+		used += cells[i]
+	}
+	// Give the rounding slack to (or take it from) the largest segment
+	largest := 0
+	for i := range cells {
+		if cells[i] > cells[largest] {
+			largest = i
+		}
+	}
+	cells[largest] = max(1, cells[largest]+width-used)
+
+	var sb strings.Builder
+	for i, n := range cells {
+		label := fmt.Sprint(i + 1)
+		if d.Parts[i].Encrypted && n >= len(label)+3 {
+			label += " 🔐"
+		}
+		if lipgloss.Width(label) > n {
+			label = ""
+		}
+		sb.WriteString(lipgloss.NewStyle().
+			Background(partColors[i%len(partColors)]).
+			Foreground(styles.ColorBg).
+			Bold(true).
+			Width(n).
+			Align(lipgloss.Center).
+			Render(label))
+	}
+	return sb.String()
+}
+
+// partWeights are the relative sizes of the partitions: fixed sizes as is,
+// percentages of the disk, and the remainder of the disk for 100%. When the
+// disk is not on this machine, the remainder weighs as much as the rest.
+func partWeights(d engine.DiskMap) []float64 {
+	var fixed float64
+	for _, p := range d.Parts {
+		fixed += float64(p.Bytes)
+	}
+	disk := float64(d.Bytes)
+	if disk == 0 {
+		disk = max(2*fixed, 1)
+	}
+	weights := make([]float64, len(d.Parts))
+	var assigned float64
+	remainders := 0
+	for i, p := range d.Parts {
+		switch {
+		case p.Remainder():
+			remainders++
+		case p.Percent > 0:
+			weights[i] = disk * float64(p.Percent) / 100
+		default:
+			weights[i] = float64(p.Bytes)
+		}
+		assigned += weights[i]
+	}
+	rest := max(disk-assigned, disk/10)
+	for i, p := range d.Parts {
+		if p.Remainder() {
+			weights[i] = rest / float64(remainders)
+		}
+		weights[i] = max(weights[i], 1)
+	}
+	return weights
+}
+
+func hasRemainder(d engine.DiskMap) bool {
+	for _, p := range d.Parts {
+		if p.Remainder() {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionLegend is the "■ n name size fs mountpoints" line of a segment
+func partitionLegend(i int, p engine.PartMap, d engine.DiskMap) string {
+	swatch := lipgloss.NewStyle().Foreground(partColors[i%len(partColors)]).Render(fmt.Sprintf(" ■ %d", i+1))
+	size := p.Size
+	if p.Remainder() {
+		size = "resto"
+		if d.Bytes > 0 {
+			var fixed int64
+			for _, q := range d.Parts {
+				fixed += q.Bytes
+			}
+			if d.Bytes > fixed {
+				size = "~" + engine.HumanSize(d.Bytes-fixed)
+			}
+		}
+	}
+	content := p.Content
+	if content == "" {
+		content = "—"
+	}
+	line := fmt.Sprintf("%s %-12s %-8s %-14s ", swatch, p.Name, size, content) +
+		styles.MutedStyle.Render(fmt.Sprintf("%-4s", p.Type))
+	if len(p.Mountpoints) > 0 {
+		line += "  " + strings.Join(p.Mountpoints, ", ")
+	}
+	if p.Encrypted {
+		line += "  🔐"
+	}
+	return line
+}
@@ -0,0 +1,157 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// diskoPreflightMsg carries the checked target disks of the selected layout
+type diskoPreflightMsg struct {
+	targets []engine.DiskoTarget
+	err     error
+}
+
+func newConfirmInput() textinput.Model {
+	ti := textinput.New()
+	ti.CharLimit = 64
+	ti.Width = 40
+	return ti
+}
+
+// startPreflight checks the disks the layout would wipe before asking for
+// the confirmation
+func (m DiskoModel) startPreflight() (DiskoModel, tea.Cmd) {
+	m.targets = nil
+	m.errMsg = ""
+	m.message = ""
+	m.subState = diskoSubPreflight
+	r, path := m.runner, m.selected
+	return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+		targets, err := engine.CheckDiskoTargets(r, path)
+		return diskoPreflightMsg{targets, err}
+	})
+}
+
+func (m DiskoModel) updatePreflight(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case diskoPreflightMsg:
+		if msg.err != nil {
+			m.message = "Verificação do layout falhou: " + msg.err.Error()
+			m.subState = diskoSubList
+			return m, nil
+		}
+		m.targets = msg.targets
+		m.confirmInput.SetValue("")
+		m.subState = diskoSubConfirmRun
+		if !m.targetsSafe() {
+			m.confirmInput.Blur()
+			return m, nil
+		}
+		return m, m.confirmInput.Focus()
+	case tea.KeyMsg:
+		if msg.String() == "esc" {
+			m.subState = diskoSubList
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	return m, cmd
+}
+
+// confirmPhrase is what the user types to confirm: the kernel names of the
+// target disks, e.g. "nvme0n1" or "sda sdb"
+func (m DiskoModel) confirmPhrase() string {
+	names := make([]string, len(m.targets))
+	for i, t := range m.targets {
+		names[i] = t.Name()
+	}
+	return strings.Join(names, " ")
+}
+
+// targetsSafe reports whether no target disk has a problem
+func (m DiskoModel) targetsSafe() bool {
+	for _, t := range m.targets {
+		if len(t.Problems) > 0 {
+			return false
+		}
+	}
+	return len(m.targets) > 0
+}
+
+func (m DiskoModel) updateConfirmWipe(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.subState = diskoSubList
+			m.message = ""
+			return m, nil
+		case "enter":
+			if !m.targetsSafe() {
+				return m, nil
+			}
+			if strings.Join(strings.Fields(m.confirmInput.Value()), " ") != m.confirmPhrase() {
+				m.message = fmt.Sprintf("Digite exatamente %q para confirmar", m.confirmPhrase())
+				return m, nil
+			}
+			m.confirmInput.SetValue("")
+			m.message = ""
+			return m.proceedRun()
+		}
+	}
+	if !m.targetsSafe() {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.confirmInput, cmd = m.confirmInput.Update(msg)
+	return m, cmd
+}
+
+func (m DiskoModel) confirmWipeView() string {
+	var sb strings.Builder
+	sb.WriteString(styles.Subtitle.Render("PERIGO: formatar disco?") + "\n\n")
+	sb.WriteString(styles.ErrorStyle.Render(fmt.Sprintf(
+		"  ⚠️  '%s' vai APAGAR TUDO nos discos abaixo:", filepath.Base(m.selected))) + "\n\n")
+
+	for _, t := range m.targets {
+		icon := "💽"
+		if len(t.Problems) > 0 {
+			icon = "⛔"
+		}
+		sb.WriteString(fmt.Sprintf("  %s %s", icon, t.Device))
+		if t.Resolved != t.Device {
+			sb.WriteString(styles.MutedStyle.Render(" → " + t.Resolved))
+		}
+		sb.WriteString("\n")
+		if d := t.Disk; d != nil {
+			serial := d.Serial
+			if serial == "" {
+				serial = "?"
+			}
+			sb.WriteString(styles.MutedStyle.Render(fmt.Sprintf("     %s • série %s", d.Description(), serial)) + "\n")
+			if parts := len(d.Children); parts > 0 {
+				sb.WriteString(styles.MutedStyle.Render(fmt.Sprintf("     %d partição(ões) atuais serão destruídas", parts)) + "\n")
+			}
+		}
+		for _, p := range t.Problems {
+			sb.WriteString(styles.ErrorStyle.Render("     ✗ "+p) + "\n")
+		}
+	}
+
+	if !m.targetsSafe() {
+		sb.WriteString("\n" + styles.WarningStyle.Render("  Formatação recusada: resolva os problemas acima (desmonte, confira o device no layout).") + "\n")
+		return sb.String()
+	}
+	sb.WriteString("\n" + styles.WarningStyle.Render(fmt.Sprintf("  Para confirmar, digite o nome do(s) disco(s): %s", m.confirmPhrase())) + "\n\n")
+	sb.WriteString("  " + m.confirmInput.View() + "\n")
+	if m.message != "" {
+		sb.WriteString("\n" + styles.ErrorStyle.Render("  "+m.message) + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,135 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var (
+	lsblkCmd  = engine.Cmd("lsblk", "--json", "--bytes", "--output", "NAME,PATH,TYPE,SIZE,MODEL,SERIAL,TRAN,RM,RO,FSTYPE,LABEL,MOUNTPOINTS")
+	mountsCmd = engine.Cmd("cat", "/proc/mounts")
+	zpoolCmd  = engine.Cmd("zpool", "status", "-P", "rpool")
+)
+
+// fixture reads a recorded command output from the engine's testdata
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "engine", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// messages runs cmd, expanding batches, and returns what it produced
+func messages(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		var msgs []tea.Msg
+		for _, c := range batch {
+			msgs = append(msgs, messages(c)...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
+
+// preflight runs the disk check of layout against the recorded machine and
+// returns the model at the confirmation step
+func preflight(t *testing.T, rec *engine.RecordingRunner, devices ...string) DiskoModel {
+	t.Helper()
+	root := t.TempDir()
+	m := NewDiskoModel(root, rec)
+	m.selected = filepath.Join(root, "disko", "alvo.nix")
+	src := "{\n  disko.devices.disk = {\n"
+	for i, d := range devices {
+		src += "    d" + string(rune('0'+i)) + ".device = \"" + d + "\";\n"
+	}
+	if err := os.WriteFile(m.selected, []byte(src+"  };\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, cmd := m.startPreflight()
+	for _, msg := range messages(cmd) {
+		if msg, ok := msg.(diskoPreflightMsg); ok {
+			m, _ = m.Update(msg)
+		}
+	}
+	if m.subState != diskoSubConfirmRun {
+		t.Fatalf("state = %d after the preflight (%s), want the confirmation", m.subState, m.message)
+	}
+	return m
+}
+
+// typeText sends s to the model as keystrokes
+func typeText(m DiskoModel, s string) DiskoModel {
+	for _, r := range s {
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return m
+}
+
+func TestDiskoConfirmWipeRequiresDiskNames(t *testing.T) {
+	rec := &engine.RecordingRunner{Results: map[string]engine.RecordedResult{
+		lsblkCmd.String():  {Output: fixture(t, "lsblk-zfs.json")},
+		mountsCmd.String(): {Output: fixture(t, "mounts-zfs")},
+	}}
+	m := preflight(t, rec, "/dev/sdb")
+
+	m = typeText(m, "sda")
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.subState != diskoSubConfirmRun || !strings.Contains(m.message, `"sdb"`) {
+		t.Fatalf("wrong name accepted: state %d, message %q", m.subState, m.message)
+	}
+
+	m.confirmInput.SetValue("")
+	m = typeText(m, "sdb")
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.subState != diskoSubRun {
+		t.Fatalf("state = %d after confirming, want diskoSubRun (%s)", m.subState, m.message)
+	}
+	// tea.Exec runs sudo -v in the program; its result comes back as this
+	m, _ = m.Update(sudoValidated{})
+
+	want := []string{
+		lsblkCmd.String(),
+		mountsCmd.String(),
+		zpoolCmd.String(), // the root is on ZFS, just not on sdb
+		"sudo nix run github:nix-community/disko -- --mode disko " + m.selected,
+	}
+	if got := recorded(rec); !slices.Equal(got, want) {
+		t.Errorf("commands:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestDiskoConfirmWipeRefusesZFSRoot(t *testing.T) {
+	rec := &engine.RecordingRunner{Results: map[string]engine.RecordedResult{
+		lsblkCmd.String():  {Output: fixture(t, "lsblk-zfs.json")},
+		mountsCmd.String(): {Output: fixture(t, "mounts-zfs")},
+		zpoolCmd.String():  {Output: fixture(t, "zpool-status-rpool")},
+	}}
+	m := preflight(t, rec, "/dev/nvme0n1")
+	if m.targetsSafe() || !strings.Contains(m.View(), "contém o / do sistema em execução") {
+		t.Fatalf("ZFS root disk not refused:\n%s", m.View())
+	}
+
+	m = typeText(m, "nvme0n1")
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.subState != diskoSubConfirmRun {
+		t.Errorf("state = %d, want to stay at the refused confirmation", m.subState)
+	}
+	for _, c := range recorded(rec) {
+		if strings.HasPrefix(c, "sudo") {
+			t.Errorf("ran %q on a refused disk", c)
+		}
+	}
+}
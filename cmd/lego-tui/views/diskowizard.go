@@ -0,0 +1,457 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// diskListMsg carries the disks found by lsblk
+type diskListMsg struct {
+	disks []engine.BlockDevice
+	err   error
+}
+
+// wizardField is a position in the layout form
+type wizardField int
+
+const (
+	fieldName wizardField = iota
+	fieldESP
+	fieldSwap
+	fieldFS
+	fieldMirror
+	fieldLUKS
+	fieldTPM2
+	fieldFIDO2
+	fieldHome
+	fieldRootSize
+	wizardFieldCount
+)
+
+// wizardInputIndex maps the text fields of the form to wizardInputs
+var wizardInputIndex = map[wizardField]int{fieldName: 0, fieldESP: 1, fieldSwap: 2, fieldRootSize: 3}
+
+// ── Disk list item ───────────────────────────────────────────
+type diskItem struct {
+	dev engine.BlockDevice
+}
+
+func (d diskItem) Title() string { return d.dev.Name + "  " + d.dev.Description() }
+func (d diskItem) Description() string {
+	desc := d.dev.DevicePath()
+	if mounts := d.dev.AllMounts(); len(mounts) > 0 {
+		desc += " • montado em " + strings.Join(mounts, ", ")
+	}
+	return desc
+}
+func (d diskItem) FilterValue() string { return d.dev.Name }
+
+func newWizardInputs() []textinput.Model {
+	placeholders := []string{"layout.nix", "1G", "4G (vazio: sem swap)", "64G"}
+	inputs := make([]textinput.Model, len(placeholders))
+	for i, placeholder := range placeholders {
+		inputs[i] = textinput.New()
+		inputs[i].Placeholder = placeholder
+		inputs[i].CharLimit = 40
+		inputs[i].Width = 30
+	}
+	return inputs
+}
+
+// InputActive reports whether the layout form, the passphrase prompt or the
+// typed confirmation is capturing keystrokes
+func (m DiskoModel) InputActive() bool {
+	switch m.subState {
+	case diskoSubWizardForm, diskoSubPassphrase:
+		return true
+	case diskoSubConfirmRun:
+		return !m.isMountOnly
+	}
+	return false
+}
+
+// startWizard lists the disks with lsblk
+func (m DiskoModel) startWizard() (DiskoModel, tea.Cmd) {
+	m.message = ""
+	m.subState = diskoSubWizardLoading
+	r := m.runner
+	return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+		disks, err := engine.ListDisks(r)
+		return diskListMsg{disks, err}
+	})
+}
+
+func (m DiskoModel) updateWizardDisk(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case diskListMsg:
+		if m.subState != diskoSubWizardLoading {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.message = "Erro ao listar discos: " + msg.err.Error()
+			m.subState = diskoSubList
+			return m, nil
+		}
+		if len(msg.disks) == 0 {
+			m.message = "Nenhum disco encontrado pelo lsblk"
+			m.subState = diskoSubList
+			return m, nil
+		}
+		m.refreshDiskList(msg.disks)
+		m.subState = diskoSubWizardDisk
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "esc":
+			m.subState = diskoSubList
+			return m, nil
+		case "enter":
+			if item, ok := m.diskList.SelectedItem().(diskItem); ok {
+				return m, m.openWizardForm(item.dev)
+			}
+			return m, nil
+		}
+	}
+	if m.subState == diskoSubWizardLoading {
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	var cmd tea.Cmd
+	m.diskList, cmd = m.diskList.Update(msg)
+	return m, cmd
+}
+
+func (m *DiskoModel) refreshDiskList(disks []engine.BlockDevice) {
+	items := make([]list.Item, len(disks))
+	for i, d := range disks {
+		items[i] = diskItem{d}
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(styles.ColorText)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(styles.ColorMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(styles.ColorSecondary).
+		BorderLeftForeground(styles.ColorSecondary)
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.
+		Foreground(styles.ColorMuted).
+		BorderLeftForeground(styles.ColorSecondary)
+
+	l := list.New(items, delegate, m.width-4, m.height-8)
+	l.Title = "Escolha o disco de destino"
+	l.Styles.Title = styles.Subtitle
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+	m.diskList = l
+}
+
+// openWizardForm fills the form with the defaults for dev
+func (m *DiskoModel) openWizardForm(dev engine.BlockDevice) tea.Cmd {
+	m.disk = dev
+	m.device = engine.StableDevicePath(dev.DevicePath())
+	m.message = ""
+	def := engine.DefaultDiskLayout(dev.DevicePath())
+	values := []string{dev.Name + ".nix", def.ESPSize, def.SwapSize, def.RootSize}
+	for i := range m.wizardInputs {
+		m.wizardInputs[i].SetValue(values[i])
+		m.wizardInputs[i].Blur()
+	}
+	m.wizardFS = 0
+	m.wizardHome = def.Home
+	m.wizardCrypt = engine.EncryptionConfig{}
+	m.wizardMirror = 0
+	m.wizardFocus = int(fieldName)
+	m.subState = diskoSubWizardForm
+	return m.wizardInputs[0].Focus()
+}
+
+// focusWizardField moves the form focus by delta, wrapping around
+func (m *DiskoModel) focusWizardField(delta int) tea.Cmd {
+	if i, ok := wizardInputIndex[wizardField(m.wizardFocus)]; ok {
+		m.wizardInputs[i].Blur()
+	}
+	n := int(wizardFieldCount)
+	m.wizardFocus = (m.wizardFocus + delta + n) % n
+	for m.wizardSkips(wizardField(m.wizardFocus)) {
+		m.wizardFocus = (m.wizardFocus + delta + n) % n
+	}
+	if i, ok := wizardInputIndex[wizardField(m.wizardFocus)]; ok {
+		return m.wizardInputs[i].Focus()
+	}
+	return nil
+}
+
+// wizardSkips reports whether f does not apply to the current choices: the
+// size of / only matters when /home takes the rest of the disk, TPM2 and
+// FIDO2 unlock a LUKS container, and a zfs pool has its own datasets and
+// encryption but may be mirrored
+func (m DiskoModel) wizardSkips(f wizardField) bool {
+	zfs := engine.RootFilesystems[m.wizardFS] == "zfs"
+	switch f {
+	case fieldMirror:
+		return !zfs
+	case fieldLUKS, fieldHome:
+		return zfs
+	case fieldRootSize:
+		return zfs || !m.wizardHome
+	case fieldTPM2, fieldFIDO2:
+		return zfs || !m.wizardCrypt.LUKS
+	}
+	return false
+}
+
+// wizardLastField reports whether no field after f applies, so that enter
+// saves the layout
+func (m DiskoModel) wizardLastField(f wizardField) bool {
+	for next := f + 1; next < wizardFieldCount; next++ {
+		if !m.wizardSkips(next) {
+			return false
+		}
+	}
+	return true
+}
+
+// mirrorCandidates are the other disks listed by lsblk
+func (m DiskoModel) mirrorCandidates() []engine.BlockDevice {
+	var disks []engine.BlockDevice
+	for _, item := range m.diskList.Items() {
+		if d := item.(diskItem).dev; d.Name != m.disk.Name {
+			disks = append(disks, d)
+		}
+	}
+	return disks
+}
+
+// mirrorDisk is the chosen mirror, if any
+func (m DiskoModel) mirrorDisk() (engine.BlockDevice, bool) {
+	candidates := m.mirrorCandidates()
+	if m.wizardMirror == 0 || m.wizardMirror > len(candidates) {
+		return engine.BlockDevice{}, false
+	}
+	return candidates[m.wizardMirror-1], true
+}
+
+func (m DiskoModel) updateWizardForm(msg tea.Msg) (DiskoModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		field := wizardField(m.wizardFocus)
+		switch msg.String() {
+		case "esc":
+			m.subState = diskoSubWizardDisk
+			return m, nil
+		case "tab", "down":
+			return m, m.focusWizardField(1)
+		case "shift+tab", "up":
+			return m, m.focusWizardField(-1)
+		case "enter":
+			if m.wizardLastField(field) {
+				return m.saveWizardLayout()
+			}
+			return m, m.focusWizardField(1)
+		case "ctrl+s":
+			return m.saveWizardLayout()
+		case " ", "left", "right":
+			switch field {
+			case fieldFS:
+				delta := 1
+				if msg.String() == "left" {
+					delta = len(engine.RootFilesystems) - 1
+				}
+				m.wizardFS = (m.wizardFS + delta) % len(engine.RootFilesystems)
+				return m, nil
+			case fieldMirror:
+				n := len(m.mirrorCandidates()) + 1
+				delta := 1
+				if msg.String() == "left" {
+					delta = n - 1
+				}
+				m.wizardMirror = (m.wizardMirror + delta) % n
+				return m, nil
+			case fieldLUKS:
+				m.wizardCrypt = engine.EncryptionConfig{LUKS: !m.wizardCrypt.LUKS}
+				return m, nil
+			case fieldTPM2:
+				m.wizardCrypt.TPM2 = !m.wizardCrypt.TPM2
+				return m, nil
+			case fieldFIDO2:
+				m.wizardCrypt.FIDO2 = !m.wizardCrypt.FIDO2
+				return m, nil
+			case fieldHome:
+				m.wizardHome = !m.wizardHome
+				return m, nil
+			}
+		}
+	}
+	if i, ok := wizardInputIndex[wizardField(m.wizardFocus)]; ok {
+		var cmd tea.Cmd
+		m.wizardInputs[i], cmd = m.wizardInputs[i].Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// wizardLayout reads the form
+func (m DiskoModel) wizardLayout() engine.DiskLayout {
+	value := func(f wizardField) string {
+		return strings.TrimSpace(m.wizardInputs[wizardInputIndex[f]].Value())
+	}
+	l := engine.DiskLayout{
+		Device:     m.device,
+		ESPSize:    value(fieldESP),
+		SwapSize:   value(fieldSwap),
+		RootFS:     engine.RootFilesystems[m.wizardFS],
+		RootSize:   value(fieldRootSize),
+		Home:       m.wizardHome,
+		Encryption: m.wizardCrypt,
+	}
+	if l.RootFS == "zfs" {
+		l.Home = false
+		l.Encryption = engine.EncryptionConfig{}
+		if d, ok := m.mirrorDisk(); ok {
+			l.Mirror = engine.StableDevicePath(d.DevicePath())
+		}
+	}
+	return l
+}
+
+// saveWizardLayout writes the layout to disko/ and returns to the list
+func (m DiskoModel) saveWizardLayout() (DiskoModel, tea.Cmd) {
+	name := strings.TrimSpace(m.wizardInputs[wizardInputIndex[fieldName]].Value())
+	path, err := engine.WriteDiskoLayout(m.rootDir, name, m.wizardLayout())
+	if err != nil {
+		m.message = err.Error()
+		return m, nil
+	}
+	m.Refresh()
+	for i, item := range m.list.Items() {
+		if item.(diskoItem).path == path {
+			m.list.Select(i)
+		}
+	}
+	m.message = fmt.Sprintf("✅ Layout salvo em %s/%s — e edita, enter executa", engine.DiskoDir, filepath.Base(path))
+	if l := m.wizardLayout(); l.Encryption.LUKS {
+		m.message += "\n🔐 No preset do host, ative a mesma criptografia em [encryption]: " + encryptionKeys(m.wizardCrypt)
+	}
+	m.subState = diskoSubList
+	return m, nil
+}
+
+func (m DiskoModel) wizardView() string {
+	title := styles.Subtitle.Render("NOVO LAYOUT DE DISCO")
+	switch m.subState {
+	case diskoSubWizardLoading:
+		return title + "\n\n  " + m.spinner.View() + " Lendo discos (lsblk)..."
+	case diskoSubWizardDisk:
+		return title + "\n\n" + m.diskList.View()
+	}
+
+	l := m.wizardLayout()
+	var sb strings.Builder
+	sb.WriteString(title + "\n\n")
+	sb.WriteString(styles.MutedStyle.Render("  Disco: ") + m.disk.Name + "  " + m.disk.Description() + "\n")
+	sb.WriteString(styles.MutedStyle.Render("  Device: "+l.Device) + "\n\n")
+
+	row := func(f wizardField, label, value string) {
+		cursor := "  "
+		if wizardField(m.wizardFocus) == f {
+			cursor = styles.Subtitle.Render("▸ ")
+		}
+		sb.WriteString("  " + cursor + styles.MutedStyle.Render(fmt.Sprintf("%-20s", label)) + value + "\n")
+	}
+	input := func(f wizardField) string { return m.wizardInputs[wizardInputIndex[f]].View() }
+	row(fieldName, "Arquivo", input(fieldName))
+	row(fieldESP, "ESP (/boot)", input(fieldESP))
+	row(fieldSwap, "Swap", input(fieldSwap))
+	row(fieldFS, "Sistema de arquivos", "◂ "+l.RootFS+" ▸")
+	if l.RootFS == "zfs" {
+		mirror := "◂ nenhum ▸"
+		if d, ok := m.mirrorDisk(); ok {
+			mirror = "◂ " + d.Name + "  " + d.Description() + " ▸"
+		}
+		row(fieldMirror, "Espelho (mirror)", mirror)
+		sb.WriteString(styles.MutedStyle.Render("  Pool "+engine.ZFSPool+": datasets root, nix e home (com snapshots automáticos)") + "\n")
+		return m.wizardFooter(&sb, l)
+	}
+	row(fieldLUKS, "Criptografia", yesNo(l.Encryption.LUKS, "LUKS2 (senha pedida ao executar)", "não"))
+	if l.Encryption.LUKS {
+		row(fieldTPM2, "  Desbloqueio TPM2", yesNo(l.Encryption.TPM2, "sim", "não"))
+		row(fieldFIDO2, "  Desbloqueio FIDO2", yesNo(l.Encryption.FIDO2, "sim", "não"))
+	}
+	home := "não (/ usa o resto do disco)"
+	if m.wizardHome {
+		home = "sim (/home usa o resto do disco)"
+	}
+	row(fieldHome, "/home separado", home)
+	if m.wizardHome {
+		row(fieldRootSize, "Tamanho do /", input(fieldRootSize))
+	} else {
+		row(fieldRootSize, "Tamanho do /", styles.MutedStyle.Render("100% (resto do disco)"))
+	}
+	if l.RootFS == "btrfs" {
+		sb.WriteString(styles.MutedStyle.Render("  Subvolumes @, @home, @nix e @snapshots, com compress=zstd") + "\n")
+	}
+	return m.wizardFooter(&sb, l)
+}
+
+// wizardFooter adds the partition summary, validation and messages
+func (m DiskoModel) wizardFooter(sb *strings.Builder, l engine.DiskLayout) string {
+	sb.WriteString("\n" + styles.MutedStyle.Render("  "+layoutSummary(l)) + "\n")
+	if err := l.Validate(); err != nil {
+		sb.WriteString(styles.WarningStyle.Render("  ⚠️  "+err.Error()) + "\n")
+	}
+	if m.message != "" {
+		sb.WriteString(styles.ErrorStyle.Render("  "+m.message) + "\n")
+	}
+	return sb.String()
+}
+
+func yesNo(b bool, yes, no string) string {
+	if b {
+		return yes
+	}
+	return no
+}
+
+// encryptionKeys lists the [encryption] keys of a preset matching e
+func encryptionKeys(e engine.EncryptionConfig) string {
+	s := "luks = true"
+	if e.TPM2 {
+		s += ", tpm2 = true"
+	}
+	if e.FIDO2 {
+		s += ", fido2 = true"
+	}
+	return s
+}
+
+// layoutSummary is a one-line partition table, e.g. "ESP 1G │ swap 4G │ / ext4 resto"
+func layoutSummary(l engine.DiskLayout) string {
+	parts := []string{"ESP " + l.ESPSize}
+	if l.SwapSize != "" {
+		parts = append(parts, "swap "+l.SwapSize)
+	}
+	if l.RootFS == "zfs" {
+		pool := "zfs " + engine.ZFSPool + " resto"
+		if l.Mirror != "" {
+			pool += " (mirror)"
+		}
+		return strings.Join(append(parts, pool), " │ ")
+	}
+	fs := l.RootFS
+	if l.Encryption.LUKS {
+		fs = "luks2+" + fs
+	}
+	if l.Home {
+		parts = append(parts, "/ "+fs+" "+l.RootSize, "/home "+fs+" resto")
+	} else {
+		parts = append(parts, "/ "+fs+" resto")
+	}
+	return strings.Join(parts, " │ ")
+}
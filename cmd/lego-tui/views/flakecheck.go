@@ -0,0 +1,80 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// FlakeCheckMsg carries the result of a flake evaluation started by Gerar
+// or Aplicar. The main model forwards it to both; each one ignores
+// evaluations of flakes it is not waiting for.
+type FlakeCheckMsg struct {
+	check *engine.FlakeCheck
+	err   error // saving the result failed
+}
+
+// maxCheckProblems is how many problems are listed before summarizing the rest
+const maxCheckProblems = 5
+
+// checkFlake evaluates a generated flake and saves the result next to it
+func checkFlake(r engine.Runner, root, flakePath string) tea.Cmd {
+	return func() tea.Msg {
+		check := engine.CheckFlake(r, root, flakePath)
+		return FlakeCheckMsg{check: check, err: engine.SaveFlakeCheck(check)}
+	}
+}
+
+// checkStatus is the one-line state of a flake's saved evaluation
+func checkStatus(check *engine.FlakeCheck) string {
+	switch {
+	case check == nil:
+		return "não avaliada"
+	case !check.Current():
+		return "alterada desde a avaliação"
+	case check.OK():
+		return "✅ avaliada"
+	}
+	return fmt.Sprintf("❌ avaliação falhou (%d)", len(check.Problems))
+}
+
+// renderCheck shows the drvPath of every host, or the problems found
+func renderCheck(check *engine.FlakeCheck) string {
+	var sb strings.Builder
+	if check.OK() {
+		sb.WriteString(styles.SuccessStyle.Render("  ✅ Avaliação OK (parse, nix flake check, drvPath)") + "\n")
+		hosts := make([]string, 0, len(check.DrvPaths))
+		for h := range check.DrvPaths {
+			hosts = append(hosts, h)
+		}
+		sort.Strings(hosts)
+		for _, h := range hosts {
+			sb.WriteString(styles.MutedStyle.Render("    "+h+": "+check.DrvPaths[h]) + "\n")
+		}
+		return sb.String()
+	}
+
+	sb.WriteString(styles.ErrorStyle.Render(fmt.Sprintf("  ❌ A avaliação encontrou %d problema(s):", len(check.Problems))) + "\n")
+	for i, p := range check.Problems {
+		if i == maxCheckProblems {
+			sb.WriteString(styles.MutedStyle.Render(fmt.Sprintf("    ... e mais %d", len(check.Problems)-i)) + "\n")
+			break
+		}
+		where := "flake"
+		if p.Module != "" {
+			where = p.Module
+			if p.Line > 0 {
+				where += fmt.Sprintf(" (linha %d)", p.Line)
+			}
+		}
+		sb.WriteString("    " + styles.WarningStyle.Render("["+p.Step+"]") + " " + styles.Subtitle.Render(where) + "\n")
+		for _, l := range strings.Split(p.Message, "\n") {
+			sb.WriteString(styles.MutedStyle.Render("      "+l) + "\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,473 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type genState int
+
+const (
+	genList genState = iota
+	genDiffing
+	genDiff
+	genConfirm
+	genRunning
+	genDone
+	genError
+)
+
+// genAction is what genConfirm is about to run on the selected generation
+type genAction int
+
+const (
+	genRollback genAction = iota // make it the default and switch to it
+	genActivate                  // switch-to-configuration test
+)
+
+// closureDiffMsg carries the output of nix store diff-closures
+type closureDiffMsg struct {
+	out string
+	err error
+}
+
+// ── Generation list item ─────────────────────────────────────
+type generationItem struct {
+	gen engine.Generation
+}
+
+func (g generationItem) Title() string {
+	title := fmt.Sprintf("#%d  %s", g.gen.Number, g.gen.Label())
+	if g.gen.Current {
+		title += "  ● atual"
+	}
+	if g.gen.Booted {
+		title += "  ⏻ em uso"
+	}
+	return title
+}
+
+func (g generationItem) Description() string {
+	desc := g.gen.Created.Format("2006-01-02 15:04")
+	if r := g.gen.Record; r != nil {
+		desc += " • " + r.Flake
+		if r.Preset != "" {
+			desc += " (preset " + r.Preset + ")"
+		}
+	} else {
+		desc += " • sem registro do lego-tui"
+	}
+	return desc
+}
+
+func (g generationItem) FilterValue() string { return g.gen.Label() }
+
+// ── Model ────────────────────────────────────────────────────
+type GenerationsModel struct {
+	state    genState
+	genList  list.Model
+	spinner  spinner.Model
+	rootDir  string
+	runner   engine.Runner
+	profile  string
+	proc     processView
+	errMsg   string
+	notice   string
+	width    int
+	height   int
+	selected engine.Generation
+	action   genAction
+
+	// Closure diff
+	diffBase  *engine.Generation // generation marked with "m" as the old side
+	diffTitle string
+	diffView  viewport.Model
+}
+
+func NewGenerationsModel(rootDir string, runner engine.Runner) GenerationsModel {
+	sp := spinner.New()
+	sp.Spinner = spinner.Line
+	sp.Style = lipgloss.NewStyle().Foreground(styles.ColorWarning)
+
+	emptyList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	emptyList.SetShowHelp(false)
+
+	return GenerationsModel{
+		state:    genList,
+		genList:  emptyList,
+		spinner:  sp,
+		rootDir:  rootDir,
+		runner:   runner,
+		profile:  engine.SystemProfile(),
+		proc:     newProcessView(),
+		diffView: viewport.New(76, 14),
+		width:    80,
+		height:   24,
+	}
+}
+
+// Refresh rereads the generations of the system profile
+func (m *GenerationsModel) Refresh() {
+	m.errMsg = ""
+	gens, err := engine.ListGenerations(m.rootDir, m.profile)
+	if err != nil {
+		m.errMsg = err.Error()
+	}
+	var items []list.Item
+	for _, g := range gens {
+		items = append(items, generationItem{g})
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(styles.ColorText)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(styles.ColorMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(styles.ColorSecondary).
+		BorderLeftForeground(styles.ColorSecondary)
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.
+		Foreground(styles.ColorMuted).
+		BorderLeftForeground(styles.ColorSecondary)
+
+	l := list.New(items, delegate, m.width-4, m.height-14)
+	l.Title = "Gerações do sistema (" + m.profile + ")"
+	l.Styles.Title = styles.Subtitle
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+	m.genList = l
+	m.diffBase = nil
+}
+
+func (m GenerationsModel) Init() tea.Cmd { return nil }
+
+func (m GenerationsModel) Update(msg tea.Msg) (GenerationsModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case closureDiffMsg:
+		if m.state != genDiffing {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.state = genList
+			m.notice = "Erro no diff: " + msg.err.Error()
+			return m, nil
+		}
+		m.diffView.SetContent(renderClosureDiff(msg.out))
+		m.diffView.GotoTop()
+		m.state = genDiff
+		return m, nil
+	case sudoValidated:
+		if m.state != genRunning {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.state = genError
+			m.errMsg = "sudo: " + msg.err.Error()
+			return m, nil
+		}
+		return m.runAction()
+	case ProcessMsg:
+		if !m.proc.owns(msg) {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.handle(msg)
+		if msg.done {
+			if msg.err != nil {
+				m.state = genError
+				m.errMsg = msg.err.Error()
+			} else {
+				m.state = genDone
+			}
+		}
+		return m, cmd
+	}
+
+	switch m.state {
+	case genList:
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			item, ok := m.genList.SelectedItem().(generationItem)
+			switch msg.String() {
+			case "r", "t":
+				if !ok {
+					return m, nil
+				}
+				if item.gen.Current && msg.String() == "r" {
+					m.notice = "Esta já é a geração atual"
+					return m, nil
+				}
+				m.selected = item.gen
+				m.action = genRollback
+				if msg.String() == "t" {
+					m.action = genActivate
+				}
+				m.notice = ""
+				m.state = genConfirm
+				return m, nil
+			case "m":
+				if !ok {
+					return m, nil
+				}
+				if m.diffBase != nil && m.diffBase.Number == item.gen.Number {
+					m.diffBase = nil
+					m.notice = ""
+				} else {
+					g := item.gen
+					m.diffBase = &g
+					m.notice = fmt.Sprintf("Base do diff: #%d — selecione outra geração e pressione d", g.Number)
+				}
+				return m, nil
+			case "d":
+				if ok {
+					return m.startDiff(item.gen)
+				}
+				return m, nil
+			case "R":
+				m.Refresh()
+				m.notice = ""
+				return m, nil
+			}
+		case tea.WindowSizeMsg:
+			m.width = msg.Width
+			m.height = msg.Height
+			m.genList.SetSize(msg.Width-4, msg.Height-14)
+		}
+		var cmd tea.Cmd
+		m.genList, cmd = m.genList.Update(msg)
+		return m, cmd
+
+	case genDiffing:
+		if msg, ok := msg.(spinner.TickMsg); ok {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
+	case genDiff:
+		if msg, ok := msg.(tea.KeyMsg); ok && (msg.String() == "esc" || msg.String() == "q") {
+			m.state = genList
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.diffView, cmd = m.diffView.Update(msg)
+		return m, cmd
+
+	case genConfirm:
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "y", "Y":
+				// Ask for the sudo password before the output is captured
+				m.state = genRunning
+				m.errMsg = ""
+				return m, validateSudo(m.runner)
+			case "n", "N", "esc":
+				m.state = genList
+				return m, nil
+			}
+		}
+
+	case genRunning:
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			var cmd tea.Cmd
+			m.proc, cmd = m.proc.updateKeys(msg)
+			return m, cmd
+		case spinner.TickMsg:
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
+	case genDone, genError:
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "enter", "esc":
+				m.Refresh()
+				m.state = genList
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.proc, cmd = m.proc.updateKeys(msg)
+			return m, cmd
+		}
+	}
+	return m, nil
+}
+
+// startDiff compares newer with the marked base, or with the generation
+// just before it when nothing is marked
+func (m GenerationsModel) startDiff(newer engine.Generation) (GenerationsModel, tea.Cmd) {
+	var older engine.Generation
+	switch {
+	case m.diffBase != nil && m.diffBase.Number != newer.Number:
+		older = *m.diffBase
+	default:
+		idx := m.genList.Index()
+		items := m.genList.Items()
+		if idx+1 >= len(items) {
+			m.notice = "Nenhuma geração anterior para comparar — marque uma base com m"
+			return m, nil
+		}
+		older = items[idx+1].(generationItem).gen
+	}
+	if older.Number > newer.Number {
+		older, newer = newer, older
+	}
+	m.diffTitle = fmt.Sprintf("#%d → #%d", older.Number, newer.Number)
+	m.diffBase = nil
+	m.notice = ""
+	m.state = genDiffing
+	r := m.runner
+	return m, tea.Batch(m.spinner.Tick, func() tea.Msg {
+		out, err := engine.DiffClosures(r, older, newer)
+		return closureDiffMsg{out, err}
+	})
+}
+
+// renderClosureDiff colors the "pkg: 1.0 → 1.1, +1.2 MiB" lines of
+// nix store diff-closures
+func renderClosureDiff(out string) string {
+	out = strings.TrimRight(out, "\n")
+	if out == "" {
+		return styles.SuccessStyle.Render("Nenhuma diferença entre as closures.")
+	}
+	var lines []string
+	for _, l := range strings.Split(out, "\n") {
+		switch {
+		case strings.Contains(l, "∅ →"):
+			lines = append(lines, styles.SuccessStyle.Render(l))
+		case strings.Contains(l, "→ ∅"):
+			lines = append(lines, styles.ErrorStyle.Render(l))
+		case strings.Contains(l, "→"):
+			lines = append(lines, styles.WarningStyle.Render(l))
+		default:
+			lines = append(lines, styles.MutedStyle.Render(l))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// actionCommand is the command genConfirm runs on the selected generation
+func (m GenerationsModel) actionCommand() engine.Command {
+	if m.action == genActivate {
+		return engine.ActivateCommand(m.selected)
+	}
+	return engine.RollbackCommand(m.profile, m.selected)
+}
+
+// runAction streams the rollback or activation into the output viewport
+func (m GenerationsModel) runAction() (GenerationsModel, tea.Cmd) {
+	name := fmt.Sprintf("generation-%d", m.selected.Number)
+	readCmd := m.proc.start(m.runner, m.rootDir, name, m.actionCommand())
+	if m.proc.err != nil {
+		m.state = genError
+		m.errMsg = m.proc.err.Error()
+		return m, nil
+	}
+	return m, tea.Batch(m.spinner.Tick, readCmd)
+}
+
+func (m GenerationsModel) HelpKeys() string {
+	switch m.state {
+	case genList:
+		return "d: diff de closures • m: marcar base • r: rollback • t: ativar sem mudar o boot • R: recarregar"
+	case genDiffing:
+		return "aguarde o diff..."
+	case genDiff:
+		return "↑/↓/pgup/pgdn: rolar • esc: voltar"
+	case genConfirm:
+		return "y: confirmar • n/esc: cancelar"
+	case genRunning:
+		return "↑/↓/pgup/pgdn: rolar • x: cancelar"
+	case genDone, genError:
+		return "↑/↓/pgup/pgdn: rolar • enter: voltar"
+	}
+	return ""
+}
+
+func (m GenerationsModel) View() string {
+	var s string
+	title := styles.Subtitle.Render("GERAÇÕES")
+
+	switch m.state {
+	case genList:
+		s = title + "\n\n"
+		if m.errMsg != "" {
+			s += styles.ErrorStyle.Render("  "+m.errMsg) + "\n\n"
+		}
+		s += m.genList.View()
+		if item, ok := m.genList.SelectedItem().(generationItem); ok {
+			s += "\n" + m.detailView(item.gen)
+		}
+		if m.notice != "" {
+			s += "\n" + styles.WarningStyle.Render("  "+m.notice)
+		}
+	case genDiffing:
+		s = title + "\n\n  " + m.spinner.View() + " Comparando closures " + m.diffTitle + " (nix store diff-closures)..."
+	case genDiff:
+		s = styles.Subtitle.Render("DIFF DE CLOSURES  "+m.diffTitle) + "\n\n" + m.diffView.View()
+	case genConfirm:
+		what := fmt.Sprintf("Voltar para a geração #%d (%s) e torná-la o padrão do boot?", m.selected.Number, m.selected.Label())
+		if m.action == genActivate {
+			what = fmt.Sprintf("Ativar a geração #%d (%s) agora, sem mudar o padrão do boot?", m.selected.Number, m.selected.Label())
+		}
+		s = title + "\n\n" + styles.WarningStyle.Render("  ⚠️  "+what) + "\n\n" +
+			m.detailView(m.selected) + "\n" +
+			styles.MutedStyle.Render("  $ "+m.actionCommand().String())
+	case genRunning:
+		s = title + "\n\n  " + m.spinner.View() + fmt.Sprintf(" Ativando a geração #%d...\n\n", m.selected.Number) +
+			m.proc.View()
+	case genDone:
+		s = title + "\n\n" +
+			styles.SuccessStyle.Render(fmt.Sprintf("  ✅ Geração #%d ativada.", m.selected.Number)) + "\n\n" +
+			m.proc.View()
+	case genError:
+		s = title + "\n\n" +
+			styles.ErrorStyle.Render("  ❌ Erro ao ativar a geração:") + "\n" +
+			styles.MutedStyle.Render("  "+m.errMsg) + "\n\n" +
+			m.proc.View()
+	}
+
+	return lipgloss.NewStyle().Padding(1, 2).Render(s)
+}
+
+// detailView shows where a generation came from
+func (m GenerationsModel) detailView(g engine.Generation) string {
+	var sb strings.Builder
+	line := func(label, value string) {
+		if value != "" {
+			sb.WriteString(styles.MutedStyle.Render("  "+label+": ") + value + "\n")
+		}
+	}
+	line("store", g.StorePath)
+	line("nixos", g.Version)
+	line("kernel", g.Kernel)
+	if r := g.Record; r != nil {
+		flake := r.Flake
+		if _, err := os.Stat(filepath.Join(m.rootDir, "flakes", r.Flake)); err != nil {
+			flake += styles.WarningStyle.Render(" (arquivo removido)")
+		}
+		line("flake", flake)
+		line("preset", r.Preset)
+		line("aplicada", r.AppliedAt+" com nixos-rebuild "+r.Action)
+	}
+	return sb.String()
+}
+
+func (m *GenerationsModel) SetSize(w, h int) {
+	m.width = w
+	m.height = h
+	m.genList.SetSize(w-4, h-14)
+	m.diffView.Width = w - 4
+	m.diffView.Height = h - 6
+	m.proc.SetSize(w-4, h-10)
+}
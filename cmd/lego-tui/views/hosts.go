@@ -4,8 +4,13 @@ import (
 	"LEGOFlakes/cmd/lego-tui/engine"
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -21,6 +26,8 @@ type ManageModulesMsg struct {
 type presetItem struct {
 	info     engine.PresetInfo
 	isActive bool
+	issues   int    // problems found by engine.ValidatePreset
+	warning  string // plaintext/default password warning
 }
 
 func (p presetItem) Title() string {
@@ -32,7 +39,11 @@ func (p presetItem) Title() string {
 	return prefix + p.info.Name
 }
 func (p presetItem) Description() string {
-	return "modificado: " + p.info.Modified.Format("2006-01-02 15:04")
+	desc := "modificado: " + p.info.Modified.Format("2006-01-02 15:04")
+	if p.issues > 0 {
+		desc += fmt.Sprintf(" • ⚠️  %d problema(s)", p.issues)
+	}
+	return desc
 }
 func (p presetItem) FilterValue() string { return p.info.Name }
 
@@ -43,6 +54,14 @@ const (
 	hostSubList hostSubState = iota
 	hostSubCreate
 	hostSubAction
+	hostSubValidate
+	hostSubPassword
+	hostSubUsers
+	hostSubUserForm
+	hostSubUserDelete
+	hostSubUserHome
+	hostSubImport
+	hostSubImportPreview
 )
 
 // ── Hosts Model ──────────────────────────────────────────
@@ -52,16 +71,31 @@ type HostsModel struct {
 	subState     hostSubState
 	presetsDir   string
 	rootDir      string
+	runner       engine.Runner
 	selected     string
 	activePreset string // Track the active preset
 	actionList   list.Model
+	issues       engine.PresetIssues // last validation of the selected preset
+	loadErr      error
+	warning      string            // password warning of the selected preset
+	pwInputs     []textinput.Model // password, confirmation
+	pwFocus      int
+	userList     list.Model
+	userIdx      int               // user being edited, -1 for a new one
+	userInputs   []textinput.Model // name, description, groups, shell
+	userKeys     textarea.Model    // SSH public keys, one per line
+	userFocus    int               // index into userInputs, len(userInputs) for userKeys
+	homeList     list.Model        // home modules of the user at userIdx
+	importInputs []textinput.Model // configuration.nix path, preset name
+	importFocus  int
+	importPlan   *engine.ImportPlan
 	message      string
 	err          error
 	width        int
 	height       int
 }
 
-func NewHostsModel(presetsDir, rootDir string) HostsModel {
+func NewHostsModel(presetsDir, rootDir string, runner engine.Runner) HostsModel {
 	// Text input for new preset
 	ti := textinput.New()
 	ti.Placeholder = "meu-desktop"
@@ -73,14 +107,49 @@ func NewHostsModel(presetsDir, rootDir string) HostsModel {
 	emptyActionList := list.New([]list.Item{}, emptyDelegate, 80, 18)
 	emptyActionList.SetShowHelp(false)
 
+	pwInputs := make([]textinput.Model, 2)
+	for i, placeholder := range []string{"nova senha", "confirmar senha"} {
+		pwInputs[i] = textinput.New()
+		pwInputs[i].Placeholder = placeholder
+		pwInputs[i].EchoMode = textinput.EchoPassword
+		pwInputs[i].EchoCharacter = '•'
+		pwInputs[i].Width = 40
+	}
+
+	userInputs := make([]textinput.Model, 4)
+	for i, placeholder := range []string{"nome", "descrição", "wheel, networkmanager", "bash, zsh, fish... (vazio = padrão)"} {
+		userInputs[i] = textinput.New()
+		userInputs[i].Placeholder = placeholder
+		userInputs[i].Width = 50
+	}
+	userKeys := textarea.New()
+	userKeys.Placeholder = "ssh-ed25519 AAAA... usuario@maquina"
+	userKeys.ShowLineNumbers = false
+	userKeys.SetWidth(70)
+	userKeys.SetHeight(4)
+
+	importInputs := make([]textinput.Model, 2)
+	for i, placeholder := range []string{"/etc/nixos/configuration.nix", "nome do preset"} {
+		importInputs[i] = textinput.New()
+		importInputs[i].Placeholder = placeholder
+		importInputs[i].Width = 50
+	}
+
 	m := HostsModel{
-		presetsDir: presetsDir,
-		rootDir:    rootDir,
-		input:      ti,
-		subState:   hostSubList,
-		width:      80,
-		height:     24,
-		actionList: emptyActionList,
+		importInputs: importInputs,
+		homeList:     emptyActionList,
+		userList:     emptyActionList,
+		userInputs:   userInputs,
+		userKeys:     userKeys,
+		pwInputs:     pwInputs,
+		presetsDir:   presetsDir,
+		rootDir:      rootDir,
+		runner:       runner,
+		input:        ti,
+		subState:     hostSubList,
+		width:        80,
+		height:       24,
+		actionList:   emptyActionList,
 	}
 	m.refreshList()
 	return m
@@ -90,10 +159,17 @@ func (m *HostsModel) refreshList() {
 	presets, _ := engine.ListPresets(m.presetsDir)
 	items := make([]list.Item, len(presets))
 	for i, p := range presets {
-		items[i] = presetItem{
+		item := presetItem{
 			info:     p,
 			isActive: m.activePreset == p.Name,
 		}
+		if preset, err := engine.LoadPreset(p.Path); err != nil {
+			item.issues = 1
+		} else {
+			item.issues = len(engine.ValidatePreset(m.rootDir, preset))
+			item.warning = strings.Join(presetWarnings(m.rootDir, preset), "; ")
+		}
+		items[i] = item
 	}
 
 	delegate := list.NewDefaultDelegate()
@@ -119,6 +195,8 @@ func (m *HostsModel) refreshActionList() {
 	actions := []list.Item{
 		simpleItem{title: "✅ Escolher Preset", desc: "Carrega o Preset limpo de módulos"},
 		simpleItem{title: "🧩 Gerenciar Módulos", desc: "Carrega o Preset completo com todos os módulos"},
+		simpleItem{title: "🔍 Validar Preset", desc: "Verificar host, locale, fuso horário e módulos"},
+		simpleItem{title: "👥 Usuários", desc: "Contas, grupos, shell, chaves SSH e senhas (hashedPassword)"},
 		simpleItem{title: "📝 Editar Preset", desc: "Abrir no editor"},
 		simpleItem{title: "🗑️ Deletar Preset", desc: "Remover permanentemente"},
 		simpleItem{title: "↩️ Voltar", desc: "Retornar à lista"},
@@ -154,10 +232,123 @@ func (m HostsModel) Update(msg tea.Msg) (HostsModel, tea.Cmd) {
 		return m.updateCreate(msg)
 	case hostSubAction:
 		return m.updateAction(msg)
+	case hostSubValidate:
+		if msg, ok := msg.(tea.KeyMsg); ok && (msg.String() == "esc" || msg.String() == "enter") {
+			m.subState = hostSubAction
+		}
+		return m, nil
+	case hostSubPassword:
+		return m.updatePassword(msg)
+	case hostSubUsers:
+		return m.updateUsers(msg)
+	case hostSubUserForm:
+		return m.updateUserForm(msg)
+	case hostSubUserDelete:
+		return m.updateUserDelete(msg)
+	case hostSubUserHome:
+		return m.updateUserHome(msg)
+	case hostSubImport:
+		return m.updateImport(msg)
+	case hostSubImportPreview:
+		return m.updateImportPreview(msg)
 	}
 	return m, nil
 }
 
+// InputActive reports whether a text field is capturing keystrokes
+func (m HostsModel) InputActive() bool {
+	return m.subState == hostSubCreate || m.subState == hostSubPassword ||
+		m.subState == hostSubUserForm || m.subState == hostSubImport || m.list.SettingFilter()
+}
+
+func (m *HostsModel) openPassword() tea.Cmd {
+	m.subState = hostSubPassword
+	m.message = ""
+	m.pwFocus = 0
+	for i := range m.pwInputs {
+		m.pwInputs[i].SetValue("")
+		m.pwInputs[i].Blur()
+	}
+	return m.pwInputs[0].Focus()
+}
+
+func (m HostsModel) updatePassword(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.subState = hostSubUsers
+			return m, nil
+		case "up", "down":
+			m.pwInputs[m.pwFocus].Blur()
+			m.pwFocus = 1 - m.pwFocus
+			return m, m.pwInputs[m.pwFocus].Focus()
+		case "enter":
+			if m.pwFocus == 0 {
+				m.pwInputs[0].Blur()
+				m.pwFocus = 1
+				return m, m.pwInputs[1].Focus()
+			}
+			m.savePassword()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.pwInputs[m.pwFocus], cmd = m.pwInputs[m.pwFocus].Update(msg)
+	return m, cmd
+}
+
+// savePassword hashes the typed password into the selected user
+func (m *HostsModel) savePassword() {
+	password := m.pwInputs[0].Value()
+	if password == "" {
+		m.message = "A senha não pode ser vazia"
+		return
+	}
+	if password != m.pwInputs[1].Value() {
+		m.message = "As senhas não conferem"
+		return
+	}
+	preset, err := m.loadSelected()
+	if err != nil {
+		m.message = "Erro ao carregar preset: " + err.Error()
+		return
+	}
+	if m.userIdx < 0 || m.userIdx >= len(preset.Users) {
+		return
+	}
+	user := &preset.Users[m.userIdx]
+	if err := user.SetPassword(password); err != nil {
+		m.message = err.Error()
+		return
+	}
+	if err := m.saveSelected(preset); err != nil {
+		m.message = "Erro ao salvar: " + err.Error()
+		return
+	}
+	m.message = fmt.Sprintf("🔑 hashedPassword gerado para '%s' em '%s'", user.Name, m.selected)
+	m.subState = hostSubUsers
+	m.refreshUserList()
+}
+
+// presetWarnings lists what does not block a build but needs attention:
+// unsafe passwords and secrets not created yet
+func presetWarnings(root string, p *engine.Preset) []string {
+	return append(p.PasswordWarnings(), engine.MissingSecrets(root, p.Modules.Active)...)
+}
+
+// validateSelected runs engine.ValidatePreset on the selected preset
+func (m *HostsModel) validateSelected() {
+	m.issues = nil
+	path := fmt.Sprintf("%s/%s.toml", m.presetsDir, m.selected)
+	preset, err := engine.LoadPreset(path)
+	m.loadErr = err
+	m.warning = ""
+	if err == nil {
+		m.issues = engine.ValidatePreset(m.rootDir, preset)
+		m.warning = strings.Join(presetWarnings(m.rootDir, preset), "\n  ⚠️  ")
+	}
+}
+
 func (m HostsModel) updateList(msg tea.Msg) (HostsModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -169,6 +360,10 @@ func (m HostsModel) updateList(msg tea.Msg) (HostsModel, tea.Cmd) {
 				m.message = ""
 				return m, m.input.Cursor.BlinkCmd()
 			}
+		case "i":
+			if !m.list.SettingFilter() {
+				return m, m.openImport()
+			}
 		case "enter":
 			if !m.list.SettingFilter() {
 				if item, ok := m.list.SelectedItem().(presetItem); ok {
@@ -237,6 +432,11 @@ func (m HostsModel) updateAction(msg tea.Msg) (HostsModel, tea.Cmd) {
 				case "✅ Escolher Preset":
 					m.activePreset = m.selected
 					m.message = fmt.Sprintf("Preset '%s' selecionado!", m.selected)
+					if m.validateSelected(); m.loadErr != nil || len(m.issues) > 0 {
+						m.subState = hostSubValidate
+						m.refreshList()
+						return m, nil
+					}
 					m.subState = hostSubList
 					m.refreshList()
 					return m, nil
@@ -269,9 +469,18 @@ func (m HostsModel) updateAction(msg tea.Msg) (HostsModel, tea.Cmd) {
 					m.subState = hostSubList
 					m.refreshList()
 					return m, nil
+				case "🔍 Validar Preset":
+					m.validateSelected()
+					m.subState = hostSubValidate
+					return m, nil
+				case "👥 Usuários":
+					m.message = ""
+					m.subState = hostSubUsers
+					m.refreshUserList()
+					return m, nil
 				case "📝 Editar Preset":
 					path := fmt.Sprintf("%s/%s.toml", m.presetsDir, m.selected)
-					return m, openEditor(path)
+					return m, openEditor(m.runner, path)
 				case "↩️  Voltar":
 					m.subState = hostSubList
 					return m, nil
@@ -292,11 +501,27 @@ func deletePresetFile(path string) error {
 func (m HostsModel) HelpKeys() string {
 	switch m.subState {
 	case hostSubList:
-		return "n: novo preset • enter: selecionar • /: filtrar"
+		return "n: novo preset • i: importar configuration.nix • enter: selecionar • /: filtrar"
 	case hostSubCreate:
 		return "enter: confirmar • esc: cancelar"
 	case hostSubAction:
 		return "enter: selecionar ação • esc: voltar"
+	case hostSubValidate:
+		return "enter/esc: voltar"
+	case hostSubPassword:
+		return "enter: próximo/confirmar • ↑/↓: trocar campo • esc: cancelar"
+	case hostSubUsers:
+		return "enter: editar • n: novo usuário • p: senha • h: módulos home • d: remover • esc: voltar"
+	case hostSubUserForm:
+		return "tab/shift+tab: trocar campo • ctrl+s: salvar • esc: cancelar"
+	case hostSubUserDelete:
+		return "y: confirmar • n/esc: cancelar"
+	case hostSubUserHome:
+		return "espaço: marcar/desmarcar • enter: salvar • esc: cancelar"
+	case hostSubImport:
+		return "enter: próximo/analisar • ↑/↓: trocar campo • esc: cancelar"
+	case hostSubImportPreview:
+		return "y: gravar módulos e preset • esc: cancelar"
 	}
 	return ""
 }
@@ -309,6 +534,9 @@ func (m HostsModel) View() string {
 		if m.message != "" {
 			header = styles.SuccessStyle.Render(m.message) + "\n\n"
 		}
+		if item, ok := m.list.SelectedItem().(presetItem); ok && item.warning != "" {
+			header += styles.WarningStyle.Render(fmt.Sprintf("⚠️  %s: %s", item.info.Name, item.warning)) + "\n\n"
+		}
 		s = header + m.list.View()
 	case hostSubCreate:
 		title := styles.Subtitle.Render("CRIAR NOVO PRESET")
@@ -320,15 +548,70 @@ func (m HostsModel) View() string {
 		s = title + label + "\n  " + m.input.View() + errMsg
 	case hostSubAction:
 		s = m.actionList.View()
+	case hostSubValidate:
+		s = m.validateView()
+	case hostSubUsers:
+		s = m.userList.View()
+		if m.message != "" {
+			s += "\n" + styles.SuccessStyle.Render(m.message)
+		}
+	case hostSubUserForm:
+		s = m.userFormView()
+	case hostSubUserHome:
+		s = m.homeList.View()
+		if m.message != "" {
+			s += "\n" + styles.ErrorStyle.Render(m.message)
+		}
+	case hostSubImport:
+		s = styles.Subtitle.Render("IMPORTAR CONFIGURATION.NIX") + "\n\n" +
+			styles.MutedStyle.Render("  Separa as opções em módulos (reaproveitando os que já existem) e cria um preset.") + "\n\n" +
+			"  Arquivo: " + m.importInputs[0].View() + "\n  Preset:  " + m.importInputs[1].View()
+		if m.message != "" {
+			s += "\n\n" + styles.ErrorStyle.Render("  "+m.message)
+		}
+	case hostSubImportPreview:
+		s = m.importPreviewView()
+	case hostSubUserDelete:
+		s = styles.Subtitle.Render("REMOVER USUÁRIO") +
+			styles.WarningStyle.Render(fmt.Sprintf("\n  ⚠️  Remover '%s' do preset '%s'?\n", m.userName(), m.selected))
+	case hostSubPassword:
+		s = styles.Subtitle.Render("DEFINIR SENHA: "+m.userName()) + "\n\n" +
+			styles.MutedStyle.Render("  A senha é salva apenas como hash SHA-512 crypt (hashedPassword).") + "\n\n" +
+			"  " + m.pwInputs[0].View() + "\n  " + m.pwInputs[1].View()
+		if m.message != "" {
+			s += "\n\n" + styles.ErrorStyle.Render("  "+m.message)
+		}
 	}
 	return lipgloss.NewStyle().Padding(1, 2).Render(s)
 }
 
+func (m HostsModel) validateView() string {
+	s := styles.Subtitle.Render("VALIDAÇÃO: "+m.selected) + "\n\n"
+	if m.loadErr == nil && m.warning != "" {
+		s += styles.WarningStyle.Render("  ⚠️  "+m.warning) + "\n\n"
+	}
+	switch {
+	case m.loadErr != nil:
+		s += styles.ErrorStyle.Render("  ❌ "+m.loadErr.Error()) + "\n"
+	case len(m.issues) == 0:
+		s += styles.SuccessStyle.Render("  ✅ Preset válido") + "\n"
+	default:
+		s += styles.ErrorStyle.Render(fmt.Sprintf("  ❌ %d problema(s) — a geração da flake será recusada:", len(m.issues))) + "\n\n"
+		for _, issue := range m.issues {
+			s += styles.WarningStyle.Render("  • "+issue.Field) + "\n"
+			s += styles.MutedStyle.Render("    "+issue.Msg) + "\n"
+		}
+	}
+	return s
+}
+
 func (m *HostsModel) SetSize(w, h int) {
 	m.width = w
 	m.height = h
 	m.list.SetSize(w-4, h-6)
 	m.actionList.SetSize(w-4, h-6)
+	m.userList.SetSize(w-4, h-8)
+	m.homeList.SetSize(w-4, h-8)
 }
 
 // SelectedPreset returns the currently selected preset name (for tab switching)
@@ -352,3 +635,519 @@ func (m HostsModel) SelectedHostName() string {
 	}
 	return m.activePreset
 }
+
+// ── Import ───────────────────────────────────────────────────
+func (m *HostsModel) openImport() tea.Cmd {
+	m.subState = hostSubImport
+	m.message = ""
+	m.importPlan = nil
+	m.importFocus = 0
+	for i := range m.importInputs {
+		m.importInputs[i].SetValue("")
+		m.importInputs[i].Blur()
+	}
+	return m.importInputs[0].Focus()
+}
+
+func (m HostsModel) updateImport(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.message = ""
+			m.subState = hostSubList
+			return m, nil
+		case "up", "down":
+			m.importInputs[m.importFocus].Blur()
+			m.importFocus = 1 - m.importFocus
+			return m, m.importInputs[m.importFocus].Focus()
+		case "enter":
+			if m.importFocus == 0 {
+				m.importInputs[0].Blur()
+				m.importFocus = 1
+				return m, m.importInputs[1].Focus()
+			}
+			m.planImport()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.importInputs[m.importFocus], cmd = m.importInputs[m.importFocus].Update(msg)
+	return m, cmd
+}
+
+// planImport reads the configuration and shows what the import would do
+func (m *HostsModel) planImport() {
+	path := strings.TrimSpace(m.importInputs[0].Value())
+	name := strings.TrimSpace(m.importInputs[1].Value())
+	if path == "" {
+		path = m.importInputs[0].Placeholder
+	}
+	if name == "" {
+		m.message = "Nome não pode ser vazio"
+		return
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+		path = filepath.Join(home, path[2:])
+	}
+	if _, err := os.Stat(filepath.Join(m.presetsDir, name+".toml")); err == nil {
+		m.message = fmt.Sprintf("Preset '%s' já existe", name)
+		return
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		m.message = "Erro ao ler arquivo: " + err.Error()
+		return
+	}
+	plan, err := engine.PlanImport(m.rootDir, name, src)
+	if err != nil {
+		m.message = err.Error()
+		return
+	}
+	m.message = ""
+	m.importPlan = plan
+	m.subState = hostSubImportPreview
+}
+
+func (m HostsModel) updateImportPreview(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc", "n":
+			m.subState = hostSubImport
+			return m, m.importInputs[m.importFocus].Focus()
+		case "y":
+			if err := m.importPlan.Write(m.rootDir); err != nil {
+				m.message = "Erro ao importar: " + err.Error()
+				return m, nil
+			}
+			name := m.importPlan.Preset.Host.PresetName
+			m.message = fmt.Sprintf("📥 Preset '%s' importado com %d módulo(s)", name, len(m.importPlan.Modules))
+			m.importPlan = nil
+			m.subState = hostSubList
+			m.refreshList()
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+func (m HostsModel) importPreviewView() string {
+	plan := m.importPlan
+	s := styles.Subtitle.Render("IMPORTAR: "+plan.Preset.Host.PresetName) + "\n\n"
+	s += styles.MutedStyle.Render(fmt.Sprintf("  host %s • %d usuário(s) • stateVersion %s",
+		plan.Preset.Host.HostName, len(plan.Preset.Users), plan.Preset.Host.StateVersion)) + "\n\n"
+	for _, mod := range plan.Modules {
+		if mod.Reused {
+			s += styles.NormalItem.Render("  ♻️  "+mod.RelPath) + styles.MutedStyle.Render("  (existente)") + "\n"
+		} else {
+			s += styles.SuccessStyle.Render("  ✚ "+mod.RelPath) + styles.MutedStyle.Render("  "+mod.Purpose) + "\n"
+		}
+	}
+	if len(plan.Warnings) > 0 {
+		s += "\n"
+		for _, w := range plan.Warnings {
+			s += styles.WarningStyle.Render("  ⚠️  "+w) + "\n"
+		}
+	}
+	if m.message != "" {
+		s += "\n" + styles.ErrorStyle.Render("  "+m.message)
+	}
+	return s
+}
+
+// ── Users ────────────────────────────────────────────────────
+type userItem struct {
+	user    engine.UserConfig
+	primary bool
+}
+
+func (u userItem) Title() string {
+	if u.primary {
+		return u.user.Name + " (principal)"
+	}
+	return u.user.Name
+}
+
+func (u userItem) Description() string {
+	parts := []string{"grupos: " + strings.Join(u.user.Groups, ", ")}
+	if len(u.user.Groups) == 0 {
+		parts = []string{"sem grupos extras"}
+	}
+	if u.user.Shell != "" {
+		parts = append(parts, "shell: "+u.user.Shell)
+	}
+	if n := len(u.user.SSHKeys); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d chave(s) SSH", n))
+	}
+	if n := len(u.user.Home); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d módulo(s) home", n))
+	}
+	if w := u.user.PasswordWarning(); w != "" {
+		parts = append(parts, "⚠️  "+w)
+	}
+	return strings.Join(parts, " • ")
+}
+
+func (u userItem) FilterValue() string { return u.user.Name }
+
+func (m *HostsModel) loadSelected() (*engine.Preset, error) {
+	return engine.LoadPreset(fmt.Sprintf("%s/%s.toml", m.presetsDir, m.selected))
+}
+
+func (m *HostsModel) saveSelected(p *engine.Preset) error {
+	return engine.SavePreset(fmt.Sprintf("%s/%s.toml", m.presetsDir, m.selected), p)
+}
+
+func (m *HostsModel) refreshUserList() {
+	var items []list.Item
+	if preset, err := m.loadSelected(); err != nil {
+		m.message = "Erro ao carregar preset: " + err.Error()
+	} else {
+		for i, u := range preset.Users {
+			items = append(items, userItem{user: u, primary: i == 0})
+		}
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(styles.ColorText)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(styles.ColorMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(styles.ColorSecondary).
+		BorderLeftForeground(styles.ColorSecondary)
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.
+		Foreground(styles.ColorMuted).
+		BorderLeftForeground(styles.ColorSecondary)
+
+	cursor := m.userList.Index()
+	l := list.New(items, delegate, m.width-4, m.height-8)
+	l.Title = fmt.Sprintf("Usuários: %s", m.selected)
+	l.Styles.Title = styles.Subtitle
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	if cursor < len(items) {
+		l.Select(cursor)
+	}
+	m.userList = l
+}
+
+// userName is the name of the user at userIdx, for titles
+func (m HostsModel) userName() string {
+	if item, ok := m.userList.SelectedItem().(userItem); ok && m.userIdx >= 0 {
+		return item.user.Name
+	}
+	return m.selected
+}
+
+func (m HostsModel) updateUsers(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.message = ""
+			m.subState = hostSubAction
+			return m, nil
+		case "enter":
+			if item, ok := m.userList.SelectedItem().(userItem); ok {
+				return m, m.openUserForm(m.userList.Index(), item.user)
+			}
+			return m, nil
+		case "n":
+			return m, m.openUserForm(-1, engine.NewUser(""))
+		case "p":
+			if _, ok := m.userList.SelectedItem().(userItem); ok {
+				m.userIdx = m.userList.Index()
+				return m, m.openPassword()
+			}
+			return m, nil
+		case "h":
+			if item, ok := m.userList.SelectedItem().(userItem); ok {
+				m.userIdx = m.userList.Index()
+				m.openUserHome(item.user)
+			}
+			return m, nil
+		case "d":
+			if len(m.userList.Items()) <= 1 {
+				m.message = "O preset precisa de pelo menos um usuário"
+				return m, nil
+			}
+			m.userIdx = m.userList.Index()
+			m.subState = hostSubUserDelete
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.userList, cmd = m.userList.Update(msg)
+	return m, cmd
+}
+
+func (m *HostsModel) openUserForm(idx int, u engine.UserConfig) tea.Cmd {
+	m.userIdx = idx
+	m.message = ""
+	m.subState = hostSubUserForm
+	values := []string{u.Name, u.Description, strings.Join(u.Groups, ", "), u.Shell}
+	for i := range m.userInputs {
+		m.userInputs[i].SetValue(values[i])
+		m.userInputs[i].Blur()
+	}
+	m.userKeys.SetValue(strings.Join(u.SSHKeys, "\n"))
+	m.userKeys.Blur()
+	m.userFocus = 0
+	return m.userInputs[0].Focus()
+}
+
+// focusUserField moves the form focus by delta, wrapping around
+func (m *HostsModel) focusUserField(delta int) tea.Cmd {
+	n := len(m.userInputs) + 1
+	if m.userFocus < len(m.userInputs) {
+		m.userInputs[m.userFocus].Blur()
+	} else {
+		m.userKeys.Blur()
+	}
+	m.userFocus = (m.userFocus + delta + n) % n
+	if m.userFocus < len(m.userInputs) {
+		return m.userInputs[m.userFocus].Focus()
+	}
+	return m.userKeys.Focus()
+}
+
+func (m HostsModel) updateUserForm(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.subState = hostSubUsers
+			return m, nil
+		case "tab":
+			return m, m.focusUserField(1)
+		case "shift+tab":
+			return m, m.focusUserField(-1)
+		case "enter":
+			if m.userFocus < len(m.userInputs) {
+				return m, m.focusUserField(1)
+			}
+		case "ctrl+s":
+			m.saveUser()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	if m.userFocus < len(m.userInputs) {
+		m.userInputs[m.userFocus], cmd = m.userInputs[m.userFocus].Update(msg)
+	} else {
+		m.userKeys, cmd = m.userKeys.Update(msg)
+	}
+	return m, cmd
+}
+
+// saveUser writes the form into the preset, adding a user when userIdx is -1
+func (m *HostsModel) saveUser() {
+	preset, err := m.loadSelected()
+	if err != nil {
+		m.message = "Erro ao carregar preset: " + err.Error()
+		return
+	}
+	u := engine.NewUser("")
+	if m.userIdx >= 0 && m.userIdx < len(preset.Users) {
+		u = preset.Users[m.userIdx]
+	}
+	u.Name = strings.TrimSpace(m.userInputs[0].Value())
+	u.Description = strings.TrimSpace(m.userInputs[1].Value())
+	u.Groups = splitList(m.userInputs[2].Value(), ",")
+	u.Shell = strings.TrimSpace(m.userInputs[3].Value())
+	u.SSHKeys = splitList(m.userKeys.Value(), "\n")
+
+	if u.Name == "" {
+		m.message = "O nome não pode ser vazio"
+		return
+	}
+	for i, other := range preset.Users {
+		if i != m.userIdx && other.Name == u.Name {
+			m.message = fmt.Sprintf("Usuário '%s' já existe", u.Name)
+			return
+		}
+	}
+	if m.userIdx >= 0 && m.userIdx < len(preset.Users) {
+		preset.Users[m.userIdx] = u
+	} else {
+		preset.Users = append(preset.Users, u)
+	}
+
+	// Refuse values the builder would reject, but only for this user
+	for _, issue := range engine.ValidatePreset(m.rootDir, preset) {
+		if strings.HasPrefix(issue.Field, fmt.Sprintf("users[%d].", indexOfUser(preset, u.Name))) {
+			m.message = issue.String()
+			return
+		}
+	}
+	if err := m.saveSelected(preset); err != nil {
+		m.message = "Erro ao salvar: " + err.Error()
+		return
+	}
+	m.message = fmt.Sprintf("✅ Usuário '%s' salvo", u.Name)
+	m.subState = hostSubUsers
+	m.refreshUserList()
+	m.refreshList()
+}
+
+func indexOfUser(p *engine.Preset, name string) int {
+	for i, u := range p.Users {
+		if u.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m HostsModel) updateUserDelete(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "y", "Y":
+			preset, err := m.loadSelected()
+			if err == nil && m.userIdx < len(preset.Users) {
+				name := preset.Users[m.userIdx].Name
+				preset.Users = append(preset.Users[:m.userIdx], preset.Users[m.userIdx+1:]...)
+				err = m.saveSelected(preset)
+				m.message = fmt.Sprintf("🗑️ Usuário '%s' removido", name)
+			}
+			if err != nil {
+				m.message = "Erro: " + err.Error()
+			}
+			m.subState = hostSubUsers
+			m.refreshUserList()
+			m.refreshList()
+			return m, nil
+		case "n", "N", "esc":
+			m.subState = hostSubUsers
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+func (m HostsModel) userFormView() string {
+	title := "NOVO USUÁRIO"
+	if m.userIdx >= 0 {
+		title = "EDITAR USUÁRIO: " + m.userName()
+	}
+	labels := []string{"Nome", "Descrição", "Grupos (separados por vírgula)", "Shell"}
+	s := styles.Subtitle.Render(title) + "\n"
+	for i, in := range m.userInputs {
+		s += "\n  " + styles.MutedStyle.Render(labels[i]) + "\n  " + in.View() + "\n"
+	}
+	s += "\n  " + styles.MutedStyle.Render("Chaves SSH públicas (uma por linha)") + "\n" + m.userKeys.View()
+	if m.userIdx < 0 {
+		s += "\n\n" + styles.MutedStyle.Render("  Defina a senha depois com 'p' na lista de usuários.")
+	}
+	if m.message != "" {
+		s += "\n\n" + styles.ErrorStyle.Render("  "+m.message)
+	}
+	return s
+}
+
+// ── Home modules ─────────────────────────────────────────────
+type homeItem struct {
+	info engine.ModuleInfo
+	on   bool
+}
+
+func (h homeItem) Title() string {
+	if h.on {
+		return "[✓] " + h.info.Name
+	}
+	return "[ ] " + h.info.Name
+}
+func (h homeItem) Description() string { return h.info.Purpose }
+func (h homeItem) FilterValue() string { return h.info.Name }
+
+// openUserHome lists modules/home with the user's current choice checked
+func (m *HostsModel) openUserHome(u engine.UserConfig) {
+	var items []list.Item
+	for _, mod := range engine.HomeModules(m.rootDir) {
+		items = append(items, homeItem{info: mod, on: slices.Contains(u.Home, mod.RelPath)})
+	}
+	// Keep entries whose file is gone, so saving does not drop them silently
+	for _, rel := range u.Home {
+		found := false
+		for _, it := range items {
+			found = found || it.(homeItem).info.RelPath == rel
+		}
+		if !found {
+			items = append(items, homeItem{info: engine.ModuleInfo{RelPath: rel, Name: rel, Purpose: "⚠️  não encontrado em modules/"}, on: true})
+		}
+	}
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(styles.ColorText)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(styles.ColorMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(styles.ColorSecondary).
+		BorderLeftForeground(styles.ColorSecondary)
+
+	l := list.New(items, delegate, m.width-4, m.height-8)
+	l.Title = fmt.Sprintf("Módulos Home Manager: %s", u.Name)
+	l.Styles.Title = styles.Subtitle
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	m.homeList = l
+	m.message = ""
+	if len(items) == 0 {
+		m.message = "Nenhum módulo em modules/home — crie um na aba Módulos"
+	}
+	m.subState = hostSubUserHome
+}
+
+func (m HostsModel) updateUserHome(msg tea.Msg) (HostsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "esc":
+			m.message = ""
+			m.subState = hostSubUsers
+			return m, nil
+		case " ":
+			if item, ok := m.homeList.SelectedItem().(homeItem); ok {
+				item.on = !item.on
+				return m, m.homeList.SetItem(m.homeList.Index(), item)
+			}
+			return m, nil
+		case "enter":
+			m.saveUserHome()
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.homeList, cmd = m.homeList.Update(msg)
+	return m, cmd
+}
+
+// saveUserHome stores the checked home modules in the user's entry
+func (m *HostsModel) saveUserHome() {
+	preset, err := m.loadSelected()
+	if err != nil || m.userIdx >= len(preset.Users) {
+		m.message = "Erro ao carregar preset"
+		return
+	}
+	var home []string
+	for _, it := range m.homeList.Items() {
+		if h := it.(homeItem); h.on {
+			home = append(home, h.info.RelPath)
+		}
+	}
+	u := &preset.Users[m.userIdx]
+	u.Home = home
+	if err := m.saveSelected(preset); err != nil {
+		m.message = "Erro ao salvar: " + err.Error()
+		return
+	}
+	m.message = fmt.Sprintf("🏠 %d módulo(s) home para '%s'", len(home), u.Name)
+	m.subState = hostSubUsers
+	m.refreshUserList()
+	m.refreshList()
+}
+
+// splitList splits s on sep, trimming items and dropping empty ones
+func splitList(s, sep string) []string {
+	var items []string
+	for _, it := range strings.Split(s, sep) {
+		if it = strings.TrimSpace(it); it != "" {
+			items = append(items, it)
+		}
+	}
+	return items
+}
@@ -5,12 +5,14 @@ import (
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -23,24 +25,30 @@ const (
 	installRunning
 	installDone
 	installError
+	installDiff
+	installChecking
+	installInput
 )
 
-type installResult struct {
-	output string
-	err    error
-}
+// rebuildInput is the [rebuild] field being typed in installInput
+type rebuildInput int
+
+const (
+	inputOption rebuildInput = iota
+	inputSpecialisation
+)
 
 type installerEditorFinished struct{ err error }
-type installerRebuildFinished struct{ err error }
 
 // ── Flake list item ──────────────────────────────────────────
 type flakeItem struct {
-	name string
-	path string
+	name   string
+	path   string
+	status string // evaluation state, see checkStatus
 }
 
 func (f flakeItem) Title() string       { return f.name }
-func (f flakeItem) Description() string { return f.path }
+func (f flakeItem) Description() string { return f.path + " • " + f.status }
 func (f flakeItem) FilterValue() string { return f.name }
 
 // ── Model ────────────────────────────────────────────────────
@@ -49,15 +57,31 @@ type InstallerModel struct {
 	flakeList list.Model
 	spinner   spinner.Model
 	rootDir   string
+	runner    engine.Runner
 	selected  string
 	hostname  string
-	output    string
+	proc      processView
 	errMsg    string
 	width     int
 	height    int
+
+	// Generation diff
+	diffBase  string // flake marked with "m" as the old side
+	diffTitle string
+	diffView  viewport.Model
+	notice    string
+
+	// Evaluation of the selected flake (see engine.CheckFlake)
+	check *engine.FlakeCheck
+
+	// nixos-rebuild action and flags, saved in the preset's [rebuild]
+	preset    string
+	rebuild   engine.RebuildConfig
+	input     textinput.Model
+	inputKind rebuildInput
 }
 
-func NewInstallerModel(rootDir string) InstallerModel {
+func NewInstallerModel(rootDir string, runner engine.Runner) InstallerModel {
 	sp := spinner.New()
 	sp.Spinner = spinner.Line
 	sp.Style = lipgloss.NewStyle().Foreground(styles.ColorWarning)
@@ -67,11 +91,19 @@ func NewInstallerModel(rootDir string) InstallerModel {
 	emptyFlakeList := list.New([]list.Item{}, emptyDelegate, 76, 14)
 	emptyFlakeList.SetShowHelp(false)
 
+	ti := textinput.New()
+	ti.CharLimit = 80
+	ti.Width = 50
+
 	return InstallerModel{
 		state:     installIdle,
 		spinner:   sp,
 		rootDir:   rootDir,
+		runner:    runner,
 		flakeList: emptyFlakeList,
+		diffView:  viewport.New(76, 14),
+		input:     ti,
+		proc:      newProcessView(),
 		width:     80,
 		height:    24,
 	}
@@ -84,7 +116,19 @@ func (m *InstallerModel) RefreshFlakes(presetName, hostName string) {
 	for _, f := range files {
 		name := filepath.Base(f)
 		if presetName == "" || strings.HasPrefix(name, presetName) {
-			items = append(items, flakeItem{name: name, path: f})
+			items = append(items, newFlakeItem(name, f))
+		}
+	}
+	// Directory flakes (multi-host) are listed when they define this host
+	dirFlakes, _ := filepath.Glob(filepath.Join(dir, "*", engine.FlakeDirFile))
+	for _, f := range dirFlakes {
+		name := filepath.Base(filepath.Dir(f)) + "/"
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if hostName == "" || strings.Contains(string(data), "nixosConfigurations."+hostName+" =") {
+			items = append(items, newFlakeItem(name, f))
 		}
 	}
 
@@ -105,18 +149,52 @@ func (m *InstallerModel) RefreshFlakes(presetName, hostName string) {
 	l.SetShowHelp(false)
 	m.flakeList = l
 	m.hostname = hostName
+	m.diffBase = ""
+	m.notice = ""
+
+	m.preset = presetName
+	m.rebuild = engine.RebuildConfig{}
+	if presetName != "" {
+		if p, err := engine.LoadPreset(m.presetPath()); err == nil {
+			m.rebuild = p.Rebuild
+		}
+	}
 }
 
-func (m *InstallerModel) openEditor(path string) tea.Cmd {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "micro"
+func (m InstallerModel) presetPath() string {
+	return filepath.Join(m.rootDir, "presets", m.preset+".toml")
+}
+
+// saveRebuild remembers the rebuild settings in the preset
+func (m *InstallerModel) saveRebuild() {
+	if m.preset == "" {
+		m.notice = "Nenhum preset selecionado: as opções valem só para esta execução"
+		return
 	}
-	c := exec.Command(editor, path)
-	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	return tea.ExecProcess(c, func(err error) tea.Msg {
+	p, err := engine.LoadPreset(m.presetPath())
+	if err == nil {
+		p.Rebuild = m.rebuild
+		err = engine.SavePreset(m.presetPath(), p)
+	}
+	if err != nil {
+		m.notice = "Erro ao salvar as opções no preset: " + err.Error()
+		return
+	}
+	m.notice = ""
+}
+
+func newFlakeItem(name, path string) flakeItem {
+	check, _ := engine.LoadFlakeCheck(path)
+	return flakeItem{name: name, path: path, status: checkStatus(check)}
+}
+
+// blocked reports whether the selected flake failed its evaluation
+func (m InstallerModel) blocked() bool {
+	return m.check != nil && m.check.Current() && !m.check.OK()
+}
+
+func (m *InstallerModel) openEditor(path string) tea.Cmd {
+	return editorCommand(m.runner, path, func(err error) tea.Msg {
 		return installerEditorFinished{err}
 	})
 }
@@ -129,16 +207,65 @@ func (m InstallerModel) Update(msg tea.Msg) (InstallerModel, tea.Cmd) {
 		if msg.err != nil {
 			m.state = installError
 			m.errMsg = "Erro no editor: " + msg.err.Error()
+			return m, nil
+		}
+		// The edit may have invalidated the saved evaluation
+		if item, ok := m.flakeList.SelectedItem().(flakeItem); ok {
+			m.flakeList.SetItem(m.flakeList.Index(), newFlakeItem(item.name, item.path))
 		}
 		return m, nil
-	case installerRebuildFinished:
+	case FlakeCheckMsg:
+		// An evaluation left with esc still updates its flake's status
+		for i, it := range m.flakeList.Items() {
+			if item, ok := it.(flakeItem); ok && item.path == msg.check.Flake {
+				item.status = checkStatus(msg.check)
+				m.flakeList.SetItem(i, item)
+			}
+		}
+		if m.state != installChecking || msg.check.Flake != m.selected {
+			return m, nil
+		}
+		m.check = msg.check
+		m.state = installIdle
+		switch {
+		case msg.err != nil:
+			m.notice = "Erro ao salvar a avaliação: " + msg.err.Error()
+		case msg.check.OK():
+			m.notice = "✅ Avaliação OK: " + filepath.Base(m.selected)
+		default:
+			m.notice = fmt.Sprintf("❌ A avaliação encontrou %d problema(s) — enter mostra os detalhes", len(msg.check.Problems))
+		}
+		return m, nil
+	case sudoValidated:
+		if m.state != installRunning {
+			return m, nil
+		}
 		if msg.err != nil {
 			m.state = installError
-			m.errMsg = msg.err.Error()
-		} else {
-			m.state = installDone
+			m.errMsg = "sudo: " + msg.err.Error()
+			return m, nil
 		}
-		return m, nil
+		return m.runRebuild()
+	case ProcessMsg:
+		if !m.proc.owns(msg) {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.handle(msg)
+		if msg.done {
+			if msg.err != nil {
+				m.state = installError
+				m.errMsg = msg.err.Error()
+			} else {
+				m.state = installDone
+				// Remember which flake produced the new generation (see Gerações)
+				if err := engine.RecordGeneration(m.runner, m.rootDir, engine.SystemProfile(),
+					m.selected, m.preset, m.hostname, m.rebuild); err != nil {
+					m.notice = "Erro ao registrar a geração: " + err.Error()
+				}
+			}
+		}
+		return m, cmd
 	}
 
 	switch m.state {
@@ -149,13 +276,35 @@ func (m InstallerModel) Update(msg tea.Msg) (InstallerModel, tea.Cmd) {
 			case "enter":
 				if item, ok := m.flakeList.SelectedItem().(flakeItem); ok {
 					m.selected = item.path
+					m.check, _ = engine.LoadFlakeCheck(item.path)
 					m.state = installConfirm
 					return m, nil
 				}
+			case "v":
+				if item, ok := m.flakeList.SelectedItem().(flakeItem); ok {
+					m.selected = item.path
+					m.notice = ""
+					m.state = installChecking
+					return m, tea.Batch(m.spinner.Tick, checkFlake(m.runner, m.rootDir, item.path))
+				}
 			case "e":
 				if item, ok := m.flakeList.SelectedItem().(flakeItem); ok {
 					return m, m.openEditor(item.path)
 				}
+			case "m":
+				if item, ok := m.flakeList.SelectedItem().(flakeItem); ok {
+					if m.diffBase == item.path {
+						m.diffBase = ""
+						m.notice = ""
+					} else {
+						m.diffBase = item.path
+						m.notice = "Base do diff: " + item.name + " — selecione outra flake e pressione d"
+					}
+				}
+				return m, nil
+			case "d":
+				m.openDiff()
+				return m, nil
 			}
 		case tea.WindowSizeMsg:
 			m.width = msg.Width
@@ -170,25 +319,69 @@ func (m InstallerModel) Update(msg tea.Msg) (InstallerModel, tea.Cmd) {
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
 			switch msg.String() {
-			case "y", "Y":
+			case "y", "Y", "F":
+				// A failed evaluation blocks the rebuild unless forced with F
+				if m.blocked() && msg.String() != "F" {
+					return m, nil
+				}
 				m.state = installRunning
-				return m, m.runRebuild()
+				m.errMsg = ""
+				if !m.rebuild.NeedsRoot() {
+					return m.runRebuild()
+				}
+				// Ask for the sudo password before the output is captured
+				return m, validateSudo(m.runner)
 			case "n", "N", "esc":
 				m.state = installIdle
 				return m, nil
+			case "a":
+				m.rebuild.NextAction()
+				m.saveRebuild()
+			case "o":
+				m.rebuild.Offline = !m.rebuild.Offline
+				m.saveRebuild()
+			case "i":
+				m.rebuild.Impure = !m.rebuild.Impure
+				m.saveRebuild()
+			case "O":
+				return m, m.startInput(inputOption, "nome=valor (valor vazio remove a opção)", "")
+			case "s":
+				return m, m.startInput(inputSpecialisation, "nome (vazio desativa)", m.rebuild.Specialisation)
 			}
 		}
 
-	case installRunning:
+	case installInput:
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch msg.String() {
+			case "esc":
+				m.state = installConfirm
+				return m, nil
+			case "enter":
+				value := strings.TrimSpace(m.input.Value())
+				if m.inputKind == inputOption {
+					if err := m.rebuild.SetOption(value); err != nil {
+						m.notice = err.Error()
+						return m, nil
+					}
+				} else {
+					m.rebuild.Specialisation = value
+				}
+				m.state = installConfirm
+				m.saveRebuild()
+				return m, nil
+			}
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+
+	case installChecking:
 		switch msg := msg.(type) {
-		case installResult:
-			if msg.err != nil {
-				m.state = installError
-				m.errMsg = msg.err.Error()
-				m.output = msg.output
-			} else {
-				m.state = installDone
-				m.output = msg.output
+		case tea.KeyMsg:
+			if msg.String() == "esc" {
+				// The evaluation keeps running and still saves its result
+				m.state = installIdle
+				m.notice = "A avaliação de " + filepath.Base(m.selected) + " continua em segundo plano"
 			}
 			return m, nil
 		case spinner.TickMsg:
@@ -197,47 +390,147 @@ func (m InstallerModel) Update(msg tea.Msg) (InstallerModel, tea.Cmd) {
 			return m, cmd
 		}
 
+	case installRunning:
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			var cmd tea.Cmd
+			m.proc, cmd = m.proc.updateKeys(msg)
+			return m, cmd
+		case spinner.TickMsg:
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
 	case installDone, installError:
 		switch msg := msg.(type) {
 		case tea.KeyMsg:
 			switch msg.String() {
 			case "enter", "esc":
 				m.state = installIdle
-				m.output = ""
 				m.errMsg = ""
 				return m, nil
 			}
+			var cmd tea.Cmd
+			m.proc, cmd = m.proc.updateKeys(msg)
+			return m, cmd
 		}
+
+	case installDiff:
+		if msg, ok := msg.(tea.KeyMsg); ok && (msg.String() == "esc" || msg.String() == "q") {
+			m.state = installIdle
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.diffView, cmd = m.diffView.Update(msg)
+		return m, cmd
 	}
 
 	return m, nil
 }
 
-func (m InstallerModel) runRebuild() tea.Cmd {
-	cmd, err := engine.PrepareRebuild(m.selected, m.hostname)
-	if err != nil {
-		return func() tea.Msg {
-			return installerRebuildFinished{err: err}
+// startInput asks for an --option pair or the specialisation name
+func (m *InstallerModel) startInput(kind rebuildInput, placeholder, value string) tea.Cmd {
+	m.inputKind = kind
+	m.input.Placeholder = placeholder
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+	m.input.Focus()
+	m.notice = ""
+	m.state = installInput
+	return textinput.Blink
+}
+
+// openDiff compares the selected flake with the marked base, or with the
+// previous flake in the list when nothing is marked.
+func (m *InstallerModel) openDiff() {
+	item, ok := m.flakeList.SelectedItem().(flakeItem)
+	if !ok {
+		return
+	}
+	oldPath, oldName := m.diffBase, filepath.Base(m.diffBase)
+	if oldPath == "" || oldPath == item.path {
+		idx := m.flakeList.Index()
+		if idx == 0 {
+			m.notice = "Nenhuma flake anterior para comparar — marque uma base com m"
+			return
 		}
+		prev := m.flakeList.Items()[idx-1].(flakeItem)
+		oldPath, oldName = prev.path, prev.name
 	}
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return tea.ExecProcess(cmd, func(err error) tea.Msg {
-		return installerRebuildFinished{err: err}
-	})
+
+	diff, err := engine.DiffFlakeFiles(oldPath, item.path)
+	if err != nil {
+		m.notice = "Erro no diff: " + err.Error()
+		return
+	}
+
+	var lines []string
+	if diff.Empty() {
+		lines = append(lines, styles.SuccessStyle.Render("Nenhuma diferença entre as flakes."))
+	}
+	for _, l := range diff.Lines() {
+		lines = append(lines, renderDiffLine(l))
+	}
+	m.diffTitle = oldName + " → " + item.name
+	m.diffView.SetContent(strings.Join(lines, "\n"))
+	m.diffView.GotoTop()
+	m.diffBase = ""
+	m.notice = ""
+	m.state = installDiff
+}
+
+func renderDiffLine(l engine.DiffLine) string {
+	switch l.Kind {
+	case '+':
+		return styles.SuccessStyle.Render(l.String())
+	case '-':
+		return styles.ErrorStyle.Render(l.String())
+	case '@':
+		return lipgloss.NewStyle().Foreground(styles.ColorPurple).Render(l.String())
+	case '#':
+		return styles.Subtitle.Render(l.String())
+	}
+	return styles.MutedStyle.Render(l.String())
+}
+
+// runRebuild streams nixos-rebuild into the output viewport
+func (m InstallerModel) runRebuild() (InstallerModel, tea.Cmd) {
+	cmd, err := engine.PrepareRebuild(m.runner, m.selected, m.hostname, m.rebuild)
+	if err != nil {
+		m.state = installError
+		m.errMsg = err.Error()
+		return m, nil
+	}
+	readCmd := m.proc.start(m.runner, m.rootDir, "rebuild-"+m.hostname, cmd)
+	if m.proc.err != nil {
+		m.state = installError
+		m.errMsg = m.proc.err.Error()
+		return m, nil
+	}
+	return m, tea.Batch(m.spinner.Tick, readCmd)
 }
 
 func (m InstallerModel) HelpKeys() string {
 	switch m.state {
 	case installIdle:
-		return "enter: selecionar flake para aplicar • e: editar"
+		return "enter: selecionar flake para aplicar • v: avaliar • e: editar • d: diff • m: marcar base"
 	case installConfirm:
-		return "y: confirmar • n/esc: cancelar"
+		keys := "a: ação • o: offline • i: impure • O: --option • s: specialisation • n/esc: cancelar"
+		if m.blocked() {
+			return "F: aplicar mesmo assim • " + keys
+		}
+		return "y: confirmar • " + keys
+	case installInput:
+		return "enter: salvar • esc: cancelar"
+	case installChecking:
+		return "esc: não esperar a avaliação"
 	case installRunning:
-		return "aguarde..."
+		return "↑/↓/pgup/pgdn: rolar • x: cancelar"
 	case installDone, installError:
-		return "enter: voltar"
+		return "↑/↓/pgup/pgdn: rolar • enter: voltar"
+	case installDiff:
+		return "↑/↓/pgup/pgdn: rolar • esc: voltar"
 	}
 	return ""
 }
@@ -249,37 +542,128 @@ func (m InstallerModel) View() string {
 	switch m.state {
 	case installIdle:
 		s = title + "\n\n" + m.flakeList.View()
+		if m.notice != "" {
+			s += "\n" + styles.WarningStyle.Render("  "+m.notice)
+		}
+	case installDiff:
+		s = styles.Subtitle.Render("DIFF  "+m.diffTitle) + "\n\n" + m.diffView.View()
 	case installConfirm:
-		fname := filepath.Base(m.selected)
-		warn := styles.WarningStyle.Render(fmt.Sprintf(
-			"\n  ⚠️  Aplicar '%s' no sistema?\\n  Isso irá executar nixos-rebuild switch.\\n", fname))
-		s = title + warn
+		s = title + "\n\n" + m.confirmView() + "\n" + m.checkView()
+	case installInput:
+		label := "--option (nome=valor):"
+		if m.inputKind == inputSpecialisation {
+			label = "--specialisation:"
+		}
+		s = title + "\n\n" + m.confirmView() + "\n  " + label + "\n  " + m.input.View()
+	case installChecking:
+		s = title + "\n\n  " + m.spinner.View() + " Avaliando " + filepath.Base(m.selected) +
+			" (nix-instantiate --parse, nix flake check, drvPath)..."
 	case installRunning:
-		s = title + "\n\n  " + m.spinner.View() + " Executando nixos-rebuild switch..."
+		s = title + "\n\n  " + m.spinner.View() + " Executando nixos-rebuild " + m.rebuild.ActionName() + "...\n\n" +
+			m.proc.View()
 	case installDone:
-		out := m.output
-		if len(out) > 500 {
-			out = out[len(out)-500:]
-		}
 		s = title + "\n\n" +
-			styles.SuccessStyle.Render("  ✅ Configuração aplicada com sucesso!") + "\n\n" +
-			styles.MutedStyle.Render(out)
-	case installError:
-		out := m.output
-		if len(out) > 500 {
-			out = out[len(out)-500:]
+			styles.SuccessStyle.Render("  ✅ "+m.doneMessage()) + "\n\n" +
+			m.proc.View()
+		if m.notice != "" {
+			s += "\n" + styles.WarningStyle.Render("  "+m.notice)
 		}
+	case installError:
 		s = title + "\n\n" +
 			styles.ErrorStyle.Render("  ❌ Erro ao aplicar:") + "\n" +
 			styles.MutedStyle.Render("  "+m.errMsg) + "\n\n" +
-			styles.MutedStyle.Render(out)
+			m.proc.View()
 	}
 
 	return lipgloss.NewStyle().Padding(1, 2).Render(s)
 }
 
+// confirmView shows the command about to run and the remembered options
+func (m InstallerModel) confirmView() string {
+	rc := m.rebuild
+	var sb strings.Builder
+	sb.WriteString(styles.WarningStyle.Render(fmt.Sprintf("  ⚠️  Executar nixos-rebuild %s com '%s'?",
+		rc.ActionName(), filepath.Base(m.selected))) + "\n")
+	sb.WriteString(styles.MutedStyle.Render("  "+rc.ActionInfo()) + "\n\n")
+
+	onOff := func(b bool) string {
+		if b {
+			return "sim"
+		}
+		return "não"
+	}
+	field := func(key, label, value string) {
+		sb.WriteString("  " + styles.Subtitle.Render(key) + " " + styles.MutedStyle.Render(label+": ") + value + "\n")
+	}
+	field("a", "ação", rc.ActionName())
+	field("o", "--offline", onOff(rc.Offline))
+	field("i", "--impure", onOff(rc.Impure))
+	options := "nenhuma"
+	if len(rc.Options) > 0 {
+		var pairs []string
+		for name, value := range rc.Options {
+			pairs = append(pairs, name+"="+value)
+		}
+		sort.Strings(pairs)
+		options = strings.Join(pairs, ", ")
+	}
+	field("O", "--option", options)
+	spec := "nenhuma"
+	if rc.Specialisation != "" {
+		spec = rc.Specialisation
+		if !rc.SpecialisationApplies() {
+			spec += styles.MutedStyle.Render(" (ignorada: só vale para switch e test)")
+		}
+	}
+	field("s", "--specialisation", spec)
+
+	cmdLine := strings.Join(append([]string{"nixos-rebuild", rc.ActionName(), "--flake", ".#" + m.hostname}, rc.Args()...), " ")
+	if rc.NeedsRoot() {
+		cmdLine = "sudo " + cmdLine
+	}
+	sb.WriteString("\n" + styles.MutedStyle.Render("  $ "+cmdLine) + "\n")
+	if m.preset == "" {
+		sb.WriteString(styles.MutedStyle.Render("  (sem preset: as opções não serão lembradas)") + "\n")
+	}
+	if m.notice != "" {
+		sb.WriteString(styles.ErrorStyle.Render("  "+m.notice) + "\n")
+	}
+	return sb.String()
+}
+
+// doneMessage describes a successful run of the configured action
+func (m InstallerModel) doneMessage() string {
+	switch m.rebuild.ActionName() {
+	case "switch", "test":
+		return "Configuração aplicada com sucesso!"
+	case "boot":
+		return "Configuração instalada: será usada no próximo boot."
+	case "build-vm":
+		return "VM construída: ./result/bin/run-" + m.hostname + "-vm"
+	}
+	return "nixos-rebuild " + m.rebuild.ActionName() + " concluído."
+}
+
+// checkView summarizes the evaluation of the flake about to be applied
+func (m InstallerModel) checkView() string {
+	switch {
+	case m.check == nil:
+		return styles.WarningStyle.Render("  ⚠️  Flake não avaliada — v na lista avalia antes de aplicar.")
+	case !m.check.Current():
+		return styles.WarningStyle.Render("  ⚠️  A flake mudou desde a última avaliação — v na lista avalia de novo.")
+	}
+	s := renderCheck(m.check)
+	if !m.check.OK() {
+		s += "\n" + styles.ErrorStyle.Render("  Aplicar bloqueado: F aplica mesmo assim.")
+	}
+	return s
+}
+
 func (m *InstallerModel) SetSize(w, h int) {
 	m.width = w
 	m.height = h
 	m.flakeList.SetSize(w-4, h-6)
+	m.diffView.Width = w - 4
+	m.diffView.Height = h - 6
+	m.proc.SetSize(w-4, h-10)
 }
@@ -0,0 +1,41 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestInstallerEscLeavesEvaluationRunning(t *testing.T) {
+	root := t.TempDir()
+	flake := filepath.Join(root, "flakes", "vm-1.nix")
+	if err := os.MkdirAll(filepath.Dir(flake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(flake, []byte("{ }\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewInstallerModel(root, &engine.RecordingRunner{})
+	m.RefreshFlakes("", "")
+
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("v")})
+	if m.state != installChecking {
+		t.Fatalf("state = %d after v, want installChecking", m.state)
+	}
+	m, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.state != installIdle {
+		t.Fatalf("state = %d after esc, want installIdle", m.state)
+	}
+
+	// The result arriving later still marks the flake, without leaving the list
+	m, _ = m.Update(FlakeCheckMsg{check: &engine.FlakeCheck{Flake: flake}})
+	if m.state != installIdle {
+		t.Errorf("state = %d after the result, want installIdle", m.state)
+	}
+	if item := m.flakeList.Items()[0].(flakeItem); item.status == checkStatus(nil) {
+		t.Errorf("status still %q", item.status)
+	}
+}
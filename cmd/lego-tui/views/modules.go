@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -73,6 +76,9 @@ func (d compactDelegate) Render(w io.Writer, m list.Model, index int, item list.
 	if i.info.Purpose != "" {
 		title += " — " + i.info.Purpose
 	}
+	if i.info.Err != nil {
+		title += " ⚠️  cabeçalho inválido"
+	}
 
 	// Estilização
 	var style lipgloss.Style
@@ -87,7 +93,7 @@ func (d compactDelegate) Render(w io.Writer, m list.Model, index int, item list.
 		style = styles.NormalItem.Copy().PaddingLeft(2)
 	}
 
-	fmt.Fprint(w, style.Render(title))
+	fmt.Fprint(w, style.MaxWidth(m.Width()).Render(title))
 }
 
 // ── Model ────────────────────────────────────────────────────
@@ -98,14 +104,23 @@ type ModulesModel struct {
 	subState       moduleSubState
 	createStep     createStep
 	rootDir        string
+	runner         engine.Runner
 	newCategory    string
 	message        string
 	width          int
 	height         int
 	selectedModule moduleItem
+
+	preview     viewport.Model
+	previewRel  string // module shown in the preview pane
+	previewWrap bool   // show the module as BuildFlake wraps it instead of the file
+	previewFlip bool   // p: hides the pane on wide screens, shows it on narrow ones
 }
 
-func NewModulesModel(rootDir string) ModulesModel {
+// splitMinWidth is the terminal width from which the preview sits beside the list
+const splitMinWidth = 100
+
+func NewModulesModel(rootDir string, runner engine.Runner) ModulesModel {
 	ti := textinput.New()
 	ti.Placeholder = "meu-modulo"
 	ti.CharLimit = 80
@@ -113,10 +128,12 @@ func NewModulesModel(rootDir string) ModulesModel {
 
 	m := ModulesModel{
 		rootDir:   rootDir,
+		runner:    runner,
 		nameInput: ti,
 		subState:  moduleSubList,
 		width:     80,
 		height:    24,
+		preview:   viewport.New(40, 16),
 	}
 	m.refreshList()
 	m.buildCatList()
@@ -138,6 +155,7 @@ func (m *ModulesModel) refreshList() {
 	l.SetShowHelp(false)
 	l.SetShowStatusBar(false)
 	m.list = l
+	m.layout()
 }
 
 func (m *ModulesModel) buildCatList() {
@@ -199,14 +217,40 @@ func (m ModulesModel) updateList(msg tea.Msg) (ModulesModel, tea.Cmd) {
 		case "e":
 			if !m.list.SettingFilter() {
 				if item, ok := m.list.SelectedItem().(moduleItem); ok {
-					return m, openEditor(item.info.FullPath)
+					return m, openEditor(m.runner, item.info.FullPath)
 				}
 			}
+		case "p":
+			if !m.list.SettingFilter() {
+				m.previewFlip = !m.previewFlip
+				m.layout()
+				return m, nil
+			}
+		case "w":
+			if !m.list.SettingFilter() {
+				m.previewWrap = !m.previewWrap
+				m.refreshPreview()
+				return m, nil
+			}
+		case "J", "K", "ctrl+d", "ctrl+u":
+			if !m.list.SettingFilter() {
+				switch msg.String() {
+				case "J":
+					m.preview.ScrollDown(1)
+				case "K":
+					m.preview.ScrollUp(1)
+				case "ctrl+d":
+					m.preview.HalfPageDown()
+				case "ctrl+u":
+					m.preview.HalfPageUp()
+				}
+				return m, nil
+			}
 		}
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
-		m.list.SetSize(msg.Width-4, msg.Height-12)
+		m.layout()
 	case editorFinishedMsg:
 		m.refreshList()
 		return m, nil
@@ -214,6 +258,7 @@ func (m ModulesModel) updateList(msg tea.Msg) (ModulesModel, tea.Cmd) {
 
 	var cmd tea.Cmd
 	m.list, cmd = m.list.Update(msg)
+	m.syncPreview()
 	return m, cmd
 }
 
@@ -255,7 +300,7 @@ func (m ModulesModel) updateCreate(msg tea.Msg) (ModulesModel, tea.Cmd) {
 				}
 				// Create module file with LEGO header
 				path := fmt.Sprintf("%s/modules/%s/%s.nix", m.rootDir, m.newCategory, name)
-				content := fmt.Sprintf(`# NIXOS-LEGO-MODULE: %s\n# PURPOSE: <descreva o propósito>\n# CATEGORY: %s\n# AUTHOR: user\n`, name, m.newCategory)
+				content := fmt.Sprintf("# NIXOS-LEGO-MODULE: %s\n# PURPOSE: <descreva o propósito>\n# CATEGORY: %s\n# AUTHOR: user\n%s\n", name, m.newCategory, engine.HeaderSeparator)
 				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
 					m.message = "Erro: " + err.Error()
 					return m, nil
@@ -264,7 +309,7 @@ func (m ModulesModel) updateCreate(msg tea.Msg) (ModulesModel, tea.Cmd) {
 				m.subState = moduleSubList
 				m.refreshList()
 				// Open editor for the new module
-				return m, openEditor(path)
+				return m, openEditor(m.runner, path)
 			}
 		}
 		var cmd tea.Cmd
@@ -300,7 +345,7 @@ func (m ModulesModel) updateConfirmDelete(msg tea.Msg) (ModulesModel, tea.Cmd) {
 func (m ModulesModel) HelpKeys() string {
 	switch m.subState {
 	case moduleSubList:
-		return "n: novo módulo • e: editar • d: deletar • /: filtrar"
+		return "n: novo módulo • e: editar • d: deletar • /: filtrar • p: prévia • w: arquivo/flake • J/K: rolar prévia"
 	case moduleSubCreate:
 		switch m.createStep {
 		case createStepCategory:
@@ -322,7 +367,14 @@ func (m ModulesModel) View() string {
 		if m.message != "" {
 			heade = styles.SuccessStyle.Render(m.message) + "\n\n"
 		}
-		s = heade + m.list.View()
+		switch {
+		case m.split():
+			s = heade + lipgloss.JoinHorizontal(lipgloss.Top, m.list.View(), " ", m.previewView())
+		case m.previewFlip:
+			s = heade + m.previewView()
+		default:
+			s = heade + m.list.View()
+		}
 	case moduleSubCreate:
 		switch m.createStep {
 		case createStepCategory:
@@ -347,22 +399,199 @@ func (m ModulesModel) View() string {
 func (m *ModulesModel) SetSize(w, h int) {
 	m.width = w
 	m.height = h
-	m.list.SetSize(w-6, h-6)
+	m.layout()
 	m.catList.SetSize(w-6, h-6)
 }
 
+// ── Preview pane ─────────────────────────────────────────────
+
+// split reports whether the preview is shown beside the list
+func (m ModulesModel) split() bool {
+	return m.width >= splitMinWidth && !m.previewFlip
+}
+
+// layout sizes the list and the preview pane for the current mode
+func (m *ModulesModel) layout() {
+	w := m.width - 6
+	listW, paneW := w, w
+	if m.split() {
+		listW = w * 2 / 5
+		paneW = w - listW - 1
+	}
+	m.list.SetSize(listW, m.height-6)
+	m.preview.Width = paneW - 2 // left border and padding
+	m.preview.Height = m.height - 7
+	m.refreshPreview()
+}
+
+// syncPreview reloads the preview when the list cursor moved to another module
+func (m *ModulesModel) syncPreview() {
+	item, ok := m.list.SelectedItem().(moduleItem)
+	if !ok || item.info.RelPath != m.previewRel {
+		m.refreshPreview()
+	}
+}
+
+func (m *ModulesModel) refreshPreview() {
+	item, ok := m.list.SelectedItem().(moduleItem)
+	if !ok {
+		m.previewRel = ""
+		m.preview.SetContent(styles.MutedStyle.Render("Nenhum módulo selecionado."))
+		return
+	}
+	m.previewRel = item.info.RelPath
+	m.preview.SetContent(m.previewContent(item.info))
+	m.preview.GotoTop()
+}
+
+// previewContent renders the header metadata, the presets using the module
+// and its code: the file body, or the wrapper BuildFlake injects
+func (m ModulesModel) previewContent(info engine.ModuleInfo) string {
+	var sb strings.Builder
+	field := func(key, value string) {
+		sb.WriteString(styles.MutedStyle.Render(fmt.Sprintf("%-10s ", key)) + value + "\n")
+	}
+
+	mod, err := engine.LoadModule(info.FullPath)
+	if err != nil {
+		sb.WriteString(styles.ErrorStyle.Render("⚠️  "+err.Error()) + "\n\n")
+		data, _ := os.ReadFile(info.FullPath)
+		sb.WriteString(highlightNix(string(data), 1))
+		return sb.String()
+	}
+
+	field("propósito", mod.Purpose)
+	field("categoria", mod.Category)
+	field("arquivo", filepath.Join("modules", info.RelPath+".nix"))
+	for _, key := range []string{"REQUIRES", "CONFLICTS", "PROVIDES", "SECRETS"} {
+		if list := mod.List(key); len(list) > 0 {
+			field(strings.ToLower(key), strings.Join(list, ", "))
+		}
+	}
+	var extra []string
+	for key := range mod.Header {
+		switch key {
+		case "NIXOS-LEGO-MODULE", "PURPOSE", "CATEGORY", "REQUIRES", "CONFLICTS", "PROVIDES", "SECRETS":
+		default:
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		field(strings.ToLower(key), mod.Header[key])
+	}
+	for _, p := range mod.Params {
+		value := "obrigatório"
+		if p.Default != "" {
+			value = "= " + p.Default
+		}
+		line := fmt.Sprintf("%s (%s) %s", p.Name, p.Type, value)
+		if p.Description != "" {
+			line += styles.MutedStyle.Render(" — " + p.Description)
+		}
+		field("param", line)
+	}
+
+	var used []string
+	for _, u := range engine.PresetsUsingModule(m.rootDir, info.RelPath) {
+		name := u.Preset
+		if u.Via != "" {
+			name += styles.MutedStyle.Render(" (" + u.Via + ")")
+		}
+		used = append(used, name)
+	}
+	if len(used) == 0 {
+		field("presets", styles.MutedStyle.Render("nenhum preset usa este módulo"))
+	} else {
+		field("presets", strings.Join(used, ", "))
+	}
+	sb.WriteString(styles.MutedStyle.Render(strings.Repeat("─", max(m.preview.Width, 1))) + "\n")
+
+	if m.previewWrap {
+		wrapped, err := engine.WrapModulePreview(m.rootDir, info.RelPath)
+		if err != nil {
+			sb.WriteString(styles.ErrorStyle.Render("⚠️  " + err.Error()))
+			return sb.String()
+		}
+		sb.WriteString(highlightNix(wrapped, 0))
+		return sb.String()
+	}
+	sb.WriteString(highlightNix(mod.Body, mod.BodyLine))
+	return sb.String()
+}
+
+func (m ModulesModel) previewView() string {
+	mode := "arquivo"
+	if m.previewWrap {
+		mode = "como entra no flake"
+	}
+	title := styles.Subtitle.Render(m.previewRel) + styles.MutedStyle.Render(" • "+mode)
+	if m.previewRel == "" {
+		title = styles.Subtitle.Render("Prévia")
+	}
+	s := title + "\n" + m.preview.View()
+	if !m.split() {
+		return s
+	}
+	return lipgloss.NewStyle().
+		BorderLeft(true).
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderLeftForeground(styles.ColorMuted).
+		PaddingLeft(1).
+		Render(s)
+}
+
+// nixTokenStyles colors each kind of engine.NixToken
+var nixTokenStyles = map[engine.NixTokenKind]lipgloss.Style{
+	engine.NixComment:       styles.NixComment,
+	engine.NixString:        styles.NixString,
+	engine.NixInterpolation: styles.NixInterpolation,
+	engine.NixKeyword:       styles.NixKeyword,
+	engine.NixLiteral:       styles.NixLiteral,
+	engine.NixPath:          styles.NixPath,
+	engine.NixAttr:          styles.NixAttr,
+	engine.NixPlaceholder:   styles.NixPlaceholder,
+}
+
+// highlightNix colors Nix source; a firstLine above zero numbers the lines from it
+func highlightNix(src string, firstLine int) string {
+	lines := []string{""}
+	for _, tok := range engine.TokenizeNix(strings.TrimRight(src, "\n")) {
+		style, styled := nixTokenStyles[tok.Kind]
+		for i, part := range strings.Split(tok.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, "")
+			}
+			if styled && part != "" {
+				part = style.Render(part)
+			}
+			lines[len(lines)-1] += part
+		}
+	}
+	if firstLine > 0 {
+		width := len(fmt.Sprint(firstLine + len(lines) - 1))
+		for i := range lines {
+			lines[i] = styles.MutedStyle.Render(fmt.Sprintf("%*d ", width, firstLine+i)) + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 // ── Shared helpers ───────────────────────────────────────────
 type editorFinishedMsg struct{}
 
-func openEditor(path string) tea.Cmd {
+// editorCommand opens path in $EDITOR (micro by default) through r, so a
+// dry run records the editor instead of letting it change the file
+func editorCommand(r engine.Runner, path string, done func(error) tea.Msg) tea.Cmd {
 	editor := os.Getenv("EDITOR")
 	if editor == "" {
 		editor = "micro"
 	}
-	c := exec.Command(editor, path)
-	return tea.ExecProcess(c, func(err error) tea.Msg {
-		return editorFinishedMsg{}
-	})
+	return tea.Exec(r.Interactive(engine.Cmd(editor, path)), done)
+}
+
+func openEditor(r engine.Runner, path string) tea.Cmd {
+	return editorCommand(r, path, func(error) tea.Msg { return editorFinishedMsg{} })
 }
 
 func removeFile(path string) error {
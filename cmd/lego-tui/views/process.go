@@ -0,0 +1,182 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ProcessMsg carries streamed output to the tab that started the process.
+// The main model forwards it to every tab; each one ignores foreign ids.
+type ProcessMsg struct {
+	id    int64
+	lines []string
+	done  bool
+	err   error
+}
+
+// sudoValidated is sent after "sudo -v" ran in the foreground, so that the
+// streamed command finds cached credentials instead of prompting.
+type sudoValidated struct{ err error }
+
+// validateSudo asks for the sudo password with the terminal released
+func validateSudo(r engine.Runner) tea.Cmd {
+	return tea.Exec(r.Interactive(engine.Cmd("sudo", "-v")), func(err error) tea.Msg {
+		return sudoValidated{err}
+	})
+}
+
+// showDryRun appends the commands a dry run recorded since the last display
+func showDryRun(v *processView, r engine.Runner) {
+	if !r.DryRun() {
+		return
+	}
+	var lines []string
+	for _, c := range r.Drain() {
+		lines = append(lines, engine.DryRunLine(c))
+	}
+	if len(lines) > 0 {
+		v.append(lines...)
+	}
+}
+
+// ── Process view ─────────────────────────────────────────────
+
+// maxProcessLines is how much output a view keeps; the full output is in
+// the process log
+const maxProcessLines = 4000
+
+// lineRing keeps the last maxProcessLines lines
+type lineRing struct {
+	buf     []string
+	start   int // oldest line once buf is full
+	dropped int // lines pushed out
+}
+
+func (r *lineRing) push(lines ...string) {
+	for _, l := range lines {
+		if len(r.buf) < maxProcessLines {
+			r.buf = append(r.buf, l)
+			continue
+		}
+		r.buf[r.start] = l
+		r.start = (r.start + 1) % len(r.buf)
+		r.dropped++
+	}
+}
+
+func (r lineRing) join() string {
+	var sb strings.Builder
+	for i := range r.buf {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(r.buf[(r.start+i)%len(r.buf)])
+	}
+	return sb.String()
+}
+
+// processView shows a streamed process in a scrollable viewport. The
+// viewport content is rebuilt once per batch of lines, never while drawing.
+type processView struct {
+	proc     *engine.Process
+	viewport viewport.Model
+	lines    lineRing
+	follow   bool // keep the newest line in view
+	running  bool
+	err      error
+}
+
+func newProcessView() processView {
+	return processView{viewport: viewport.New(76, 14), follow: true}
+}
+
+// start launches c through r and returns the command that reads its first lines
+func (v *processView) start(r engine.Runner, root, name string, c engine.Command) tea.Cmd {
+	v.lines = lineRing{}
+	v.err = nil
+	v.follow = true
+	v.viewport.SetContent("")
+	v.viewport.GotoTop()
+	proc, err := r.Start(root, name, c)
+	if err != nil {
+		v.proc = nil
+		v.running = false
+		v.err = err
+		return nil
+	}
+	v.proc = proc
+	v.running = true
+	return waitProcess(proc)
+}
+
+func waitProcess(p *engine.Process) tea.Cmd {
+	return func() tea.Msg {
+		lines, ok := p.NextLines()
+		if !ok {
+			return ProcessMsg{id: p.ID, done: true, err: p.Err()}
+		}
+		return ProcessMsg{id: p.ID, lines: lines}
+	}
+}
+
+// owns reports whether msg belongs to the process shown here
+func (v processView) owns(msg ProcessMsg) bool {
+	return v.proc != nil && v.proc.ID == msg.id
+}
+
+// handle appends streamed lines, or records the result once the process exits
+func (v processView) handle(msg ProcessMsg) (processView, tea.Cmd) {
+	if msg.done {
+		v.running = false
+		v.err = msg.err
+		return v, nil
+	}
+	v.append(msg.lines...)
+	return v, waitProcess(v.proc)
+}
+
+// append adds lines and copies the buffer into the viewport, following the
+// output while the user has not scrolled up
+func (v *processView) append(lines ...string) {
+	v.lines.push(lines...)
+	content := v.lines.join()
+	if v.lines.dropped > 0 {
+		note := fmt.Sprintf("… %d linhas anteriores omitidas (veja o log)", v.lines.dropped)
+		content = styles.MutedStyle.Render(note) + "\n" + content
+	}
+	v.viewport.SetContent(content)
+	if v.follow {
+		v.viewport.GotoBottom()
+	}
+}
+
+// updateKeys scrolls the output; "x" cancels a running process
+func (v processView) updateKeys(msg tea.KeyMsg) (processView, tea.Cmd) {
+	if msg.String() == "x" && v.running {
+		v.proc.Cancel()
+		v.append(styles.WarningStyle.Render("⏹  Cancelando..."))
+		return v, nil
+	}
+	var cmd tea.Cmd
+	v.viewport, cmd = v.viewport.Update(msg)
+	v.follow = v.viewport.AtBottom()
+	return v, cmd
+}
+
+func (v processView) View() string {
+	s := v.viewport.View()
+	if v.proc != nil && v.proc.LogPath != "" {
+		s += "\n" + styles.MutedStyle.Render("  log: "+v.proc.LogPath)
+	}
+	return s
+}
+
+func (v *processView) SetSize(w, h int) {
+	v.viewport.Width = w
+	v.viewport.Height = max(h, 3)
+}
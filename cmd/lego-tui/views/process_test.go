@@ -0,0 +1,64 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLineRingKeepsNewestLines(t *testing.T) {
+	var r lineRing
+	for i := range maxProcessLines + 10 {
+		r.push(fmt.Sprint(i))
+	}
+	if r.dropped != 10 {
+		t.Fatalf("dropped = %d, want 10", r.dropped)
+	}
+	lines := strings.Split(r.join(), "\n")
+	if len(lines) != maxProcessLines {
+		t.Fatalf("kept %d lines, want %d", len(lines), maxProcessLines)
+	}
+	if lines[0] != "10" || lines[len(lines)-1] != fmt.Sprint(maxProcessLines+9) {
+		t.Errorf("kept %s..%s, want 10..%d", lines[0], lines[len(lines)-1], maxProcessLines+9)
+	}
+}
+
+func TestProcessViewFollowsOutput(t *testing.T) {
+	v := newProcessView()
+	v.SetSize(40, 5)
+	for i := range 50 {
+		v.append(fmt.Sprint("linha ", i))
+	}
+	if !strings.Contains(v.View(), "linha 49") {
+		t.Errorf("view does not show the newest line:\n%s", v.View())
+	}
+}
+
+func TestProcessViewHandleFillsViewport(t *testing.T) {
+	v := newProcessView()
+	v.SetSize(40, 5)
+	v.proc = &engine.Process{ID: 7}
+	v, _ = v.handle(ProcessMsg{id: 7, lines: []string{"primeira", "segunda"}})
+	if got := v.viewport.View(); !strings.Contains(got, "segunda") {
+		t.Errorf("viewport after handle:\n%s", got)
+	}
+}
+
+func TestShowDryRunOnlyForDryRuns(t *testing.T) {
+	rec := &engine.RecordingRunner{}
+	rec.Run(engine.Cmd("sudo", "mkdir", "-p", "/mnt/etc/nixos"))
+	live := liveRunner{&engine.RecordingRunner{}}
+	live.Run(engine.Cmd("sudo", "true"))
+
+	v := newProcessView()
+	showDryRun(&v, live)
+	if v.lines.join() != "" {
+		t.Errorf("a real run showed %q", v.lines.join())
+	}
+	showDryRun(&v, rec)
+	showDryRun(&v, rec)
+	if got, want := v.lines.join(), engine.DryRunLine(engine.Cmd("sudo", "mkdir", "-p", "/mnt/etc/nixos")); got != want {
+		t.Errorf("lines = %q, want %q once", got, want)
+	}
+}
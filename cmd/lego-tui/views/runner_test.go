@@ -0,0 +1,79 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var errFake = errors.New("falha simulada")
+
+// recorded renders the commands r recorded as shell lines
+func recorded(r *engine.RecordingRunner) []string {
+	var lines []string
+	for _, c := range r.Commands() {
+		lines = append(lines, c.String())
+	}
+	return lines
+}
+
+func TestDiskoRunSequence(t *testing.T) {
+	for _, tc := range []struct {
+		mountOnly bool
+		mode      string
+	}{{false, "disko"}, {true, "mount"}} {
+		root := t.TempDir()
+		rec := &engine.RecordingRunner{}
+		m := NewDiskoModel(root, rec)
+		m.selected = filepath.Join(root, "disko", "nvme.nix")
+		m.isMountOnly = tc.mountOnly
+
+		m, _ = m.runDisko()
+		if m.errMsg != "" {
+			t.Fatalf("%s: %s", tc.mode, m.errMsg)
+		}
+		msg := m.copyLayout()()
+		if res, ok := msg.(diskoCopyFinished); !ok || res.err != nil {
+			t.Fatalf("%s: copyLayout = %#v", tc.mode, msg)
+		}
+
+		want := []string{
+			"sudo nix run github:nix-community/disko -- --mode " + tc.mode + " " + m.selected,
+			"sudo mkdir -p /mnt/etc/nixos",
+			"sudo cp " + m.selected + " /mnt/etc/nixos/disko.nix",
+		}
+		if got := recorded(rec); !slices.Equal(got, want) {
+			t.Errorf("%s:\n%q\nwant:\n%q", tc.mode, got, want)
+		}
+	}
+}
+
+func TestDiskoCopyFailureIsReported(t *testing.T) {
+	root := t.TempDir()
+	m := NewDiskoModel(root, nil)
+	m.selected = filepath.Join(root, "disko", "sda.nix")
+	m.runner = &engine.RecordingRunner{Results: map[string]engine.RecordedResult{
+		"sudo cp " + m.selected + " /mnt/etc/nixos/disko.nix": {Output: "cp: sem espaço", Err: errFake},
+	}}
+	res, ok := m.copyLayout()().(diskoCopyFinished)
+	if !ok || res.err == nil {
+		t.Fatalf("copyLayout = %#v, want an error", res)
+	}
+}
+
+func TestScriptRunSequence(t *testing.T) {
+	root := t.TempDir()
+	rec := &engine.RecordingRunner{}
+	m := NewScriptsModel(root, rec)
+	m.selected = filepath.Join(root, "scripts", "#1-prepare.nu")
+
+	m, _ = m.runScript()
+	if m.errMsg != "" {
+		t.Fatal(m.errMsg)
+	}
+	if got, want := recorded(rec), []string{"nu '" + m.selected + "'"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
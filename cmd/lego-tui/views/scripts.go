@@ -1,10 +1,10 @@
 package views
 
 import (
+	"LEGOFlakes/cmd/lego-tui/engine"
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -27,11 +27,6 @@ const (
 	scriptSubResult
 )
 
-type scriptResult struct {
-	output string
-	err    error
-}
-
 type scriptEditorFinished struct{ err error }
 
 // ── Script list item ─────────────────────────────────────────
@@ -62,15 +57,16 @@ type ScriptsModel struct {
 	input      textinput.Model
 	spinner    spinner.Model
 	rootDir    string
+	runner     engine.Runner
 	selected   string // Path of selected script
-	output     string
+	proc       processView
 	errMsg     string
 	width      int
 	height     int
 	message    string // status message
 }
 
-func NewScriptsModel(rootDir string) ScriptsModel {
+func NewScriptsModel(rootDir string, runner engine.Runner) ScriptsModel {
 	sp := spinner.New()
 	sp.Spinner = spinner.Line
 	sp.Style = lipgloss.NewStyle().Foreground(styles.ColorWarning)
@@ -93,9 +89,11 @@ func NewScriptsModel(rootDir string) ScriptsModel {
 		subState:   scriptSubList,
 		spinner:    sp,
 		rootDir:    rootDir,
+		runner:     runner,
 		scriptList: emptyList,
 		actionList: actionList,
 		input:      ti,
+		proc:       newProcessView(),
 		width:      80,
 		height:     24,
 	}
@@ -152,15 +150,7 @@ func (m *ScriptsModel) refreshActionList() {
 }
 
 func (m *ScriptsModel) openEditor(path string) tea.Cmd {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "micro"
-	}
-	c := exec.Command(editor, path)
-	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	return tea.ExecProcess(c, func(err error) tea.Msg {
+	return editorCommand(m.runner, path, func(err error) tea.Msg {
 		return scriptEditorFinished{err}
 	})
 }
@@ -176,6 +166,19 @@ func (m ScriptsModel) Update(msg tea.Msg) (ScriptsModel, tea.Cmd) {
 		}
 		m.subState = scriptSubList
 		return m, nil
+	case ProcessMsg:
+		if !m.proc.owns(msg) {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.handle(msg)
+		if msg.done {
+			if msg.err != nil {
+				m.errMsg = msg.err.Error()
+			}
+			m.subState = scriptSubResult
+		}
+		return m, cmd
 	}
 
 	switch m.subState {
@@ -323,10 +326,12 @@ func (m ScriptsModel) updateResult(msg tea.Msg) (ScriptsModel, tea.Cmd) {
 		switch msg.String() {
 		case "enter", "esc":
 			m.subState = scriptSubList
-			m.output = ""
 			m.errMsg = ""
 			return m, nil
 		}
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.updateKeys(msg)
+		return m, cmd
 	}
 	return m, nil
 }
@@ -359,8 +364,7 @@ func (m ScriptsModel) updateConfirmRun(msg tea.Msg) (ScriptsModel, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "y", "Y":
-			m.subState = scriptSubRun
-			return m, tea.Batch(m.spinner.Tick, m.runScript())
+			return m.runScript()
 		case "n", "N", "esc":
 			m.subState = scriptSubList
 			return m, nil
@@ -371,15 +375,10 @@ func (m ScriptsModel) updateConfirmRun(msg tea.Msg) (ScriptsModel, tea.Cmd) {
 
 func (m ScriptsModel) updateRun(msg tea.Msg) (ScriptsModel, tea.Cmd) {
 	switch msg := msg.(type) {
-	case scriptResult:
-		if msg.err != nil {
-			m.errMsg = msg.err.Error()
-			m.output = msg.output
-		} else {
-			m.output = msg.output
-		}
-		m.subState = scriptSubResult // Always go to result
-		return m, nil
+	case tea.KeyMsg:
+		var cmd tea.Cmd
+		m.proc, cmd = m.proc.updateKeys(msg)
+		return m, cmd
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -388,17 +387,18 @@ func (m ScriptsModel) updateRun(msg tea.Msg) (ScriptsModel, tea.Cmd) {
 	return m, nil
 }
 
-func (m ScriptsModel) runScript() tea.Cmd {
-	return func() tea.Msg {
-		path, err := exec.LookPath("nu")
-		if err != nil {
-			return scriptResult{err: fmt.Errorf("nu not found in PATH")}
-		}
-
-		cmd := exec.Command(path, m.selected)
-		out, err := cmd.CombinedOutput()
-		return scriptResult{output: string(out), err: err}
+// runScript streams "nu <script>" into the output viewport
+func (m ScriptsModel) runScript() (ScriptsModel, tea.Cmd) {
+	m.errMsg = ""
+	name := "script-" + strings.TrimSuffix(filepath.Base(m.selected), ".nu")
+	cmd := m.proc.start(m.runner, m.rootDir, name, engine.Cmd("nu", m.selected))
+	if m.proc.err != nil {
+		m.errMsg = m.proc.err.Error()
+		m.subState = scriptSubResult
+		return m, nil
 	}
+	m.subState = scriptSubRun
+	return m, tea.Batch(m.spinner.Tick, cmd)
 }
 
 func (m ScriptsModel) HelpKeys() string {
@@ -414,9 +414,9 @@ func (m ScriptsModel) HelpKeys() string {
 	case scriptSubConfirmRun:
 		return "y: confirmar • n/esc: cancelar"
 	case scriptSubRun:
-		return "aguarde..."
+		return "↑/↓/pgup/pgdn: rolar • x: cancelar"
 	case scriptSubResult:
-		return "enter/esc: voltar"
+		return "↑/↓/pgup/pgdn: rolar • enter/esc: voltar"
 	}
 	return ""
 }
@@ -456,14 +456,11 @@ func (m ScriptsModel) View() string {
 
 	case scriptSubRun:
 		title := styles.Subtitle.Render("EXECUTANDO")
-		s = title + "\n\n  " + m.spinner.View() + " Executando " + filepath.Base(m.selected) + "..."
+		s = title + "\n\n  " + m.spinner.View() + " Executando " + filepath.Base(m.selected) + "...\n\n" +
+			m.proc.View()
 
 	case scriptSubResult:
 		title := styles.Subtitle.Render("RESULTADO")
-		out := m.output
-		if len(out) > 800 {
-			out = out[len(out)-800:]
-		}
 		resStyle := styles.SuccessStyle
 		icon := "✅"
 		if m.errMsg != "" {
@@ -478,7 +475,7 @@ func (m ScriptsModel) View() string {
 			s += styles.MutedStyle.Render("  Erro: "+m.errMsg) + "\n"
 		}
 
-		s += "\n" + styles.MutedStyle.Render(strings.TrimSpace(out))
+		s += "\n" + m.proc.View()
 	}
 
 	return lipgloss.NewStyle().Padding(1, 2).Render(s)
@@ -489,4 +486,5 @@ func (m *ScriptsModel) SetSize(w, h int) {
 	m.height = h
 	m.scriptList.SetSize(w-4, h-8)
 	m.actionList.SetSize(w-4, h-6)
+	m.proc.SetSize(w-4, h-10)
 }
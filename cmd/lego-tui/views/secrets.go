@@ -0,0 +1,425 @@
+package views
+
+import (
+	"LEGOFlakes/cmd/lego-tui/engine"
+	"LEGOFlakes/cmd/lego-tui/styles"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type secretSubState int
+
+const (
+	secretSubList secretSubState = iota
+	secretSubName
+	secretSubValue
+	secretSubRecipient
+	secretSubConfirm // Delete confirmation
+)
+
+type secretKeyInstalled struct{ err error }
+
+// ── Secret list item ─────────────────────────────────────────
+type secretItem struct {
+	name    string
+	usedBy  []string // modules whose SECRETS header lists it
+	missing bool     // referenced by a module but not created yet
+}
+
+func (s secretItem) Title() string {
+	if s.missing {
+		return "⚠️  " + s.name + " (ausente)"
+	}
+	return "🔒 " + s.name
+}
+
+func (s secretItem) Description() string {
+	if len(s.usedBy) == 0 {
+		return "não usado por nenhum módulo"
+	}
+	return "usado por: " + strings.Join(s.usedBy, ", ")
+}
+
+func (s secretItem) FilterValue() string { return s.name }
+
+// ── Model ────────────────────────────────────────────────────
+type SecretsModel struct {
+	subState  secretSubState
+	list      list.Model
+	nameInput textinput.Model
+	keyInput  textinput.Model
+	value     textarea.Model
+	rootDir   string
+	runner    engine.Runner
+	selected  string // Name of the secret being edited or deleted
+	pubKey    string
+	nRecip    int
+	message   string
+	isError   bool
+	width     int
+	height    int
+}
+
+func NewSecretsModel(rootDir string, runner engine.Runner) SecretsModel {
+	ni := textinput.New()
+	ni.Placeholder = "nome-do-segredo"
+	ni.CharLimit = 64
+
+	ki := textinput.New()
+	ki.Placeholder = "age1... ou ssh-ed25519 AAAA..."
+	ki.Width = 70
+
+	ta := textarea.New()
+	ta.Placeholder = "Conteúdo do segredo (ex.: CHAVE=valor por linha)"
+	ta.ShowLineNumbers = false
+	ta.SetWidth(70)
+	ta.SetHeight(8)
+
+	m := SecretsModel{
+		subState:  secretSubList,
+		nameInput: ni,
+		keyInput:  ki,
+		value:     ta,
+		rootDir:   rootDir,
+		runner:    runner,
+		width:     80,
+		height:    24,
+	}
+	m.Refresh()
+	return m
+}
+
+// Refresh reloads secrets/ and the secrets referenced by modules
+func (m *SecretsModel) Refresh() {
+	usedBy := map[string][]string{}
+	var referenced []string
+	for _, mod := range engine.ListModules(m.rootDir) {
+		for _, s := range mod.Secrets {
+			if _, seen := usedBy[s]; !seen {
+				referenced = append(referenced, s)
+			}
+			usedBy[s] = append(usedBy[s], mod.RelPath)
+		}
+	}
+
+	names, err := engine.ListSecrets(m.rootDir)
+	if err != nil {
+		m.message, m.isError = err.Error(), true
+	}
+	var items []list.Item
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+		items = append(items, secretItem{name: name, usedBy: usedBy[name]})
+	}
+	for _, name := range referenced {
+		if !exists[name] {
+			items = append(items, secretItem{name: name, usedBy: usedBy[name], missing: true})
+		}
+	}
+
+	m.pubKey = engine.LocalAgePublicKey()
+	recipients, _ := engine.SecretRecipients(m.rootDir)
+	m.nRecip = len(recipients)
+
+	delegate := list.NewDefaultDelegate()
+	delegate.Styles.NormalTitle = delegate.Styles.NormalTitle.Foreground(styles.ColorText)
+	delegate.Styles.NormalDesc = delegate.Styles.NormalDesc.Foreground(styles.ColorMuted)
+	delegate.Styles.SelectedTitle = delegate.Styles.SelectedTitle.
+		Foreground(styles.ColorSecondary).
+		BorderLeftForeground(styles.ColorSecondary)
+	delegate.Styles.SelectedDesc = delegate.Styles.SelectedDesc.
+		Foreground(styles.ColorMuted).
+		BorderLeftForeground(styles.ColorSecondary)
+
+	l := list.New(items, delegate, m.width-4, m.height-10)
+	l.Title = "Segredos (secrets/*.age)"
+	l.Styles.Title = styles.Subtitle
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+	m.list = l
+}
+
+// InputActive reports whether a text field is capturing keys
+func (m SecretsModel) InputActive() bool {
+	return m.subState == secretSubName || m.subState == secretSubValue || m.subState == secretSubRecipient
+}
+
+func (m *SecretsModel) setMessage(msg string, isError bool) {
+	m.message, m.isError = msg, isError
+}
+
+func (m SecretsModel) Update(msg tea.Msg) (SecretsModel, tea.Cmd) {
+	if msg, ok := msg.(secretKeyInstalled); ok {
+		switch {
+		case msg.err != nil:
+			m.setMessage("Erro ao instalar chave: "+msg.err.Error(), true)
+		case m.runner.DryRun():
+			var lines []string
+			for _, c := range m.runner.Drain() {
+				lines = append(lines, engine.DryRunLine(c))
+			}
+			m.setMessage(strings.Join(lines, "\n  "), false)
+		default:
+			m.setMessage("✅ Chave instalada em "+engine.HostAgeKeyPath, false)
+		}
+		return m, nil
+	}
+
+	switch m.subState {
+	case secretSubList:
+		return m.updateList(msg)
+	case secretSubName:
+		return m.updateName(msg)
+	case secretSubValue:
+		return m.updateValue(msg)
+	case secretSubRecipient:
+		return m.updateRecipient(msg)
+	case secretSubConfirm:
+		return m.updateConfirm(msg)
+	}
+	return m, nil
+}
+
+func (m SecretsModel) updateList(msg tea.Msg) (SecretsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			if item, ok := m.list.SelectedItem().(secretItem); ok {
+				return m.openValue(item.name)
+			}
+			return m, nil
+		case "n":
+			m.subState = secretSubName
+			m.message = ""
+			m.nameInput.SetValue("")
+			return m, m.nameInput.Focus()
+		case "d":
+			if item, ok := m.list.SelectedItem().(secretItem); ok && !item.missing {
+				m.selected = item.name
+				m.subState = secretSubConfirm
+			}
+			return m, nil
+		case "g":
+			pub, err := engine.GenerateAgeKey(m.rootDir)
+			if err != nil {
+				m.setMessage(err.Error(), true)
+			} else {
+				m.setMessage("🔑 Chave gerada em "+engine.AgeKeyPath()+"\n  Pública: "+pub, false)
+			}
+			m.Refresh()
+			return m, nil
+		case "a":
+			m.subState = secretSubRecipient
+			m.message = ""
+			m.keyInput.SetValue("")
+			return m, m.keyInput.Focus()
+		case "r":
+			n, err := engine.RekeySecrets(m.rootDir)
+			if err != nil {
+				m.setMessage(fmt.Sprintf("Erro após %d segredo(s): %v", n, err), true)
+			} else {
+				m.setMessage(fmt.Sprintf("🔁 %d segredo(s) recriptografados para %d destinatário(s)", n, m.nRecip), false)
+			}
+			return m, nil
+		case "i":
+			if m.pubKey == "" {
+				m.setMessage("Gere a chave age primeiro (g)", true)
+				return m, nil
+			}
+			c := engine.Cmd("sudo", "install", "-D", "-m", "0400", "-o", "root", "-g", "root",
+				engine.AgeKeyPath(), engine.HostAgeKeyPath)
+			return m, tea.Exec(m.runner.Interactive(c), func(err error) tea.Msg {
+				return secretKeyInstalled{err}
+			})
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+// openValue starts editing the value of name. Existing values are
+// decrypted with the local key so they can be changed in place.
+func (m SecretsModel) openValue(name string) (SecretsModel, tea.Cmd) {
+	m.selected = name
+	m.message = ""
+	m.value.SetValue("")
+	if engine.SecretExists(m.rootDir, name) {
+		data, err := engine.ReadSecret(m.rootDir, name)
+		if err != nil {
+			m.setMessage(err.Error(), true)
+			return m, nil
+		}
+		m.value.SetValue(string(data))
+	}
+	m.subState = secretSubValue
+	return m, m.value.Focus()
+}
+
+func (m SecretsModel) updateName(msg tea.Msg) (SecretsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			name := strings.TrimSpace(m.nameInput.Value())
+			if !engine.ValidSecretName(name) {
+				m.setMessage("Nome inválido: use letras, números, '_' e '-', começando por letra", true)
+				return m, nil
+			}
+			m.nameInput.Blur()
+			return m.openValue(name)
+		case "esc":
+			m.nameInput.Blur()
+			m.subState = secretSubList
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.nameInput, cmd = m.nameInput.Update(msg)
+	return m, cmd
+}
+
+func (m SecretsModel) updateValue(msg tea.Msg) (SecretsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+s":
+			if err := engine.WriteSecret(m.rootDir, m.selected, []byte(m.value.Value())); err != nil {
+				m.setMessage(err.Error(), true)
+				return m, nil
+			}
+			m.value.Reset()
+			m.value.Blur()
+			m.subState = secretSubList
+			m.Refresh()
+			m.setMessage("✅ Segredo '"+m.selected+"' salvo em "+engine.SecretsDir+"/"+m.selected+".age", false)
+			return m, nil
+		case "esc":
+			m.value.Reset()
+			m.value.Blur()
+			m.subState = secretSubList
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.value, cmd = m.value.Update(msg)
+	return m, cmd
+}
+
+func (m SecretsModel) updateRecipient(msg tea.Msg) (SecretsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "enter":
+			if err := engine.AddSecretRecipient(m.rootDir, m.keyInput.Value()); err != nil {
+				m.setMessage(err.Error(), true)
+				return m, nil
+			}
+			m.keyInput.Blur()
+			m.subState = secretSubList
+			m.Refresh()
+			m.setMessage("✅ Destinatário adicionado — r: recriptografar os segredos existentes", false)
+			return m, nil
+		case "esc":
+			m.keyInput.Blur()
+			m.subState = secretSubList
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.keyInput, cmd = m.keyInput.Update(msg)
+	return m, cmd
+}
+
+func (m SecretsModel) updateConfirm(msg tea.Msg) (SecretsModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "y", "Y":
+			if err := engine.DeleteSecret(m.rootDir, m.selected); err != nil {
+				m.setMessage(err.Error(), true)
+			} else {
+				m.setMessage("🗑️ Segredo removido", false)
+			}
+			m.subState = secretSubList
+			m.Refresh()
+			return m, nil
+		case "n", "N", "esc":
+			m.subState = secretSubList
+			return m, nil
+		}
+	}
+	return m, nil
+}
+
+func (m SecretsModel) HelpKeys() string {
+	switch m.subState {
+	case secretSubList:
+		return "enter: editar valor • n: novo • d: deletar • g: gerar chave • a: destinatário • r: recriptografar • i: instalar chave no host"
+	case secretSubName, secretSubRecipient:
+		return "enter: confirmar • esc: cancelar"
+	case secretSubValue:
+		return "ctrl+s: criptografar e salvar • esc: cancelar"
+	case secretSubConfirm:
+		return "y: confirmar • n/esc: cancelar"
+	}
+	return ""
+}
+
+func (m SecretsModel) View() string {
+	var s string
+
+	switch m.subState {
+	case secretSubList:
+		title := styles.Subtitle.Render("SEGREDOS")
+		var key string
+		if m.pubKey == "" {
+			key = styles.WarningStyle.Render("  ⚠️  Nenhuma chave age local — g: gerar")
+		} else {
+			key = styles.MutedStyle.Render(fmt.Sprintf("  🔑 %s (%s)", m.pubKey, engine.AgeKeyPath()))
+		}
+		recip := styles.MutedStyle.Render(fmt.Sprintf("  👥 %d destinatário(s) em %s/%s",
+			m.nRecip, engine.SecretsDir, engine.RecipientsFile))
+		s = title + "\n\n" + key + "\n" + recip + "\n\n" + m.list.View()
+
+	case secretSubName:
+		title := styles.Subtitle.Render("NOVO SEGREDO")
+		s = title + "\n\n  Nome (referenciado em # SECRETS: nos módulos):\n  " + m.nameInput.View()
+
+	case secretSubValue:
+		title := styles.Subtitle.Render("SEGREDO: " + m.selected)
+		s = title + "\n\n" +
+			styles.MutedStyle.Render("  Criptografado com age ao salvar; o texto claro nunca vai para o disco.") +
+			"\n\n" + m.value.View()
+
+	case secretSubRecipient:
+		title := styles.Subtitle.Render("NOVO DESTINATÁRIO")
+		s = title + "\n\n" +
+			styles.MutedStyle.Render("  Chave pública de quem pode ler os segredos (ex.: /etc/ssh/ssh_host_ed25519_key.pub do host)") +
+			"\n\n  " + m.keyInput.View()
+
+	case secretSubConfirm:
+		title := styles.Subtitle.Render("CONFIRMAR DELEÇÃO")
+		s = title + styles.WarningStyle.Render(fmt.Sprintf("\n  ⚠️  Deletar o segredo '%s'?\n", m.selected))
+	}
+
+	if m.message != "" {
+		msgStyle := styles.SuccessStyle
+		if m.isError {
+			msgStyle = styles.ErrorStyle
+		}
+		s += "\n\n" + msgStyle.Render("  "+m.message)
+	}
+	return lipgloss.NewStyle().Padding(1, 2).Render(s)
+}
+
+func (m *SecretsModel) SetSize(w, h int) {
+	m.width = w
+	m.height = h
+	m.list.SetSize(w-4, h-10)
+	m.value.SetWidth(min(w-8, 100))
+}
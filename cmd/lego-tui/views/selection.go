@@ -4,62 +4,321 @@ import (
 	"LEGOFlakes/cmd/lego-tui/engine"
 	"LEGOFlakes/cmd/lego-tui/styles"
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
 )
 
 // ── Selection Model ──────────────────────────────────────────
 type SelectionModel struct {
-	modules  []engine.ModuleInfo
-	selected map[string]bool
-	cursor   int
-	rootDir  string
-	message  string
-	width    int
-	height   int
+	modules    []engine.ModuleInfo
+	selected   map[string]bool
+	cursor     int // index into rows()
+	rootDir    string
+	presetName string
+	message    string
+	width      int
+	height     int
+
+	// Parameter form for the module under the cursor
+	paramMode   bool
+	paramModule engine.ModuleInfo
+	paramInputs []textinput.Model
+	paramFocus  int
+	paramErr    string
+
+	// Browsing: fuzzy search, folded categories, selected-only view
+	search       textinput.Model
+	searching    bool // search field has focus
+	collapsed    map[string]bool
+	onlySelected bool
+}
+
+// selectionRow is a line of the list: a category header (mod == nil) or a
+// module, with the byte offsets of its label matched by the search
+type selectionRow struct {
+	category string
+	mod      *engine.ModuleInfo
+	matched  []int
 }
 
 func NewSelectionModel(rootDir string) SelectionModel {
-	mods := engine.ListModules(rootDir)
+	mods := engine.SystemModules(rootDir)
+	search := textinput.New()
+	search.Prompt = "🔍 "
+	search.Placeholder = "nome, propósito ou categoria"
+	search.Width = 40
 	return SelectionModel{
-		modules:  mods,
-		selected: make(map[string]bool),
-		rootDir:  rootDir,
-		width:    80,
-		height:   24,
+		modules:   mods,
+		selected:  make(map[string]bool),
+		collapsed: make(map[string]bool),
+		search:    search,
+		rootDir:   rootDir,
+		width:     80,
+		height:    24,
+	}
+}
+
+// moduleLabel is the text shown, and searched, for a module
+func moduleLabel(mod engine.ModuleInfo) string {
+	if mod.Purpose == "" {
+		return mod.Name
+	}
+	return mod.Name + " — " + mod.Purpose
+}
+
+// searchModule ranks mod against query: fuzzy on the name, plain substring
+// on the purpose and category. It returns the rank (higher is better) and
+// the byte offsets of moduleLabel(mod) to highlight.
+func searchModule(mod engine.ModuleInfo, query string) (int, []int, bool) {
+	if ms := fuzzy.Find(query, []string{mod.Name}); len(ms) > 0 {
+		return 1000 + ms[0].Score, ms[0].MatchedIndexes, true
+	}
+	q := strings.ToLower(query)
+	label := moduleLabel(mod)
+	if i := strings.Index(strings.ToLower(label), q); i >= 0 {
+		var offsets []int
+		for j := i; j < i+len(q); j++ {
+			offsets = append(offsets, j)
+		}
+		return 500 - i, offsets, true
+	}
+	if strings.Contains(mod.Category, q) {
+		return 0, nil, true
+	}
+	return 0, nil, false
+}
+
+// rows lists the visible lines: every category with modules passing the
+// search and the selected-only filter, expanded unless folded. A search
+// ranks modules and shows every category that has a match.
+func (m SelectionModel) rows() []selectionRow {
+	query := strings.TrimSpace(m.search.Value())
+	var rows []selectionRow
+	for _, cat := range engine.Categories {
+		var mods []selectionRow
+		var ranks []int
+		for i := range m.modules {
+			mod := &m.modules[i]
+			if mod.Category != cat || (m.onlySelected && !m.selected[mod.RelPath]) {
+				continue
+			}
+			row := selectionRow{category: cat, mod: mod}
+			rank := 0
+			if query != "" {
+				var ok bool
+				if rank, row.matched, ok = searchModule(*mod, query); !ok {
+					continue
+				}
+			}
+			mods = append(mods, row)
+			ranks = append(ranks, rank)
+		}
+		if len(mods) == 0 {
+			continue
+		}
+		if query != "" {
+			order := make([]int, len(mods))
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(a, b int) bool { return ranks[order[a]] > ranks[order[b]] })
+			sorted := make([]selectionRow, len(mods))
+			for i, j := range order {
+				sorted[i] = mods[j]
+			}
+			mods = sorted
+		}
+		rows = append(rows, selectionRow{category: cat})
+		if query != "" || !m.collapsed[cat] {
+			rows = append(rows, mods...)
+		}
+	}
+	return rows
+}
+
+// currentRow returns the row under the cursor
+func (m SelectionModel) currentRow() (selectionRow, bool) {
+	rows := m.rows()
+	if m.cursor < 0 || m.cursor >= len(rows) {
+		return selectionRow{}, false
+	}
+	return rows[m.cursor], true
+}
+
+// clampCursor keeps the cursor on an existing row, preferring a module
+func (m *SelectionModel) clampCursor() {
+	rows := m.rows()
+	if m.cursor >= len(rows) {
+		m.cursor = len(rows) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
 	}
 }
 
+// firstModuleRow moves the cursor to the first module line
+func (m *SelectionModel) firstModuleRow() {
+	m.cursor = 0
+	for i, row := range m.rows() {
+		if row.mod != nil {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+// categoryCount returns how many modules of cat are selected, out of all
+func (m SelectionModel) categoryCount(cat string) (int, int) {
+	selected, total := 0, 0
+	for _, mod := range m.modules {
+		if mod.Category == cat {
+			total++
+			if m.selected[mod.RelPath] {
+				selected++
+			}
+		}
+	}
+	return selected, total
+}
+
+// toggleModules selects every module of mods, or clears them all when
+// they already are
+func (m *SelectionModel) toggleModules(mods []*engine.ModuleInfo) {
+	all := true
+	for _, mod := range mods {
+		all = all && m.selected[mod.RelPath]
+	}
+	for _, mod := range mods {
+		m.selected[mod.RelPath] = !all
+	}
+	m.message = ""
+	if !all {
+		m.pullRequirements()
+	}
+}
+
+// visibleModules lists the modules passing the filters, folded or not
+func (m SelectionModel) visibleModules(category string) []*engine.ModuleInfo {
+	m.collapsed = nil // m is a copy: unfold everything for the walk
+	var mods []*engine.ModuleInfo
+	for _, row := range m.rows() {
+		if row.mod != nil && (category == "" || row.category == category) {
+			mods = append(mods, row.mod)
+		}
+	}
+	return mods
+}
+
+func (m SelectionModel) updateSearch(msg tea.Msg) (SelectionModel, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "esc":
+			m.search.SetValue("")
+			m.searching = false
+			m.search.Blur()
+			m.clampCursor()
+			return m, nil
+		case "enter":
+			m.searching = false
+			m.search.Blur()
+			return m, nil
+		case "up", "down":
+			m.searching = false
+			m.search.Blur()
+			return m.Update(msg)
+		}
+	}
+	before := m.search.Value()
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	if m.search.Value() != before {
+		m.firstModuleRow()
+	}
+	return m, cmd
+}
+
 func (m SelectionModel) Init() tea.Cmd { return nil }
 
 func (m SelectionModel) Update(msg tea.Msg) (SelectionModel, tea.Cmd) {
+	if m.paramMode {
+		return m.updateParams(msg)
+	}
+	if m.searching {
+		return m.updateSearch(msg)
+	}
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		row, hasRow := m.currentRow()
 		switch msg.String() {
+		case "/":
+			m.searching = true
+			return m, m.search.Focus()
+		case "esc":
+			if m.search.Value() != "" {
+				m.search.SetValue("")
+				m.clampCursor()
+			}
+		case "p":
+			if hasRow && row.mod != nil && len(row.mod.Params) > 0 {
+				return m, m.openParams(*row.mod)
+			}
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
 			}
 		case "down", "j":
-			if m.cursor < len(m.modules)-1 {
+			if m.cursor < len(m.rows())-1 {
 				m.cursor++
 			}
+		case "enter", "c":
+			// Fold or unfold the category under the cursor
+			if hasRow && m.search.Value() == "" {
+				m.collapsed[row.category] = !m.collapsed[row.category]
+				for i, r := range m.rows() {
+					if r.mod == nil && r.category == row.category {
+						m.cursor = i
+					}
+				}
+			}
+		case "C":
+			fold := false
+			for _, cat := range engine.Categories {
+				fold = fold || !m.collapsed[cat]
+			}
+			for _, cat := range engine.Categories {
+				m.collapsed[cat] = fold
+			}
+			m.clampCursor()
+		case "s":
+			m.onlySelected = !m.onlySelected
+			m.clampCursor()
 		case " ":
-			if len(m.modules) > 0 {
-				key := m.modules[m.cursor].RelPath
+			switch {
+			case !hasRow:
+			case row.mod == nil:
+				m.toggleModules(m.visibleModules(row.category))
+			default:
+				key := row.mod.RelPath
 				m.selected[key] = !m.selected[key]
-			}
-		case "a":
-			allSelected := true
-			for _, mod := range m.modules {
-				if !m.selected[mod.RelPath] {
-					allSelected = false
-					break
+				m.message = ""
+				if m.selected[key] {
+					m.pullRequirements()
 				}
 			}
-			for _, mod := range m.modules {
-				m.selected[mod.RelPath] = !allSelected
+			if m.onlySelected {
+				m.clampCursor()
+			}
+		case "a":
+			m.toggleModules(m.visibleModules(""))
+			if m.onlySelected {
+				m.clampCursor()
 			}
 		}
 	case tea.WindowSizeMsg:
@@ -69,11 +328,144 @@ func (m SelectionModel) Update(msg tea.Msg) (SelectionModel, tea.Cmd) {
 	return m, nil
 }
 
+// openParams builds the parameter form, prefilled from the preset or defaults
+func (m *SelectionModel) openParams(mod engine.ModuleInfo) tea.Cmd {
+	if m.presetName == "" {
+		m.message = "Escolha um preset na aba Hosts para editar parâmetros"
+		return nil
+	}
+	preset, err := engine.LoadPreset(m.presetPath())
+	if err != nil {
+		m.message = "Erro ao carregar preset: " + err.Error()
+		return nil
+	}
+
+	m.paramModule = mod
+	m.paramInputs = nil
+	m.paramFocus = 0
+	m.paramErr = ""
+	for _, p := range mod.Params {
+		ti := textinput.New()
+		ti.Placeholder = p.Default
+		ti.CharLimit = 200
+		ti.Width = 60
+		if v, ok := preset.Params[mod.RelPath][p.Name]; ok {
+			ti.SetValue(engine.FormatParamInput(v))
+		} else {
+			ti.SetValue(p.Default)
+		}
+		m.paramInputs = append(m.paramInputs, ti)
+	}
+	m.paramMode = true
+	m.paramInputs[0].Focus()
+	return textinput.Blink
+}
+
+func (m SelectionModel) updateParams(msg tea.Msg) (SelectionModel, tea.Cmd) {
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "esc":
+			m.paramMode = false
+			return m, nil
+		case "down":
+			m.paramInputs[m.paramFocus].Blur()
+			m.paramFocus = (m.paramFocus + 1) % len(m.paramInputs)
+			m.paramInputs[m.paramFocus].Focus()
+			return m, textinput.Blink
+		case "up":
+			m.paramInputs[m.paramFocus].Blur()
+			m.paramFocus = (m.paramFocus - 1 + len(m.paramInputs)) % len(m.paramInputs)
+			m.paramInputs[m.paramFocus].Focus()
+			return m, textinput.Blink
+		case "enter":
+			if err := m.saveParams(); err != nil {
+				m.paramErr = err.Error()
+				return m, nil
+			}
+			m.paramMode = false
+			m.message = fmt.Sprintf("⚙️  Parâmetros de %s salvos em '%s'", m.paramModule.RelPath, m.presetName)
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.paramInputs[m.paramFocus], cmd = m.paramInputs[m.paramFocus].Update(msg)
+	return m, cmd
+}
+
+// saveParams validates the form and writes [params."<module>"] to the preset
+func (m *SelectionModel) saveParams() error {
+	values := map[string]any{}
+	for i, p := range m.paramModule.Params {
+		v, err := engine.ParseParamInput(p, m.paramInputs[i].Value())
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		values[p.Name] = v
+	}
+
+	path := m.presetPath()
+	preset, err := engine.LoadPreset(path)
+	if err != nil {
+		return err
+	}
+	if preset.Params == nil {
+		preset.Params = engine.ParamsConfig{}
+	}
+	preset.Params[m.paramModule.RelPath] = values
+	return engine.SavePreset(path, preset)
+}
+
+func (m SelectionModel) presetPath() string {
+	return filepath.Join(m.rootDir, "presets", m.presetName+".toml")
+}
+
+// paramsView renders the parameter form
+func (m SelectionModel) paramsView() string {
+	title := styles.Subtitle.Render("PARÂMETROS — " + m.paramModule.RelPath)
+	s := title + "\n" + styles.MutedStyle.Render("  preset: "+m.presetName) + "\n\n"
+	for i, p := range m.paramModule.Params {
+		label := fmt.Sprintf("%s (%s)", p.Name, p.Type)
+		style := styles.NormalItem
+		if i == m.paramFocus {
+			style = styles.SelectedItem
+		}
+		s += "  " + style.Render(label) + "\n"
+		if p.Description != "" {
+			s += "  " + styles.MutedStyle.Render(p.Description) + "\n"
+		}
+		s += "  " + m.paramInputs[i].View() + "\n\n"
+	}
+	if m.paramErr != "" {
+		s += styles.ErrorStyle.Render("  "+m.paramErr) + "\n"
+	}
+	return lipgloss.NewStyle().Padding(1, 2).Render(s)
+}
+
+// pullRequirements auto-selects modules required by the current selection
+func (m *SelectionModel) pullRequirements() {
+	res := engine.ResolveModules(m.modules, m.GetSelected())
+	for _, rel := range res.Added {
+		m.selected[rel] = true
+	}
+	if len(res.Added) > 0 {
+		m.message = "➕ Dependências adicionadas: " + strings.Join(res.Added, ", ")
+	}
+}
+
 func (m SelectionModel) HelpKeys() string {
-	return "space: toggle • a: todos • j/k: navegar"
+	if m.paramMode {
+		return "↑/↓: campo • enter: salvar no preset • esc: cancelar"
+	}
+	if m.searching {
+		return "digite para filtrar • enter: manter filtro • esc: limpar • ↑/↓: navegar"
+	}
+	return "space: toggle (categoria no título) • a: todos visíveis • /: buscar • enter/c: recolher • C: recolher todas • s: só selecionados • p: parâmetros"
 }
 
 func (m SelectionModel) View() string {
+	if m.paramMode {
+		return m.paramsView()
+	}
 	title := styles.Subtitle.Render("SELECIONAR MÓDULOS")
 	count := 0
 	for _, v := range m.selected {
@@ -81,11 +473,39 @@ func (m SelectionModel) View() string {
 			count++
 		}
 	}
-	counter := styles.MutedStyle.Render(fmt.Sprintf("  %d selecionado(s)", count))
+	counter := styles.MutedStyle.Render(fmt.Sprintf("  %d de %d selecionado(s)", count, len(m.modules)))
+	if m.onlySelected {
+		counter += styles.WarningStyle.Render("  • só selecionados")
+	}
+
+	search := ""
+	if m.searching || m.search.Value() != "" {
+		search = "\n  " + m.search.View()
+	}
 
+	// Dependency and conflict feedback for the current selection
+	notes := ""
+	if m.message != "" {
+		notes += styles.SuccessStyle.Render("  "+m.message) + "\n"
+	}
+	res := engine.ResolveModules(m.modules, m.GetSelected())
+	for _, c := range res.Conflicts {
+		notes += styles.ErrorStyle.Render("  ⚠️  "+c.String()) + "\n"
+	}
+	for _, missing := range res.Missing {
+		notes += styles.WarningStyle.Render("  ⚠️  "+missing) + "\n"
+	}
+	if notes != "" {
+		notes = "\n" + notes
+	}
+
+	rows := m.rows()
 	lines := ""
+	if len(rows) == 0 {
+		lines = styles.MutedStyle.Render("  nenhum módulo encontrado") + "\n"
+	}
 	scrollStart := 0
-	maxVisible := m.height - 10
+	maxVisible := m.height - 12
 	if maxVisible < 5 {
 		maxVisible = 5
 	}
@@ -93,7 +513,9 @@ func (m SelectionModel) View() string {
 		scrollStart = m.cursor - maxVisible + 1
 	}
 
-	for i, mod := range m.modules {
+	headerStyle := lipgloss.NewStyle().Bold(true).Foreground(styles.ColorPrimary)
+	matchStyle := lipgloss.NewStyle().Underline(true).Foreground(styles.ColorAccent)
+	for i, row := range rows {
 		if i < scrollStart || i >= scrollStart+maxVisible {
 			continue
 		}
@@ -102,31 +524,66 @@ func (m SelectionModel) View() string {
 			cursor = "▸ "
 		}
 
+		if row.mod == nil {
+			fold := "▾"
+			if m.collapsed[row.category] && m.search.Value() == "" {
+				fold = "▸"
+			}
+			sel, total := m.categoryCount(row.category)
+			countStyle := styles.MutedStyle
+			if sel > 0 {
+				countStyle = lipgloss.NewStyle().Foreground(styles.ColorSecondary)
+			}
+			style := headerStyle
+			if i == m.cursor {
+				style = style.Foreground(styles.ColorSecondary)
+			}
+			lines += cursor + style.Render(fold+" "+strings.ToUpper(row.category)) + " " +
+				countStyle.Render(fmt.Sprintf("%d/%d", sel, total)) + "\n"
+			continue
+		}
+
+		mod := row.mod
 		check := "[ ]"
 		if m.selected[mod.RelPath] {
 			check = "[✓]"
 		}
 
-		label := fmt.Sprintf("[%s] %s", mod.Category, mod.Name)
-		if mod.Purpose != "" {
-			label += " — " + mod.Purpose
-		}
-
 		style := styles.NormalItem
 		if i == m.cursor {
 			style = styles.SelectedItem
 		}
+		label := moduleLabel(*mod)
+		rendered := style.Render(label)
+		if len(row.matched) > 0 {
+			rendered = lipgloss.StyleRunes(label, runeIndexes(label, row.matched), matchStyle.Inherit(style), style)
+		}
+		if len(mod.Params) > 0 {
+			rendered += style.Render(" ⚙")
+		}
 
 		checkStyle := styles.MutedStyle
 		if m.selected[mod.RelPath] {
 			checkStyle = lipgloss.NewStyle().Foreground(styles.ColorSecondary)
 		}
 
-		lines += cursor + checkStyle.Render(check) + " " + style.Render(label) + "\n"
+		lines += cursor + "  " + checkStyle.Render(check) + " " + rendered + "\n"
 	}
 
 	return lipgloss.NewStyle().Padding(1, 2).Render(
-		title + "\n" + counter + "\n\n" + lines)
+		title + "\n" + counter + search + "\n" + notes + "\n" + lines)
+}
+
+// runeIndexes converts byte offsets of s into rune indexes, dropping those
+// past the end of s
+func runeIndexes(s string, offsets []int) []int {
+	var idx []int
+	for _, off := range offsets {
+		if off < len(s) {
+			idx = append(idx, utf8.RuneCountInString(s[:off]))
+		}
+	}
+	return idx
 }
 
 func (m *SelectionModel) SetSize(w, h int) {
@@ -147,7 +604,19 @@ func (m SelectionModel) GetSelected() []string {
 
 // Refresh reloads the module list
 func (m *SelectionModel) Refresh() {
-	m.modules = engine.ListModules(m.rootDir)
+	m.modules = engine.SystemModules(m.rootDir)
+	m.clampCursor()
+}
+
+// InputActive reports whether the parameter form or the search field is
+// capturing keystrokes
+func (m SelectionModel) InputActive() bool {
+	return m.paramMode || m.searching
+}
+
+// SetPreset sets the preset whose [params] the form edits
+func (m *SelectionModel) SetPreset(name string) {
+	m.presetName = name
 }
 
 // LoadFromPreset pre-selects modules listed in the preset's active list
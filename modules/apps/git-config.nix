@@ -1,13 +1,15 @@
 # NIXOS-LEGO-MODULE: git-config
 # PURPOSE: Git configuration
 # CATEGORY: apps
+# PARAM: GIT_USER_NAME | string | l41twz | Git user.name
+# PARAM: GIT_USER_EMAIL | string | 253585242+l41twz@users.noreply.github.com | Git user.email
 # ---
 programs.git = {
   enable = true;
   config = {
     user = {
-    name = "l41twz";
-    email = "253585242+l41twz@users.noreply.github.com";
+    name = {{GIT_USER_NAME}};
+    email = {{GIT_USER_EMAIL}};
     };
     # Optional: Safe directory global configuration
     safe = {
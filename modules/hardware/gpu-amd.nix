@@ -1,6 +1,7 @@
 # NIXOS-LEGO-MODULE: gpu-amd
 # PURPOSE: AMD GPU with AMDGPU driver, Vulkan, OpenGL and ROCm compute
 # CATEGORY: hardware
+# CONFLICTS: gpu-nvidia
 # ---
 hardware.amdgpu.initrd.enable = true;
 
@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: gpu-nouveau
 # PURPOSE: Nouveau open-source NVIDIA driver with NVK Vulkan
 # CATEGORY: hardware
+# PROVIDES: gpu-nvidia
+# CONFLICTS: gpu-nvidia
 # ---
 boot = {
   kernelParams = [
@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: gpu-nvidia-pascal
 # PURPOSE: NVIDIA proprietary driver for PASCAL architecture with modesetting
 # CATEGORY: hardware
+# PROVIDES: gpu-nvidia
+# CONFLICTS: gpu-nvidia
 # ---
 boot = {
   kernelParams = [
@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: gpu-nvidia-pro
 # PURPOSE: NVIDIA proprietary driver with modesetting, Vulkan and PRIME offload
 # CATEGORY: hardware
+# PROVIDES: gpu-nvidia
+# CONFLICTS: gpu-nvidia
 # ---
 boot = {
   kernelParams = [
@@ -0,0 +1,15 @@
+# NIXOS-LEGO-MODULE: fish-config
+# PURPOSE: Per-user fish shell configuration and aliases
+# CATEGORY: home
+# ---
+# Requer o fish no sistema (apps/fish-shell ou shell = "fish" no usuário)
+programs.fish = {
+  enable = true;
+  interactiveShellInit = ''
+    set -g fish_greeting
+  '';
+  shellAliases = {
+    ll = "ls -lah";
+    gs = "git status";
+  };
+};
@@ -0,0 +1,12 @@
+# NIXOS-LEGO-MODULE: ghostty-config
+# PURPOSE: Per-user Ghostty terminal settings
+# CATEGORY: home
+# ---
+programs.ghostty = {
+  enable = true;
+  settings = {
+    font-family = "FiraCode Nerd Font";
+    font-size = 12;
+    window-decoration = true;
+  };
+};
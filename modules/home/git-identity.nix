@@ -0,0 +1,18 @@
+# NIXOS-LEGO-MODULE: git-identity
+# PURPOSE: Per-user Git identity and defaults
+# CATEGORY: home
+# PARAM: GIT_USER_NAME | string | l41twz | Git user.name
+# PARAM: GIT_USER_EMAIL | string | 253585242+l41twz@users.noreply.github.com | Git user.email
+# ---
+# Valores diferentes por usuário: [users.params."home/git-identity"] no preset
+programs.git = {
+  enable = true;
+  settings = {
+    user = {
+      name = {{GIT_USER_NAME}};
+      email = {{GIT_USER_EMAIL}};
+    };
+    init.defaultBranch = "main";
+    pull.rebase = true;
+  };
+};
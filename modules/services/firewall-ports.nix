@@ -1,5 +1,6 @@
 # NIXOS-LEGO-MODULE: firewall-ports
-# PURPOSE: Open TCP ports for SSH and VNC
+# PURPOSE: Open TCP ports in the firewall (SSH and VNC by default)
 # CATEGORY: services
+# PARAM: TCP_PORTS | port[] | 22, 5901 | TCP ports allowed through the firewall
 # ---
-networking.firewall.allowedTCPPorts = [ 22 5901 ];
+networking.firewall.allowedTCPPorts = {{TCP_PORTS}};
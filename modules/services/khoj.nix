@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: khoj
 # PURPOSE: Khoj AI assistant deployed via Docker container
 # CATEGORY: services
+# REQUIRES: services/docker-engine
+# SECRETS: khoj-env
 # ---
 
 # ╔══════════════════════════════════════════════════════════════════════════════╗
@@ -11,6 +13,12 @@
 # https://github.com/khoj-ai/khoj/blob/master/docker-compose.yml
 #
 # Requer: docker-engine module
+#
+# Credenciais ficam no segredo "khoj-env" (aba Segredos), um arquivo de
+# ambiente lido pelos containers database e server:
+#   POSTGRES_PASSWORD=...
+#   KHOJ_DJANGO_SECRET_KEY=...
+#   KHOJ_ADMIN_PASSWORD=...
 
 # ── Rede Docker compartilhada ──
 # No docker-compose, todos os serviços compartilham uma rede bridge automaticamente.
@@ -47,9 +55,9 @@ virtualisation.oci-containers.containers = {
     image = "docker.io/pgvector/pgvector:pg15";
     environment = {
       POSTGRES_USER = "postgres";
-      POSTGRES_PASSWORD = "postgres";
       POSTGRES_DB = "khoj";
     };
+    environmentFiles = [ config.age.secrets.khoj-env.path ];
     volumes = [ "khoj_db:/var/lib/postgresql/data/" ];
     extraOptions = [
       "--network=khoj-net"
@@ -114,13 +122,10 @@ virtualisation.oci-containers.containers = {
     environment = {
       POSTGRES_DB = "khoj";
       POSTGRES_USER = "postgres";
-      POSTGRES_PASSWORD = "postgres";
       POSTGRES_HOST = "database";
       POSTGRES_PORT = "5432";
-      KHOJ_DJANGO_SECRET_KEY = "secret";
       KHOJ_DEBUG = "False";
       KHOJ_ADMIN_EMAIL = "253585242+l41twz@users.noreply.github.com";
-      KHOJ_ADMIN_PASSWORD = "postgres";
       KHOJ_TERRARIUM_URL = "http://sandbox:8080";
       KHOJ_SEARXNG_URL = "http://search:8080";
       KHOJ_TELEMETRY_DISABLE = "True";
@@ -169,6 +174,7 @@ virtualisation.oci-containers.containers = {
       # KHOJ_ALLOWED_DOMAIN = "server";
       # KHOJ_ALLOWED_DOMAIN = "127.0.0.1";
     };
+    environmentFiles = [ config.age.secrets.khoj-env.path ];
     cmd = [ "--host=0.0.0.0" "--port=42110" "--anonymous-mode" "-vv" "--non-interactive" ]; #"--anonymous-mode" no mult-user and api key, local only use.
     extraOptions = [
       "--network=khoj-net"
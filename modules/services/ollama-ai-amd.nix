@@ -1,6 +1,7 @@
 # NIXOS-LEGO-MODULE: ollama-ai
 # PURPOSE: Ollama local LLM inference server with ROCm acceleration for AMD GPUs
 # CATEGORY: services
+# REQUIRES: hardware/gpu-amd
 # ---
 
 # ╔══════════════════════════════════════════════════════════════════════════════╗
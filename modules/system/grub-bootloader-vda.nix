@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: grub-bootloader
 # PURPOSE: GRUB bootloader for MBR/BIOS with OS prober
 # CATEGORY: system
+# PROVIDES: bootloader
+# CONFLICTS: bootloader
 # ---
 boot.loader.grub.enable = true;
 boot.loader.grub.device = "/dev/vda";
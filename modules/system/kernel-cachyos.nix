@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: kernel-cachyos
 # PURPOSE: Use CachyOS kernel
 # CATEGORY: system
+# PROVIDES: kernel
+# CONFLICTS: kernel
 # ---
 #
 # ╔══════════════════════════════════════════════════════════════════════════════╗
@@ -1,5 +1,7 @@
 # NIXOS-LEGO-MODULE: kernel-latest
 # PURPOSE: Use the latest available Linux kernel
 # CATEGORY: system
+# PROVIDES: kernel
+# CONFLICTS: kernel
 # ---
 boot.kernelPackages = pkgs.linuxPackages_latest;
@@ -1,5 +1,7 @@
 # NIXOS-LEGO-MODULE: kernel-xanmod
 # PURPOSE: Use Xanmod kernel (unstable branch using pkgs-master)
 # CATEGORY: system
+# PROVIDES: kernel
+# CONFLICTS: kernel
 # ---
 boot.kernelPackages = pkgs-master.linuxPackages_xanmod_latest;
@@ -1,6 +1,8 @@
 # NIXOS-LEGO-MODULE: systemd-boot
 # PURPOSE: Habilita o Systemd-boot (UEFI) como bootloader padrao
 # CATEGORY: system
+# PROVIDES: bootloader
+# CONFLICTS: bootloader
 # ---
 boot.loader.systemd-boot.enable = true;
 boot.loader.efi.canTouchEfiVariables = true;